@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/sharelinuxs/my-first-opeartor/agent/modelsync"
+)
+
+// modelbox-agent 在 ModelBox 的 Pod 中运行: 作为 InitContainer 时准备模型后退出,
+// 作为 sidecar 时监视模型配置, 热更新模型并通过 HTTP 报告同步状态; 在预热 DaemonSet 中下载模型到节点本地缓存
+func main() {
+	var opts modelsync.Options
+	var once, prefetch bool
+	var statusAddress string
+	var model modelsync.Model
+	var dir string
+	flag.StringVar(&model.URL, "url", "", "Fetch a single model from the url into --dir and exit, used by the per-model init containers.")
+	flag.StringVar(&model.Digest, "digest", "", "The sha256 digest of the single model.")
+	flag.StringVar(&model.Endpoint, "endpoint", "", "The object storage, registry or Hugging Face endpoint of the single model.")
+	flag.StringVar(&model.CredentialsDir, "credentials-dir", "", "The directory of the mounted credentials of the single model.")
+	flag.StringVar(&dir, "dir", "", "The directory to fetch the single model into.")
+	flag.StringVar(&opts.ConfigFile, "config", "/etc/modelbox/"+modelsync.ConfigFileName, "The model config file mounted from the ModelBox ConfigMap.")
+	flag.StringVar(&opts.Root, "root", "/app/model", "The model directory shared with the serving container.")
+	flag.StringVar(&opts.ReloadURL, "reload-url", "", "The endpoint of the serving container to POST after models are switched.")
+	flag.DurationVar(&opts.Interval, "interval", 5*time.Second, "How often to check the model config for changes.")
+	flag.BoolVar(&once, "once", false, "Fetch all models and exit, used by the init container.")
+	flag.StringVar(&opts.CacheDir, "cache-dir", "", "The node-local model cache directory. Models found in the cache are copied from it instead of being downloaded.")
+	flag.BoolVar(&prefetch, "prefetch", false, "Keep downloading the models in the config into --cache-dir, used by the prefetch DaemonSet.")
+	flag.DurationVar(&opts.Retention, "cache-retention", time.Hour, "How long cached model versions no longer in the config are kept before being removed.")
+	flag.StringVar(&statusAddress, "status-address", ":9090", "The address the sync status endpoint binds to.")
+	flag.Parse()
+
+	syncer := modelsync.NewSyncer(opts)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+		<-sigCh
+		cancel()
+	}()
+
+	if model.URL != "" {
+		if err := modelsync.Fetch(ctx, &model, dir, opts.CacheDir); err != nil {
+			logrus.Fatalf("fetch model: %v", err)
+		}
+		return
+	}
+
+	if prefetch {
+		logrus.Infof("prefetching models in %s into %s", opts.ConfigFile, opts.CacheDir)
+		modelsync.NewPrefetcher(opts).Run(ctx)
+		return
+	}
+
+	if once {
+		if err := syncer.SyncOnce(ctx); err != nil {
+			logrus.Fatalf("fetch models: %v", err)
+		}
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(modelsync.StatusPath, syncer)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	})
+	server := &http.Server{Addr: statusAddress, Handler: mux}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logrus.Fatalf("status server: %v", err)
+		}
+	}()
+
+	logrus.Infof("watching model config %s", opts.ConfigFile)
+	syncer.Run(ctx)
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer shutdownCancel()
+	_ = server.Shutdown(shutdownCtx)
+}
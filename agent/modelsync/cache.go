@@ -0,0 +1,171 @@
+package modelsync
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// CacheMountPath 节点本地模型缓存在容器中的挂载路径
+	CacheMountPath = "/var/cache/modelbox"
+	// cacheCompleteMarker 缓存下载完成的标记, 没有该标记的缓存不会被使用
+	cacheCompleteMarker = ".complete"
+	// cacheUnusedMarker 版本不再被配置引用时记录的时间, 超过保留时长后删除
+	cacheUnusedMarker = ".unused"
+)
+
+// cachedDir 模型在缓存中的目录, 按模型版本区分, 地址变化后不会使用旧的缓存
+func cachedDir(cacheDir string, model *Model) string {
+	return filepath.Join(cacheDir, model.version())
+}
+
+// fetchFromCache 节点缓存中有完整的模型时从缓存复制, 返回是否命中
+func fetchFromCache(ctx context.Context, cacheDir string, model *Model, dir string) (bool, error) {
+	if cacheDir == "" {
+		return false, nil
+	}
+	from := cachedDir(cacheDir, model)
+	if !exists(filepath.Join(from, cacheCompleteMarker)) {
+		return false, nil
+	}
+	logrus.Infof("fetching model %s from node cache %s", model.Name, from)
+	err := filepath.Walk(from, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !info.Mode().IsRegular() || p == filepath.Join(from, cacheCompleteMarker) || p == filepath.Join(from, cacheUnusedMarker) {
+			return nil
+		}
+		rel, err := filepath.Rel(from, p)
+		if err != nil {
+			return err
+		}
+		return copyFile(p, filepath.Join(dir, rel))
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Prefetcher 由 DaemonSet 在节点上运行, 按模型配置预先下载模型到节点本地缓存, 缩短新节点上 Pod 的启动时间
+type Prefetcher struct {
+	opts   Options
+	client *http.Client
+}
+
+// NewPrefetcher 创建 Prefetcher, opts.CacheDir 为缓存目录
+func NewPrefetcher(opts Options) *Prefetcher {
+	return &Prefetcher{opts: opts, client: &http.Client{}}
+}
+
+// Run 定期检查模型配置, 下载缺少的模型并清理不再使用的版本, 直到 ctx 结束
+func (p *Prefetcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.opts.Interval)
+	defer ticker.Stop()
+	for {
+		p.prefetch(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Prefetcher) prefetch(ctx context.Context) {
+	data, err := ioutil.ReadFile(p.opts.ConfigFile)
+	if err != nil {
+		logrus.Errorf("read model config: %v", err)
+		return
+	}
+	config := &Config{}
+	if err := json.Unmarshal(data, config); err != nil {
+		logrus.Errorf("invalid model config %s: %v", p.opts.ConfigFile, err)
+		return
+	}
+
+	desired := map[string]bool{}
+	for i := range config.Models {
+		model := &config.Models[i]
+		dir := cachedDir(p.opts.CacheDir, model)
+		desired[filepath.Base(dir)] = true
+		// pvc 中的模型已经在集群内, 不需要缓存
+		if u, err := url.Parse(model.URL); err == nil && u.Scheme == "pvc" {
+			continue
+		}
+		if exists(filepath.Join(dir, cacheCompleteMarker)) {
+			os.Remove(filepath.Join(dir, cacheUnusedMarker))
+			continue
+		}
+		logrus.Infof("prefetching model %s from %s", model.Name, model.URL)
+		if err := p.fetch(ctx, model, dir); err != nil {
+			logrus.Errorf("prefetch model %s: %v", model.Name, err)
+			continue
+		}
+		logrus.Infof("model %s cached in %s", model.Name, dir)
+	}
+	p.prune(desired)
+}
+
+// fetch 先下载到临时目录, 完成后写入标记再改名, 读取缓存的容器不会看到不完整的模型
+func (p *Prefetcher) fetch(ctx context.Context, model *Model, dir string) error {
+	tmpDir := dir + ".tmp"
+	if err := os.RemoveAll(tmpDir); err != nil {
+		return err
+	}
+	if err := fetch(ctx, p.client, model, tmpDir, ""); err != nil {
+		os.RemoveAll(tmpDir)
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, cacheCompleteMarker), nil, 0644); err != nil {
+		os.RemoveAll(tmpDir)
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	return os.Rename(tmpDir, dir)
+}
+
+// prune 不再被配置引用的版本先标记, 超过保留时长后删除, 滚动更新中的旧 Pod 仍可能需要这些版本
+func (p *Prefetcher) prune(desired map[string]bool) {
+	entries, err := ioutil.ReadDir(p.opts.CacheDir)
+	if err != nil {
+		logrus.Warnf("read cache dir: %v", err)
+		return
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() || desired[name] || strings.HasSuffix(name, ".tmp") {
+			continue
+		}
+		dir := filepath.Join(p.opts.CacheDir, name)
+		marker := filepath.Join(dir, cacheUnusedMarker)
+		info, err := os.Stat(marker)
+		if os.IsNotExist(err) {
+			if err := ioutil.WriteFile(marker, nil, 0644); err != nil {
+				logrus.Warnf("mark unused cache %s: %v", dir, err)
+			}
+			continue
+		}
+		if err == nil && time.Since(info.ModTime()) > p.opts.Retention {
+			logrus.Infof("removing unused cache %s", dir)
+			if err := os.RemoveAll(dir); err != nil {
+				logrus.Warnf("remove unused cache %s: %v", dir, err)
+			}
+		}
+	}
+}
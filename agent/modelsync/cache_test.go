@@ -0,0 +1,207 @@
+package modelsync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeCache 在缓存目录中写入模型的一个版本, complete 为 false 时模拟下载到一半的缓存
+func writeCache(t *testing.T, cacheDir string, model *Model, files map[string]string, complete bool) string {
+	t.Helper()
+	dir := cachedDir(cacheDir, model)
+	if complete {
+		files[cacheCompleteMarker] = ""
+	}
+	for name, content := range files {
+		if _, err := writeFile(strings.NewReader(content), filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestFetchFromCache(t *testing.T) {
+	model := &Model{Name: "resnet", URL: "https://models.example.com/resnet.onnx"}
+	tests := []struct {
+		name       string
+		cacheDir   bool
+		files      map[string]string
+		complete   bool
+		model      *Model
+		wantCached bool
+		wantFiles  map[string]string
+	}{
+		{
+			name:      "cache disabled",
+			files:     map[string]string{"resnet.onnx": "weights"},
+			complete:  true,
+			wantFiles: map[string]string{},
+		},
+		{
+			name:       "complete cache",
+			cacheDir:   true,
+			files:      map[string]string{"resnet.onnx": "weights", "sub/labels.txt": "cat", cacheUnusedMarker: ""},
+			complete:   true,
+			wantCached: true,
+			wantFiles:  map[string]string{"resnet.onnx": "weights", "sub/labels.txt": "cat"},
+		},
+		{
+			name:      "incomplete cache",
+			cacheDir:  true,
+			files:     map[string]string{"resnet.onnx": "partial"},
+			wantFiles: map[string]string{},
+		},
+		{
+			name:      "cache of another version",
+			cacheDir:  true,
+			files:     map[string]string{"resnet.onnx": "weights"},
+			complete:  true,
+			model:     &Model{Name: "resnet", URL: model.URL, Digest: "sha256:aaaa"},
+			wantFiles: map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheDir := t.TempDir()
+			writeCache(t, cacheDir, model, tt.files, tt.complete)
+			if !tt.cacheDir {
+				cacheDir = ""
+			}
+			m := model
+			if tt.model != nil {
+				m = tt.model
+			}
+			dir := t.TempDir()
+
+			cached, err := fetchFromCache(context.Background(), cacheDir, m, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cached != tt.wantCached {
+				t.Errorf("got cached %v, want %v", cached, tt.wantCached)
+			}
+			if got := readFiles(t, dir); !reflect.DeepEqual(got, tt.wantFiles) {
+				t.Errorf("got files %v, want %v", got, tt.wantFiles)
+			}
+		})
+	}
+}
+
+// TestFetchUsesCache 缓存命中时不访问远端, 仍然校验 digest
+func TestFetchUsesCache(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprint(w, "weights")
+	}))
+	defer server.Close()
+	cacheDir := t.TempDir()
+	model := &Model{Name: "resnet", URL: server.URL + "/resnet.onnx", Digest: sha256Digest([]byte("weights"))}
+
+	writeCache(t, cacheDir, model, map[string]string{"resnet.onnx": "weights"}, true)
+	if err := fetch(context.Background(), server.Client(), model, t.TempDir(), cacheDir); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 0 {
+		t.Errorf("got %d requests, want the cache used", requests)
+	}
+
+	// 缓存被篡改时 digest 校验失败
+	writeCache(t, cacheDir, model, map[string]string{"resnet.onnx": "tampered"}, true)
+	if err := fetch(context.Background(), server.Client(), model, t.TempDir(), cacheDir); err == nil {
+		t.Error("got no error for a tampered cache")
+	}
+}
+
+func TestPrefetcher(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/resnet.onnx" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, "weights")
+	}))
+	defer server.Close()
+
+	cacheDir := t.TempDir()
+	configFile := filepath.Join(t.TempDir(), ConfigFileName)
+	writeConfig := func(models ...Model) {
+		data, err := json.Marshal(&Config{Models: models})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(configFile, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	resnet := Model{Name: "resnet", URL: server.URL + "/resnet.onnx"}
+	missing := Model{Name: "bert", URL: server.URL + "/bert.onnx"}
+	onPVC := Model{Name: "gpt2", URL: "pvc://models/gpt2"}
+	p := NewPrefetcher(Options{ConfigFile: configFile, CacheDir: cacheDir, Retention: time.Hour})
+	p.client = server.Client()
+
+	// 下载完成的模型写入标记, 下载失败的模型不留下缓存, pvc 中的模型不缓存
+	writeConfig(resnet, missing, onPVC)
+	p.prefetch(context.Background())
+	resnetDir := cachedDir(cacheDir, &resnet)
+	want := map[string]string{"resnet.onnx": "weights", cacheCompleteMarker: ""}
+	if got := readFiles(t, resnetDir); !reflect.DeepEqual(got, want) {
+		t.Errorf("got cached files %v, want %v", got, want)
+	}
+	for _, model := range []*Model{&missing, &onPVC} {
+		if exists(cachedDir(cacheDir, model)) || exists(cachedDir(cacheDir, model)+".tmp") {
+			t.Errorf("model %s cached", model.Name)
+		}
+	}
+
+	// 已缓存的模型不再下载
+	requests = 0
+	p.prefetch(context.Background())
+	if requests != 1 {
+		t.Errorf("got %d requests, want only the missing model retried", requests)
+	}
+
+	// 不再引用的版本先标记, 重新引用后取消标记
+	writeConfig()
+	p.prefetch(context.Background())
+	marker := filepath.Join(resnetDir, cacheUnusedMarker)
+	if !exists(marker) {
+		t.Fatal("unused cache not marked")
+	}
+	writeConfig(resnet)
+	p.prefetch(context.Background())
+	if exists(marker) {
+		t.Error("marker kept after the model is referenced again")
+	}
+
+	// 超过保留时长后删除, 正在下载的临时目录不会被清理
+	writeConfig()
+	p.prefetch(context.Background())
+	expired := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(marker, expired, expired); err != nil {
+		t.Fatal(err)
+	}
+	tmpDir := filepath.Join(cacheDir, "downloading.tmp")
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	p.prefetch(context.Background())
+	if exists(resnetDir) {
+		t.Error("expired cache not removed")
+	}
+	if !exists(tmpDir) {
+		t.Error("temporary download directory removed")
+	}
+}
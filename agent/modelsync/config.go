@@ -0,0 +1,80 @@
+// Package modelsync 实现模型热更新: 按控制器写入 ConfigMap 的模型配置下载模型,
+// 通过原子替换符号链接切换到新版本, 并通知推理服务重新加载
+package modelsync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+const (
+	// ConfigFileName 模型配置在 ConfigMap 中的 key
+	ConfigFileName = "models.json"
+	// StatusPath agent 返回同步状态的 HTTP 路径
+	StatusPath = "/status"
+	// serviceAccountTokenFile 投射的 ServiceAccount token 在凭证目录中的文件名, 与控制器一致
+	serviceAccountTokenFile = "serviceaccount-token"
+)
+
+// Config 控制器写入 ConfigMap 的模型配置
+type Config struct {
+	Models []Model `json:"models"`
+}
+
+// Model 单个模型, Path 为模型在模型目录下的相对路径, 该路径是指向当前版本的符号链接
+type Model struct {
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+	Digest string `json:"digest,omitempty"`
+	Path   string `json:"path"`
+	// Endpoint 对象存储、镜像仓库或 Hugging Face 镜像站的地址, 为空时使用各 scheme 的默认地址
+	Endpoint string `json:"endpoint,omitempty"`
+	// CredentialsDir 挂载的模型凭证目录, 包含 Secret 中的 key 以及投射的 ServiceAccount token
+	CredentialsDir string `json:"credentialsDir,omitempty"`
+}
+
+// Marshal 序列化模型配置, 控制器与 agent 以序列化后的内容计算版本
+func (c *Config) Marshal() ([]byte, error) {
+	return json.MarshalIndent(c, "", "  ")
+}
+
+// Revision 模型配置的版本, 由配置内容计算, 用于判断 Pod 是否已加载最新配置
+func Revision(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// version 模型文件的版本, url、digest 或 endpoint 变化时重新下载
+func (m *Model) version() string {
+	sum := sha256.Sum256([]byte(m.URL + "\n" + m.Digest + "\n" + m.Endpoint))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// State 同步状态
+type State string
+
+const (
+	// StateSyncing 正在下载模型或通知推理服务
+	StateSyncing State = "Syncing"
+	// StateReady 已加载配置中的所有模型
+	StateReady State = "Ready"
+	// StateFailed 下载、校验或通知推理服务失败
+	StateFailed State = "Failed"
+)
+
+// Status agent 的同步状态
+type Status struct {
+	// Revision 已成功加载的模型配置版本
+	Revision string        `json:"revision,omitempty"`
+	State    State         `json:"state"`
+	Message  string        `json:"message,omitempty"`
+	Models   []ModelStatus `json:"models,omitempty"`
+}
+
+// ModelStatus 单个模型的同步状态
+type ModelStatus struct {
+	Name    string `json:"name"`
+	State   State  `json:"state"`
+	Message string `json:"message,omitempty"`
+}
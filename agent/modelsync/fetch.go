@@ -0,0 +1,363 @@
+package modelsync
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// PVCMountPath pvc:// 模型所在的 PVC 在 agent 容器中的挂载路径, 每个 PVC 挂载到以其名称命名的子目录
+const PVCMountPath = "/mnt/pvc"
+
+// source 一次下载的上下文
+type source struct {
+	client *http.Client
+	model  *Model
+	url    *url.URL
+}
+
+// scheme 每种模型地址的校验与下载方式
+type scheme struct {
+	validate func(u *url.URL) error
+	fetch    func(ctx context.Context, src *source, dir string) error
+}
+
+var schemes = map[string]scheme{
+	"http":  {validate: validateHost("host"), fetch: fetchHTTP},
+	"https": {validate: validateHost("host"), fetch: fetchHTTP},
+	"s3":    {validate: validateHost("bucket"), fetch: fetchS3},
+	"gs":    {validate: validateHost("bucket"), fetch: fetchGCS},
+	"oci":   {validate: validateOCI, fetch: fetchOCI},
+	"pvc":   {validate: validateHost("claim"), fetch: fetchPVC},
+	"hf":    {validate: validateHuggingFace, fetch: fetchHuggingFace},
+}
+
+// SupportedSchemes 支持的模型地址 scheme
+func SupportedSchemes() []string {
+	var names []string
+	for name := range schemes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidateURL 检查模型地址的 scheme 是否支持以及格式是否正确
+func ValidateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid url %q: %v", raw, err)
+	}
+	s, ok := schemes[u.Scheme]
+	if !ok {
+		return fmt.Errorf("unsupported url scheme %q in %q, supported schemes: %s",
+			u.Scheme, raw, strings.Join(SupportedSchemes(), ", "))
+	}
+	if err := s.validate(u); err != nil {
+		return fmt.Errorf("invalid url %q: %v", raw, err)
+	}
+	return nil
+}
+
+func validateHost(name string) func(u *url.URL) error {
+	return func(u *url.URL) error {
+		if u.Host == "" {
+			return fmt.Errorf("missing %s", name)
+		}
+		return nil
+	}
+}
+
+// Fetch 下载模型到 dir, 用于不开启热更新时每个模型单独的 InitContainer. cacheDir 不为空时优先从节点缓存复制.
+// 先下载到临时目录, 校验通过后再移动到 dir, 避免推理服务读到不完整的模型
+func Fetch(ctx context.Context, model *Model, dir, cacheDir string) error {
+	tmpDir := filepath.Clean(dir) + ".tmp"
+	if err := os.RemoveAll(tmpDir); err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	if err := fetch(ctx, &http.Client{}, model, tmpDir, cacheDir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	// 逐个移动而不是替换整个目录, dir 下可能有 subPath 嵌套在其中的其他模型
+	entries, err := ioutil.ReadDir(tmpDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		dst := filepath.Join(dir, entry.Name())
+		if err := os.RemoveAll(dst); err != nil {
+			return err
+		}
+		if err := os.Rename(filepath.Join(tmpDir, entry.Name()), dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetch 按 scheme 下载模型到 dir, 节点缓存命中时从缓存复制, 设置了 digest 时校验 sha256
+func fetch(ctx context.Context, client *http.Client, model *Model, dir, cacheDir string) error {
+	if err := ValidateURL(model.URL); err != nil {
+		return err
+	}
+	u, _ := url.Parse(model.URL)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	cached, err := fetchFromCache(ctx, cacheDir, model, dir)
+	if err != nil {
+		// 缓存可能正在被清理, 回退到从远端下载
+		logrus.Warnf("fetch model %s from node cache: %v", model.Name, err)
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	if !cached {
+		if err := schemes[u.Scheme].fetch(ctx, &source{client: client, model: model, url: u}, dir); err != nil {
+			return err
+		}
+	}
+	if model.Digest != "" {
+		return verifyDigest(dir, model.URL, model.Digest)
+	}
+	return nil
+}
+
+// verifyDigest digest 只适用于下载结果为单个文件的模型
+func verifyDigest(dir, rawURL, digest string) error {
+	var files []string
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			files = append(files, p)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if len(files) != 1 {
+		return fmt.Errorf("digest requires %s to be a single file, got %d files", rawURL, len(files))
+	}
+	file, err := os.Open(files[0])
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return err
+	}
+	actual := "sha256:" + hex.EncodeToString(hash.Sum(nil))
+	if !strings.EqualFold(actual, digest) {
+		return fmt.Errorf("digest mismatch for %s: expected %s, got %s", rawURL, digest, actual)
+	}
+	return nil
+}
+
+// fetchHTTP 下载单个文件, 文件名取 URL 路径的最后一段
+func fetchHTTP(ctx context.Context, src *source, dir string) error {
+	name := path.Base(src.url.Path)
+	if name == "/" || name == "." {
+		name = "model"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src.model.URL, nil)
+	if err != nil {
+		return err
+	}
+	if err := setAuthorization(req, src.model.CredentialsDir); err != nil {
+		return err
+	}
+	_, err = src.download(req, filepath.Join(dir, name))
+	return err
+}
+
+// do 发送请求, 非 2xx 响应作为错误返回
+func (s *source) do(req *http.Request) (*http.Response, error) {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return nil, responseError(req, resp)
+	}
+	return resp, nil
+}
+
+// download 下载到 file, 返回文件的 sha256 摘要
+func (s *source) download(req *http.Request, file string) (string, error) {
+	resp, err := s.do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	return writeFile(resp.Body, file)
+}
+
+func responseError(req *http.Request, resp *http.Response) error {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	message := strings.TrimSpace(string(body))
+	if message == "" {
+		return fmt.Errorf("%s %s: %s", req.Method, req.URL.Redacted(), resp.Status)
+	}
+	return fmt.Errorf("%s %s: %s: %s", req.Method, req.URL.Redacted(), resp.Status, message)
+}
+
+// writeFile 写入 file 并计算 sha256, 父目录不存在时创建
+func writeFile(r io.Reader, file string) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return "", err
+	}
+	out, err := os.Create(file)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(out, hash), r)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("write %s: %v", file, err)
+	}
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// safeJoin 将远端列出的相对路径拼接到 dir 下, 拒绝跳出 dir 的路径
+func safeJoin(dir, rel string) (string, error) {
+	cleaned := filepath.Clean("/" + filepath.FromSlash(rel))
+	if cleaned == "/" {
+		return "", fmt.Errorf("invalid path %q", rel)
+	}
+	joined := filepath.Join(dir, cleaned)
+	if !strings.HasPrefix(joined, filepath.Clean(dir)+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid path %q", rel)
+	}
+	return joined, nil
+}
+
+// endpoint 模型配置的服务地址, 未配置时使用默认地址
+func (s *source) endpoint(defaultEndpoint string) (*url.URL, error) {
+	raw := s.model.Endpoint
+	if raw == "" {
+		raw = defaultEndpoint
+	}
+	u, err := url.Parse(strings.TrimSuffix(raw, "/"))
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid endpoint %q", raw)
+	}
+	return u, nil
+}
+
+// setAuthorization 按凭证目录设置认证信息: 有 token 时以 Bearer 认证, 有 username/password 时以 Basic 认证,
+// 否则使用投射的 ServiceAccount token. 每次下载时重新读取, Secret 更新和 token 轮换后无需重启
+func setAuthorization(req *http.Request, dir string) error {
+	if dir == "" {
+		return nil
+	}
+	if token, ok, err := readCredential(dir, "token"); err != nil || ok {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return err
+	}
+	if username, ok, err := readCredential(dir, "username"); err != nil || ok {
+		password, _, passwordErr := readCredential(dir, "password")
+		if err == nil {
+			err = passwordErr
+		}
+		req.SetBasicAuth(username, password)
+		return err
+	}
+	if token, ok, err := readCredential(dir, serviceAccountTokenFile); err != nil || ok {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return err
+	}
+	return nil
+}
+
+// readCredential 读取凭证目录中的文件, 文件不存在时返回 false
+func readCredential(dir, name string) (string, bool, error) {
+	if dir == "" {
+		return "", false, nil
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, name))
+	if os.IsNotExist(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("read credentials: %v", err)
+	}
+	return strings.TrimSpace(string(data)), true, nil
+}
+
+// lookupCredential 先读取凭证目录中的文件, 不存在时使用同名环境变量
+func (s *source) lookupCredential(name string) (string, error) {
+	value, ok, err := readCredential(s.model.CredentialsDir, name)
+	if err != nil || ok {
+		return value, err
+	}
+	return os.Getenv(name), nil
+}
+
+// fetchPVC 从挂载的 PVC 中复制预先准备好的模型, 路径可以是文件或目录
+func fetchPVC(ctx context.Context, src *source, dir string) error {
+	root := filepath.Join(PVCMountPath, src.url.Host)
+	from := root
+	if p := strings.Trim(src.url.Path, "/"); p != "" {
+		var err error
+		if from, err = safeJoin(root, p); err != nil {
+			return err
+		}
+	}
+	info, err := os.Stat(from)
+	if err != nil {
+		return fmt.Errorf("pvc %s: %v", src.url.Host, err)
+	}
+	if !info.IsDir() {
+		return copyFile(from, filepath.Join(dir, info.Name()))
+	}
+	return filepath.Walk(from, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(from, p)
+		if err != nil {
+			return err
+		}
+		return copyFile(p, filepath.Join(dir, rel))
+	})
+}
+
+func copyFile(from, to string) error {
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	_, err = writeFile(in, to)
+	return err
+}
@@ -0,0 +1,168 @@
+package modelsync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	gcsEndpoint = "https://storage.googleapis.com"
+	// gcsServiceAccountKey 凭证目录中 GCP 服务账号密钥的文件名
+	gcsServiceAccountKey = "service-account.json"
+	gcsReadOnlyScope     = "https://www.googleapis.com/auth/devstorage.read_only"
+)
+
+// fetchGCS 通过 JSON API 下载 gs://bucket/object. object 为空或以 / 结尾时下载该前缀下的所有对象, 保留相对路径
+func fetchGCS(ctx context.Context, src *source, dir string) error {
+	endpoint, err := src.endpoint(gcsEndpoint)
+	if err != nil {
+		return err
+	}
+	token, err := gcsToken(ctx, src)
+	if err != nil {
+		return err
+	}
+	bucket := src.url.Host
+	object := strings.TrimPrefix(src.url.Path, "/")
+	get := func(name, file string) error {
+		u := fmt.Sprintf("%s/storage/v1/b/%s/o/%s?alt=media", endpoint, url.PathEscape(bucket), url.PathEscape(name))
+		req, err := newGCSRequest(ctx, u, token)
+		if err != nil {
+			return err
+		}
+		_, err = src.download(req, file)
+		return err
+	}
+	if object != "" && !strings.HasSuffix(object, "/") {
+		return get(object, filepath.Join(dir, path.Base(object)))
+	}
+
+	var fetched int
+	var pageToken string
+	for {
+		query := url.Values{"prefix": {object}, "fields": {"items(name),nextPageToken"}}
+		if pageToken != "" {
+			query.Set("pageToken", pageToken)
+		}
+		req, err := newGCSRequest(ctx, fmt.Sprintf("%s/storage/v1/b/%s/o?%s", endpoint, url.PathEscape(bucket), query.Encode()), token)
+		if err != nil {
+			return err
+		}
+		resp, err := src.do(req)
+		if err != nil {
+			return err
+		}
+		var list struct {
+			Items []struct {
+				Name string `json:"name"`
+			} `json:"items"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&list)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("list %s: %v", src.model.URL, err)
+		}
+		for _, item := range list.Items {
+			if strings.HasSuffix(item.Name, "/") {
+				continue
+			}
+			file, err := safeJoin(dir, strings.TrimPrefix(item.Name, object))
+			if err != nil {
+				return err
+			}
+			if err := get(item.Name, file); err != nil {
+				return err
+			}
+			fetched++
+		}
+		if list.NextPageToken == "" {
+			break
+		}
+		pageToken = list.NextPageToken
+	}
+	if fetched == 0 {
+		return fmt.Errorf("no objects found under %s", src.model.URL)
+	}
+	return nil
+}
+
+func newGCSRequest(ctx context.Context, u, token string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
+
+// gcsToken 凭证目录中有 token (OAuth2 access token) 时直接使用; 有服务账号密钥时换取只读的 access token;
+// 都没有时匿名访问公开的 bucket
+func gcsToken(ctx context.Context, src *source) (string, error) {
+	if token, ok, err := readCredential(src.model.CredentialsDir, "token"); err != nil || ok {
+		return token, err
+	}
+	data, ok, err := readCredential(src.model.CredentialsDir, gcsServiceAccountKey)
+	if err != nil || !ok {
+		return "", err
+	}
+	var key struct {
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}
+	if err := json.Unmarshal([]byte(data), &key); err != nil {
+		return "", fmt.Errorf("invalid %s: %v", gcsServiceAccountKey, err)
+	}
+	if key.TokenURI == "" {
+		key.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(key.PrivateKey))
+	if err != nil {
+		return "", fmt.Errorf("invalid private key in %s: %v", gcsServiceAccountKey, err)
+	}
+	now := time.Now()
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   key.ClientEmail,
+		"scope": gcsReadOnlyScope,
+		"aud":   key.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}).SignedString(privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, key.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := src.do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("decode access token: %v", err)
+	}
+	return token.AccessToken, nil
+}
@@ -0,0 +1,197 @@
+package modelsync
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// gcsServer 模拟 JSON API 与 OAuth2 token 接口, 列出对象时每页返回一个对象
+type gcsServer struct {
+	*httptest.Server
+	objects map[string]string
+	key     *rsa.PrivateKey
+	// token 需要的 access token, 为空时允许匿名访问
+	token string
+}
+
+func newGCSServer(t *testing.T, objects map[string]string, token string) *gcsServer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &gcsServer{objects: objects, key: key, token: token}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+func (s *gcsServer) serve(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/token" {
+		s.exchange(w, r)
+		return
+	}
+	if s.token != "" && r.Header.Get("Authorization") != "Bearer "+s.token {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if r.URL.EscapedPath() == "/storage/v1/b/models/o" {
+		var names []string
+		for name := range s.objects {
+			if strings.HasPrefix(name, r.URL.Query().Get("prefix")) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		start := 0
+		if token := r.URL.Query().Get("pageToken"); token != "" {
+			fmt.Sscanf(token, "page-%d", &start)
+		}
+		list := map[string]interface{}{}
+		if start < len(names) {
+			list["items"] = []map[string]string{{"name": names[start]}}
+		}
+		if start+1 < len(names) {
+			list["nextPageToken"] = fmt.Sprintf("page-%d", start+1)
+		}
+		json.NewEncoder(w).Encode(list)
+		return
+	}
+	// 对象名称中的 / 编码为 %2F
+	name, err := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), "/storage/v1/b/models/o/"))
+	content, ok := s.objects[name]
+	if err != nil || !ok || r.URL.Query().Get("alt") != "media" {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	fmt.Fprint(w, content)
+}
+
+// exchange 校验服务账号签名的 JWT, 返回 access token
+func (s *gcsServer) exchange(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.Form.Get("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+		http.Error(w, "invalid grant", http.StatusBadRequest)
+		return
+	}
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(r.Form.Get("assertion"), claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		return &s.key.PublicKey, nil
+	})
+	if err != nil || claims["iss"] != "loader@project.iam.gserviceaccount.com" ||
+		claims["scope"] != gcsReadOnlyScope || claims["aud"] != s.URL+"/token" {
+		http.Error(w, fmt.Sprintf("invalid assertion: %v %v", err, claims), http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"access_token": s.token, "token_type": "Bearer"})
+}
+
+// serviceAccountKey 服务账号密钥文件的内容
+func (s *gcsServer) serviceAccountKey() string {
+	block := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(s.key)})
+	data, _ := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"client_email": "loader@project.iam.gserviceaccount.com",
+		"private_key":  string(block),
+		"token_uri":    s.URL + "/token",
+	})
+	return string(data)
+}
+
+func TestFetchGCS(t *testing.T) {
+	objects := map[string]string{
+		"resnet/model.onnx":        "weights",
+		"resnet/config/labels.txt": "cat\ndog",
+		"resnet/config/":           "",
+		"bert/model.onnx":          "bert",
+	}
+	tests := []struct {
+		name        string
+		url         string
+		token       string
+		credentials func(s *gcsServer) map[string]string
+		wantFiles   map[string]string
+		wantErr     string
+	}{
+		{
+			name:      "anonymous single object",
+			url:       "gs://models/resnet/model.onnx",
+			wantFiles: map[string]string{"model.onnx": "weights"},
+		},
+		{
+			name:        "access token",
+			url:         "gs://models/resnet/",
+			token:       "access-token",
+			credentials: func(*gcsServer) map[string]string { return map[string]string{"token": "access-token"} },
+			wantFiles:   map[string]string{"model.onnx": "weights", "config/labels.txt": "cat\ndog"},
+		},
+		{
+			name:  "service account key",
+			url:   "gs://models/resnet/",
+			token: "exchanged-token",
+			credentials: func(s *gcsServer) map[string]string {
+				return map[string]string{gcsServiceAccountKey: s.serviceAccountKey()}
+			},
+			wantFiles: map[string]string{"model.onnx": "weights", "config/labels.txt": "cat\ndog"},
+		},
+		{
+			name:        "invalid service account key",
+			url:         "gs://models/resnet/",
+			credentials: func(*gcsServer) map[string]string { return map[string]string{gcsServiceAccountKey: "{"} },
+			wantErr:     "invalid service-account.json",
+		},
+		{
+			name:        "wrong token",
+			url:         "gs://models/resnet/model.onnx",
+			token:       "access-token",
+			credentials: func(*gcsServer) map[string]string { return map[string]string{"token": "expired"} },
+			wantErr:     "401 Unauthorized: unauthorized",
+		},
+		{
+			name:    "empty prefix",
+			url:     "gs://models/gpt2/",
+			wantErr: "no objects found under gs://models/gpt2/",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newGCSServer(t, objects, tt.token)
+			defer server.Close()
+			var credentials map[string]string
+			if tt.credentials != nil {
+				credentials = tt.credentials(server)
+			}
+			model := &Model{Name: "resnet", URL: tt.url, Endpoint: server.URL, CredentialsDir: writeCredentials(t, credentials)}
+			dir := filepath.Join(t.TempDir(), "model")
+
+			err := fetch(context.Background(), server.Client(), model, dir, "")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := readFiles(t, dir); !reflect.DeepEqual(got, tt.wantFiles) {
+				t.Errorf("got files %v, want %v", got, tt.wantFiles)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package modelsync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const huggingFaceEndpoint = "https://huggingface.co"
+
+// parseHuggingFace 将 hf://org/model@revision 拆分为仓库与版本, 默认版本为 main.
+// 仓库名可以不带组织, 例如 hf://gpt2, 因此不能按 url 的 host 解析
+func parseHuggingFace(raw string) (string, string) {
+	repo := strings.Trim(strings.TrimPrefix(raw, "hf://"), "/")
+	revision := "main"
+	if i := strings.LastIndex(repo, "@"); i >= 0 {
+		repo, revision = repo[:i], repo[i+1:]
+	}
+	return repo, revision
+}
+
+func validateHuggingFace(u *url.URL) error {
+	repo, revision := parseHuggingFace(u.String())
+	if repo == "" || revision == "" || strings.Count(repo, "/") > 1 {
+		return fmt.Errorf("expected hf://[org/]model[@revision]")
+	}
+	return nil
+}
+
+// fetchHuggingFace 下载 Hugging Face Hub 上模型仓库指定版本的所有文件, 凭证目录中的 token 作为访问令牌
+func fetchHuggingFace(ctx context.Context, src *source, dir string) error {
+	endpoint, err := src.endpoint(huggingFaceEndpoint)
+	if err != nil {
+		return err
+	}
+	repo, revision := parseHuggingFace(src.model.URL)
+	newRequest := func(u string) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		return req, setAuthorization(req, src.model.CredentialsDir)
+	}
+
+	req, err := newRequest(fmt.Sprintf("%s/api/models/%s/revision/%s", endpoint, repo, url.PathEscape(revision)))
+	if err != nil {
+		return err
+	}
+	resp, err := src.do(req)
+	if err != nil {
+		return err
+	}
+	var info struct {
+		Siblings []struct {
+			RFilename string `json:"rfilename"`
+		} `json:"siblings"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&info)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("decode model info of %s: %v", src.model.URL, err)
+	}
+	if len(info.Siblings) == 0 {
+		return fmt.Errorf("no files found in %s", src.model.URL)
+	}
+
+	for _, sibling := range info.Siblings {
+		file, err := safeJoin(dir, sibling.RFilename)
+		if err != nil {
+			return err
+		}
+		segments := strings.Split(sibling.RFilename, "/")
+		for i := range segments {
+			segments[i] = url.PathEscape(segments[i])
+		}
+		req, err := newRequest(fmt.Sprintf("%s/%s/resolve/%s/%s", endpoint, repo, url.PathEscape(revision), strings.Join(segments, "/")))
+		if err != nil {
+			return err
+		}
+		if _, err := src.download(req, file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
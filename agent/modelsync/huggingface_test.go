@@ -0,0 +1,182 @@
+package modelsync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseHuggingFace(t *testing.T) {
+	tests := []struct {
+		url          string
+		wantRepo     string
+		wantRevision string
+		wantErr      bool
+	}{
+		{url: "hf://bert-base/uncased", wantRepo: "bert-base/uncased", wantRevision: "main"},
+		{url: "hf://gpt2", wantRepo: "gpt2", wantRevision: "main"},
+		{url: "hf://org/model@v1.0", wantRepo: "org/model", wantRevision: "v1.0"},
+		{url: "hf://org/model@", wantErr: true},
+		{url: "hf://org/model/extra", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := ValidateURL(tt.url)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("got no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if repo, revision := parseHuggingFace(tt.url); repo != tt.wantRepo || revision != tt.wantRevision {
+				t.Errorf("got %s and %s, want %s and %s", repo, revision, tt.wantRepo, tt.wantRevision)
+			}
+		})
+	}
+}
+
+// newHuggingFaceServer 模拟 Hub 的模型信息与文件下载接口, 只有 org/model 仓库的 main 与 v1.0 两个版本,
+// token 不为空时要求以该 token 访问
+func newHuggingFaceServer(files map[string]string, token string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" && r.Header.Get("Authorization") != "Bearer "+token {
+			http.Error(w, "Invalid username or password.", http.StatusUnauthorized)
+			return
+		}
+		for _, revision := range []string{"main", "v1.0"} {
+			if r.URL.Path == "/api/models/org/model/revision/"+revision {
+				var siblings []map[string]string
+				for name := range files {
+					siblings = append(siblings, map[string]string{"rfilename": name})
+				}
+				json.NewEncoder(w).Encode(map[string]interface{}{"siblings": siblings})
+				return
+			}
+			prefix := "/org/model/resolve/" + revision + "/"
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				if content, ok := files[strings.TrimPrefix(r.URL.Path, prefix)]; ok {
+					fmt.Fprint(w, content)
+					return
+				}
+			}
+		}
+		http.Error(w, "Repository not found", http.StatusNotFound)
+	}))
+}
+
+func TestFetchHuggingFace(t *testing.T) {
+	files := map[string]string{
+		"config.json":            "{}",
+		"model.safetensors":      "weights",
+		"tokenizer/vocab 1.txt":  "a b c",
+		"tokenizer/merges.txt":   "a b",
+		"onnx/model quant.onnx":  "quantized",
+		"onnx/nested/extra.json": "[]",
+	}
+	tests := []struct {
+		name        string
+		url         string
+		files       map[string]string
+		token       string
+		credentials map[string]string
+		wantFiles   map[string]string
+		wantErr     string
+	}{
+		{
+			name:  "public repository",
+			url:   "hf://org/model",
+			files: files,
+		},
+		{
+			name:        "private repository at a revision",
+			url:         "hf://org/model@v1.0",
+			files:       files,
+			token:       "hf_token",
+			credentials: map[string]string{"token": "hf_token"},
+		},
+		{
+			name:    "missing token",
+			url:     "hf://org/model",
+			files:   files,
+			token:   "hf_token",
+			wantErr: "401 Unauthorized: Invalid username or password.",
+		},
+		{
+			name:    "unknown repository",
+			url:     "hf://org/other",
+			files:   files,
+			wantErr: "404 Not Found: Repository not found",
+		},
+		{
+			name:    "empty repository",
+			url:     "hf://org/model",
+			wantErr: "no files found in hf://org/model",
+		},
+		{
+			name:      "files stay in the model directory",
+			url:       "hf://org/model",
+			files:     map[string]string{"../escape": "x"},
+			wantFiles: map[string]string{"escape": "x"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newHuggingFaceServer(tt.files, tt.token)
+			defer server.Close()
+			model := &Model{Name: "model", URL: tt.url, Endpoint: server.URL, CredentialsDir: writeCredentials(t, tt.credentials)}
+			dir := filepath.Join(t.TempDir(), "model")
+
+			err := fetch(context.Background(), server.Client(), model, dir, "")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := tt.wantFiles
+			if want == nil {
+				want = tt.files
+			}
+			if got := readFiles(t, dir); !reflect.DeepEqual(got, want) {
+				t.Errorf("got files %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// TestFetchHuggingFaceEscapesPaths 文件名中的特殊字符按路径段编码
+func TestFetchHuggingFaceEscapesPaths(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.EscapedPath())
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			fmt.Fprint(w, `{"siblings":[{"rfilename":"dir/a b#1.txt"}]}`)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+	model := &Model{Name: "model", URL: "hf://org/model@refs/pr/1", Endpoint: server.URL}
+	if err := fetch(context.Background(), server.Client(), model, t.TempDir(), ""); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"/api/models/org/model/revision/refs%2Fpr%2F1",
+		"/org/model/resolve/refs%2Fpr%2F1/dir/a%20b%231.txt",
+	}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("got paths %v, want %v", paths, want)
+	}
+}
@@ -0,0 +1,291 @@
+package modelsync
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const (
+	ociManifestMediaType    = "application/vnd.oci.image.manifest.v1+json"
+	dockerManifestMediaType = "application/vnd.docker.distribution.manifest.v2+json"
+	// ociTitleAnnotation ORAS 等工具推送文件时记录的文件名
+	ociTitleAnnotation = "org.opencontainers.image.title"
+	// ociUnpackAnnotation ORAS 推送目录时打包为 tar+gzip, 下载后需要解包
+	ociUnpackAnnotation = "io.deis.oras.content.unpack"
+)
+
+// ociManifest 镜像仓库中模型 artifact 的 manifest, 每个 layer 是一个文件
+type ociManifest struct {
+	MediaType string `json:"mediaType"`
+	Layers    []struct {
+		MediaType   string            `json:"mediaType"`
+		Digest      string            `json:"digest"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"layers"`
+}
+
+// ociClient 访问 OCI Distribution API, 支持匿名以及 username/password 换取的 Bearer token
+type ociClient struct {
+	src   *source
+	base  string
+	token string
+}
+
+// parseOCIReference 将 oci://registry/repo:tag 或 oci://registry/repo@sha256:... 拆分为 repo 与 reference, 默认 tag 为 latest
+func parseOCIReference(u *url.URL) (string, string) {
+	repo := strings.Trim(u.Path, "/")
+	if i := strings.Index(repo, "@"); i >= 0 {
+		return repo[:i], repo[i+1:]
+	}
+	if i := strings.LastIndex(repo, ":"); i > strings.LastIndex(repo, "/") {
+		return repo[:i], repo[i+1:]
+	}
+	return repo, "latest"
+}
+
+func validateOCI(u *url.URL) error {
+	if u.Host == "" {
+		return fmt.Errorf("missing registry")
+	}
+	if repo, ref := parseOCIReference(u); repo == "" || ref == "" {
+		return fmt.Errorf("missing repository or reference")
+	}
+	return nil
+}
+
+// fetchOCI 下载镜像仓库中的模型 artifact, 每个 layer 以 title 注解命名, 下载后校验 layer 的 digest
+func fetchOCI(ctx context.Context, src *source, dir string) error {
+	registry := src.url.Host
+	defaultEndpoint := "https://" + registry
+	if strings.HasPrefix(registry, "localhost") || strings.HasPrefix(registry, "127.0.0.1") {
+		defaultEndpoint = "http://" + registry
+	}
+	endpoint, err := src.endpoint(defaultEndpoint)
+	if err != nil {
+		return err
+	}
+	c := &ociClient{src: src, base: endpoint.String()}
+	repo, ref := parseOCIReference(src.url)
+
+	resp, err := c.get(ctx, "/v2/"+repo+"/manifests/"+ref, ociManifestMediaType+", "+dockerManifestMediaType)
+	if err != nil {
+		return err
+	}
+	var manifest ociManifest
+	err = json.NewDecoder(resp.Body).Decode(&manifest)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("decode manifest of %s: %v", src.model.URL, err)
+	}
+	if len(manifest.Layers) == 0 {
+		return fmt.Errorf("%s has no layers, image indexes are not supported", src.model.URL)
+	}
+
+	for _, layer := range manifest.Layers {
+		name := layer.Annotations[ociTitleAnnotation]
+		if name == "" {
+			name = strings.Replace(layer.Digest, ":", "-", 1)
+		}
+		target, err := safeJoin(dir, name)
+		if err != nil {
+			return err
+		}
+		unpack := layer.Annotations[ociUnpackAnnotation] == "true"
+		file := target
+		if unpack {
+			file = target + ".tar.gz"
+		}
+
+		resp, err := c.get(ctx, "/v2/"+repo+"/blobs/"+layer.Digest, "")
+		if err != nil {
+			return err
+		}
+		digest, err := writeFile(resp.Body, file)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		if digest != layer.Digest {
+			return fmt.Errorf("digest mismatch for layer %s of %s: got %s", layer.Digest, src.model.URL, digest)
+		}
+		if unpack {
+			err := extractTarGz(file, target)
+			os.Remove(file)
+			if err != nil {
+				return fmt.Errorf("unpack %s: %v", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// get 发送请求, 收到 401 时按 WWW-Authenticate 认证后重试一次
+func (c *ociClient) get(ctx context.Context, path, accept string) (*http.Response, error) {
+	newRequest := func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.base+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		return req, nil
+	}
+	req, err := newRequest()
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.src.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		if req, err = newRequest(); err != nil {
+			return nil, err
+		}
+		if err := c.authorize(ctx, req, challenge); err != nil {
+			return nil, err
+		}
+		return c.src.do(req)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return nil, responseError(req, resp)
+	}
+	return resp, nil
+}
+
+// authorize 处理 Basic 与 Bearer 两种认证质询, Bearer token 按 realm 换取后在后续请求中复用
+func (c *ociClient) authorize(ctx context.Context, req *http.Request, challenge string) error {
+	username, _, err := readCredential(c.src.model.CredentialsDir, "username")
+	if err != nil {
+		return err
+	}
+	password, _, err := readCredential(c.src.model.CredentialsDir, "password")
+	if err != nil {
+		return err
+	}
+	scheme, params := ParseChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		req.SetBasicAuth(username, password)
+		return nil
+	case "bearer":
+	default:
+		return fmt.Errorf("unsupported registry auth challenge %q", challenge)
+	}
+
+	query := url.Values{}
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	if params["scope"] != "" {
+		query.Set("scope", params["scope"])
+	}
+	tokenReq, err := http.NewRequestWithContext(ctx, http.MethodGet, params["realm"]+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	if username != "" {
+		tokenReq.SetBasicAuth(username, password)
+	}
+	resp, err := c.src.do(tokenReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return fmt.Errorf("decode registry token: %v", err)
+	}
+	c.token = token.Token
+	if c.token == "" {
+		c.token = token.AccessToken
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	return nil
+}
+
+// ParseChallenge 解析 Bearer realm="...",service="...",scope="...", 控制器解析镜像 digest 时同样使用
+func ParseChallenge(challenge string) (string, map[string]string) {
+	params := map[string]string{}
+	parts := strings.SplitN(strings.TrimSpace(challenge), " ", 2)
+	if len(parts) < 2 {
+		return parts[0], params
+	}
+	rest := parts[1]
+	for rest != "" {
+		eq := strings.Index(rest, "=")
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = rest[eq+1:]
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else if comma := strings.Index(rest, ","); comma >= 0 {
+			value, rest = rest[:comma], rest[comma:]
+		} else {
+			value, rest = rest, ""
+		}
+		params[key] = value
+		rest = strings.TrimLeft(rest, ", ")
+	}
+	return parts[0], params
+}
+
+// extractTarGz 解包到 dir, 拒绝跳出 dir 的路径, 忽略链接等特殊文件
+func extractTarGz(file, dir string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		target, err := safeJoin(dir, header.Name)
+		if err != nil {
+			return err
+		}
+		if _, err := writeFile(tr, target); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package modelsync
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func sha256Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// tarGz 将文件打包为 tar+gzip, 与 ORAS 推送目录时的格式一致
+func tarGz(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// ociLayer manifest 中的一个文件
+type ociLayer struct {
+	title   string
+	unpack  bool
+	content []byte
+	// digest 为空时按内容计算, 用于模拟被篡改的 blob
+	digest string
+}
+
+// ociRegistry 模拟以 Bearer token 认证的镜像仓库, 只有 resnet 仓库的 v1 tag
+type ociRegistry struct {
+	*httptest.Server
+	layers []ociLayer
+	// tokenRequests 换取 token 的次数, token 应当在后续请求中复用
+	tokenRequests int
+}
+
+func newOCIRegistry(layers []ociLayer) *ociRegistry {
+	r := &ociRegistry{layers: layers}
+	r.Server = httptest.NewServer(http.HandlerFunc(r.serve))
+	return r
+}
+
+func (r *ociRegistry) serve(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/token" {
+		r.tokenRequests++
+		username, password, ok := req.BasicAuth()
+		if !ok || username != "robot" || password != "secret" ||
+			req.URL.Query().Get("service") != "registry" || req.URL.Query().Get("scope") != "repository:models/resnet:pull" {
+			http.Error(w, "denied", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"token": "registry-token"})
+		return
+	}
+	if req.Header.Get("Authorization") != "Bearer registry-token" {
+		w.Header().Set("WWW-Authenticate",
+			fmt.Sprintf(`Bearer realm="%s/token",service="registry",scope="repository:models/resnet:pull"`, r.URL))
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case req.URL.Path == "/v2/models/resnet/manifests/v1":
+		if !strings.Contains(req.Header.Get("Accept"), ociManifestMediaType) {
+			http.Error(w, "unsupported manifest type", http.StatusNotAcceptable)
+			return
+		}
+		var layers []map[string]interface{}
+		for _, layer := range r.layers {
+			annotations := map[string]string{ociTitleAnnotation: layer.title}
+			if layer.unpack {
+				annotations[ociUnpackAnnotation] = "true"
+			}
+			digest := layer.digest
+			if digest == "" {
+				digest = sha256Digest(layer.content)
+			}
+			layers = append(layers, map[string]interface{}{
+				"mediaType": "application/octet-stream", "digest": digest, "annotations": annotations,
+			})
+		}
+		manifest := map[string]interface{}{"mediaType": ociManifestMediaType, "layers": layers}
+		json.NewEncoder(w).Encode(manifest)
+	case strings.HasPrefix(req.URL.Path, "/v2/models/resnet/blobs/"):
+		digest := strings.TrimPrefix(req.URL.Path, "/v2/models/resnet/blobs/")
+		for _, layer := range r.layers {
+			if digest == layer.digest || digest == sha256Digest(layer.content) {
+				w.Write(layer.content)
+				return
+			}
+		}
+		http.Error(w, "blob unknown", http.StatusNotFound)
+	default:
+		http.Error(w, "manifest unknown", http.StatusNotFound)
+	}
+}
+
+func TestFetchOCI(t *testing.T) {
+	credentials := map[string]string{"username": "robot", "password": "secret"}
+	tests := []struct {
+		name        string
+		url         string
+		layers      []ociLayer
+		credentials map[string]string
+		wantFiles   map[string]string
+		wantErr     string
+	}{
+		{
+			name:        "files and an unpacked directory",
+			url:         "oci://registry.example.com/models/resnet:v1",
+			credentials: credentials,
+			layers: []ociLayer{
+				{title: "model.onnx", content: []byte("weights")},
+				{title: "config", unpack: true, content: tarGz(t, map[string]string{"labels.txt": "cat\ndog", "sub/vocab.txt": "a"})},
+			},
+			wantFiles: map[string]string{"model.onnx": "weights", "config/labels.txt": "cat\ndog", "config/sub/vocab.txt": "a"},
+		},
+		{
+			name:        "layer without a title is named by its digest",
+			url:         "oci://registry.example.com/models/resnet:v1",
+			credentials: credentials,
+			layers:      []ociLayer{{content: []byte("weights")}},
+			wantFiles:   map[string]string{strings.Replace(sha256Digest([]byte("weights")), ":", "-", 1): "weights"},
+		},
+		{
+			name:        "digest mismatch",
+			url:         "oci://registry.example.com/models/resnet:v1",
+			credentials: credentials,
+			layers:      []ociLayer{{title: "model.onnx", content: []byte("tampered"), digest: sha256Digest([]byte("weights"))}},
+			wantErr:     "digest mismatch for layer " + sha256Digest([]byte("weights")),
+		},
+		{
+			name:    "wrong credentials",
+			url:     "oci://registry.example.com/models/resnet:v1",
+			layers:  []ociLayer{{title: "model.onnx", content: []byte("weights")}},
+			wantErr: "401 Unauthorized: denied",
+		},
+		{
+			name:        "unknown tag",
+			url:         "oci://registry.example.com/models/resnet:v2",
+			credentials: credentials,
+			wantErr:     "404 Not Found: manifest unknown",
+		},
+		{
+			name:        "no layers",
+			url:         "oci://registry.example.com/models/resnet:v1",
+			credentials: credentials,
+			wantErr:     "image indexes are not supported",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := newOCIRegistry(tt.layers)
+			defer registry.Close()
+			model := &Model{Name: "resnet", URL: tt.url, Endpoint: registry.URL, CredentialsDir: writeCredentials(t, tt.credentials)}
+			dir := filepath.Join(t.TempDir(), "model")
+
+			err := fetch(context.Background(), registry.Client(), model, dir, "")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := readFiles(t, dir); !reflect.DeepEqual(got, tt.wantFiles) {
+				t.Errorf("got files %v, want %v", got, tt.wantFiles)
+			}
+			if registry.tokenRequests != 1 {
+				t.Errorf("got %d token requests, want the token reused", registry.tokenRequests)
+			}
+		})
+	}
+}
+
+func TestParseOCIReference(t *testing.T) {
+	tests := []struct {
+		url      string
+		wantRepo string
+		wantRef  string
+	}{
+		{url: "oci://registry.example.com/models/resnet:v1", wantRepo: "models/resnet", wantRef: "v1"},
+		{url: "oci://registry.example.com/models/resnet", wantRepo: "models/resnet", wantRef: "latest"},
+		{url: "oci://registry.example.com/models/resnet@sha256:aaaa", wantRepo: "models/resnet", wantRef: "sha256:aaaa"},
+		{url: "oci://localhost:5000/resnet", wantRepo: "resnet", wantRef: "latest"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if repo, ref := parseOCIReference(u); repo != tt.wantRepo || ref != tt.wantRef {
+				t.Errorf("got %s and %s, want %s and %s", repo, ref, tt.wantRepo, tt.wantRef)
+			}
+		})
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	tests := []struct {
+		challenge  string
+		wantScheme string
+		wantParams map[string]string
+	}{
+		{
+			challenge:  `Bearer realm="https://auth.example.com/token",service="registry",scope="repository:a/b:pull,push"`,
+			wantScheme: "Bearer",
+			wantParams: map[string]string{"realm": "https://auth.example.com/token", "service": "registry", "scope": "repository:a/b:pull,push"},
+		},
+		{
+			challenge:  `Basic realm=registry, charset="UTF-8"`,
+			wantScheme: "Basic",
+			wantParams: map[string]string{"realm": "registry", "charset": "UTF-8"},
+		},
+		{
+			challenge:  "Basic",
+			wantScheme: "Basic",
+			wantParams: map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.challenge, func(t *testing.T) {
+			scheme, params := ParseChallenge(tt.challenge)
+			if scheme != tt.wantScheme || !reflect.DeepEqual(params, tt.wantParams) {
+				t.Errorf("got %s %v, want %s %v", scheme, params, tt.wantScheme, tt.wantParams)
+			}
+		})
+	}
+}
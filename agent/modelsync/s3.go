@@ -0,0 +1,247 @@
+package modelsync
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// emptyPayloadHash GET 请求空 body 的 sha256
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// s3Client 访问 S3 及 MinIO 等兼容 S3 的对象存储, 以 AWS Signature V4 签名请求, 没有凭证时匿名访问
+type s3Client struct {
+	src          *source
+	endpoint     *url.URL
+	pathStyle    bool
+	region       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+}
+
+// fetchS3 下载 s3://bucket/key. key 为空或以 / 结尾时下载该前缀下的所有对象, 保留相对路径
+func fetchS3(ctx context.Context, src *source, dir string) error {
+	c, err := newS3Client(src)
+	if err != nil {
+		return err
+	}
+	bucket := src.url.Host
+	key := strings.TrimPrefix(src.url.Path, "/")
+	if key != "" && !strings.HasSuffix(key, "/") {
+		return c.get(ctx, bucket, key, filepath.Join(dir, path.Base(key)))
+	}
+
+	keys, err := c.list(ctx, bucket, key)
+	if err != nil {
+		return err
+	}
+	var fetched int
+	for _, k := range keys {
+		if strings.HasSuffix(k, "/") {
+			continue
+		}
+		file, err := safeJoin(dir, strings.TrimPrefix(k, key))
+		if err != nil {
+			return err
+		}
+		if err := c.get(ctx, bucket, k, file); err != nil {
+			return err
+		}
+		fetched++
+	}
+	if fetched == 0 {
+		return fmt.Errorf("no objects found under %s", src.model.URL)
+	}
+	return nil
+}
+
+// newS3Client 凭证取自凭证目录中的 AWS_ACCESS_KEY_ID、AWS_SECRET_ACCESS_KEY、AWS_SESSION_TOKEN、AWS_REGION,
+// 不存在时使用同名环境变量. 配置了 endpoint 时使用 path-style 地址
+func newS3Client(src *source) (*s3Client, error) {
+	c := &s3Client{src: src}
+	var err error
+	for name, value := range map[string]*string{
+		"AWS_ACCESS_KEY_ID":     &c.accessKey,
+		"AWS_SECRET_ACCESS_KEY": &c.secretKey,
+		"AWS_SESSION_TOKEN":     &c.sessionToken,
+		"AWS_REGION":            &c.region,
+	} {
+		if *value, err = src.lookupCredential(name); err != nil {
+			return nil, err
+		}
+	}
+	if c.region == "" {
+		c.region = "us-east-1"
+	}
+	if c.accessKey != "" && c.secretKey == "" {
+		return nil, fmt.Errorf("AWS_SECRET_ACCESS_KEY is required with AWS_ACCESS_KEY_ID")
+	}
+	// bucket 名称中有 . 时 virtual-hosted 地址与 S3 的证书不匹配
+	c.pathStyle = src.model.Endpoint != "" || strings.Contains(src.url.Host, ".")
+	c.endpoint, err = src.endpoint("https://s3." + c.region + ".amazonaws.com")
+	return c, err
+}
+
+// objectURL 构造对象地址, path 与 query 按签名要求编码
+func (c *s3Client) objectURL(bucket, key string, query url.Values) *url.URL {
+	u := *c.endpoint
+	if c.pathStyle {
+		u.Path = u.Path + "/" + bucket + "/" + key
+	} else {
+		u.Host = bucket + "." + u.Host
+		u.Path = u.Path + "/" + key
+	}
+	u.RawPath = awsEscape(u.Path, true)
+	u.RawQuery = canonicalQuery(query)
+	return &u
+}
+
+func (c *s3Client) get(ctx context.Context, bucket, key, file string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.objectURL(bucket, key, nil).String(), nil)
+	if err != nil {
+		return err
+	}
+	c.sign(req, time.Now())
+	_, err = c.src.download(req, file)
+	return err
+}
+
+// list 以 ListObjectsV2 分页列出前缀下的所有对象
+func (c *s3Client) list(ctx context.Context, bucket, prefix string) ([]string, error) {
+	var keys []string
+	var token string
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.objectURL(bucket, "", query).String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		c.sign(req, time.Now())
+		resp, err := c.src.do(req)
+		if err != nil {
+			return nil, err
+		}
+		var result struct {
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("list s3://%s/%s: %v", bucket, prefix, err)
+		}
+		for _, object := range result.Contents {
+			keys = append(keys, object.Key)
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// sign 以 AWS Signature V4 签名请求, 没有凭证时不签名
+func (c *s3Client) sign(req *http.Request, now time.Time) {
+	if c.accessKey == "" {
+		return
+	}
+	amzDate := now.UTC().Format("20060102T150405Z")
+	day := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+	if c.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(req.Header.Get(name))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptyPayloadHash,
+	}, "\n")
+	scope := day + "/" + c.region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+c.secretKey), day)
+	key = hmacSHA256(key, c.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery 按 key 排序并以 AWS 的规则编码
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, key := range keys {
+		for _, value := range query[key] {
+			pairs = append(pairs, awsEscape(key, false)+"="+awsEscape(value, false))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// awsEscape 除 A-Z a-z 0-9 - _ . ~ 外全部编码, path 中保留 /
+func awsEscape(s string, isPath bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case 'A' <= ch && ch <= 'Z', 'a' <= ch && ch <= 'z', '0' <= ch && ch <= '9',
+			ch == '-', ch == '_', ch == '.', ch == '~', isPath && ch == '/':
+			b.WriteByte(ch)
+		default:
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,289 @@
+package modelsync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// versionsDir 模型各版本在模型目录下的存放位置, 模型路径是指向其中某个版本的符号链接
+const versionsDir = ".versions"
+
+// Options agent 的配置
+type Options struct {
+	// ConfigFile 挂载的 ConfigMap 中的模型配置文件
+	ConfigFile string
+	// Root 模型目录, 与推理服务容器共享同一个存储卷
+	Root string
+	// ReloadURL 切换模型后以 POST 调用的推理服务接口, 为空时不调用
+	ReloadURL string
+	// Interval 检查模型配置是否变化的间隔. ConfigMap 更新后 kubelet 需要一段时间才会同步到挂载的文件
+	Interval time.Duration
+	// CacheDir 挂载的节点本地模型缓存目录, 缓存中有完整的模型时从缓存复制, 不再从远端下载. 为空时不使用缓存
+	CacheDir string
+	// Retention 预热模式下不再使用的模型版本在缓存中保留的时长
+	Retention time.Duration
+}
+
+// Syncer 按模型配置下载并切换模型
+type Syncer struct {
+	opts   Options
+	client *http.Client
+
+	mu            sync.RWMutex
+	status        Status
+	applied       string
+	reloadPending bool
+}
+
+// NewSyncer 创建 Syncer
+func NewSyncer(opts Options) *Syncer {
+	return &Syncer{
+		opts:   opts,
+		client: &http.Client{},
+		status: Status{State: StateSyncing},
+	}
+}
+
+// SyncOnce 下载配置中的所有模型, 用于 InitContainer 在推理服务启动前准备模型
+func (s *Syncer) SyncOnce(ctx context.Context) error {
+	_, config, err := s.readConfig()
+	if err != nil {
+		return err
+	}
+	_, err = s.syncModels(ctx, config)
+	return err
+}
+
+// Run 定期检查模型配置, 配置变化时下载新模型、切换并通知推理服务, 直到 ctx 结束
+func (s *Syncer) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.opts.Interval)
+	defer ticker.Stop()
+	for {
+		s.sync(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Status 返回当前的同步状态
+func (s *Syncer) Status() Status {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	status := s.status
+	status.Models = append([]ModelStatus(nil), s.status.Models...)
+	return status
+}
+
+// ServeHTTP 以 JSON 返回同步状态, 控制器据此汇总每个 Pod 的热更新结果
+func (s *Syncer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.Status()); err != nil {
+		logrus.Errorf("write status: %v", err)
+	}
+}
+
+func (s *Syncer) sync(ctx context.Context) {
+	data, config, err := s.readConfig()
+	if err != nil {
+		s.setFailed(err)
+		return
+	}
+	revision := Revision(data)
+	s.mu.RLock()
+	upToDate := revision == s.applied && !s.reloadPending
+	s.mu.RUnlock()
+	if upToDate {
+		return
+	}
+
+	logrus.Infof("syncing models of revision %s", revision)
+	s.mu.Lock()
+	s.status.State = StateSyncing
+	s.status.Message = ""
+	s.mu.Unlock()
+
+	changed, err := s.syncModels(ctx, config)
+	if changed {
+		s.mu.Lock()
+		s.reloadPending = true
+		s.mu.Unlock()
+	}
+	if err != nil {
+		s.setFailed(err)
+		return
+	}
+
+	// 启动时模型已由 InitContainer 准备好, 没有变化时无需通知推理服务
+	s.mu.RLock()
+	reloadPending := s.reloadPending
+	s.mu.RUnlock()
+	if reloadPending && s.opts.ReloadURL != "" {
+		if err := s.reload(ctx); err != nil {
+			s.setFailed(fmt.Errorf("reload: %v", err))
+			return
+		}
+		logrus.Infof("serving container reloaded models of revision %s", revision)
+	}
+
+	s.mu.Lock()
+	s.reloadPending = false
+	s.applied = revision
+	s.status.Revision = revision
+	s.status.State = StateReady
+	s.status.Message = ""
+	s.mu.Unlock()
+}
+
+func (s *Syncer) readConfig() ([]byte, *Config, error) {
+	data, err := ioutil.ReadFile(s.opts.ConfigFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	config := &Config{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, nil, fmt.Errorf("invalid model config %s: %v", s.opts.ConfigFile, err)
+	}
+	return data, config, nil
+}
+
+// syncModels 依次同步所有模型, 单个模型失败不影响其他模型
+func (s *Syncer) syncModels(ctx context.Context, config *Config) (bool, error) {
+	var changed bool
+	var failed []string
+	statuses := make([]ModelStatus, 0, len(config.Models))
+	for i := range config.Models {
+		model := &config.Models[i]
+		status := ModelStatus{Name: model.Name, State: StateReady}
+		modelChanged, err := s.syncModel(ctx, model)
+		if err != nil {
+			logrus.Errorf("sync model %s: %v", model.Name, err)
+			status.State = StateFailed
+			status.Message = err.Error()
+			failed = append(failed, model.Name)
+		}
+		changed = changed || modelChanged
+		statuses = append(statuses, status)
+	}
+
+	s.mu.Lock()
+	s.status.Models = statuses
+	s.mu.Unlock()
+	if len(failed) > 0 {
+		return changed, fmt.Errorf("failed to sync models: %s", strings.Join(failed, ", "))
+	}
+	return changed, nil
+}
+
+// syncModel 将新版本下载到旧版本旁边, 完成后原子地把模型路径的符号链接切换到新版本,
+// 推理服务在切换前后看到的都是完整的模型. 返回模型是否发生了切换
+func (s *Syncer) syncModel(ctx context.Context, model *Model) (bool, error) {
+	link := filepath.Join(s.opts.Root, filepath.Clean(model.Path))
+	modelVersions := filepath.Join(s.opts.Root, versionsDir, model.Name)
+	versionDir := filepath.Join(modelVersions, model.version())
+
+	previous, _ := os.Readlink(link)
+	if previous != "" && !filepath.IsAbs(previous) {
+		previous = filepath.Join(filepath.Dir(link), previous)
+	}
+	if previous == versionDir && exists(versionDir) {
+		return false, nil
+	}
+
+	if !exists(versionDir) {
+		logrus.Infof("fetching model %s from %s", model.Name, model.URL)
+		tmpDir := versionDir + ".tmp"
+		if err := os.RemoveAll(tmpDir); err != nil {
+			return false, err
+		}
+		if err := fetch(ctx, s.client, model, tmpDir, s.opts.CacheDir); err != nil {
+			os.RemoveAll(tmpDir)
+			return false, err
+		}
+		if err := os.Rename(tmpDir, versionDir); err != nil {
+			return false, err
+		}
+	}
+
+	// 先创建临时链接再 rename 覆盖, rename 是原子操作
+	if err := os.MkdirAll(filepath.Dir(link), 0755); err != nil {
+		return false, err
+	}
+	target, err := filepath.Rel(filepath.Dir(link), versionDir)
+	if err != nil {
+		return false, err
+	}
+	tmpLink := link + ".tmp"
+	if err := os.Remove(tmpLink); err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	if err := os.Symlink(target, tmpLink); err != nil {
+		return false, err
+	}
+	if err := os.Rename(tmpLink, link); err != nil {
+		os.Remove(tmpLink)
+		return false, fmt.Errorf("switch %s to the new version: %v", link, err)
+	}
+	logrus.Infof("model %s switched to version %s", model.Name, filepath.Base(versionDir))
+
+	// 只保留当前版本和上一个版本, 上一个版本可能仍在被推理服务使用
+	entries, err := ioutil.ReadDir(modelVersions)
+	if err != nil {
+		return true, nil
+	}
+	for _, entry := range entries {
+		dir := filepath.Join(modelVersions, entry.Name())
+		if dir != versionDir && dir != previous {
+			if err := os.RemoveAll(dir); err != nil {
+				logrus.Warnf("remove old version %s: %v", dir, err)
+			}
+		}
+	}
+	return true, nil
+}
+
+// reload 通知推理服务重新加载模型
+func (s *Syncer) reload(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.opts.ReloadURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func (s *Syncer) setFailed(err error) {
+	logrus.Error(err)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.State = StateFailed
+	s.status.Message = err.Error()
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,406 @@
+/*
+Copyright 2021 Anjie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"encoding/json"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	modelv2 "github.com/sharelinuxs/my-first-opeartor/api/v2"
+)
+
+const (
+	// SpecNameAnnotation 保存 v1 的 spec.name, v2 中已去掉该字段(与 metadata.name 重复)
+	SpecNameAnnotation = "model.github.com/v1-spec-name"
+	// HubSpecAnnotation 保存 v1 无法完整表达的 v2 spec, 保证 v2 -> v1 -> v2 不丢字段
+	HubSpecAnnotation = "model.github.com/v2-spec"
+)
+
+// ConvertTo converts this ModelBox to the Hub version (v2).
+func (src *ModelBox) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*modelv2.ModelBox)
+
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+	// 先还原 v1 表达不了的 v2 字段, 再用 v1 中的字段覆盖
+	if raw, ok := dst.Annotations[HubSpecAnnotation]; ok {
+		if err := json.Unmarshal([]byte(raw), &dst.Spec); err != nil {
+			return err
+		}
+		delete(dst.Annotations, HubSpecAnnotation)
+	}
+	delete(dst.Annotations, SpecNameAnnotation)
+	if src.Spec.Name != "" {
+		if dst.Annotations == nil {
+			dst.Annotations = map[string]string{}
+		}
+		dst.Annotations[SpecNameAnnotation] = src.Spec.Name
+	}
+	if len(dst.Annotations) == 0 {
+		dst.Annotations = nil
+	}
+
+	convertSpecToHub(&src.Spec, &dst.Spec)
+	src.Status.DeploymentStatus.DeepCopyInto(&dst.Status.DeploymentStatus)
+	dst.Status.Models = nil
+	for _, model := range src.Status.Models {
+		dst.Status.Models = append(dst.Status.Models, modelv2.ModelStatus{
+			Name:           model.Name,
+			State:          modelv2.ModelLoadState(model.State),
+			LoadedReplicas: model.LoadedReplicas,
+			Message:        model.Message,
+		})
+	}
+	dst.Status.ModelRevision = src.Status.ModelRevision
+	dst.Status.Reloads = nil
+	for _, reload := range src.Status.Reloads {
+		dst.Status.Reloads = append(dst.Status.Reloads, modelv2.PodReloadStatus{
+			Pod:      reload.Pod,
+			Revision: reload.Revision,
+			State:    modelv2.ReloadState(reload.State),
+			Message:  reload.Message,
+		})
+	}
+	dst.Status.PolicyViolations = src.Status.PolicyViolations
+	dst.Status.ResolvedImages = nil
+	for _, image := range src.Status.ResolvedImages {
+		dst.Status.ResolvedImages = append(dst.Status.ResolvedImages, modelv2.ResolvedImage{Image: image.Image, Digest: image.Digest})
+	}
+	dst.Status.Batch = nil
+	if batch := src.Status.Batch; batch != nil {
+		dst.Status.Batch = &modelv2.BatchStatus{
+			Phase:          modelv2.BatchPhase(batch.Phase),
+			Message:        batch.Message,
+			Active:         batch.Active,
+			Failed:         batch.Failed,
+			StartTime:      batch.StartTime,
+			CompletionTime: batch.CompletionTime,
+			Output:         batch.Output,
+		}
+	}
+
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v2) to this version.
+func (dst *ModelBox) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*modelv2.ModelBox)
+
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+	dst.Spec.Name = dst.Annotations[SpecNameAnnotation]
+	delete(dst.Annotations, SpecNameAnnotation)
+	delete(dst.Annotations, HubSpecAnnotation)
+
+	convertSpecFromHub(&src.Spec, &dst.Spec)
+
+	// v1 转回 v2 后与原 spec 不一致, 说明有 v1 表达不了的字段, 整体保存到注解中
+	var roundTrip modelv2.ModelBoxSpec
+	convertSpecToHub(&dst.Spec, &roundTrip)
+	if !equality.Semantic.DeepEqual(roundTrip, src.Spec) {
+		data, err := json.Marshal(src.Spec)
+		if err != nil {
+			return err
+		}
+		if dst.Annotations == nil {
+			dst.Annotations = map[string]string{}
+		}
+		dst.Annotations[HubSpecAnnotation] = string(data)
+	}
+	if len(dst.Annotations) == 0 {
+		dst.Annotations = nil
+	}
+
+	src.Status.DeploymentStatus.DeepCopyInto(&dst.Status.DeploymentStatus)
+	dst.Status.Models = nil
+	for _, model := range src.Status.Models {
+		dst.Status.Models = append(dst.Status.Models, ModelStatus{
+			Name:           model.Name,
+			State:          string(model.State),
+			LoadedReplicas: model.LoadedReplicas,
+			Message:        model.Message,
+		})
+	}
+	dst.Status.ModelRevision = src.Status.ModelRevision
+	dst.Status.Reloads = nil
+	for _, reload := range src.Status.Reloads {
+		dst.Status.Reloads = append(dst.Status.Reloads, PodReloadStatus{
+			Pod:      reload.Pod,
+			Revision: reload.Revision,
+			State:    string(reload.State),
+			Message:  reload.Message,
+		})
+	}
+	dst.Status.PolicyViolations = src.Status.PolicyViolations
+	dst.Status.ResolvedImages = nil
+	for _, image := range src.Status.ResolvedImages {
+		dst.Status.ResolvedImages = append(dst.Status.ResolvedImages, ResolvedImage{Image: image.Image, Digest: image.Digest})
+	}
+	dst.Status.Batch = nil
+	if batch := src.Status.Batch; batch != nil {
+		dst.Status.Batch = &BatchStatus{
+			Phase:          string(batch.Phase),
+			Message:        batch.Message,
+			Active:         batch.Active,
+			Failed:         batch.Failed,
+			StartTime:      batch.StartTime,
+			CompletionTime: batch.CompletionTime,
+			Output:         batch.Output,
+		}
+	}
+
+	return nil
+}
+
+// convertSpecToHub 将 v1 spec 中的字段写入 v2 spec, dst 中 v1 没有的字段保持不变
+func convertSpecToHub(src *ModelBoxSpec, dst *modelv2.ModelBoxSpec) {
+	dst.Model.URL = src.ModelFileURL
+	dst.Models = nil
+	for _, model := range src.Models {
+		source := modelv2.ModelSource{
+			Name:                 model.Name,
+			URL:                  model.URL,
+			Digest:               model.Digest,
+			SubPath:              model.SubPath,
+			Endpoint:             model.Endpoint,
+			CredentialsSecretRef: model.CredentialsSecretRef,
+		}
+		if model.ServiceAccountToken != nil {
+			source.ServiceAccountToken = &modelv2.ServiceAccountTokenProjection{
+				Audience:          model.ServiceAccountToken.Audience,
+				ExpirationSeconds: model.ServiceAccountToken.ExpirationSeconds,
+			}
+		}
+		dst.Models = append(dst.Models, source)
+	}
+
+	dst.Serving.Image = src.Image
+	dst.Serving.Env = src.Envs
+	dst.Serving.ResourceProfile = modelv2.ResourceProfile(src.ResourceType)
+	dst.Serving.Resources = nil
+	if len(src.Resources.Limits) > 0 || len(src.Resources.Requests) > 0 {
+		dst.Serving.Resources = src.Resources.DeepCopy()
+	}
+	dst.Serving.ReadinessProbe = src.ReadinessProbe
+	dst.Serving.LivenessProbe = src.LivenessProbe
+	dst.Serving.Command = src.Command
+	dst.Serving.Args = src.Args
+	dst.Serving.WorkingDir = src.WorkingDir
+	dst.Serving.EnvFrom = src.EnvFrom
+	dst.Serving.Ports = src.ContainerPorts
+	dst.Serving.Lifecycle = src.Lifecycle
+	dst.Serving.TerminationGracePeriodSeconds = src.TerminationGracePeriodSeconds
+
+	dst.Scaling.Replicas = src.Replicas
+	dst.Scaling.IdleTimeout = src.IdleTimeout
+	// v1 的 rollingUpdate 同时作为 maxUnavailable 和 maxSurge, 未变化时保留 v2 中的取值
+	if rollingUpdateString(dst.Scaling.RollingUpdate) != src.RollingUpdate {
+		dst.Scaling.RollingUpdate = nil
+		if src.RollingUpdate != "" {
+			maxUnavailable := intstr.Parse(src.RollingUpdate)
+			maxSurge := intstr.Parse(src.RollingUpdate)
+			dst.Scaling.RollingUpdate = &modelv2.RollingUpdateSpec{
+				MaxUnavailable: &maxUnavailable,
+				MaxSurge:       &maxSurge,
+			}
+		}
+	}
+
+	dst.Exposure.ServiceType = src.ServiceType
+	dst.Exposure.Ports = src.Ports
+	dst.HotReload = nil
+	if src.HotReload != nil {
+		dst.HotReload = &modelv2.HotReloadSpec{ReloadURL: src.HotReload.ReloadURL, Image: src.HotReload.Image}
+	}
+	dst.TemplateRef = nil
+	if src.TemplateRef != nil {
+		dst.TemplateRef = &modelv2.TemplateReference{Kind: src.TemplateRef.Kind, Name: src.TemplateRef.Name}
+	}
+	dst.Prefetch = nil
+	if src.Prefetch != nil {
+		dst.Prefetch = &modelv2.PrefetchPolicy{
+			NodeSelector: src.Prefetch.NodeSelector,
+			Tolerations:  src.Prefetch.Tolerations,
+			CachePath:    src.Prefetch.CachePath,
+		}
+	}
+	dst.NetworkAccess = nil
+	if src.NetworkAccess != nil {
+		dst.NetworkAccess = &modelv2.NetworkAccessSpec{
+			AllowedNamespaces:  src.NetworkAccess.AllowedNamespaces,
+			AllowedPods:        src.NetworkAccess.AllowedPods,
+			AllowGateway:       src.NetworkAccess.AllowGateway,
+			AllowModelDownload: src.NetworkAccess.AllowModelDownload,
+			ModelDownloadCIDRs: src.NetworkAccess.ModelDownloadCIDRs,
+		}
+	}
+	dst.ServiceAccountName = src.ServiceAccountName
+	dst.ServiceAccount = nil
+	if src.ServiceAccount != nil {
+		dst.ServiceAccount = &modelv2.ServiceAccountSpec{
+			Create:           src.ServiceAccount.Create,
+			Annotations:      src.ServiceAccount.Annotations,
+			ImagePullSecrets: src.ServiceAccount.ImagePullSecrets,
+		}
+	}
+	dst.ImagePullPolicy = src.ImagePullPolicy
+	dst.ImagePullSecrets = nil
+	for _, secret := range src.ImagePullSecrets {
+		dst.ImagePullSecrets = append(dst.ImagePullSecrets, modelv2.ImagePullSecret{Name: secret.Name, Copy: secret.Copy})
+	}
+	dst.Distributed = nil
+	if src.Distributed != nil {
+		dst.Distributed = &modelv2.DistributedSpec{MasterPort: src.Distributed.MasterPort}
+	}
+	dst.WorkloadType = modelv2.WorkloadType(src.WorkloadType)
+	// v1 没有的 input 字段 (digest、ServiceAccount token) 未变化时保留 v2 中的取值
+	var input modelv2.ModelSource
+	if dst.Batch != nil {
+		input = dst.Batch.Input
+	}
+	dst.Batch = nil
+	if src.Batch != nil {
+		input.URL = src.Batch.InputURL
+		input.Endpoint = src.Batch.InputEndpoint
+		input.CredentialsSecretRef = src.Batch.InputCredentialsSecretRef
+		dst.Batch = &modelv2.BatchSpec{
+			Input:                 input,
+			Output:                modelv2.BatchOutput{ClaimName: src.Batch.OutputClaimName, SubPath: src.Batch.OutputSubPath},
+			BackoffLimit:          src.Batch.BackoffLimit,
+			ActiveDeadlineSeconds: src.Batch.ActiveDeadlineSeconds,
+		}
+	}
+}
+
+// convertSpecFromHub 将 v2 spec 转换为 v1 spec, v1 的 spec.name 由调用方处理
+func convertSpecFromHub(src *modelv2.ModelBoxSpec, dst *ModelBoxSpec) {
+	dst.ModelFileURL = src.Model.URL
+	dst.Models = nil
+	for _, model := range src.Models {
+		source := ModelSource{
+			Name:                 model.Name,
+			URL:                  model.URL,
+			Digest:               model.Digest,
+			SubPath:              model.SubPath,
+			Endpoint:             model.Endpoint,
+			CredentialsSecretRef: model.CredentialsSecretRef,
+		}
+		if model.ServiceAccountToken != nil {
+			source.ServiceAccountToken = &ServiceAccountTokenProjection{
+				Audience:          model.ServiceAccountToken.Audience,
+				ExpirationSeconds: model.ServiceAccountToken.ExpirationSeconds,
+			}
+		}
+		dst.Models = append(dst.Models, source)
+	}
+
+	dst.Image = src.Serving.Image
+	dst.Envs = src.Serving.Env
+	dst.ResourceType = string(src.Serving.ResourceProfile)
+	dst.Resources = corev1.ResourceRequirements{}
+	if src.Serving.Resources != nil {
+		src.Serving.Resources.DeepCopyInto(&dst.Resources)
+	}
+	dst.ReadinessProbe = src.Serving.ReadinessProbe
+	dst.LivenessProbe = src.Serving.LivenessProbe
+	dst.Command = src.Serving.Command
+	dst.Args = src.Serving.Args
+	dst.WorkingDir = src.Serving.WorkingDir
+	dst.EnvFrom = src.Serving.EnvFrom
+	dst.ContainerPorts = src.Serving.Ports
+	dst.Lifecycle = src.Serving.Lifecycle
+	dst.TerminationGracePeriodSeconds = src.Serving.TerminationGracePeriodSeconds
+
+	dst.Replicas = src.Scaling.Replicas
+	dst.IdleTimeout = src.Scaling.IdleTimeout
+	dst.RollingUpdate = rollingUpdateString(src.Scaling.RollingUpdate)
+
+	dst.ServiceType = src.Exposure.ServiceType
+	dst.Ports = src.Exposure.Ports
+	dst.HotReload = nil
+	if src.HotReload != nil {
+		dst.HotReload = &HotReloadSpec{ReloadURL: src.HotReload.ReloadURL, Image: src.HotReload.Image}
+	}
+	dst.TemplateRef = nil
+	if src.TemplateRef != nil {
+		dst.TemplateRef = &TemplateReference{Kind: src.TemplateRef.Kind, Name: src.TemplateRef.Name}
+	}
+	dst.Prefetch = nil
+	if src.Prefetch != nil {
+		dst.Prefetch = &PrefetchPolicy{
+			NodeSelector: src.Prefetch.NodeSelector,
+			Tolerations:  src.Prefetch.Tolerations,
+			CachePath:    src.Prefetch.CachePath,
+		}
+	}
+	dst.NetworkAccess = nil
+	if src.NetworkAccess != nil {
+		dst.NetworkAccess = &NetworkAccessSpec{
+			AllowedNamespaces:  src.NetworkAccess.AllowedNamespaces,
+			AllowedPods:        src.NetworkAccess.AllowedPods,
+			AllowGateway:       src.NetworkAccess.AllowGateway,
+			AllowModelDownload: src.NetworkAccess.AllowModelDownload,
+			ModelDownloadCIDRs: src.NetworkAccess.ModelDownloadCIDRs,
+		}
+	}
+	dst.ServiceAccountName = src.ServiceAccountName
+	dst.ServiceAccount = nil
+	if src.ServiceAccount != nil {
+		dst.ServiceAccount = &ServiceAccountSpec{
+			Create:           src.ServiceAccount.Create,
+			Annotations:      src.ServiceAccount.Annotations,
+			ImagePullSecrets: src.ServiceAccount.ImagePullSecrets,
+		}
+	}
+	dst.ImagePullPolicy = src.ImagePullPolicy
+	dst.ImagePullSecrets = nil
+	for _, secret := range src.ImagePullSecrets {
+		dst.ImagePullSecrets = append(dst.ImagePullSecrets, ImagePullSecret{Name: secret.Name, Copy: secret.Copy})
+	}
+	dst.Distributed = nil
+	if src.Distributed != nil {
+		dst.Distributed = &DistributedSpec{MasterPort: src.Distributed.MasterPort}
+	}
+	dst.WorkloadType = string(src.WorkloadType)
+	dst.Batch = nil
+	if src.Batch != nil {
+		dst.Batch = &BatchSpec{
+			InputURL:                  src.Batch.Input.URL,
+			InputEndpoint:             src.Batch.Input.Endpoint,
+			InputCredentialsSecretRef: src.Batch.Input.CredentialsSecretRef,
+			OutputClaimName:           src.Batch.Output.ClaimName,
+			OutputSubPath:             src.Batch.Output.SubPath,
+			BackoffLimit:              src.Batch.BackoffLimit,
+			ActiveDeadlineSeconds:     src.Batch.ActiveDeadlineSeconds,
+		}
+	}
+}
+
+// rollingUpdateString v2 滚动更新配置在 v1 中的表示, 优先取 maxUnavailable
+func rollingUpdateString(ru *modelv2.RollingUpdateSpec) string {
+	switch {
+	case ru == nil:
+		return ""
+	case ru.MaxUnavailable != nil:
+		return ru.MaxUnavailable.String()
+	case ru.MaxSurge != nil:
+		return ru.MaxSurge.String()
+	}
+	return ""
+}
@@ -0,0 +1,271 @@
+package v1
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/diff"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	modelv2 "github.com/sharelinuxs/my-first-opeartor/api/v2"
+)
+
+func int32Ptr(i int32) *int32 { return &i }
+
+func int64Ptr(i int64) *int64 { return &i }
+
+func boolPtr(b bool) *bool { return &b }
+
+func intOrStringPtr(s string) *intstr.IntOrString {
+	v := intstr.Parse(s)
+	return &v
+}
+
+// TestModelBoxV1RoundTrip v1 -> v2 -> v1 不丢字段, 也不产生额外的注解
+func TestModelBoxV1RoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		in   *ModelBox
+	}{
+		{
+			name: "empty",
+			in:   &ModelBox{ObjectMeta: metav1.ObjectMeta{Name: "empty", Namespace: "default"}},
+		},
+		{
+			name: "spec name and basic fields",
+			in: &ModelBox{
+				ObjectMeta: metav1.ObjectMeta{Name: "resnet", Namespace: "default", Labels: map[string]string{"team": "cv"}},
+				Spec: ModelBoxSpec{
+					Name:          "resnet-serving",
+					Image:         "registry.example.com/resnet:1.0",
+					Replicas:      int32Ptr(2),
+					ModelFileURL:  "s3://models/resnet/",
+					ServiceType:   corev1.ServiceTypeNodePort,
+					Ports:         []corev1.ServicePort{{Name: "http", Port: 80, TargetPort: intstr.FromString("http")}},
+					ResourceType:  "custom",
+					Resources:     corev1.ResourceRequirements{Limits: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("2")}},
+					Envs:          []corev1.EnvVar{{Name: "A", Value: "1"}},
+					RollingUpdate: "30%",
+					Command:       []string{"serve"},
+					Args:          []string{"--port=8080"},
+					WorkingDir:    "/app",
+					ContainerPorts: []corev1.ContainerPort{
+						{Name: "http", ContainerPort: 8080, Protocol: corev1.ProtocolTCP},
+					},
+					TerminationGracePeriodSeconds: int64Ptr(60),
+					IdleTimeout:                   &metav1.Duration{Duration: 600000000000},
+				},
+			},
+		},
+		{
+			name: "nested specs",
+			in: &ModelBox{
+				ObjectMeta: metav1.ObjectMeta{Name: "llm", Namespace: "ml"},
+				Spec: ModelBoxSpec{
+					Image: "vllm:1",
+					Models: []ModelSource{
+						{
+							Name:                 "base",
+							URL:                  "hf://org/model@main",
+							Digest:               "sha256:" + "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+							SubPath:              "base",
+							Endpoint:             "https://hf-mirror.example.com",
+							CredentialsSecretRef: &corev1.LocalObjectReference{Name: "hf-token"},
+							ServiceAccountToken:  &ServiceAccountTokenProjection{Audience: "sts.amazonaws.com", ExpirationSeconds: int64Ptr(3600)},
+						},
+					},
+					HotReload:          &HotReloadSpec{ReloadURL: "http://localhost:8080/reload", Image: "agent:1"},
+					Prefetch:           &PrefetchPolicy{NodeSelector: map[string]string{"gpu": "a100"}, CachePath: "/data/cache"},
+					TemplateRef:        &TemplateReference{Kind: "ClusterModelBoxTemplate", Name: "gpu"},
+					NetworkAccess:      &NetworkAccessSpec{AllowedNamespaces: []string{"web"}, AllowGateway: boolPtr(false)},
+					ServiceAccountName: "llm",
+					ServiceAccount:     &ServiceAccountSpec{Create: true, Annotations: map[string]string{"iam": "role"}},
+					ImagePullPolicy:    corev1.PullIfNotPresent,
+					ImagePullSecrets:   []ImagePullSecret{{Name: "registry", Copy: true}},
+					Distributed:        &DistributedSpec{MasterPort: 29501},
+					WorkloadType:       "StatefulSet",
+				},
+			},
+		},
+		{
+			name: "batch",
+			in: &ModelBox{
+				ObjectMeta: metav1.ObjectMeta{Name: "batch", Namespace: "ml"},
+				Spec: ModelBoxSpec{
+					Image:        "resnet-batch:1",
+					WorkloadType: "BatchJob",
+					Batch: &BatchSpec{
+						InputURL:                  "s3://datasets/images/",
+						InputCredentialsSecretRef: &corev1.LocalObjectReference{Name: "s3"},
+						OutputClaimName:           "results",
+						OutputSubPath:             "resnet",
+						BackoffLimit:              int32Ptr(2),
+						ActiveDeadlineSeconds:     int64Ptr(3600),
+					},
+				},
+				Status: ModelBoxStatus{
+					Batch: &BatchStatus{Phase: "Succeeded", Output: "pvc://results/resnet"},
+				},
+			},
+		},
+		{
+			name: "status",
+			in: &ModelBox{
+				ObjectMeta: metav1.ObjectMeta{Name: "status", Namespace: "default"},
+				Spec:       ModelBoxSpec{Image: "img:1"},
+				Status: ModelBoxStatus{
+					DeploymentStatus: appsv1.DeploymentStatus{Replicas: 2, ReadyReplicas: 1, AvailableReplicas: 1},
+					Models:           []ModelStatus{{Name: "model", State: "Loaded", LoadedReplicas: 1}},
+					ModelRevision:    "abc",
+					Reloads:          []PodReloadStatus{{Pod: "status-0", Revision: "abc", State: "Loaded"}},
+					PolicyViolations: []string{"image not allowed"},
+					ResolvedImages:   []ResolvedImage{{Image: "img:1", Digest: "sha256:1"}},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hub := &modelv2.ModelBox{}
+			if err := tt.in.DeepCopy().ConvertTo(hub); err != nil {
+				t.Fatalf("ConvertTo: %v", err)
+			}
+			out := &ModelBox{}
+			if err := out.ConvertFrom(hub); err != nil {
+				t.Fatalf("ConvertFrom: %v", err)
+			}
+			if !equality.Semantic.DeepEqual(tt.in, out) {
+				t.Errorf("round trip mismatch:\n%s", diff.ObjectReflectDiff(tt.in, out))
+			}
+			if _, ok := out.Annotations[HubSpecAnnotation]; ok {
+				t.Errorf("unexpected %s annotation for a spec v1 can express", HubSpecAnnotation)
+			}
+		})
+	}
+}
+
+// TestModelBoxV2RoundTrip v2 -> v1 -> v2 不丢字段, v1 表达不了的字段通过注解保留
+func TestModelBoxV2RoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		in   *modelv2.ModelBox
+		// hubAnnotation v1 对象上是否需要保存完整的 v2 spec
+		hubAnnotation bool
+	}{
+		{
+			name: "representable in v1",
+			in: &modelv2.ModelBox{
+				ObjectMeta: metav1.ObjectMeta{Name: "resnet", Namespace: "default"},
+				Spec: modelv2.ModelBoxSpec{
+					Model:   modelv2.ModelSource{URL: "s3://models/resnet/"},
+					Serving: modelv2.ServingSpec{Image: "resnet:1", ResourceProfile: modelv2.ResourceProfileSmall},
+					Scaling: modelv2.ScalingSpec{
+						Replicas:      int32Ptr(3),
+						RollingUpdate: &modelv2.RollingUpdateSpec{MaxUnavailable: intOrStringPtr("25%"), MaxSurge: intOrStringPtr("25%")},
+					},
+					Exposure: modelv2.ExposureSpec{Ports: []corev1.ServicePort{{Port: 80}}},
+				},
+			},
+		},
+		{
+			name: "different maxUnavailable and maxSurge",
+			in: &modelv2.ModelBox{
+				ObjectMeta: metav1.ObjectMeta{Name: "rolling", Namespace: "default"},
+				Spec: modelv2.ModelBoxSpec{
+					Serving: modelv2.ServingSpec{Image: "img:1"},
+					Scaling: modelv2.ScalingSpec{
+						RollingUpdate: &modelv2.RollingUpdateSpec{MaxUnavailable: intOrStringPtr("0"), MaxSurge: intOrStringPtr("1")},
+					},
+				},
+			},
+			hubAnnotation: true,
+		},
+		{
+			name: "spec.model credentials",
+			in: &modelv2.ModelBox{
+				ObjectMeta: metav1.ObjectMeta{Name: "creds", Namespace: "default"},
+				Spec: modelv2.ModelBoxSpec{
+					Model: modelv2.ModelSource{
+						URL:                  "s3://models/creds/",
+						Endpoint:             "http://minio.minio:9000",
+						CredentialsSecretRef: &corev1.LocalObjectReference{Name: "s3"},
+					},
+					Serving: modelv2.ServingSpec{Image: "img:1"},
+				},
+			},
+			hubAnnotation: true,
+		},
+		{
+			name: "batch input digest and token",
+			in: &modelv2.ModelBox{
+				ObjectMeta: metav1.ObjectMeta{Name: "batch", Namespace: "default"},
+				Spec: modelv2.ModelBoxSpec{
+					Serving:      modelv2.ServingSpec{Image: "img:1"},
+					WorkloadType: modelv2.WorkloadBatchJob,
+					Batch: &modelv2.BatchSpec{
+						Input: modelv2.ModelSource{
+							URL:                 "s3://datasets/images/",
+							Digest:              "sha256:" + "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+							ServiceAccountToken: &modelv2.ServiceAccountTokenProjection{Audience: "sts.amazonaws.com"},
+						},
+						Output: modelv2.BatchOutput{ClaimName: "results"},
+					},
+				},
+			},
+			hubAnnotation: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spoke := &ModelBox{}
+			if err := spoke.ConvertFrom(tt.in.DeepCopy()); err != nil {
+				t.Fatalf("ConvertFrom: %v", err)
+			}
+			if _, ok := spoke.Annotations[HubSpecAnnotation]; ok != tt.hubAnnotation {
+				t.Errorf("%s annotation present = %t, want %t", HubSpecAnnotation, ok, tt.hubAnnotation)
+			}
+			out := &modelv2.ModelBox{}
+			if err := spoke.ConvertTo(out); err != nil {
+				t.Fatalf("ConvertTo: %v", err)
+			}
+			if !equality.Semantic.DeepEqual(tt.in, out) {
+				t.Errorf("round trip mismatch:\n%s", diff.ObjectReflectDiff(tt.in, out))
+			}
+		})
+	}
+}
+
+// TestModelBoxV1UpdateKeepsHubFields 通过 v1 修改对象时, 修改生效且 v1 表达不了的 v2 字段仍然保留
+func TestModelBoxV1UpdateKeepsHubFields(t *testing.T) {
+	in := &modelv2.ModelBox{
+		ObjectMeta: metav1.ObjectMeta{Name: "rolling", Namespace: "default"},
+		Spec: modelv2.ModelBoxSpec{
+			Model:   modelv2.ModelSource{URL: "s3://models/a/", CredentialsSecretRef: &corev1.LocalObjectReference{Name: "s3"}},
+			Serving: modelv2.ServingSpec{Image: "img:1"},
+		},
+	}
+	spoke := &ModelBox{}
+	if err := spoke.ConvertFrom(in); err != nil {
+		t.Fatalf("ConvertFrom: %v", err)
+	}
+	spoke.Spec.Image = "img:2"
+	spoke.Spec.ModelFileURL = "s3://models/b/"
+
+	out := &modelv2.ModelBox{}
+	if err := spoke.ConvertTo(out); err != nil {
+		t.Fatalf("ConvertTo: %v", err)
+	}
+	if out.Spec.Serving.Image != "img:2" || out.Spec.Model.URL != "s3://models/b/" {
+		t.Errorf("v1 changes not applied: image %q, model %q", out.Spec.Serving.Image, out.Spec.Model.URL)
+	}
+	if out.Spec.Model.CredentialsSecretRef == nil || out.Spec.Model.CredentialsSecretRef.Name != "s3" {
+		t.Errorf("spec.model.credentialsSecretRef lost: %+v", out.Spec.Model.CredentialsSecretRef)
+	}
+	if _, ok := out.Annotations[HubSpecAnnotation]; ok {
+		t.Errorf("%s annotation leaked into the hub object", HubSpecAnnotation)
+	}
+}
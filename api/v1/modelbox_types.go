@@ -36,13 +36,133 @@ type ModelBoxSpec struct {
 	Replicas       *int32                      `json:"replicas,omitempty"`       // 副本数
 	ModelFileURL   string                      `json:"modelFileURL,omitempty"`   // 模型文件
 	ServiceType    corev1.ServiceType          `json:"serviceType,omitempty"`    // 服务类型
-	Ports          []corev1.ServicePort        `json:"ports"`                    // 服务端口
+	Ports          []corev1.ServicePort        `json:"ports,omitempty"`          // 服务端口, 可以由模板提供
 	Resources      corev1.ResourceRequirements `json:"resources,omitempty"`      // 资源配额
 	ResourceType   string                      `json:"resourceType,omitempty"`   // 资源规格
 	Envs           []corev1.EnvVar             `json:"envs,omitempty"`           // 环境变量
-	RollingUpdate  string                      `json:"rollingUpdate"`            // 配置滚动更新百分比
+	RollingUpdate  string                      `json:"rollingUpdate,omitempty"`  // 配置滚动更新百分比
 	ReadinessProbe *corev1.Probe               `json:"readinessProbe,omitempty"` // 就绪探针
 	LivenessProbe  *corev1.Probe               `json:"livenessProbe,omitempty"`  // 存活探针
+	Command        []string                    `json:"command,omitempty"`        // 覆盖镜像的 ENTRYPOINT
+	Args           []string                    `json:"args,omitempty"`           // 覆盖镜像的 CMD
+	WorkingDir     string                      `json:"workingDir,omitempty"`     // 工作目录
+	// 从 ConfigMap 或 Secret 导入环境变量
+	EnvFrom   []corev1.EnvFromSource `json:"envFrom,omitempty"`
+	Lifecycle *corev1.Lifecycle      `json:"lifecycle,omitempty"` // 生命周期钩子, 例如 preStop
+	//+kubebuilder:validation:Minimum=0
+	TerminationGracePeriodSeconds *int64 `json:"terminationGracePeriodSeconds,omitempty"` // 优雅退出的最长时间
+	// 推理服务容器的端口, ports 中命名的 targetPort 按名称解析为这里的端口号
+	ContainerPorts []corev1.ContainerPort `json:"containerPorts,omitempty"`
+	// 空闲超过该时长后缩容到 0, 收到推理请求时由 apigateway 激活, 不设置时不缩容
+	IdleTimeout *metav1.Duration `json:"idleTimeout,omitempty"`
+	Models      []ModelSource    `json:"models,omitempty"`    // 多模型, 分别下载到 /app/model 下的子目录
+	HotReload   *HotReloadSpec   `json:"hotReload,omitempty"` // 模型热更新, 修改模型地址不重启 Pod
+	Prefetch    *PrefetchPolicy  `json:"prefetch,omitempty"`  // 在节点上预先下载模型
+	// 引用的 ModelBoxTemplate 或 ClusterModelBoxTemplate, 模板中的字段作为默认值
+	TemplateRef *TemplateReference `json:"templateRef,omitempty"`
+	// 只允许指定的客户端访问推理服务, 由控制器创建同名的 NetworkPolicy
+	NetworkAccess *NetworkAccessSpec `json:"networkAccess,omitempty"`
+	// Pod 使用的 ServiceAccount, 默认为命名空间的 default
+	ServiceAccountName string              `json:"serviceAccountName,omitempty"`
+	ServiceAccount     *ServiceAccountSpec `json:"serviceAccount,omitempty"` // 由控制器创建专用的 ServiceAccount
+	//+kubebuilder:validation:Enum=Always;IfNotPresent;Never
+	ImagePullPolicy  corev1.PullPolicy `json:"imagePullPolicy,omitempty"`  // 所有容器的镜像拉取策略
+	ImagePullSecrets []ImagePullSecret `json:"imagePullSecrets,omitempty"` // 拉取私有镜像使用的 Secret
+	// 以 StatefulSet 运行分布式推理, 各 Pod 通过 <name>-headless Service 互相发现
+	Distributed *DistributedSpec `json:"distributed,omitempty"`
+	//+kubebuilder:validation:Enum=Deployment;StatefulSet;BatchJob
+	WorkloadType string     `json:"workloadType,omitempty"` // 工作负载类型, 默认 Deployment
+	Batch        *BatchSpec `json:"batch,omitempty"`        // workloadType 为 BatchJob 时的批量推理任务
+}
+
+// BatchSpec 批量推理任务, 输入数据集下载到 /app/input, 结果写入 /app/output
+type BatchSpec struct {
+	//+kubebuilder:validation:Pattern=`^(https?|s3|gs|oci|pvc|hf)://.+$`
+	InputURL      string `json:"inputURL"`                // 输入数据集的地址, 格式与模型地址相同
+	InputEndpoint string `json:"inputEndpoint,omitempty"` // 对象存储、镜像仓库或 Hugging Face 镜像站的地址
+	// 访问输入数据集的凭证, 只挂载到下载输入数据集的容器中
+	InputCredentialsSecretRef *corev1.LocalObjectReference `json:"inputCredentialsSecretRef,omitempty"`
+	OutputClaimName           string                       `json:"outputClaimName"` // 写入结果的 PVC
+	//+kubebuilder:validation:Pattern=`^[a-zA-Z0-9_-][a-zA-Z0-9._-]*(/[a-zA-Z0-9_-][a-zA-Z0-9._-]*)*$`
+	OutputSubPath string `json:"outputSubPath,omitempty"` // 结果在 PVC 中的目录, 默认为 ModelBox 的名称
+	//+kubebuilder:validation:Minimum=0
+	BackoffLimit *int32 `json:"backoffLimit,omitempty"` // 失败后重试的次数, 默认 6
+	//+kubebuilder:validation:Minimum=1
+	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"` // 任务运行的最长时间
+}
+
+// DistributedSpec 跨 Pod 的分布式推理
+type DistributedSpec struct {
+	//+kubebuilder:validation:Minimum=1
+	//+kubebuilder:validation:Maximum=65535
+	MasterPort int32 `json:"masterPort,omitempty"` // 协调推理组的端口, 默认 29500
+}
+
+// ImagePullSecret 拉取镜像的 Secret
+type ImagePullSecret struct {
+	Name string `json:"name"`           // Secret 名称
+	Copy bool   `json:"copy,omitempty"` // 由控制器从集中管理的命名空间复制
+}
+
+// ServiceAccountSpec 控制器创建的专用 ServiceAccount
+type ServiceAccountSpec struct {
+	Create           bool                          `json:"create,omitempty"`           // 是否由控制器创建
+	Annotations      map[string]string             `json:"annotations,omitempty"`      // 注解, 用于绑定云厂商的身份
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"` // 拉取镜像凭证
+}
+
+// NetworkAccessSpec 推理服务的网络访问控制
+type NetworkAccessSpec struct {
+	AllowedNamespaces  []string               `json:"allowedNamespaces,omitempty"`  // 允许访问的命名空间
+	AllowedPods        []metav1.LabelSelector `json:"allowedPods,omitempty"`        // 同一命名空间中允许访问的 Pod
+	AllowGateway       *bool                  `json:"allowGateway,omitempty"`       // 是否允许 apigateway 访问, 默认允许
+	AllowModelDownload *bool                  `json:"allowModelDownload,omitempty"` // 是否允许下载模型的出站流量, 默认允许
+	ModelDownloadCIDRs []string               `json:"modelDownloadCIDRs,omitempty"` // 下载模型时允许访问的地址段
+}
+
+// TemplateReference 引用的 ModelBox 模板
+type TemplateReference struct {
+	//+kubebuilder:validation:Enum=ModelBoxTemplate;ClusterModelBoxTemplate
+	Kind string `json:"kind,omitempty"` // 模板类型, 默认 ModelBoxTemplate
+	Name string `json:"name"`           // 模板名称
+}
+
+// HotReloadSpec 模型热更新配置
+type HotReloadSpec struct {
+	ReloadURL string `json:"reloadURL,omitempty"` // 模型切换后以 POST 调用的推理服务接口
+	Image     string `json:"image,omitempty"`     // sidecar 镜像
+}
+
+// PrefetchPolicy 模型预热配置
+type PrefetchPolicy struct {
+	NodeSelector map[string]string   `json:"nodeSelector,omitempty"` // 预热的节点, 为空时为所有节点
+	Tolerations  []corev1.Toleration `json:"tolerations,omitempty"`  // 预热 Pod 的容忍
+	//+kubebuilder:validation:Pattern=`^/.+$`
+	CachePath string `json:"cachePath,omitempty"` // 节点上的缓存目录, 默认 /var/lib/modelbox/cache
+}
+
+// ModelSource 模型文件来源
+type ModelSource struct {
+	//+kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	//+kubebuilder:validation:MaxLength=50
+	Name string `json:"name"` // 模型名称, 在 models 中唯一
+	//+kubebuilder:validation:Pattern=`^(https?|s3|gs|oci|pvc|hf)://.+$`
+	URL string `json:"url"` // 模型地址, 支持 http(s)、s3、gs、oci、pvc 与 hf
+	//+kubebuilder:validation:Pattern=`^sha256:[a-f0-9]{64}$`
+	Digest string `json:"digest,omitempty"` // 模型文件的摘要, sha256:<hex>
+	//+kubebuilder:validation:Pattern=`^[a-zA-Z0-9_-][a-zA-Z0-9._-]*(/[a-zA-Z0-9_-][a-zA-Z0-9._-]*)*$`
+	SubPath  string `json:"subPath,omitempty"`  // /app/model 下的子目录, 默认为模型名称
+	Endpoint string `json:"endpoint,omitempty"` // 对象存储、镜像仓库或 Hugging Face 镜像站的地址
+	// 访问模型地址的凭证, 只挂载到下载模型的容器中
+	CredentialsSecretRef *corev1.LocalObjectReference   `json:"credentialsSecretRef,omitempty"`
+	ServiceAccountToken  *ServiceAccountTokenProjection `json:"serviceAccountToken,omitempty"` // 投射的 ServiceAccount token
+}
+
+// ServiceAccountTokenProjection 投射到下载模型容器中的 ServiceAccount token
+type ServiceAccountTokenProjection struct {
+	Audience string `json:"audience"` // token 的受众
+	//+kubebuilder:validation:Minimum=600
+	ExpirationSeconds *int64 `json:"expirationSeconds,omitempty"` // 有效期, 默认 1 小时
 }
 
 // ModelBoxStatus defines the observed state of ModelBox
@@ -51,6 +171,45 @@ type ModelBoxStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 	appsv1.DeploymentStatus `json:",inline"`
+	Models                  []ModelStatus     `json:"models,omitempty"`           // 各模型的加载状态
+	ModelRevision           string            `json:"modelRevision,omitempty"`    // 热更新模式下最新的模型配置版本
+	Reloads                 []PodReloadStatus `json:"reloads,omitempty"`          // 热更新模式下各 Pod 的加载结果
+	PolicyViolations        []string          `json:"policyViolations,omitempty"` // 违反的命名空间策略
+	ResolvedImages          []ResolvedImage   `json:"resolvedImages,omitempty"`   // 镜像 tag 解析得到的 digest
+	Batch                   *BatchStatus      `json:"batch,omitempty"`            // 批量推理任务的状态
+}
+
+// BatchStatus 批量推理任务的状态
+type BatchStatus struct {
+	Phase          string       `json:"phase,omitempty"`          // Pending、Running、Succeeded 或 Failed
+	Message        string       `json:"message,omitempty"`        // 任务失败的原因
+	Active         int32        `json:"active,omitempty"`         // 正在运行的 Pod 数
+	Failed         int32        `json:"failed,omitempty"`         // 失败的 Pod 数
+	StartTime      *metav1.Time `json:"startTime,omitempty"`      // 任务开始的时间
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"` // 任务完成的时间
+	Output         string       `json:"output,omitempty"`         // 结果所在的位置, pvc://claim/subPath
+}
+
+// ResolvedImage 镜像 tag 解析得到的 digest
+type ResolvedImage struct {
+	Image  string `json:"image"`
+	Digest string `json:"digest"`
+}
+
+// PodReloadStatus 单个 Pod 的热更新结果, State 为 Reloading、Reloaded、Failed 或 Unknown
+type PodReloadStatus struct {
+	Pod      string `json:"pod"`
+	Revision string `json:"revision,omitempty"`
+	State    string `json:"state"`
+	Message  string `json:"message,omitempty"`
+}
+
+// ModelStatus 模型的加载状态, State 为 Pending、Loading、Loaded 或 Failed
+type ModelStatus struct {
+	Name           string `json:"name"`
+	State          string `json:"state"`
+	LoadedReplicas int32  `json:"loadedReplicas"`
+	Message        string `json:"message,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -22,9 +22,108 @@ package v1
 
 import (
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BatchSpec) DeepCopyInto(out *BatchSpec) {
+	*out = *in
+	if in.InputCredentialsSecretRef != nil {
+		in, out := &in.InputCredentialsSecretRef, &out.InputCredentialsSecretRef
+		*out = new(corev1.LocalObjectReference)
+		**out = **in
+	}
+	if in.BackoffLimit != nil {
+		in, out := &in.BackoffLimit, &out.BackoffLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.ActiveDeadlineSeconds != nil {
+		in, out := &in.ActiveDeadlineSeconds, &out.ActiveDeadlineSeconds
+		*out = new(int64)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BatchSpec.
+func (in *BatchSpec) DeepCopy() *BatchSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(BatchSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BatchStatus) DeepCopyInto(out *BatchStatus) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BatchStatus.
+func (in *BatchStatus) DeepCopy() *BatchStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(BatchStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DistributedSpec) DeepCopyInto(out *DistributedSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DistributedSpec.
+func (in *DistributedSpec) DeepCopy() *DistributedSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DistributedSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HotReloadSpec) DeepCopyInto(out *HotReloadSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HotReloadSpec.
+func (in *HotReloadSpec) DeepCopy() *HotReloadSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(HotReloadSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ImagePullSecret) DeepCopyInto(out *ImagePullSecret) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImagePullSecret.
+func (in *ImagePullSecret) DeepCopy() *ImagePullSecret {
+	if in == nil {
+		return nil
+	}
+	out := new(ImagePullSecret)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ModelBox) DeepCopyInto(out *ModelBox) {
 	*out = *in
@@ -117,6 +216,90 @@ func (in *ModelBoxSpec) DeepCopyInto(out *ModelBoxSpec) {
 		*out = new(corev1.Probe)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.Command != nil {
+		in, out := &in.Command, &out.Command
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Args != nil {
+		in, out := &in.Args, &out.Args
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.EnvFrom != nil {
+		in, out := &in.EnvFrom, &out.EnvFrom
+		*out = make([]corev1.EnvFromSource, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Lifecycle != nil {
+		in, out := &in.Lifecycle, &out.Lifecycle
+		*out = new(corev1.Lifecycle)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TerminationGracePeriodSeconds != nil {
+		in, out := &in.TerminationGracePeriodSeconds, &out.TerminationGracePeriodSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	if in.ContainerPorts != nil {
+		in, out := &in.ContainerPorts, &out.ContainerPorts
+		*out = make([]corev1.ContainerPort, len(*in))
+		copy(*out, *in)
+	}
+	if in.IdleTimeout != nil {
+		in, out := &in.IdleTimeout, &out.IdleTimeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.Models != nil {
+		in, out := &in.Models, &out.Models
+		*out = make([]ModelSource, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.HotReload != nil {
+		in, out := &in.HotReload, &out.HotReload
+		*out = new(HotReloadSpec)
+		**out = **in
+	}
+	if in.Prefetch != nil {
+		in, out := &in.Prefetch, &out.Prefetch
+		*out = new(PrefetchPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TemplateRef != nil {
+		in, out := &in.TemplateRef, &out.TemplateRef
+		*out = new(TemplateReference)
+		**out = **in
+	}
+	if in.NetworkAccess != nil {
+		in, out := &in.NetworkAccess, &out.NetworkAccess
+		*out = new(NetworkAccessSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ServiceAccount != nil {
+		in, out := &in.ServiceAccount, &out.ServiceAccount
+		*out = new(ServiceAccountSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ImagePullSecrets != nil {
+		in, out := &in.ImagePullSecrets, &out.ImagePullSecrets
+		*out = make([]ImagePullSecret, len(*in))
+		copy(*out, *in)
+	}
+	if in.Distributed != nil {
+		in, out := &in.Distributed, &out.Distributed
+		*out = new(DistributedSpec)
+		**out = **in
+	}
+	if in.Batch != nil {
+		in, out := &in.Batch, &out.Batch
+		*out = new(BatchSpec)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModelBoxSpec.
@@ -133,6 +316,31 @@ func (in *ModelBoxSpec) DeepCopy() *ModelBoxSpec {
 func (in *ModelBoxStatus) DeepCopyInto(out *ModelBoxStatus) {
 	*out = *in
 	in.DeploymentStatus.DeepCopyInto(&out.DeploymentStatus)
+	if in.Models != nil {
+		in, out := &in.Models, &out.Models
+		*out = make([]ModelStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.Reloads != nil {
+		in, out := &in.Reloads, &out.Reloads
+		*out = make([]PodReloadStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.PolicyViolations != nil {
+		in, out := &in.PolicyViolations, &out.PolicyViolations
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ResolvedImages != nil {
+		in, out := &in.ResolvedImages, &out.ResolvedImages
+		*out = make([]ResolvedImage, len(*in))
+		copy(*out, *in)
+	}
+	if in.Batch != nil {
+		in, out := &in.Batch, &out.Batch
+		*out = new(BatchStatus)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModelBoxStatus.
@@ -144,3 +352,206 @@ func (in *ModelBoxStatus) DeepCopy() *ModelBoxStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ModelSource) DeepCopyInto(out *ModelSource) {
+	*out = *in
+	if in.CredentialsSecretRef != nil {
+		in, out := &in.CredentialsSecretRef, &out.CredentialsSecretRef
+		*out = new(corev1.LocalObjectReference)
+		**out = **in
+	}
+	if in.ServiceAccountToken != nil {
+		in, out := &in.ServiceAccountToken, &out.ServiceAccountToken
+		*out = new(ServiceAccountTokenProjection)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModelSource.
+func (in *ModelSource) DeepCopy() *ModelSource {
+	if in == nil {
+		return nil
+	}
+	out := new(ModelSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ModelStatus) DeepCopyInto(out *ModelStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModelStatus.
+func (in *ModelStatus) DeepCopy() *ModelStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ModelStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkAccessSpec) DeepCopyInto(out *NetworkAccessSpec) {
+	*out = *in
+	if in.AllowedNamespaces != nil {
+		in, out := &in.AllowedNamespaces, &out.AllowedNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllowedPods != nil {
+		in, out := &in.AllowedPods, &out.AllowedPods
+		*out = make([]metav1.LabelSelector, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.AllowGateway != nil {
+		in, out := &in.AllowGateway, &out.AllowGateway
+		*out = new(bool)
+		**out = **in
+	}
+	if in.AllowModelDownload != nil {
+		in, out := &in.AllowModelDownload, &out.AllowModelDownload
+		*out = new(bool)
+		**out = **in
+	}
+	if in.ModelDownloadCIDRs != nil {
+		in, out := &in.ModelDownloadCIDRs, &out.ModelDownloadCIDRs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkAccessSpec.
+func (in *NetworkAccessSpec) DeepCopy() *NetworkAccessSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkAccessSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodReloadStatus) DeepCopyInto(out *PodReloadStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodReloadStatus.
+func (in *PodReloadStatus) DeepCopy() *PodReloadStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PodReloadStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PrefetchPolicy) DeepCopyInto(out *PrefetchPolicy) {
+	*out = *in
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Tolerations != nil {
+		in, out := &in.Tolerations, &out.Tolerations
+		*out = make([]corev1.Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PrefetchPolicy.
+func (in *PrefetchPolicy) DeepCopy() *PrefetchPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(PrefetchPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResolvedImage) DeepCopyInto(out *ResolvedImage) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResolvedImage.
+func (in *ResolvedImage) DeepCopy() *ResolvedImage {
+	if in == nil {
+		return nil
+	}
+	out := new(ResolvedImage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceAccountSpec) DeepCopyInto(out *ServiceAccountSpec) {
+	*out = *in
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.ImagePullSecrets != nil {
+		in, out := &in.ImagePullSecrets, &out.ImagePullSecrets
+		*out = make([]corev1.LocalObjectReference, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceAccountSpec.
+func (in *ServiceAccountSpec) DeepCopy() *ServiceAccountSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceAccountSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceAccountTokenProjection) DeepCopyInto(out *ServiceAccountTokenProjection) {
+	*out = *in
+	if in.ExpirationSeconds != nil {
+		in, out := &in.ExpirationSeconds, &out.ExpirationSeconds
+		*out = new(int64)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceAccountTokenProjection.
+func (in *ServiceAccountTokenProjection) DeepCopy() *ServiceAccountTokenProjection {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceAccountTokenProjection)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TemplateReference) DeepCopyInto(out *TemplateReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TemplateReference.
+func (in *TemplateReference) DeepCopy() *TemplateReference {
+	if in == nil {
+		return nil
+	}
+	out := new(TemplateReference)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,389 @@
+/*
+Copyright 2021 Anjie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2
+
+import (
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// ResourceProfile 预置的资源规格
+// +kubebuilder:validation:Enum=small;medium;large;custom
+type ResourceProfile string
+
+const (
+	ResourceProfileSmall  ResourceProfile = "small"
+	ResourceProfileMedium ResourceProfile = "medium"
+	ResourceProfileLarge  ResourceProfile = "large"
+	// ResourceProfileCustom 使用 Serving.Resources 中自定义的资源配额
+	ResourceProfileCustom ResourceProfile = "custom"
+)
+
+const (
+	// LastActivityAnnotation 最近一次收到推理请求的时间 (RFC3339), 由 apigateway 更新,
+	// 控制器据此判断 ModelBox 是否空闲
+	LastActivityAnnotation = "model.github.com/last-activity"
+	// AppliedSpecAnnotation 控制器最近一次应用到工作负载与 Service 的 spec (合并了模板, JSON 格式),
+	// apigateway 据此获得由模板提供的端口与 idleTimeout
+	AppliedSpecAnnotation = "modelbox.model.github.com/last-oldSpec"
+	// ServingAnnotation ModelBox 中设置的镜像与环境变量 (不含模板提供的值与固定的 digest, JSON 格式),
+	// 记录在 Deployment 的 Pod 模板上, 每个 ReplicaSet 保留一份, rollout undo 据此恢复 spec
+	ServingAnnotation = "modelbox.model.github.com/serving"
+)
+
+// ModelBoxSpec defines the desired state of ModelBox
+type ModelBoxSpec struct {
+	Model    ModelSource   `json:"model,omitempty"`    // 模型来源
+	Models   []ModelSource `json:"models,omitempty"`   // 多模型, 每个模型由单独的 InitContainer 下载到 /app/model 下的子目录
+	Serving  ServingSpec   `json:"serving,omitempty"`  // 推理服务容器, 引用模板时可以省略
+	Scaling  ScalingSpec   `json:"scaling,omitempty"`  // 副本与滚动更新
+	Exposure ExposureSpec  `json:"exposure,omitempty"` // 服务暴露
+	// HotReload 开启后模型由 sidecar 下载并热更新, 修改模型地址不再重启 Pod
+	HotReload *HotReloadSpec `json:"hotReload,omitempty"`
+	// Prefetch 在节点上预先下载模型, 新 Pod 从节点本地缓存复制模型, 缓存不存在时仍从远端下载
+	Prefetch *PrefetchPolicy `json:"prefetch,omitempty"`
+	// TemplateRef 引用的模板, 模板中的字段作为默认值, spec 中设置了的字段优先. 模板变化后会重新同步所有引用它的 ModelBox
+	TemplateRef *TemplateReference `json:"templateRef,omitempty"`
+	// NetworkAccess 设置后由控制器创建同名的 NetworkPolicy, 只允许指定的客户端访问推理服务, 出站只允许 DNS 与下载模型
+	NetworkAccess *NetworkAccessSpec `json:"networkAccess,omitempty"`
+	// ServiceAccountName Pod 使用的 ServiceAccount, 默认为命名空间的 default, 由控制器创建时默认为 ModelBox 的名称
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+	// ServiceAccount 设置 create 后由控制器创建专用的 ServiceAccount, ModelBox 删除时一并删除
+	ServiceAccount *ServiceAccountSpec `json:"serviceAccount,omitempty"`
+	// ImagePullPolicy 推理服务、下载模型的 InitContainer 与 sidecar 的镜像拉取策略, 默认由 Kubernetes 按镜像 tag 决定
+	//+kubebuilder:validation:Enum=Always;IfNotPresent;Never
+	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
+	// ImagePullSecrets Pod 拉取私有镜像使用的 Secret
+	ImagePullSecrets []ImagePullSecret `json:"imagePullSecrets,omitempty"`
+	// Distributed 设置后以 StatefulSet 运行, 所有副本组成一个推理组, 通过 <name>-headless Service 互相发现
+	Distributed *DistributedSpec `json:"distributed,omitempty"`
+	// WorkloadType 运行 ModelBox 的工作负载, 默认为 Deployment, 设置了 distributed 时默认为 StatefulSet
+	WorkloadType WorkloadType `json:"workloadType,omitempty"`
+	// Batch workloadType 为 BatchJob 时的批量推理任务
+	Batch *BatchSpec `json:"batch,omitempty"`
+}
+
+// WorkloadType 运行 ModelBox 的工作负载类型
+// +kubebuilder:validation:Enum=Deployment;StatefulSet;BatchJob
+type WorkloadType string
+
+const (
+	// WorkloadDeployment 以 Deployment 运行在线推理服务
+	WorkloadDeployment WorkloadType = "Deployment"
+	// WorkloadStatefulSet 以 StatefulSet 运行在线推理服务, Pod 的主机名固定, 通过 <name>-headless Service 互相发现
+	WorkloadStatefulSet WorkloadType = "StatefulSet"
+	// WorkloadBatchJob 以 batch/v1 Job 运行批量推理, 处理完输入数据集后结束, 不创建 Service
+	WorkloadBatchJob WorkloadType = "BatchJob"
+)
+
+// BatchSpec 批量推理任务. 输入数据集由 InitContainer 下载到 /app/input, 推理服务容器将结果写入 /app/output,
+// 两个目录同时通过 INPUT_DIR 与 OUTPUT_DIR 环境变量传给推理服务容器, 容器正常退出即视为任务完成
+type BatchSpec struct {
+	// Input 输入数据集, 地址格式与凭证配置与模型相同, name 与 subPath 不生效
+	Input ModelSource `json:"input"`
+	// Output 写入结果的位置
+	Output BatchOutput `json:"output"`
+	// BackoffLimit 失败后重试的次数, 默认 6
+	//+kubebuilder:validation:Minimum=0
+	BackoffLimit *int32 `json:"backoffLimit,omitempty"`
+	// ActiveDeadlineSeconds 任务运行的最长时间, 超时后标记为失败
+	//+kubebuilder:validation:Minimum=1
+	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"`
+}
+
+// BatchOutput 批量推理结果写入的 PVC
+type BatchOutput struct {
+	// ClaimName 写入结果的 PVC, 与 ModelBox 位于同一命名空间
+	ClaimName string `json:"claimName"`
+	// SubPath 结果在 PVC 中的目录, 默认为 ModelBox 的名称
+	//+kubebuilder:validation:Pattern=`^[a-zA-Z0-9_-][a-zA-Z0-9._-]*(/[a-zA-Z0-9_-][a-zA-Z0-9._-]*)*$`
+	SubPath string `json:"subPath,omitempty"`
+}
+
+// DistributedSpec 跨 Pod 的分布式推理, 例如张量并行. 各 Pod 的主机名固定为 <name>-<序号>, 推理服务容器中注入
+// WORLD_SIZE (副本数)、RANK (Pod 序号)、MASTER_ADDR (序号为 0 的 Pod 的域名)、MASTER_PORT 与 POD_NAME
+type DistributedSpec struct {
+	// MasterPort 序号为 0 的 Pod 上协调推理组的端口, 默认 29500
+	//+kubebuilder:validation:Minimum=1
+	//+kubebuilder:validation:Maximum=65535
+	MasterPort int32 `json:"masterPort,omitempty"`
+}
+
+// ImagePullSecret 拉取镜像的 Secret
+type ImagePullSecret struct {
+	// Name ModelBox 命名空间中的 Secret 名称
+	Name string `json:"name"`
+	// Copy 由控制器从 --pull-secret-namespace 参数指定的命名空间复制同名的 Secret, 源 Secret 更新后随之更新.
+	// 只复制 kubernetes.io/dockerconfigjson 与 kubernetes.io/dockercfg 类型的 Secret
+	Copy bool `json:"copy,omitempty"`
+}
+
+// ServiceAccountSpec 控制器创建的专用 ServiceAccount. 同名的 ServiceAccount 已存在且不属于该 ModelBox 时不会接管
+type ServiceAccountSpec struct {
+	// Create 是否由控制器创建 serviceAccountName 指定的 ServiceAccount
+	Create bool `json:"create,omitempty"`
+	// Annotations ServiceAccount 的注解, 用于绑定云厂商的身份, 例如 eks.amazonaws.com/role-arn 或 iam.gke.io/gcp-service-account
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// ImagePullSecrets ServiceAccount 的拉取镜像凭证, 使用该 ServiceAccount 的 Pod 自动引用
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+}
+
+// NetworkAccessSpec 推理服务的网络访问控制, NetworkPolicy 作用于 modelbox=<name> 的 Pod, 需要集群的网络插件支持.
+// 热更新模式下始终允许控制器访问 sidecar 的状态端口
+type NetworkAccessSpec struct {
+	// AllowedNamespaces 允许访问推理服务端口的命名空间, 按 kubernetes.io/metadata.name 标签匹配其中的所有 Pod
+	AllowedNamespaces []string `json:"allowedNamespaces,omitempty"`
+	// AllowedPods 同一命名空间中允许访问推理服务端口的 Pod
+	AllowedPods []metav1.LabelSelector `json:"allowedPods,omitempty"`
+	// AllowGateway 是否允许 apigateway 访问推理服务端口, 默认允许. apigateway 的 Pod 由控制器的 --gateway-namespace 与
+	// --gateway-pod-labels 参数指定
+	AllowGateway *bool `json:"allowGateway,omitempty"`
+	// AllowModelDownload 是否允许下载模型的出站流量, 默认允许. 模型都位于 pvc 中时可以关闭, 只保留 DNS
+	AllowModelDownload *bool `json:"allowModelDownload,omitempty"`
+	// ModelDownloadCIDRs 下载模型时允许访问的地址段, 例如对象存储所在的网段, 为空时允许访问任意地址
+	ModelDownloadCIDRs []string `json:"modelDownloadCIDRs,omitempty"`
+}
+
+// TemplateReference 引用的 ModelBox 模板
+type TemplateReference struct {
+	// Kind 模板类型, ModelBoxTemplate 与 ModelBox 位于同一命名空间, ClusterModelBoxTemplate 为集群级别, 默认 ModelBoxTemplate
+	//+kubebuilder:validation:Enum=ModelBoxTemplate;ClusterModelBoxTemplate
+	Kind string `json:"kind,omitempty"`
+	Name string `json:"name"`
+}
+
+// HotReloadSpec 模型热更新配置. 控制器将模型配置写入 <name>-models ConfigMap,
+// Pod 中的 sidecar 监视该配置, 下载新模型后原子地切换 /app/model 下的符号链接并通知推理服务
+type HotReloadSpec struct {
+	// ReloadURL 模型切换后由 sidecar 以 POST 调用的推理服务接口, 例如 http://localhost:8080/reload, 为空时不调用
+	ReloadURL string `json:"reloadURL,omitempty"`
+	// Image sidecar 镜像, 默认使用控制器 --agent-image 参数指定的镜像
+	Image string `json:"image,omitempty"`
+}
+
+// PrefetchPolicy 模型预热配置. 控制器在匹配的节点上运行 <name>-prefetch DaemonSet, 将模型预先下载到节点的本地缓存目录,
+// 下载模型的容器以只读方式挂载该目录, 缓存完整时直接复制, 不完整或不存在时从模型地址下载
+type PrefetchPolicy struct {
+	// NodeSelector 预热的节点, 为空时在所有节点上预热. 推理服务的 Pod 优先调度到这些节点
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// Tolerations 预热 Pod 的容忍, 用于在带污点的 GPU 节点上预热
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+	// CachePath 节点上的缓存目录, 默认 /var/lib/modelbox/cache, 每个 ModelBox 使用其中的 <namespace>/<name> 子目录
+	//+kubebuilder:validation:Pattern=`^/.+$`
+	CachePath string `json:"cachePath,omitempty"`
+}
+
+// ModelSource 描述模型文件的来源, spec.model 只使用 url
+type ModelSource struct {
+	// Name 模型名称, 在 models 中唯一, 同时作为下载模型的 InitContainer 名称的一部分
+	//+kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	//+kubebuilder:validation:MaxLength=50
+	Name string `json:"name,omitempty"`
+	// URL 模型地址, 支持 http(s)://、s3://bucket/key、gs://bucket/object、oci://registry/repo:tag、
+	// pvc://claim/path 与 hf://org/model@revision, s3 与 gs 以 / 结尾时下载该前缀下的所有对象
+	//+kubebuilder:validation:Pattern=`^(https?|s3|gs|oci|pvc|hf)://.+$`
+	URL string `json:"url,omitempty"`
+	// Digest 模型文件的摘要, 下载后校验, 格式为 sha256:<hex>
+	//+kubebuilder:validation:Pattern=`^sha256:[a-f0-9]{64}$`
+	Digest string `json:"digest,omitempty"`
+	// SubPath 模型在 /app/model 下的子目录, 默认为模型名称
+	//+kubebuilder:validation:Pattern=`^[a-zA-Z0-9_-][a-zA-Z0-9._-]*(/[a-zA-Z0-9_-][a-zA-Z0-9._-]*)*$`
+	SubPath string `json:"subPath,omitempty"`
+	// Endpoint 对象存储、镜像仓库或 Hugging Face 镜像站的地址, 例如 MinIO 的 http://minio.minio:9000, 为空时使用默认地址
+	Endpoint string `json:"endpoint,omitempty"`
+	// CredentialsSecretRef 访问模型地址所需凭证所在的 Secret, 与 ModelBox 位于同一命名空间.
+	// Secret 只挂载到下载模型的容器中, 推理服务容器无法读取
+	CredentialsSecretRef *corev1.LocalObjectReference `json:"credentialsSecretRef,omitempty"`
+	// ServiceAccountToken 向下载模型的容器投射 ServiceAccount token, 用于 IRSA 等基于身份联合的访问
+	ServiceAccountToken *ServiceAccountTokenProjection `json:"serviceAccountToken,omitempty"`
+}
+
+// ServiceAccountTokenProjection 投射到下载模型容器中的 ServiceAccount token, 由 kubelet 在过期前自动轮换
+type ServiceAccountTokenProjection struct {
+	// Audience token 的受众, 例如 sts.amazonaws.com
+	Audience string `json:"audience"`
+	// ExpirationSeconds token 的有效期, 默认 1 小时
+	//+kubebuilder:validation:Minimum=600
+	ExpirationSeconds *int64 `json:"expirationSeconds,omitempty"`
+}
+
+// ServingSpec 描述推理服务容器
+type ServingSpec struct {
+	Image           string                       `json:"image,omitempty"`           // 镜像, 可以由模板提供
+	Env             []corev1.EnvVar              `json:"env,omitempty"`             // 环境变量
+	ResourceProfile ResourceProfile              `json:"resourceProfile,omitempty"` // 资源规格
+	Resources       *corev1.ResourceRequirements `json:"resources,omitempty"`       // 资源配额, resourceProfile 为 custom 时生效
+	ReadinessProbe  *corev1.Probe                `json:"readinessProbe,omitempty"`  // 就绪探针
+	LivenessProbe   *corev1.Probe                `json:"livenessProbe,omitempty"`   // 存活探针
+	Command         []string                     `json:"command,omitempty"`         // 覆盖镜像的 ENTRYPOINT
+	Args            []string                     `json:"args,omitempty"`            // 覆盖镜像的 CMD
+	WorkingDir      string                       `json:"workingDir,omitempty"`      // 工作目录, 默认使用镜像中的配置
+	EnvFrom         []corev1.EnvFromSource       `json:"envFrom,omitempty"`         // 从 ConfigMap 或 Secret 导入环境变量
+	// Ports 推理服务容器的端口, exposure.ports 中命名的 targetPort 按名称解析为这里的端口号.
+	// 不设置时按 exposure.ports 中数字的 targetPort 生成
+	Ports []corev1.ContainerPort `json:"ports,omitempty"`
+	// Lifecycle 生命周期钩子, 例如在 preStop 中等待正在处理的推理请求完成
+	Lifecycle *corev1.Lifecycle `json:"lifecycle,omitempty"`
+	// TerminationGracePeriodSeconds Pod 优雅退出的最长时间, 需要大于 preStop 的耗时, 默认 30 秒
+	//+kubebuilder:validation:Minimum=0
+	TerminationGracePeriodSeconds *int64 `json:"terminationGracePeriodSeconds,omitempty"`
+}
+
+// ScalingSpec 描述副本数与滚动更新策略
+type ScalingSpec struct {
+	//+kubebuilder:validation:Minimum=0
+	Replicas      *int32             `json:"replicas,omitempty"`      // 副本数
+	RollingUpdate *RollingUpdateSpec `json:"rollingUpdate,omitempty"` // 滚动更新
+	// IdleTimeout 超过该时长没有推理请求时将副本数缩容到 0, 收到请求时由 apigateway 激活, 不设置时不缩容
+	IdleTimeout *metav1.Duration `json:"idleTimeout,omitempty"`
+}
+
+// RollingUpdateSpec 滚动更新配置, 取值同 Deployment 的 maxUnavailable/maxSurge
+type RollingUpdateSpec struct {
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+	MaxSurge       *intstr.IntOrString `json:"maxSurge,omitempty"`
+}
+
+// ExposureSpec 描述推理服务如何暴露
+type ExposureSpec struct {
+	//+kubebuilder:validation:Enum=ClusterIP;NodePort;LoadBalancer
+	ServiceType corev1.ServiceType   `json:"serviceType,omitempty"` // 服务类型
+	Ports       []corev1.ServicePort `json:"ports,omitempty"`       // 服务端口
+}
+
+// BatchPhase 批量推理任务的阶段
+type BatchPhase string
+
+const (
+	// BatchPending Job 尚未创建 Pod
+	BatchPending BatchPhase = "Pending"
+	// BatchRunning 正在下载输入数据集或推理
+	BatchRunning BatchPhase = "Running"
+	// BatchSucceeded 任务完成, 结果已写入 output
+	BatchSucceeded BatchPhase = "Succeeded"
+	// BatchFailed 重试次数用尽或超时
+	BatchFailed BatchPhase = "Failed"
+)
+
+// BatchStatus 批量推理任务的状态, 来自 Job 的状态
+type BatchStatus struct {
+	Phase BatchPhase `json:"phase,omitempty"`
+	// Message 任务失败的原因
+	Message string `json:"message,omitempty"`
+	// Active 正在运行的 Pod 数
+	Active int32 `json:"active,omitempty"`
+	// Failed 失败的 Pod 数
+	Failed int32 `json:"failed,omitempty"`
+	// StartTime 任务开始的时间
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// CompletionTime 任务完成的时间, 只在成功时设置
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Output 结果所在的位置, 格式为 pvc://claim/subPath, 可以直接作为其他 ModelBox 的模型或输入地址
+	Output string `json:"output,omitempty"`
+}
+
+// ModelLoadState 模型的加载状态
+type ModelLoadState string
+
+const (
+	// ModelPending 还没有 Pod 开始下载模型
+	ModelPending ModelLoadState = "Pending"
+	// ModelLoading 模型正在下载
+	ModelLoading ModelLoadState = "Loading"
+	// ModelLoaded 所有 Pod 都已下载完成
+	ModelLoaded ModelLoadState = "Loaded"
+	// ModelFailed 有 Pod 下载或校验失败
+	ModelFailed ModelLoadState = "Failed"
+)
+
+// ModelStatus 单个模型在各个 Pod 中的加载情况
+type ModelStatus struct {
+	Name           string         `json:"name"`
+	State          ModelLoadState `json:"state"`
+	LoadedReplicas int32          `json:"loadedReplicas"`    // 已加载该模型的 Pod 数
+	Message        string         `json:"message,omitempty"` // 失败原因
+}
+
+// ReloadState 热更新模式下 Pod 加载模型配置的状态
+type ReloadState string
+
+const (
+	// ReloadInProgress Pod 还没有加载最新的模型配置
+	ReloadInProgress ReloadState = "Reloading"
+	// ReloadSucceeded Pod 已加载最新的模型配置
+	ReloadSucceeded ReloadState = "Reloaded"
+	// ReloadFailed 下载模型或通知推理服务失败
+	ReloadFailed ReloadState = "Failed"
+	// ReloadUnknown 无法获取 Pod 中 sidecar 的状态
+	ReloadUnknown ReloadState = "Unknown"
+)
+
+// PodReloadStatus 单个 Pod 的热更新结果
+type PodReloadStatus struct {
+	Pod      string      `json:"pod"`
+	Revision string      `json:"revision,omitempty"` // Pod 已加载的模型配置版本
+	State    ReloadState `json:"state"`
+	Message  string      `json:"message,omitempty"`
+}
+
+// ResolvedImage 镜像 tag 解析得到的 digest, 同一镜像只解析一次, tag 之后被覆盖也不会影响已有的 Pod
+type ResolvedImage struct {
+	Image  string `json:"image"`  // 未解析的镜像, 例如 spec.serving.image
+	Digest string `json:"digest"` // 镜像 manifest 的 digest, 例如 sha256:...
+}
+
+// ModelBoxStatus defines the observed state of ModelBox
+type ModelBoxStatus struct {
+	appsv1.DeploymentStatus `json:",inline"`
+	Models                  []ModelStatus     `json:"models,omitempty"`        // spec.models 中各模型的加载状态
+	ModelRevision           string            `json:"modelRevision,omitempty"` // 热更新模式下最新的模型配置版本
+	Reloads                 []PodReloadStatus `json:"reloads,omitempty"`       // 热更新模式下各 Pod 的加载结果
+	// PolicyViolations 违反的命名空间策略, 创建策略之前已存在的 ModelBox 不会被拒绝, 只在这里报告
+	PolicyViolations []string `json:"policyViolations,omitempty"`
+	// ResolvedImages 控制器开启 digest 解析时各容器镜像解析得到的 digest, Pod 按 digest 拉取镜像
+	ResolvedImages []ResolvedImage `json:"resolvedImages,omitempty"`
+	// Batch workloadType 为 BatchJob 时批量推理任务的状态
+	Batch *BatchStatus `json:"batch,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:storageversion
+
+// ModelBox is the Schema for the modelboxes API
+type ModelBox struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ModelBoxSpec   `json:"spec,omitempty"`
+	Status ModelBoxStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ModelBoxList contains a list of ModelBox
+type ModelBoxList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ModelBox `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ModelBox{}, &ModelBoxList{})
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2021 Anjie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ModelBoxPolicySpec 命名空间中 ModelBox 的限制, 未设置的字段不限制. 同一命名空间有多个策略时需要同时满足.
+// 创建或修改 ModelBox 时由 validating webhook 检查, 已存在的 ModelBox 违反策略时记录在 status.policyViolations 中
+type ModelBoxPolicySpec struct {
+	// MaxReplicas 单个 ModelBox 的最大副本数
+	//+kubebuilder:validation:Minimum=0
+	MaxReplicas *int32 `json:"maxReplicas,omitempty"`
+	// AllowedResourceProfiles 允许的资源规格, 设置后 ModelBox 必须指定其中之一
+	AllowedResourceProfiles []ResourceProfile `json:"allowedResourceProfiles,omitempty"`
+	// AllowedImageRegistries 允许的镜像仓库, 例如 registry.example.com 或 registry.example.com/ml,
+	// 不带仓库地址的镜像属于 docker.io
+	AllowedImageRegistries []string `json:"allowedImageRegistries,omitempty"`
+	// AllowedServiceTypes 允许的服务类型, 例如只允许 ClusterIP
+	AllowedServiceTypes []corev1.ServiceType `json:"allowedServiceTypes,omitempty"`
+	// MaxTotalResources 命名空间中所有 ModelBox 的 cpu 与 memory 总量上限,
+	// 按推理服务容器的 requests (未设置时取 limits) 乘以副本数计算
+	MaxTotalResources corev1.ResourceList `json:"maxTotalResources,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ModelBoxPolicy is the Schema for the modelboxpolicies API
+type ModelBoxPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ModelBoxPolicySpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ModelBoxPolicyList contains a list of ModelBoxPolicy
+type ModelBoxPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ModelBoxPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ModelBoxPolicy{}, &ModelBoxPolicyList{})
+}
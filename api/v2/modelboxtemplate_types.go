@@ -0,0 +1,82 @@
+/*
+Copyright 2021 Anjie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// TemplateKind 与 ModelBox 位于同一命名空间的模板
+	TemplateKind = "ModelBoxTemplate"
+	// ClusterTemplateKind 集群级别的模板, 所有命名空间的 ModelBox 都可以引用
+	ClusterTemplateKind = "ClusterModelBoxTemplate"
+)
+
+// ModelBoxTemplateSpec 团队共用的镜像、探针、环境变量与资源等配置, 作为引用它的 ModelBox 的默认值.
+// 合并时 ModelBox 中设置了的字段优先, 对象逐字段合并, 列表整体替换, 环境变量按名称合并
+type ModelBoxTemplateSpec struct {
+	Serving   ServingSpec     `json:"serving,omitempty"`   // 推理服务容器
+	Scaling   ScalingSpec     `json:"scaling,omitempty"`   // 副本与滚动更新
+	Exposure  ExposureSpec    `json:"exposure,omitempty"`  // 服务暴露
+	HotReload *HotReloadSpec  `json:"hotReload,omitempty"` // 模型热更新
+	Prefetch  *PrefetchPolicy `json:"prefetch,omitempty"`  // 模型预热
+}
+
+//+kubebuilder:object:root=true
+
+// ModelBoxTemplate is the Schema for the modelboxtemplates API
+type ModelBoxTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ModelBoxTemplateSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ModelBoxTemplateList contains a list of ModelBoxTemplate
+type ModelBoxTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ModelBoxTemplate `json:"items"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+
+// ClusterModelBoxTemplate is the Schema for the clustermodelboxtemplates API
+type ClusterModelBoxTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ModelBoxTemplateSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ClusterModelBoxTemplateList contains a list of ClusterModelBoxTemplate
+type ClusterModelBoxTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterModelBoxTemplate `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ModelBoxTemplate{}, &ModelBoxTemplateList{})
+	SchemeBuilder.Register(&ClusterModelBoxTemplate{}, &ClusterModelBoxTemplateList{})
+}
@@ -0,0 +1,897 @@
+// +build !ignore_autogenerated
+
+/*
+Copyright 2021 Anjie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Code generated by controller-gen. DO NOT EDIT.
+
+package v2
+
+import (
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BatchOutput) DeepCopyInto(out *BatchOutput) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BatchOutput.
+func (in *BatchOutput) DeepCopy() *BatchOutput {
+	if in == nil {
+		return nil
+	}
+	out := new(BatchOutput)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BatchSpec) DeepCopyInto(out *BatchSpec) {
+	*out = *in
+	in.Input.DeepCopyInto(&out.Input)
+	out.Output = in.Output
+	if in.BackoffLimit != nil {
+		in, out := &in.BackoffLimit, &out.BackoffLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.ActiveDeadlineSeconds != nil {
+		in, out := &in.ActiveDeadlineSeconds, &out.ActiveDeadlineSeconds
+		*out = new(int64)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BatchSpec.
+func (in *BatchSpec) DeepCopy() *BatchSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(BatchSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BatchStatus) DeepCopyInto(out *BatchStatus) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BatchStatus.
+func (in *BatchStatus) DeepCopy() *BatchStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(BatchStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterModelBoxTemplate) DeepCopyInto(out *ClusterModelBoxTemplate) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterModelBoxTemplate.
+func (in *ClusterModelBoxTemplate) DeepCopy() *ClusterModelBoxTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterModelBoxTemplate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterModelBoxTemplate) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterModelBoxTemplateList) DeepCopyInto(out *ClusterModelBoxTemplateList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ClusterModelBoxTemplate, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterModelBoxTemplateList.
+func (in *ClusterModelBoxTemplateList) DeepCopy() *ClusterModelBoxTemplateList {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterModelBoxTemplateList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterModelBoxTemplateList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DistributedSpec) DeepCopyInto(out *DistributedSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DistributedSpec.
+func (in *DistributedSpec) DeepCopy() *DistributedSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DistributedSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExposureSpec) DeepCopyInto(out *ExposureSpec) {
+	*out = *in
+	if in.Ports != nil {
+		in, out := &in.Ports, &out.Ports
+		*out = make([]v1.ServicePort, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExposureSpec.
+func (in *ExposureSpec) DeepCopy() *ExposureSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ExposureSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HotReloadSpec) DeepCopyInto(out *HotReloadSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HotReloadSpec.
+func (in *HotReloadSpec) DeepCopy() *HotReloadSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(HotReloadSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ImagePullSecret) DeepCopyInto(out *ImagePullSecret) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImagePullSecret.
+func (in *ImagePullSecret) DeepCopy() *ImagePullSecret {
+	if in == nil {
+		return nil
+	}
+	out := new(ImagePullSecret)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ModelBox) DeepCopyInto(out *ModelBox) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModelBox.
+func (in *ModelBox) DeepCopy() *ModelBox {
+	if in == nil {
+		return nil
+	}
+	out := new(ModelBox)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ModelBox) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ModelBoxList) DeepCopyInto(out *ModelBoxList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ModelBox, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModelBoxList.
+func (in *ModelBoxList) DeepCopy() *ModelBoxList {
+	if in == nil {
+		return nil
+	}
+	out := new(ModelBoxList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ModelBoxList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ModelBoxPolicy) DeepCopyInto(out *ModelBoxPolicy) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModelBoxPolicy.
+func (in *ModelBoxPolicy) DeepCopy() *ModelBoxPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(ModelBoxPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ModelBoxPolicy) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ModelBoxPolicyList) DeepCopyInto(out *ModelBoxPolicyList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ModelBoxPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModelBoxPolicyList.
+func (in *ModelBoxPolicyList) DeepCopy() *ModelBoxPolicyList {
+	if in == nil {
+		return nil
+	}
+	out := new(ModelBoxPolicyList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ModelBoxPolicyList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ModelBoxPolicySpec) DeepCopyInto(out *ModelBoxPolicySpec) {
+	*out = *in
+	if in.MaxReplicas != nil {
+		in, out := &in.MaxReplicas, &out.MaxReplicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.AllowedResourceProfiles != nil {
+		in, out := &in.AllowedResourceProfiles, &out.AllowedResourceProfiles
+		*out = make([]ResourceProfile, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllowedImageRegistries != nil {
+		in, out := &in.AllowedImageRegistries, &out.AllowedImageRegistries
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllowedServiceTypes != nil {
+		in, out := &in.AllowedServiceTypes, &out.AllowedServiceTypes
+		*out = make([]v1.ServiceType, len(*in))
+		copy(*out, *in)
+	}
+	if in.MaxTotalResources != nil {
+		in, out := &in.MaxTotalResources, &out.MaxTotalResources
+		*out = make(v1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModelBoxPolicySpec.
+func (in *ModelBoxPolicySpec) DeepCopy() *ModelBoxPolicySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ModelBoxPolicySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ModelBoxSpec) DeepCopyInto(out *ModelBoxSpec) {
+	*out = *in
+	in.Model.DeepCopyInto(&out.Model)
+	if in.Models != nil {
+		in, out := &in.Models, &out.Models
+		*out = make([]ModelSource, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	in.Serving.DeepCopyInto(&out.Serving)
+	in.Scaling.DeepCopyInto(&out.Scaling)
+	in.Exposure.DeepCopyInto(&out.Exposure)
+	if in.HotReload != nil {
+		in, out := &in.HotReload, &out.HotReload
+		*out = new(HotReloadSpec)
+		**out = **in
+	}
+	if in.Prefetch != nil {
+		in, out := &in.Prefetch, &out.Prefetch
+		*out = new(PrefetchPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TemplateRef != nil {
+		in, out := &in.TemplateRef, &out.TemplateRef
+		*out = new(TemplateReference)
+		**out = **in
+	}
+	if in.NetworkAccess != nil {
+		in, out := &in.NetworkAccess, &out.NetworkAccess
+		*out = new(NetworkAccessSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ServiceAccount != nil {
+		in, out := &in.ServiceAccount, &out.ServiceAccount
+		*out = new(ServiceAccountSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ImagePullSecrets != nil {
+		in, out := &in.ImagePullSecrets, &out.ImagePullSecrets
+		*out = make([]ImagePullSecret, len(*in))
+		copy(*out, *in)
+	}
+	if in.Distributed != nil {
+		in, out := &in.Distributed, &out.Distributed
+		*out = new(DistributedSpec)
+		**out = **in
+	}
+	if in.Batch != nil {
+		in, out := &in.Batch, &out.Batch
+		*out = new(BatchSpec)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModelBoxSpec.
+func (in *ModelBoxSpec) DeepCopy() *ModelBoxSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ModelBoxSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ModelBoxStatus) DeepCopyInto(out *ModelBoxStatus) {
+	*out = *in
+	in.DeploymentStatus.DeepCopyInto(&out.DeploymentStatus)
+	if in.Models != nil {
+		in, out := &in.Models, &out.Models
+		*out = make([]ModelStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.Reloads != nil {
+		in, out := &in.Reloads, &out.Reloads
+		*out = make([]PodReloadStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.PolicyViolations != nil {
+		in, out := &in.PolicyViolations, &out.PolicyViolations
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ResolvedImages != nil {
+		in, out := &in.ResolvedImages, &out.ResolvedImages
+		*out = make([]ResolvedImage, len(*in))
+		copy(*out, *in)
+	}
+	if in.Batch != nil {
+		in, out := &in.Batch, &out.Batch
+		*out = new(BatchStatus)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModelBoxStatus.
+func (in *ModelBoxStatus) DeepCopy() *ModelBoxStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ModelBoxStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ModelBoxTemplate) DeepCopyInto(out *ModelBoxTemplate) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModelBoxTemplate.
+func (in *ModelBoxTemplate) DeepCopy() *ModelBoxTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(ModelBoxTemplate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ModelBoxTemplate) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ModelBoxTemplateList) DeepCopyInto(out *ModelBoxTemplateList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ModelBoxTemplate, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModelBoxTemplateList.
+func (in *ModelBoxTemplateList) DeepCopy() *ModelBoxTemplateList {
+	if in == nil {
+		return nil
+	}
+	out := new(ModelBoxTemplateList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ModelBoxTemplateList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ModelBoxTemplateSpec) DeepCopyInto(out *ModelBoxTemplateSpec) {
+	*out = *in
+	in.Serving.DeepCopyInto(&out.Serving)
+	in.Scaling.DeepCopyInto(&out.Scaling)
+	in.Exposure.DeepCopyInto(&out.Exposure)
+	if in.HotReload != nil {
+		in, out := &in.HotReload, &out.HotReload
+		*out = new(HotReloadSpec)
+		**out = **in
+	}
+	if in.Prefetch != nil {
+		in, out := &in.Prefetch, &out.Prefetch
+		*out = new(PrefetchPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModelBoxTemplateSpec.
+func (in *ModelBoxTemplateSpec) DeepCopy() *ModelBoxTemplateSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ModelBoxTemplateSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ModelSource) DeepCopyInto(out *ModelSource) {
+	*out = *in
+	if in.CredentialsSecretRef != nil {
+		in, out := &in.CredentialsSecretRef, &out.CredentialsSecretRef
+		*out = new(v1.LocalObjectReference)
+		**out = **in
+	}
+	if in.ServiceAccountToken != nil {
+		in, out := &in.ServiceAccountToken, &out.ServiceAccountToken
+		*out = new(ServiceAccountTokenProjection)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModelSource.
+func (in *ModelSource) DeepCopy() *ModelSource {
+	if in == nil {
+		return nil
+	}
+	out := new(ModelSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ModelStatus) DeepCopyInto(out *ModelStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModelStatus.
+func (in *ModelStatus) DeepCopy() *ModelStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ModelStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkAccessSpec) DeepCopyInto(out *NetworkAccessSpec) {
+	*out = *in
+	if in.AllowedNamespaces != nil {
+		in, out := &in.AllowedNamespaces, &out.AllowedNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllowedPods != nil {
+		in, out := &in.AllowedPods, &out.AllowedPods
+		*out = make([]metav1.LabelSelector, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.AllowGateway != nil {
+		in, out := &in.AllowGateway, &out.AllowGateway
+		*out = new(bool)
+		**out = **in
+	}
+	if in.AllowModelDownload != nil {
+		in, out := &in.AllowModelDownload, &out.AllowModelDownload
+		*out = new(bool)
+		**out = **in
+	}
+	if in.ModelDownloadCIDRs != nil {
+		in, out := &in.ModelDownloadCIDRs, &out.ModelDownloadCIDRs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkAccessSpec.
+func (in *NetworkAccessSpec) DeepCopy() *NetworkAccessSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkAccessSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodReloadStatus) DeepCopyInto(out *PodReloadStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodReloadStatus.
+func (in *PodReloadStatus) DeepCopy() *PodReloadStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PodReloadStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PrefetchPolicy) DeepCopyInto(out *PrefetchPolicy) {
+	*out = *in
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Tolerations != nil {
+		in, out := &in.Tolerations, &out.Tolerations
+		*out = make([]v1.Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PrefetchPolicy.
+func (in *PrefetchPolicy) DeepCopy() *PrefetchPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(PrefetchPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResolvedImage) DeepCopyInto(out *ResolvedImage) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResolvedImage.
+func (in *ResolvedImage) DeepCopy() *ResolvedImage {
+	if in == nil {
+		return nil
+	}
+	out := new(ResolvedImage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RollingUpdateSpec) DeepCopyInto(out *RollingUpdateSpec) {
+	*out = *in
+	if in.MaxUnavailable != nil {
+		in, out := &in.MaxUnavailable, &out.MaxUnavailable
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	if in.MaxSurge != nil {
+		in, out := &in.MaxSurge, &out.MaxSurge
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RollingUpdateSpec.
+func (in *RollingUpdateSpec) DeepCopy() *RollingUpdateSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(RollingUpdateSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ScalingSpec) DeepCopyInto(out *ScalingSpec) {
+	*out = *in
+	if in.Replicas != nil {
+		in, out := &in.Replicas, &out.Replicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.RollingUpdate != nil {
+		in, out := &in.RollingUpdate, &out.RollingUpdate
+		*out = new(RollingUpdateSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.IdleTimeout != nil {
+		in, out := &in.IdleTimeout, &out.IdleTimeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScalingSpec.
+func (in *ScalingSpec) DeepCopy() *ScalingSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ScalingSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceAccountSpec) DeepCopyInto(out *ServiceAccountSpec) {
+	*out = *in
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.ImagePullSecrets != nil {
+		in, out := &in.ImagePullSecrets, &out.ImagePullSecrets
+		*out = make([]v1.LocalObjectReference, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceAccountSpec.
+func (in *ServiceAccountSpec) DeepCopy() *ServiceAccountSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceAccountSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceAccountTokenProjection) DeepCopyInto(out *ServiceAccountTokenProjection) {
+	*out = *in
+	if in.ExpirationSeconds != nil {
+		in, out := &in.ExpirationSeconds, &out.ExpirationSeconds
+		*out = new(int64)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceAccountTokenProjection.
+func (in *ServiceAccountTokenProjection) DeepCopy() *ServiceAccountTokenProjection {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceAccountTokenProjection)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServingSpec) DeepCopyInto(out *ServingSpec) {
+	*out = *in
+	if in.Env != nil {
+		in, out := &in.Env, &out.Env
+		*out = make([]v1.EnvVar, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = new(v1.ResourceRequirements)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ReadinessProbe != nil {
+		in, out := &in.ReadinessProbe, &out.ReadinessProbe
+		*out = new(v1.Probe)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LivenessProbe != nil {
+		in, out := &in.LivenessProbe, &out.LivenessProbe
+		*out = new(v1.Probe)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Command != nil {
+		in, out := &in.Command, &out.Command
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Args != nil {
+		in, out := &in.Args, &out.Args
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.EnvFrom != nil {
+		in, out := &in.EnvFrom, &out.EnvFrom
+		*out = make([]v1.EnvFromSource, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Ports != nil {
+		in, out := &in.Ports, &out.Ports
+		*out = make([]v1.ContainerPort, len(*in))
+		copy(*out, *in)
+	}
+	if in.Lifecycle != nil {
+		in, out := &in.Lifecycle, &out.Lifecycle
+		*out = new(v1.Lifecycle)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TerminationGracePeriodSeconds != nil {
+		in, out := &in.TerminationGracePeriodSeconds, &out.TerminationGracePeriodSeconds
+		*out = new(int64)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServingSpec.
+func (in *ServingSpec) DeepCopy() *ServingSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ServingSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TemplateReference) DeepCopyInto(out *TemplateReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TemplateReference.
+func (in *TemplateReference) DeepCopy() *TemplateReference {
+	if in == nil {
+		return nil
+	}
+	out := new(TemplateReference)
+	in.DeepCopyInto(out)
+	return out
+}
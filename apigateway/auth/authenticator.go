@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// WebSocketProtocolPrefix 浏览器无法为 WebSocket 设置 Authorization header,
+// 与 kube-apiserver 一样允许通过子协议 base64url.bearer.authorization.k8s.io.<token> 携带 token
+const WebSocketProtocolPrefix = "base64url.bearer.authorization.k8s.io."
+
+// TokenAuthenticator 校验 bearer token 并返回对应的身份;
+// token 不属于该认证器时返回 ok=false 和 nil error, 以便尝试下一个认证器
+type TokenAuthenticator interface {
+	AuthenticateToken(ctx context.Context, token string) (user *UserInfo, ok bool, err error)
+}
+
+// unionAuthenticator 依次尝试多个认证器, 任意一个通过即认证成功
+type unionAuthenticator []TokenAuthenticator
+
+// NewUnionAuthenticator 组合多个认证器
+func NewUnionAuthenticator(authenticators ...TokenAuthenticator) TokenAuthenticator {
+	return unionAuthenticator(authenticators)
+}
+
+func (u unionAuthenticator) AuthenticateToken(ctx context.Context, token string) (*UserInfo, bool, error) {
+	var errs []error
+	for _, authenticator := range u {
+		user, ok, err := authenticator.AuthenticateToken(ctx, token)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if ok {
+			return user, true, nil
+		}
+	}
+	return nil, false, utilerrors.NewAggregate(errs)
+}
+
+// BearerToken 从请求中取出 bearer token, 依次检查 Authorization header 和 WebSocket 子协议
+func BearerToken(r *http.Request) (string, bool) {
+	if header := strings.TrimSpace(r.Header.Get("Authorization")); header != "" {
+		parts := strings.SplitN(header, " ", 2)
+		if len(parts) != 2 || !strings.EqualFold(parts[0], "bearer") {
+			return "", false
+		}
+		token := strings.TrimSpace(parts[1])
+		return token, token != ""
+	}
+
+	for _, value := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, protocol := range strings.Split(value, ",") {
+			protocol = strings.TrimSpace(protocol)
+			if !strings.HasPrefix(protocol, WebSocketProtocolPrefix) {
+				continue
+			}
+			data, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(protocol, WebSocketProtocolPrefix))
+			if err != nil || len(data) == 0 {
+				return "", false
+			}
+			return string(data), true
+		}
+	}
+	return "", false
+}
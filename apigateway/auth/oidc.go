@@ -0,0 +1,326 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	// jwksMinRefreshInterval 遇到未知 kid 时刷新公钥的最小间隔, 防止伪造 kid 的请求打满 issuer
+	jwksMinRefreshInterval = time.Minute
+	oidcHTTPTimeout        = 10 * time.Second
+)
+
+// OIDCOptions 与 kube-apiserver 的 --oidc-* 参数含义一致, 保证解析出的用户名与 RBAC 中的主体一致
+type OIDCOptions struct {
+	// IssuerURL 必须为 https, 与 token 中的 iss 完全一致
+	IssuerURL string
+	// ClientID token 的 aud 中必须包含该值
+	ClientID string
+	// CAFile 校验 issuer 证书的 CA, 为空时使用系统 CA
+	CAFile string
+	// UsernameClaim 作为用户名的 claim, 默认 sub
+	UsernameClaim string
+	// UsernamePrefix 用户名前缀; 为空且 UsernameClaim 不是 email 时使用 "<issuer>#", "-" 表示不加前缀
+	UsernamePrefix string
+	// GroupsClaim 作为用户组的 claim, 为空时不解析用户组
+	GroupsClaim string
+	// GroupsPrefix 用户组前缀
+	GroupsPrefix string
+}
+
+// oidcAuthenticator 使用 issuer 发布的公钥 (JWKS) 在本地校验 OIDC ID token
+type oidcAuthenticator struct {
+	opts    OIDCOptions
+	client  *http.Client
+	jwksURL string
+
+	mu          sync.RWMutex
+	keys        map[string]interface{}
+	lastRefresh time.Time
+}
+
+// NewOIDCAuthenticator 通过 issuer 的 discovery 文档获取 JWKS 地址并加载公钥
+func NewOIDCAuthenticator(ctx context.Context, opts OIDCOptions) (TokenAuthenticator, error) {
+	if !strings.HasPrefix(opts.IssuerURL, "https://") {
+		return nil, fmt.Errorf("oidc issuer URL must use https scheme, got %q", opts.IssuerURL)
+	}
+	if opts.ClientID == "" {
+		return nil, fmt.Errorf("oidc client ID is required")
+	}
+	if opts.UsernameClaim == "" {
+		opts.UsernameClaim = "sub"
+	}
+	switch opts.UsernamePrefix {
+	case "":
+		if opts.UsernameClaim != "email" {
+			opts.UsernamePrefix = opts.IssuerURL + "#"
+		}
+	case "-":
+		opts.UsernamePrefix = ""
+	}
+
+	client := &http.Client{Timeout: oidcHTTPTimeout}
+	if opts.CAFile != "" {
+		data, err := ioutil.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read oidc CA file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in oidc CA file %s", opts.CAFile)
+		}
+		client.Transport = &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+		}
+	}
+
+	a := &oidcAuthenticator{opts: opts, client: client}
+	var discovery struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := a.getJSON(ctx, strings.TrimSuffix(opts.IssuerURL, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %v", err)
+	}
+	if discovery.Issuer != opts.IssuerURL {
+		return nil, fmt.Errorf("oidc issuer %q does not match discovery issuer %q", opts.IssuerURL, discovery.Issuer)
+	}
+	if discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("oidc discovery document has no jwks_uri")
+	}
+	a.jwksURL = discovery.JWKSURI
+	if err := a.refreshKeys(ctx); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *oidcAuthenticator) AuthenticateToken(ctx context.Context, token string) (*UserInfo, bool, error) {
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}))
+	// 先不校验签名读取 iss, 不是该 issuer 签发的 token 交给其他认证器处理
+	unverified := jwt.MapClaims{}
+	if _, _, err := parser.ParseUnverified(token, unverified); err != nil {
+		return nil, false, nil
+	}
+	if iss, _ := unverified["iss"].(string); iss != a.opts.IssuerURL {
+		return nil, false, nil
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := parser.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return a.key(ctx, kid)
+	}); err != nil {
+		return nil, false, fmt.Errorf("oidc: %v", err)
+	}
+	// MapClaims.Valid 只在 exp 存在时校验, ID token 必须带 exp
+	if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return nil, false, fmt.Errorf("oidc: token has no exp claim or is expired")
+	}
+	if !claims.VerifyIssuer(a.opts.IssuerURL, true) {
+		return nil, false, fmt.Errorf("oidc: token issuer is not %q", a.opts.IssuerURL)
+	}
+	if !claims.VerifyAudience(a.opts.ClientID, true) {
+		return nil, false, fmt.Errorf("oidc: token audience does not contain %q", a.opts.ClientID)
+	}
+
+	username, ok := claims[a.opts.UsernameClaim].(string)
+	if !ok || username == "" {
+		return nil, false, fmt.Errorf("oidc: claim %q is not a non-empty string", a.opts.UsernameClaim)
+	}
+	if a.opts.UsernameClaim == "email" {
+		if verified, present := claims["email_verified"]; present && verified != true {
+			return nil, false, fmt.Errorf("oidc: email %q is not verified", username)
+		}
+	}
+
+	user := &UserInfo{Name: a.opts.UsernamePrefix + username}
+	if sub, ok := claims["sub"].(string); ok {
+		user.UID = sub
+	}
+	if a.opts.GroupsClaim != "" {
+		groups, err := stringsClaim(claims[a.opts.GroupsClaim])
+		if err != nil {
+			return nil, false, fmt.Errorf("oidc: claim %q: %v", a.opts.GroupsClaim, err)
+		}
+		for _, group := range groups {
+			user.Groups = append(user.Groups, a.opts.GroupsPrefix+group)
+		}
+	}
+	return user, true, nil
+}
+
+// key 按 kid 查找公钥, 未找到时 (issuer 可能已轮换密钥) 重新拉取 JWKS
+func (a *oidcAuthenticator) key(ctx context.Context, kid string) (interface{}, error) {
+	if key, ok := a.lookupKey(kid); ok {
+		return key, nil
+	}
+
+	a.mu.RLock()
+	canRefresh := time.Since(a.lastRefresh) >= jwksMinRefreshInterval
+	a.mu.RUnlock()
+	if canRefresh {
+		if err := a.refreshKeys(ctx); err != nil {
+			return nil, err
+		}
+		if key, ok := a.lookupKey(kid); ok {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("no signing key found for kid %q", kid)
+}
+
+func (a *oidcAuthenticator) lookupKey(kid string) (interface{}, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	// token 未指定 kid 时, 仅在只有一个公钥的情况下使用它
+	if kid == "" && len(a.keys) == 1 {
+		for _, key := range a.keys {
+			return key, true
+		}
+	}
+	key, ok := a.keys[kid]
+	return key, ok
+}
+
+// jsonWebKey RFC 7517 中签名公钥所需的字段
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (a *oidcAuthenticator) refreshKeys(ctx context.Context) error {
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := a.getJSON(ctx, a.jwksURL, &jwks); err != nil {
+		return fmt.Errorf("fetch oidc jwks: %v", err)
+	}
+
+	keys := make(map[string]interface{}, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			// 不支持的密钥类型不影响其他公钥的使用
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("no usable signing keys found at %s", a.jwksURL)
+	}
+
+	a.mu.Lock()
+	a.keys = keys
+	a.lastRefresh = time.Now()
+	a.mu.Unlock()
+	return nil
+}
+
+func (k *jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+func (a *oidcAuthenticator) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// stringsClaim 将字符串或字符串数组类型的 claim 转换为 []string
+func stringsClaim(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		result := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("expected string, got %T", item)
+			}
+			result = append(result, s)
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("expected string or array of strings, got %T", value)
+}
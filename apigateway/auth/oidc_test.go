@@ -0,0 +1,345 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const testClientID = "modelbox"
+
+// testIssuer 测试用的 OIDC issuer, 通过 TLS 提供 discovery 文档与 JWKS, 签名公钥可以在测试中轮换
+type testIssuer struct {
+	server *httptest.Server
+	caFile string
+
+	mu          sync.Mutex
+	keys        map[string]*rsa.PrivateKey
+	jwksFetches int
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	iss := &testIssuer{keys: map[string]*rsa.PrivateKey{"k1": newRSAKey(t)}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   iss.server.URL,
+			"jwks_uri": iss.server.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		iss.mu.Lock()
+		defer iss.mu.Unlock()
+		iss.jwksFetches++
+		var keys []jsonWebKey
+		for kid, key := range iss.keys {
+			keys = append(keys, jsonWebKey{
+				Kty: "RSA",
+				Kid: kid,
+				Use: "sig",
+				N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	})
+	iss.server = httptest.NewTLSServer(mux)
+	t.Cleanup(iss.server.Close)
+
+	iss.caFile = filepath.Join(t.TempDir(), "ca.crt")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: iss.server.Certificate().Raw})
+	if err := ioutil.WriteFile(iss.caFile, ca, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return iss
+}
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// setKey 轮换 issuer 的签名公钥
+func (iss *testIssuer) setKey(kid string, key *rsa.PrivateKey) {
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+	iss.keys = map[string]*rsa.PrivateKey{kid: key}
+}
+
+func (iss *testIssuer) fetches() int {
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+	return iss.jwksFetches
+}
+
+// claims 默认的有效 claims
+func (iss *testIssuer) claims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss": iss.server.URL,
+		"aud": testClientID,
+		"sub": "alice-id",
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"iat": time.Now().Unix(),
+	}
+}
+
+func (iss *testIssuer) options() OIDCOptions {
+	return OIDCOptions{IssuerURL: iss.server.URL, ClientID: testClientID, CAFile: iss.caFile}
+}
+
+func signToken(t *testing.T, kid string, key *rsa.PrivateKey, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestOIDCAuthenticateToken(t *testing.T) {
+	iss := newTestIssuer(t)
+	signingKey := iss.keys["k1"]
+
+	tests := []struct {
+		name string
+		opts func(*OIDCOptions)
+		// claims 修改默认的 claims
+		claims   func(jwt.MapClaims)
+		key      *rsa.PrivateKey
+		wantUser *UserInfo
+		wantOK   bool
+		wantErr  bool
+	}{
+		{
+			name:     "valid token",
+			wantUser: &UserInfo{Name: iss.server.URL + "#alice-id", UID: "alice-id"},
+			wantOK:   true,
+		},
+		{
+			name:     "audience list containing client ID",
+			claims:   func(c jwt.MapClaims) { c["aud"] = []interface{}{"other", testClientID} },
+			wantUser: &UserInfo{Name: iss.server.URL + "#alice-id", UID: "alice-id"},
+			wantOK:   true,
+		},
+		{
+			name:    "wrong audience",
+			claims:  func(c jwt.MapClaims) { c["aud"] = "other" },
+			wantErr: true,
+		},
+		{
+			name:    "missing audience",
+			claims:  func(c jwt.MapClaims) { delete(c, "aud") },
+			wantErr: true,
+		},
+		{
+			name:   "wrong issuer is left to other authenticators",
+			claims: func(c jwt.MapClaims) { c["iss"] = "https://other.example.com" },
+		},
+		{
+			name:    "expired token",
+			claims:  func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() },
+			wantErr: true,
+		},
+		{
+			name:    "missing exp",
+			claims:  func(c jwt.MapClaims) { delete(c, "exp") },
+			wantErr: true,
+		},
+		{
+			name:    "not yet valid",
+			claims:  func(c jwt.MapClaims) { c["nbf"] = time.Now().Add(time.Hour).Unix() },
+			wantErr: true,
+		},
+		{
+			name:    "signed by another key",
+			key:     newRSAKey(t),
+			wantErr: true,
+		},
+		{
+			name: "verified email",
+			opts: func(o *OIDCOptions) { o.UsernameClaim = "email" },
+			claims: func(c jwt.MapClaims) {
+				c["email"] = "alice@example.com"
+				c["email_verified"] = true
+			},
+			wantUser: &UserInfo{Name: "alice@example.com", UID: "alice-id"},
+			wantOK:   true,
+		},
+		{
+			name: "unverified email",
+			opts: func(o *OIDCOptions) { o.UsernameClaim = "email" },
+			claims: func(c jwt.MapClaims) {
+				c["email"] = "alice@example.com"
+				c["email_verified"] = false
+			},
+			wantErr: true,
+		},
+		{
+			name: "username and groups prefix",
+			opts: func(o *OIDCOptions) {
+				o.UsernameClaim = "preferred_username"
+				o.UsernamePrefix = "oidc:"
+				o.GroupsClaim = "groups"
+				o.GroupsPrefix = "oidc:"
+			},
+			claims: func(c jwt.MapClaims) {
+				c["preferred_username"] = "alice"
+				c["groups"] = []interface{}{"ml", "admins"}
+			},
+			wantUser: &UserInfo{Name: "oidc:alice", UID: "alice-id", Groups: []string{"oidc:ml", "oidc:admins"}},
+			wantOK:   true,
+		},
+		{
+			name:     "no username prefix",
+			opts:     func(o *OIDCOptions) { o.UsernamePrefix = "-" },
+			wantUser: &UserInfo{Name: "alice-id", UID: "alice-id"},
+			wantOK:   true,
+		},
+		{
+			name:    "missing username claim",
+			opts:    func(o *OIDCOptions) { o.UsernameClaim = "preferred_username" },
+			wantErr: true,
+		},
+		{
+			name:    "groups claim is not a string list",
+			opts:    func(o *OIDCOptions) { o.GroupsClaim = "groups" },
+			claims:  func(c jwt.MapClaims) { c["groups"] = 1 },
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := iss.options()
+			if tt.opts != nil {
+				tt.opts(&opts)
+			}
+			authenticator, err := NewOIDCAuthenticator(context.Background(), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims := iss.claims()
+			if tt.claims != nil {
+				tt.claims(claims)
+			}
+			key := tt.key
+			if key == nil {
+				key = signingKey
+			}
+
+			user, ok, err := authenticator.AuthenticateToken(context.Background(), signToken(t, "k1", key, claims))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, wantErr %t", err, tt.wantErr)
+			}
+			if ok != tt.wantOK {
+				t.Fatalf("got ok %t, want %t", ok, tt.wantOK)
+			}
+			if !reflect.DeepEqual(user, tt.wantUser) {
+				t.Errorf("got user %+v, want %+v", user, tt.wantUser)
+			}
+		})
+	}
+}
+
+func TestOIDCRejectsUnexpectedAlgorithms(t *testing.T) {
+	iss := newTestIssuer(t)
+	authenticator, err := NewOIDCAuthenticator(context.Background(), iss.options())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 用公钥作为 HMAC 密钥签名, 校验时不能被当作 RSA 签名接受
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, iss.claims())
+	token.Header["kid"] = "k1"
+	signed, err := token.SignedString(iss.keys["k1"].PublicKey.N.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := authenticator.AuthenticateToken(context.Background(), signed); ok || err == nil {
+		t.Errorf("HS256 token accepted: ok %t, err %v", ok, err)
+	}
+}
+
+func TestOIDCRefreshesKeysForUnknownKid(t *testing.T) {
+	iss := newTestIssuer(t)
+	authenticator, err := NewOIDCAuthenticator(context.Background(), iss.options())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := iss.fetches(); got != 1 {
+		t.Fatalf("got %d JWKS fetches after discovery, want 1", got)
+	}
+
+	retired := iss.keys["k1"]
+	// issuer 轮换签名密钥
+	rotated := newRSAKey(t)
+	iss.setKey("k2", rotated)
+	token := signToken(t, "k2", rotated, iss.claims())
+
+	// 距上次刷新不足 jwksMinRefreshInterval 时不会刷新
+	if _, ok, err := authenticator.AuthenticateToken(context.Background(), token); ok || err == nil {
+		t.Fatalf("token with unknown kid accepted before refresh: ok %t, err %v", ok, err)
+	}
+	if got := iss.fetches(); got != 1 {
+		t.Fatalf("got %d JWKS fetches, want refresh to be rate limited", got)
+	}
+
+	a := authenticator.(*oidcAuthenticator)
+	a.mu.Lock()
+	a.lastRefresh = time.Now().Add(-jwksMinRefreshInterval)
+	a.mu.Unlock()
+	user, ok, err := authenticator.AuthenticateToken(context.Background(), token)
+	if err != nil || !ok {
+		t.Fatalf("token with rotated key rejected: ok %t, err %v", ok, err)
+	}
+	if user.UID != "alice-id" {
+		t.Errorf("got UID %q, want alice-id", user.UID)
+	}
+	if got := iss.fetches(); got != 2 {
+		t.Errorf("got %d JWKS fetches, want 2", got)
+	}
+
+	// 刷新后旧密钥不再有效
+	old := signToken(t, "k1", retired, iss.claims())
+	if _, ok, err := authenticator.AuthenticateToken(context.Background(), old); ok || err == nil {
+		t.Errorf("token signed with retired key accepted: ok %t, err %v", ok, err)
+	}
+}
+
+func TestNewOIDCAuthenticator(t *testing.T) {
+	iss := newTestIssuer(t)
+	tests := []struct {
+		name string
+		opts func(*OIDCOptions)
+	}{
+		{name: "http issuer", opts: func(o *OIDCOptions) { o.IssuerURL = "http://issuer.example.com" }},
+		{name: "missing client ID", opts: func(o *OIDCOptions) { o.ClientID = "" }},
+		{name: "issuer mismatch", opts: func(o *OIDCOptions) { o.IssuerURL += "/" }},
+		{name: "untrusted CA", opts: func(o *OIDCOptions) { o.CAFile = "" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := iss.options()
+			tt.opts(&opts)
+			if _, err := NewOIDCAuthenticator(context.Background(), opts); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/cache"
+	authenticationv1client "k8s.io/client-go/kubernetes/typed/authentication/v1"
+)
+
+// tokenCacheSize 缓存的 token 数量上限
+const tokenCacheSize = 1024
+
+// tokenReviewAuthenticator 通过 TokenReview API 由 API server 校验 token,
+// 支持 ServiceAccount token 以及 API server 已配置的其他认证方式
+type tokenReviewAuthenticator struct {
+	client authenticationv1client.TokenReviewInterface
+	// 认证结果缓存, 避免每个请求都创建 TokenReview
+	cache *cache.LRUExpireCache
+	ttl   time.Duration
+}
+
+// NewTokenReviewAuthenticator 创建基于 TokenReview 的认证器, ttl 为认证成功结果的缓存时间, 0 表示不缓存
+func NewTokenReviewAuthenticator(client authenticationv1client.TokenReviewInterface, ttl time.Duration) TokenAuthenticator {
+	return &tokenReviewAuthenticator{
+		client: client,
+		cache:  cache.NewLRUExpireCache(tokenCacheSize),
+		ttl:    ttl,
+	}
+}
+
+func (a *tokenReviewAuthenticator) AuthenticateToken(ctx context.Context, token string) (*UserInfo, bool, error) {
+	// 缓存 key 使用 token 的摘要, 不在内存中保留明文
+	sum := sha256.Sum256([]byte(token))
+	key := hex.EncodeToString(sum[:])
+	if a.ttl > 0 {
+		if user, ok := a.cache.Get(key); ok {
+			return user.(*UserInfo), true, nil
+		}
+	}
+
+	review := &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token},
+	}
+	result, err := a.client.Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		return nil, false, err
+	}
+	if !result.Status.Authenticated {
+		return nil, false, nil
+	}
+
+	user := &UserInfo{
+		Name:   result.Status.User.Username,
+		UID:    result.Status.User.UID,
+		Groups: result.Status.User.Groups,
+	}
+	if len(result.Status.User.Extra) > 0 {
+		user.Extra = make(map[string][]string, len(result.Status.User.Extra))
+		for k, v := range result.Status.User.Extra {
+			user.Extra[k] = []string(v)
+		}
+	}
+	if a.ttl > 0 {
+		a.cache.Add(key, user, a.ttl)
+	}
+	return user, true, nil
+}
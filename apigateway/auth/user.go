@@ -0,0 +1,26 @@
+package auth
+
+import (
+	"context"
+)
+
+// UserInfo 认证通过的调用方身份, 会通过 impersonation 转发给 API server
+type UserInfo struct {
+	Name   string
+	UID    string
+	Groups []string
+	Extra  map[string][]string
+}
+
+type userKey struct{}
+
+// WithUser 将调用方身份保存到 context 中
+func WithUser(ctx context.Context, user *UserInfo) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// UserFrom 从 context 中取出调用方身份
+func UserFrom(ctx context.Context) (*UserInfo, bool) {
+	user, ok := ctx.Value(userKey{}).(*UserInfo)
+	return user, ok && user != nil
+}
@@ -0,0 +1,73 @@
+package fake
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/discovery"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/testing"
+
+	modelapiv1 "github.com/sharelinuxs/my-first-opeartor/api/v1"
+	clientset "github.com/sharelinuxs/my-first-opeartor/apigateway/clientset"
+	modelv1 "github.com/sharelinuxs/my-first-opeartor/apigateway/clientset/v1"
+	fakemodelv1 "github.com/sharelinuxs/my-first-opeartor/apigateway/clientset/v1/fake"
+)
+
+// NewSimpleClientset returns a clientset that will respond with the provided objects.
+// It's backed by a very simple object tracker that processes creates, updates and deletions as-is,
+// without applying any validations and/or defaults. It shouldn't be considered a replacement
+// for a real clientset and is mostly useful in simple unit tests.
+func NewSimpleClientset(objects ...runtime.Object) *Clientset {
+	o := testing.NewObjectTracker(modelv1.Scheme, modelv1.Codecs.UniversalDecoder())
+	for _, obj := range objects {
+		// tracker.Add 会把 ModelBox 的资源名猜成 "modelboxs", 这里按真实的 modelboxes 资源写入
+		if mb, ok := obj.(*modelapiv1.ModelBox); ok {
+			if err := o.Create(modelapiv1.GroupVersion.WithResource("modelboxes"), mb, mb.Namespace); err != nil {
+				panic(err)
+			}
+			continue
+		}
+		if err := o.Add(obj); err != nil {
+			panic(err)
+		}
+	}
+
+	cs := &Clientset{tracker: o}
+	cs.discovery = &fakediscovery.FakeDiscovery{Fake: &cs.Fake}
+	cs.AddReactor("*", "*", testing.ObjectReaction(o))
+	cs.AddWatchReactor("*", func(action testing.Action) (handled bool, ret watch.Interface, err error) {
+		gvr := action.GetResource()
+		ns := action.GetNamespace()
+		watch, err := o.Watch(gvr, ns)
+		if err != nil {
+			return false, nil, err
+		}
+		return true, watch, nil
+	})
+
+	return cs
+}
+
+// Clientset implements clientset.Interface. Meant to be embedded into a
+// struct to get a default implementation. This makes faking out just the method
+// you want to test easier.
+type Clientset struct {
+	testing.Fake
+	discovery *fakediscovery.FakeDiscovery
+	tracker   testing.ObjectTracker
+}
+
+func (c *Clientset) Discovery() discovery.DiscoveryInterface {
+	return c.discovery
+}
+
+func (c *Clientset) Tracker() testing.ObjectTracker {
+	return c.tracker
+}
+
+var _ clientset.Interface = &Clientset{}
+
+// ModelV1 retrieves the ModelV1Client
+func (c *Clientset) ModelV1() modelv1.ModelV1Interface {
+	return &fakemodelv1.FakeModelV1{Fake: &c.Fake}
+}
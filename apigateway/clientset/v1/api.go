@@ -2,50 +2,71 @@ package v1
 
 import (
 	modelv1 "github.com/sharelinuxs/my-first-opeartor/api/v1"
-	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
-	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
-	"k8s.io/klog/v2"
 )
 
-type ModelBoxV1Alpha1Interface interface {
-	ModelBoxes(namespace string) ModelBoxInterface
+type ModelV1Interface interface {
+	RESTClient() rest.Interface
+	ModelBoxesGetter
 }
 
-type ModelBoxV1Alpha1Client struct {
+// ModelV1Client is used to interact with features provided by the model.github.com group.
+type ModelV1Client struct {
 	restClient rest.Interface
 }
 
-func NewForConfig(c *rest.Config) (*ModelBoxV1Alpha1Client, error) {
+func (c *ModelV1Client) ModelBoxes(namespace string) ModelBoxInterface {
+	return newModelBoxes(c, namespace)
+}
 
-	//crdConfig.NegotiatedSerializer = serializer.DirectCodecFactory{CodecFactory: scheme.Codecs}
+// NewForConfig creates a new ModelV1Client for the given config.
+func NewForConfig(c *rest.Config) (*ModelV1Client, error) {
 	config := *c
-	config.ContentConfig.GroupVersion = &schema.GroupVersion{Group: modelv1.GroupName, Version: modelv1.Version}
-	config.APIPath = "/apis"
-	config.UserAgent = rest.DefaultKubernetesUserAgent()
-	// 该类型目前不存在 DirectCodecFactory
-	//config.NegotiatedSerializer = serializer.DirectCodecFactory{CodecFactory: scheme.Codecs}
-	config.NegotiatedSerializer = serializer.WithoutConversionCodecFactory{CodecFactory: scheme.Codecs}
-	config.UserAgent = rest.DefaultKubernetesUserAgent()
-
-	//client, err := rest.UnversionedRESTClientFor(&config)
+	if err := setConfigDefaults(&config); err != nil {
+		return nil, err
+	}
 	client, err := rest.RESTClientFor(&config)
 	if err != nil {
 		return nil, err
 	}
-
-	return &ModelBoxV1Alpha1Client{restClient: client}, nil
+	return &ModelV1Client{restClient: client}, nil
 }
 
-func (c *ModelBoxV1Alpha1Client) ModelBoxes(namespace string) ModelBoxInterface {
-	crScheme, err := newCRScheme(SchemeBuilder...)
+// NewForConfigOrDie creates a new ModelV1Client for the given config and
+// panics if there is an error in the config.
+func NewForConfigOrDie(c *rest.Config) *ModelV1Client {
+	client, err := NewForConfig(c)
 	if err != nil {
-		klog.Errorf("ModelBoxes newCRScheme : %v", err)
+		panic(err)
+	}
+	return client
+}
+
+// New creates a new ModelV1Client for the given RESTClient.
+func New(c rest.Interface) *ModelV1Client {
+	return &ModelV1Client{restClient: c}
+}
+
+func setConfigDefaults(config *rest.Config) error {
+	gv := modelv1.GroupVersion
+	config.GroupVersion = &gv
+	config.APIPath = "/apis"
+	// 使用包含 ModelBox 类型的 Scheme 做编解码, 不做版本转换
+	config.NegotiatedSerializer = serializer.WithoutConversionCodecFactory{CodecFactory: Codecs}
+
+	if config.UserAgent == "" {
+		config.UserAgent = rest.DefaultKubernetesUserAgent()
 	}
-	return &modelBoxClient{
-		restClient: c.restClient,
-		ns:         namespace,
-		crScheme:   crScheme,
+
+	return nil
+}
+
+// RESTClient returns a RESTClient that is used to communicate
+// with API server by this client implementation.
+func (c *ModelV1Client) RESTClient() rest.Interface {
+	if c == nil {
+		return nil
 	}
+	return c.restClient
 }
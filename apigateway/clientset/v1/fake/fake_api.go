@@ -0,0 +1,23 @@
+package fake
+
+import (
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/testing"
+
+	modelv1 "github.com/sharelinuxs/my-first-opeartor/apigateway/clientset/v1"
+)
+
+type FakeModelV1 struct {
+	*testing.Fake
+}
+
+func (c *FakeModelV1) ModelBoxes(namespace string) modelv1.ModelBoxInterface {
+	return &FakeModelBoxes{c, namespace}
+}
+
+// RESTClient returns a RESTClient that is used to communicate
+// with API server by this client implementation.
+func (c *FakeModelV1) RESTClient() rest.Interface {
+	var ret *rest.RESTClient
+	return ret
+}
@@ -0,0 +1,124 @@
+package fake
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/testing"
+
+	modelv1 "github.com/sharelinuxs/my-first-opeartor/api/v1"
+)
+
+// FakeModelBoxes implements ModelBoxInterface
+type FakeModelBoxes struct {
+	Fake *FakeModelV1
+	ns   string
+}
+
+var modelboxesResource = schema.GroupVersionResource{Group: "model.github.com", Version: "v1", Resource: "modelboxes"}
+
+var modelboxesKind = schema.GroupVersionKind{Group: "model.github.com", Version: "v1", Kind: "ModelBox"}
+
+// Get takes name of the modelBox, and returns the corresponding modelBox object, and an error if there is any.
+func (c *FakeModelBoxes) Get(ctx context.Context, name string, options metav1.GetOptions) (result *modelv1.ModelBox, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewGetAction(modelboxesResource, c.ns, name), &modelv1.ModelBox{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*modelv1.ModelBox), err
+}
+
+// List takes label and field selectors, and returns the list of ModelBoxes that match those selectors.
+func (c *FakeModelBoxes) List(ctx context.Context, opts metav1.ListOptions) (result *modelv1.ModelBoxList, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewListAction(modelboxesResource, modelboxesKind, c.ns, opts), &modelv1.ModelBoxList{})
+
+	if obj == nil {
+		return nil, err
+	}
+
+	label, _, _ := testing.ExtractFromListOptions(opts)
+	if label == nil {
+		label = labels.Everything()
+	}
+	list := &modelv1.ModelBoxList{ListMeta: obj.(*modelv1.ModelBoxList).ListMeta}
+	for _, item := range obj.(*modelv1.ModelBoxList).Items {
+		if label.Matches(labels.Set(item.Labels)) {
+			list.Items = append(list.Items, item)
+		}
+	}
+	return list, err
+}
+
+// Watch returns a watch.Interface that watches the requested modelBoxes.
+func (c *FakeModelBoxes) Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+	return c.Fake.
+		InvokesWatch(testing.NewWatchAction(modelboxesResource, c.ns, opts))
+
+}
+
+// Create takes the representation of a modelBox and creates it.  Returns the server's representation of the modelBox, and an error, if there is any.
+func (c *FakeModelBoxes) Create(ctx context.Context, modelBox *modelv1.ModelBox, opts metav1.CreateOptions) (result *modelv1.ModelBox, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewCreateAction(modelboxesResource, c.ns, modelBox), &modelv1.ModelBox{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*modelv1.ModelBox), err
+}
+
+// Update takes the representation of a modelBox and updates it. Returns the server's representation of the modelBox, and an error, if there is any.
+func (c *FakeModelBoxes) Update(ctx context.Context, modelBox *modelv1.ModelBox, opts metav1.UpdateOptions) (result *modelv1.ModelBox, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateAction(modelboxesResource, c.ns, modelBox), &modelv1.ModelBox{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*modelv1.ModelBox), err
+}
+
+// UpdateStatus was generated because the type contains a Status member.
+func (c *FakeModelBoxes) UpdateStatus(ctx context.Context, modelBox *modelv1.ModelBox, opts metav1.UpdateOptions) (*modelv1.ModelBox, error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateSubresourceAction(modelboxesResource, "status", c.ns, modelBox), &modelv1.ModelBox{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*modelv1.ModelBox), err
+}
+
+// Delete takes name of the modelBox and deletes it. Returns an error if one occurs.
+func (c *FakeModelBoxes) Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	_, err := c.Fake.
+		Invokes(testing.NewDeleteAction(modelboxesResource, c.ns, name), &modelv1.ModelBox{})
+
+	return err
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *FakeModelBoxes) DeleteCollection(ctx context.Context, opts metav1.DeleteOptions, listOpts metav1.ListOptions) error {
+	action := testing.NewDeleteCollectionAction(modelboxesResource, c.ns, listOpts)
+
+	_, err := c.Fake.Invokes(action, &modelv1.ModelBoxList{})
+	return err
+}
+
+// Patch applies the patch and returns the patched modelBox.
+func (c *FakeModelBoxes) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (result *modelv1.ModelBox, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewPatchSubresourceAction(modelboxesResource, c.ns, name, pt, data, subresources...), &modelv1.ModelBox{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*modelv1.ModelBox), err
+}
@@ -5,95 +5,136 @@ import (
 	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/rest"
 
 	modelv1 "github.com/sharelinuxs/my-first-opeartor/api/v1"
 )
 
-type ModelBoxInterface interface {
-	Create(mb *modelv1.ModelBox, opts metav1.CreateOptions) (*modelv1.ModelBox, error)
-	Delete(name string, opts metav1.DeleteOptions) error
-	Get(name string, opts metav1.GetOptions) (*modelv1.ModelBox, error)
-	List(opts metav1.ListOptions) (*modelv1.ModelBoxList, error)
-	Watch(opts metav1.ListOptions) (watch.Interface, error)
-	// ...
+// ModelBoxesGetter has a method to return a ModelBoxInterface.
+// A group's client should implement this interface.
+type ModelBoxesGetter interface {
+	ModelBoxes(namespace string) ModelBoxInterface
 }
 
-type modelBoxClient struct {
-	restClient rest.Interface
-	ns         string
-	crScheme   *runtime.Scheme
+// ModelBoxInterface has methods to work with ModelBox resources.
+type ModelBoxInterface interface {
+	Create(ctx context.Context, modelBox *modelv1.ModelBox, opts metav1.CreateOptions) (*modelv1.ModelBox, error)
+	Update(ctx context.Context, modelBox *modelv1.ModelBox, opts metav1.UpdateOptions) (*modelv1.ModelBox, error)
+	UpdateStatus(ctx context.Context, modelBox *modelv1.ModelBox, opts metav1.UpdateOptions) (*modelv1.ModelBox, error)
+	Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error
+	DeleteCollection(ctx context.Context, opts metav1.DeleteOptions, listOpts metav1.ListOptions) error
+	Get(ctx context.Context, name string, opts metav1.GetOptions) (*modelv1.ModelBox, error)
+	List(ctx context.Context, opts metav1.ListOptions) (*modelv1.ModelBoxList, error)
+	Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error)
+	Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (result *modelv1.ModelBox, err error)
 }
 
-func (c *modelBoxClient) List(opts metav1.ListOptions) (*modelv1.ModelBoxList, error) {
-	ctx := context.Background()
-	result := modelv1.ModelBoxList{}
-	err := c.restClient.
-		Get().
-		Namespace(c.ns).
-		Resource("modelboxes").
-		// VersionedParams(&opts, scheme.ParameterCodec).   // 注释掉正常
-		VersionedParams(&opts, runtime.NewParameterCodec(c.crScheme)).
-		Do(ctx).
-		Into(&result)
+// modelBoxes implements ModelBoxInterface
+type modelBoxes struct {
+	client rest.Interface
+	ns     string
+}
 
-	return &result, err
+// newModelBoxes returns a ModelBoxes
+func newModelBoxes(c *ModelV1Client, namespace string) *modelBoxes {
+	return &modelBoxes{
+		client: c.RESTClient(),
+		ns:     namespace,
+	}
 }
 
-func (c *modelBoxClient) Get(name string, opts metav1.GetOptions) (*modelv1.ModelBox, error) {
-	ctx := context.Background()
-	result := modelv1.ModelBox{}
-	err := c.restClient.Get().
+// Get takes name of the modelBox, and returns the corresponding modelBox object, and an error if there is any.
+func (c *modelBoxes) Get(ctx context.Context, name string, options metav1.GetOptions) (result *modelv1.ModelBox, err error) {
+	result = &modelv1.ModelBox{}
+	err = c.client.Get().
 		Namespace(c.ns).
 		Resource("modelboxes").
 		Name(name).
-		// VersionedParams(&opts, scheme.ParameterCodec).   // 注释掉正常
-		VersionedParams(&opts, runtime.NewParameterCodec(c.crScheme)).
+		VersionedParams(&options, ParameterCodec).
 		Do(ctx).
-		Into(&result)
-
-	return &result, err
+		Into(result)
+	return
 }
 
-func (c *modelBoxClient) Create(modelbox *modelv1.ModelBox, opts metav1.CreateOptions) (result *modelv1.ModelBox, err error) {
-	ctx := context.Background()
-	result = &modelv1.ModelBox{}
-	err = c.restClient.
-		Post().
+// List takes label and field selectors, and returns the list of ModelBoxes that match those selectors.
+func (c *modelBoxes) List(ctx context.Context, opts metav1.ListOptions) (result *modelv1.ModelBoxList, err error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	result = &modelv1.ModelBoxList{}
+	err = c.client.Get().
 		Namespace(c.ns).
 		Resource("modelboxes").
-		// VersionedParams(&opts, scheme.ParameterCodec).   // 注释掉正常
-		VersionedParams(&opts, runtime.NewParameterCodec(c.crScheme)).
-		Body(modelbox).
+		VersionedParams(&opts, ParameterCodec).
+		Timeout(timeout).
 		Do(ctx).
 		Into(result)
-
 	return
 }
 
-func (c *modelBoxClient) Watch(opts metav1.ListOptions) (watch.Interface, error) {
-	ctx := context.Background()
+// Watch returns a watch.Interface that watches the requested modelBoxes.
+func (c *modelBoxes) Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
 	var timeout time.Duration
 	if opts.TimeoutSeconds != nil {
 		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
 	}
 	opts.Watch = true
-	return c.restClient.
-		Get().
+	return c.client.Get().
 		Namespace(c.ns).
 		Resource("modelboxes").
-		// VersionedParams(&opts, scheme.ParameterCodec).   // 注释掉正常
-		VersionedParams(&opts, runtime.NewParameterCodec(c.crScheme)).
+		VersionedParams(&opts, ParameterCodec).
 		Timeout(timeout).
 		Watch(ctx)
 }
 
-func (c *modelBoxClient) Delete(name string, opts metav1.DeleteOptions) error {
-	ctx := context.Background()
-	return c.restClient.
-		Delete().
+// Create takes the representation of a modelBox and creates it.  Returns the server's representation of the modelBox, and an error, if there is any.
+func (c *modelBoxes) Create(ctx context.Context, modelBox *modelv1.ModelBox, opts metav1.CreateOptions) (result *modelv1.ModelBox, err error) {
+	result = &modelv1.ModelBox{}
+	err = c.client.Post().
+		Namespace(c.ns).
+		Resource("modelboxes").
+		VersionedParams(&opts, ParameterCodec).
+		Body(modelBox).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Update takes the representation of a modelBox and updates it. Returns the server's representation of the modelBox, and an error, if there is any.
+func (c *modelBoxes) Update(ctx context.Context, modelBox *modelv1.ModelBox, opts metav1.UpdateOptions) (result *modelv1.ModelBox, err error) {
+	result = &modelv1.ModelBox{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("modelboxes").
+		Name(modelBox.Name).
+		VersionedParams(&opts, ParameterCodec).
+		Body(modelBox).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// UpdateStatus was generated because the type contains a Status member.
+func (c *modelBoxes) UpdateStatus(ctx context.Context, modelBox *modelv1.ModelBox, opts metav1.UpdateOptions) (result *modelv1.ModelBox, err error) {
+	result = &modelv1.ModelBox{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("modelboxes").
+		Name(modelBox.Name).
+		SubResource("status").
+		VersionedParams(&opts, ParameterCodec).
+		Body(modelBox).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Delete takes name of the modelBox and deletes it. Returns an error if one occurs.
+func (c *modelBoxes) Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return c.client.Delete().
 		Namespace(c.ns).
 		Resource("modelboxes").
 		Name(name).
@@ -101,3 +142,34 @@ func (c *modelBoxClient) Delete(name string, opts metav1.DeleteOptions) error {
 		Do(ctx).
 		Error()
 }
+
+// DeleteCollection deletes a collection of objects.
+func (c *modelBoxes) DeleteCollection(ctx context.Context, opts metav1.DeleteOptions, listOpts metav1.ListOptions) error {
+	var timeout time.Duration
+	if listOpts.TimeoutSeconds != nil {
+		timeout = time.Duration(*listOpts.TimeoutSeconds) * time.Second
+	}
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("modelboxes").
+		VersionedParams(&listOpts, ParameterCodec).
+		Timeout(timeout).
+		Body(&opts).
+		Do(ctx).
+		Error()
+}
+
+// Patch applies the patch and returns the patched modelBox.
+func (c *modelBoxes) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (result *modelv1.ModelBox, err error) {
+	result = &modelv1.ModelBox{}
+	err = c.client.Patch(pt).
+		Namespace(c.ns).
+		Resource("modelboxes").
+		Name(name).
+		SubResource(subresources...).
+		VersionedParams(&opts, ParameterCodec).
+		Body(data).
+		Do(ctx).
+		Into(result)
+	return
+}
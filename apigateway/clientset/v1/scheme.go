@@ -2,24 +2,29 @@ package v1
 
 import (
 	modelboxv1 "github.com/sharelinuxs/my-first-opeartor/api/v1"
-	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 )
 
 var SchemeBuilder = runtime.SchemeBuilder{
 	modelboxv1.AddToScheme,
 }
 
-func newCRScheme(schemes ...func(scheme *runtime.Scheme) error) (*runtime.Scheme, error) {
-	sc := runtime.NewScheme()
-	schemeBuilder := &runtime.SchemeBuilder{}
+// AddToScheme adds all types of this clientset into the given scheme.
+var AddToScheme = SchemeBuilder.AddToScheme
 
-	for _, s := range schemes {
-		schemeBuilder.Register(s)
-	}
-	if err := schemeBuilder.AddToScheme(sc); err != nil {
-		logrus.Errorf("failed to add scheme, err: %v", err)
-		return nil, err
-	}
-	return sc, nil
+// Scheme、Codecs、ParameterCodec 在包初始化时构建一次, 所有 ModelBox 客户端共用
+var (
+	Scheme         = runtime.NewScheme()
+	Codecs         = serializer.NewCodecFactory(Scheme)
+	ParameterCodec = runtime.NewParameterCodec(Scheme)
+)
+
+func init() {
+	// ListOptions/GetOptions 等参数需要注册到 "v1" 下才能被 ParameterCodec 编码
+	metav1.AddToGroupVersion(Scheme, schema.GroupVersion{Version: "v1"})
+	utilruntime.Must(AddToScheme(Scheme))
 }
@@ -0,0 +1,166 @@
+package informers
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+
+	modelv1 "github.com/sharelinuxs/my-first-opeartor/api/v1"
+	"github.com/sharelinuxs/my-first-opeartor/apigateway/clientset/fake"
+)
+
+func newModelBox(namespace, name string, labels map[string]string) *modelv1.ModelBox {
+	return &modelv1.ModelBox{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: labels},
+		Spec:       modelv1.ModelBoxSpec{Image: "img:1"},
+	}
+}
+
+func TestModelBoxLister(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		newModelBox("default", "resnet", map[string]string{"team": "cv"}),
+		newModelBox("default", "bert", map[string]string{"team": "nlp"}),
+		newModelBox("ml", "llama", map[string]string{"team": "nlp"}),
+	)
+	factory := NewSharedInformerFactory(client, 0)
+	lister := factory.Model().V1().ModelBoxes().Lister()
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	factory.Start(stopCh)
+	for typ, synced := range factory.WaitForCacheSync(stopCh) {
+		if !synced {
+			t.Fatalf("informer for %v not synced", typ)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		namespace string
+		selector  string
+		want      int
+	}{
+		{name: "all namespaces", selector: "", want: 3},
+		{name: "label selector", selector: "team=nlp", want: 2},
+		{name: "namespace", namespace: "default", want: 2},
+		{name: "namespace and label selector", namespace: "default", selector: "team=nlp", want: 1},
+		{name: "empty namespace", namespace: "kube-system", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selector, err := labels.Parse(tt.selector)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []*modelv1.ModelBox
+			if tt.namespace == "" {
+				got, err = lister.List(selector)
+			} else {
+				got, err = lister.ModelBoxes(tt.namespace).List(selector)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != tt.want {
+				t.Errorf("got %d ModelBoxes, want %d", len(got), tt.want)
+			}
+		})
+	}
+
+	got, err := lister.ModelBoxes("ml").Get("llama")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Spec.Image != "img:1" {
+		t.Errorf("got image %q, want img:1", got.Spec.Image)
+	}
+	if _, err := lister.ModelBoxes("default").Get("llama"); !errors.IsNotFound(err) {
+		t.Errorf("got error %v, want NotFound", err)
+	}
+}
+
+func TestModelBoxInformerEvents(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	// fake clientset 不会补发 List 与 Watch 之间的事件, 等 Watch 建立后再创建对象
+	watcherStarted := make(chan struct{})
+	var once sync.Once
+	client.PrependWatchReactor("*", func(action clienttesting.Action) (bool, watch.Interface, error) {
+		w, err := client.Tracker().Watch(action.GetResource(), action.GetNamespace())
+		if err != nil {
+			return false, nil, err
+		}
+		once.Do(func() { close(watcherStarted) })
+		return true, w, nil
+	})
+	factory := NewSharedInformerFactoryWithOptions(client, 0, WithNamespace("default"))
+	informer := factory.Model().V1().ModelBoxes()
+
+	added := make(chan string, 2)
+	deleted := make(chan string, 2)
+	informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			added <- obj.(*modelv1.ModelBox).Name
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			deleted <- obj.(*modelv1.ModelBox).Name
+		},
+	})
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	factory.Start(stopCh)
+	factory.WaitForCacheSync(stopCh)
+	<-watcherStarted
+
+	ctx := context.Background()
+	// 其他命名空间中的 ModelBox 不会进入缓存
+	if _, err := client.ModelV1().ModelBoxes("ml").Create(ctx, newModelBox("ml", "llama", nil), metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ModelV1().ModelBoxes("default").Create(ctx, newModelBox("default", "resnet", nil), metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case name := <-added:
+		if name != "resnet" {
+			t.Errorf("got add event for %q, want resnet", name)
+		}
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatal("timed out waiting for add event")
+	}
+	if _, err := informer.Lister().ModelBoxes("default").Get("resnet"); err != nil {
+		t.Errorf("lister: %v", err)
+	}
+
+	if err := client.ModelV1().ModelBoxes("default").Delete(ctx, "resnet", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case name := <-deleted:
+		if name != "resnet" {
+			t.Errorf("got delete event for %q, want resnet", name)
+		}
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatal("timed out waiting for delete event")
+	}
+	if _, err := informer.Lister().ModelBoxes("default").Get("resnet"); !errors.IsNotFound(err) {
+		t.Errorf("got error %v after delete, want NotFound", err)
+	}
+	select {
+	case name := <-added:
+		t.Errorf("unexpected add event for %q", name)
+	default:
+	}
+}
@@ -0,0 +1,27 @@
+package v1
+
+import (
+	internalinterfaces "github.com/sharelinuxs/my-first-opeartor/apigateway/informers/internalinterfaces"
+)
+
+// Interface provides access to all the informers in this group version.
+type Interface interface {
+	// ModelBoxes returns a ModelBoxInformer.
+	ModelBoxes() ModelBoxInformer
+}
+
+type version struct {
+	factory          internalinterfaces.SharedInformerFactory
+	namespace        string
+	tweakListOptions internalinterfaces.TweakListOptionsFunc
+}
+
+// New returns a new Interface.
+func New(f internalinterfaces.SharedInformerFactory, namespace string, tweakListOptions internalinterfaces.TweakListOptionsFunc) Interface {
+	return &version{factory: f, namespace: namespace, tweakListOptions: tweakListOptions}
+}
+
+// ModelBoxes returns a ModelBoxInformer.
+func (v *version) ModelBoxes() ModelBoxInformer {
+	return &modelBoxInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
+}
@@ -0,0 +1,73 @@
+package v1
+
+import (
+	"context"
+	time "time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+	watch "k8s.io/apimachinery/pkg/watch"
+	cache "k8s.io/client-go/tools/cache"
+
+	modelv1 "github.com/sharelinuxs/my-first-opeartor/api/v1"
+	clientset "github.com/sharelinuxs/my-first-opeartor/apigateway/clientset"
+	internalinterfaces "github.com/sharelinuxs/my-first-opeartor/apigateway/informers/internalinterfaces"
+	listersv1 "github.com/sharelinuxs/my-first-opeartor/apigateway/listers/v1"
+)
+
+// ModelBoxInformer provides access to a shared informer and lister for
+// ModelBoxes.
+type ModelBoxInformer interface {
+	Informer() cache.SharedIndexInformer
+	Lister() listersv1.ModelBoxLister
+}
+
+type modelBoxInformer struct {
+	factory          internalinterfaces.SharedInformerFactory
+	tweakListOptions internalinterfaces.TweakListOptionsFunc
+	namespace        string
+}
+
+// NewModelBoxInformer constructs a new informer for ModelBox type.
+// Always prefer using an informer factory to get a shared informer instead of getting an independent
+// one. This reduces memory footprint and number of connections to the server.
+func NewModelBoxInformer(client clientset.Interface, namespace string, resyncPeriod time.Duration, indexers cache.Indexers) cache.SharedIndexInformer {
+	return NewFilteredModelBoxInformer(client, namespace, resyncPeriod, indexers, nil)
+}
+
+// NewFilteredModelBoxInformer constructs a new informer for ModelBox type.
+// Always prefer using an informer factory to get a shared informer instead of getting an independent
+// one. This reduces memory footprint and number of connections to the server.
+func NewFilteredModelBoxInformer(client clientset.Interface, namespace string, resyncPeriod time.Duration, indexers cache.Indexers, tweakListOptions internalinterfaces.TweakListOptionsFunc) cache.SharedIndexInformer {
+	return cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				if tweakListOptions != nil {
+					tweakListOptions(&options)
+				}
+				return client.ModelV1().ModelBoxes(namespace).List(context.TODO(), options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				if tweakListOptions != nil {
+					tweakListOptions(&options)
+				}
+				return client.ModelV1().ModelBoxes(namespace).Watch(context.TODO(), options)
+			},
+		},
+		&modelv1.ModelBox{},
+		resyncPeriod,
+		indexers,
+	)
+}
+
+func (f *modelBoxInformer) defaultInformer(client clientset.Interface, resyncPeriod time.Duration) cache.SharedIndexInformer {
+	return NewFilteredModelBoxInformer(client, f.namespace, resyncPeriod, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}, f.tweakListOptions)
+}
+
+func (f *modelBoxInformer) Informer() cache.SharedIndexInformer {
+	return f.factory.InformerFor(&modelv1.ModelBox{}, f.defaultInformer)
+}
+
+func (f *modelBoxInformer) Lister() listersv1.ModelBoxLister {
+	return listersv1.NewModelBoxLister(f.Informer().GetIndexer())
+}
@@ -0,0 +1,9 @@
+package v1
+
+// ModelBoxListerExpansion allows custom methods to be added to
+// ModelBoxLister.
+type ModelBoxListerExpansion interface{}
+
+// ModelBoxNamespaceListerExpansion allows custom methods to be added to
+// ModelBoxNamespaceLister.
+type ModelBoxNamespaceListerExpansion interface{}
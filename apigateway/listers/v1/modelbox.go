@@ -0,0 +1,82 @@
+package v1
+
+import (
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+
+	modelv1 "github.com/sharelinuxs/my-first-opeartor/api/v1"
+)
+
+// ModelBoxLister helps list ModelBoxes.
+// All objects returned here must be treated as read-only.
+type ModelBoxLister interface {
+	// List lists all ModelBoxes in the indexer.
+	// Objects returned here must be treated as read-only.
+	List(selector labels.Selector) (ret []*modelv1.ModelBox, err error)
+	// ModelBoxes returns an object that can list and get ModelBoxes.
+	ModelBoxes(namespace string) ModelBoxNamespaceLister
+	ModelBoxListerExpansion
+}
+
+// modelBoxLister implements the ModelBoxLister interface.
+type modelBoxLister struct {
+	indexer cache.Indexer
+}
+
+// NewModelBoxLister returns a new ModelBoxLister.
+func NewModelBoxLister(indexer cache.Indexer) ModelBoxLister {
+	return &modelBoxLister{indexer: indexer}
+}
+
+// List lists all ModelBoxes in the indexer.
+func (s *modelBoxLister) List(selector labels.Selector) (ret []*modelv1.ModelBox, err error) {
+	err = cache.ListAll(s.indexer, selector, func(m interface{}) {
+		ret = append(ret, m.(*modelv1.ModelBox))
+	})
+	return ret, err
+}
+
+// ModelBoxes returns an object that can list and get ModelBoxes.
+func (s *modelBoxLister) ModelBoxes(namespace string) ModelBoxNamespaceLister {
+	return modelBoxNamespaceLister{indexer: s.indexer, namespace: namespace}
+}
+
+// ModelBoxNamespaceLister helps list and get ModelBoxes.
+// All objects returned here must be treated as read-only.
+type ModelBoxNamespaceLister interface {
+	// List lists all ModelBoxes in the indexer for a given namespace.
+	// Objects returned here must be treated as read-only.
+	List(selector labels.Selector) (ret []*modelv1.ModelBox, err error)
+	// Get retrieves the ModelBox from the indexer for a given namespace and name.
+	// Objects returned here must be treated as read-only.
+	Get(name string) (*modelv1.ModelBox, error)
+	ModelBoxNamespaceListerExpansion
+}
+
+// modelBoxNamespaceLister implements the ModelBoxNamespaceLister
+// interface.
+type modelBoxNamespaceLister struct {
+	indexer   cache.Indexer
+	namespace string
+}
+
+// List lists all ModelBoxes in the indexer for a given namespace.
+func (s modelBoxNamespaceLister) List(selector labels.Selector) (ret []*modelv1.ModelBox, err error) {
+	err = cache.ListAllByNamespace(s.indexer, s.namespace, selector, func(m interface{}) {
+		ret = append(ret, m.(*modelv1.ModelBox))
+	})
+	return ret, err
+}
+
+// Get retrieves the ModelBox from the indexer for a given namespace and name.
+func (s modelBoxNamespaceLister) Get(name string) (*modelv1.ModelBox, error) {
+	obj, exists, err := s.indexer.GetByKey(s.namespace + "/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.NewNotFound(modelv1.GroupVersion.WithResource("modelboxes").GroupResource(), name)
+	}
+	return obj.(*modelv1.ModelBox), nil
+}
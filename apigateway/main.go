@@ -2,134 +2,39 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"flag"
 	"fmt"
-
-	"github.com/sirupsen/logrus"
-
-	k8serrors "k8s.io/apimachinery/pkg/api/errors"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/apimachinery/pkg/runtime"
-
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
+	"time"
 
-	//corev1 "k8s.io/api/core/v1"
-	"sigs.k8s.io/controller-runtime/pkg/client"
-	//"sigs.k8s.io/controller-runtime/pkg/client/config"
-
-	//metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/apimachinery/pkg/runtime/serializer"
-	"k8s.io/client-go/kubernetes/scheme"
+	"github.com/sirupsen/logrus"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 
-	modelboxv1 "github.com/sharelinuxs/my-first-opeartor/api/v1"
-	clientsetv1 "github.com/sharelinuxs/my-first-opeartor/apigateway/clientset/v1"
+	"github.com/sharelinuxs/my-first-opeartor/apigateway/auth"
+	clientset "github.com/sharelinuxs/my-first-opeartor/apigateway/clientset"
+	"github.com/sharelinuxs/my-first-opeartor/apigateway/server"
 )
 
-var SchemeBuilder = runtime.SchemeBuilder{
-	modelboxv1.AddToScheme,
-}
-
 func main() {
-	//ctx := context.Background()
-	var err error
-	var config *rest.Config
-	// inCluster (Pod)、kubeconfig (kubectl)
-	var kubeconfig *string
-
-	if home := homeDir(); home != "" {
-		kubeconfig = flag.String("kubeconfig", filepath.Join(home, ".kube", "config"), "(optional) absolute path to the kubeconfig file")
-	} else {
-		kubeconfig = flag.String(
-			"kubeconfig", "", "absolute path to the kubeconfig file")
-	}
-	flag.Parse()
-
-	// 使用ServiceAccount创建集群配置(InCluster模式) 需要去配置对应的RBAC权限， 默认的sa是default没有获取deployments的list权限
-	if config, err = rest.InClusterConfig(); err != nil {
-		// 使用 kubeconfig 文件来创建集群配置
-		if config, err = clientcmd.BuildConfigFromFlags("", *kubeconfig); err != nil {
-			panic(err.Error())
-		}
-	}
-	crdClientSet, err := clientsetv1.NewForConfig(config)
-	if err != nil {
-		panic(err)
-	}
-
-	// TODO: GET CR 优雅方式
-	//modelBox, err := crdClientSet.ModelBoxes("default").Get("modelbox-sample0", metav1.GetOptions{})
-	//if err != nil {
-	//	panic(err)
-	//}
-	//
-	//fmt.Printf("graceful modelBox found: %#+v\n", modelBox)
-	//
-	//rawJson, err :=  json.Marshal(modelBox)
-	//if err != nil {
-	//	fmt.Printf("modelBoxes json.Marshal: %v\n", err)
-	//}
-	//fmt.Printf("modelBoxes rawjson: %s", string(rawJson))
-
-	// TODO: List CR 优雅方式
-	//modelBoxes, err := crdClientSet.ModelBoxes("default").List(metav1.ListOptions{})
-	//if err != nil {
-	//	panic(err)
-	//}
-	//fmt.Printf("graceful modelBoxes found: %#+v\n", modelBoxes)
-
-	// TODO: CREATE CR 优雅方式
-	aStr := `{
-    "apiVersion": "model.github.com/v1",
-    "kind": "ModelBox",
-    "metadata": {
-     "name":"modelbox-sample11",
-     "namespace":"default"
-    },
-    "spec": {
-     "image": "nginx:1.7.9",
-     "modelFileURL": "https://model-management.s3.cn-north-1.aws.com/model/example-model.zip",
-     "name": "nginx",
-     "ports": [{
-         "name": "app-port",
-         "port": 80,
-         "targetPort": 80
-     }],
-     "replicas": 1,
-     "resourceType": "small",
-     "rollingUpdate": "30%",
-     "serviceType": "ClusterIP"
-    	}
-	}`
-	mb := modelboxv1.ModelBox{}
-	err = json.Unmarshal([]byte(aStr), &mb)
-	modelBox, err := crdClientSet.ModelBoxes("default").Create(&mb, metav1.CreateOptions{})
-	if err != nil {
-		panic(err)
-	}
-	fmt.Printf("graceful modelBox Create found: %#+v\n", modelBox)
-
-	// TODO: Delete CR 优雅方式
-	//err = crdClientSet.ModelBoxes("default").Delete("modelbox-sample0" ,metav1.DeleteOptions{})
-	//if err != nil {
-	//	panic(err)
-	//}
-	//fmt.Printf("graceful modelBoxes Delete: %s", "name")
-
-}
-
-// 第一种调用方式无异常，可以获取创建的CR资源列表
-func main0() {
-	ctx := context.Background()
 	var err error
 	var config *rest.Config
 	// inCluster (Pod)、kubeconfig (kubectl)
 	var kubeconfig *string
+	var bindAddress string
+	var shutdownTimeout time.Duration
+	var insecureSkipAuth bool
+	var tokenReview bool
+	var tokenCacheTTL time.Duration
+	var oidcOpts auth.OIDCOptions
+	var inferenceOpts server.InferenceOptions
+	var disableInference bool
 
 	if home := homeDir(); home != "" {
 		kubeconfig = flag.String("kubeconfig", filepath.Join(home, ".kube", "config"), "(optional) absolute path to the kubeconfig file")
@@ -137,259 +42,124 @@ func main0() {
 		kubeconfig = flag.String(
 			"kubeconfig", "", "absolute path to the kubeconfig file")
 	}
+	flag.StringVar(&bindAddress, "bind-address", ":8090", "The address the apigateway HTTP server binds to.")
+	flag.DurationVar(&shutdownTimeout, "shutdown-timeout", 30*time.Second, "How long to wait for in-flight requests when shutting down.")
+	flag.BoolVar(&insecureSkipAuth, "insecure-skip-auth", false,
+		"Skip authentication and access the API server with the apigateway's own credentials. Only for local development.")
+	flag.BoolVar(&tokenReview, "authentication-token-review", true,
+		"Authenticate bearer tokens with the Kubernetes TokenReview API.")
+	flag.DurationVar(&tokenCacheTTL, "authentication-token-cache-ttl", 10*time.Second,
+		"How long to cache successful TokenReview results.")
+	flag.StringVar(&oidcOpts.IssuerURL, "oidc-issuer-url", "",
+		"The URL of the OpenID issuer, only HTTPS scheme will be accepted. If set, OIDC ID tokens are verified locally.")
+	flag.StringVar(&oidcOpts.ClientID, "oidc-client-id", "", "The client ID for the OpenID Connect client, must be set if oidc-issuer-url is set.")
+	flag.StringVar(&oidcOpts.CAFile, "oidc-ca-file", "", "The CA that signed the OpenID issuer's certificate. Defaults to the host's root CAs.")
+	flag.StringVar(&oidcOpts.UsernameClaim, "oidc-username-claim", "sub", "The OpenID claim to use as the user name.")
+	flag.StringVar(&oidcOpts.UsernamePrefix, "oidc-username-prefix", "",
+		"Prefix prepended to username claims. Defaults to the issuer URL followed by '#' unless the claim is 'email'; '-' disables prefixing.")
+	flag.StringVar(&oidcOpts.GroupsClaim, "oidc-groups-claim", "", "The OpenID claim to use as the user's groups.")
+	flag.StringVar(&oidcOpts.GroupsPrefix, "oidc-groups-prefix", "", "Prefix prepended to group claims.")
+	flag.BoolVar(&disableInference, "disable-inference", false, "Disable the /v1/models/{namespace}/{name}:predict inference proxy.")
+	flag.StringVar(&inferenceOpts.ClusterDomain, "cluster-domain", "cluster.local", "The cluster domain used to resolve ModelBox Services.")
+	flag.DurationVar(&inferenceOpts.Timeout, "inference-timeout", 60*time.Second, "Timeout of an inference request including retries, zero means no timeout.")
+	flag.IntVar(&inferenceOpts.Retries, "inference-retries", 3, "How many times to retry an inference request when connecting to the model fails.")
+	flag.DurationVar(&inferenceOpts.RetryBackoff, "inference-retry-backoff", 100*time.Millisecond, "Wait before the first retry, doubled for each following retry.")
+	flag.IntVar(&inferenceOpts.MaxConcurrency, "inference-max-concurrency", 100,
+		"Maximum number of concurrent inference requests per ModelBox, further requests get 429. Zero means no limit.")
+	flag.Int64Var(&inferenceOpts.MaxRequestBytes, "inference-max-request-bytes", 32*1024*1024, "Maximum size of an inference request body.")
+	flag.DurationVar(&inferenceOpts.ActivationTimeout, "activation-timeout", 5*time.Minute,
+		"How long requests to a ModelBox scaled to zero wait for its pods to become ready.")
+	flag.DurationVar(&inferenceOpts.ActivityReportInterval, "activity-report-interval", time.Minute,
+		"Minimum interval between two reports of inference traffic for the same ModelBox, capped at half of its idleTimeout.")
 	flag.Parse()
 
-	// 使用ServiceAccount创建集群配置(InCluster模式) 需要去配置对应的RBAC权限， 默认的sa是default没有获取deployments的list权限
+	// 使用ServiceAccount创建集群配置(InCluster模式) 需要去配置对应的RBAC权限， 默认的sa是default没有获取modelboxes的权限
 	if config, err = rest.InClusterConfig(); err != nil {
 		// 使用 kubeconfig 文件来创建集群配置
 		if config, err = clientcmd.BuildConfigFromFlags("", *kubeconfig); err != nil {
-			panic(err.Error())
+			logrus.Fatalf("unable to load kubernetes config: %v", err)
 		}
 	}
 
-	err = modelboxv1.AddToScheme(scheme.Scheme)
+	// apigateway 自身身份的客户端, 用于认证调用方以及上报推理流量
+	modelClient, err := clientset.NewForConfig(config)
 	if err != nil {
-		fmt.Printf("modelv1.AddToScheme : %v", err)
+		logrus.Fatalf("unable to create modelbox clientset: %v", err)
 	}
-
-	crdConfig := *config
-	crdConfig.ContentConfig.GroupVersion = &schema.GroupVersion{Group: modelboxv1.GroupName, Version: modelboxv1.Version}
-	crdConfig.APIPath = "/apis"
-	crdConfig.NegotiatedSerializer = serializer.WithoutConversionCodecFactory{CodecFactory: scheme.Codecs}
-	//crdConfig.NegotiatedSerializer = serializer.DirectCodecFactory{CodecFactory: scheme.Codecs}
-	crdConfig.UserAgent = rest.DefaultKubernetesUserAgent()
-
-	crdRestClient, err := rest.UnversionedRESTClientFor(&crdConfig)
+	kubeClient, err := kubernetes.NewForConfig(config)
 	if err != nil {
-		panic(err)
-	}
-
-	result := modelboxv1.ModelBoxList{}
-	err = crdRestClient.
-		Get().
-		Resource("ModelBoxes").
-		Do(ctx).
-		Into(&result)
-
-	if err != nil {
-		fmt.Println("crdRestClient err:", err)
-	}
-
-	for _, item := range result.Items {
-		fmt.Printf("Name: %s Image: %s\n", item.Name, item.Spec.Image)
+		logrus.Fatalf("unable to create kubernetes clientset: %v", err)
 	}
-}
 
-func main1() {
-	//ctx := context.Background()
-	var err error
-	var config *rest.Config
-	// inCluster (Pod)、kubeconfig (kubectl)
-	var kubeconfig *string
-
-	if home := homeDir(); home != "" {
-		kubeconfig = flag.String("kubeconfig", filepath.Join(home, ".kube", "config"), "(optional) absolute path to the kubeconfig file")
+	var clients server.ClientProvider
+	var authenticator auth.TokenAuthenticator
+	if insecureSkipAuth {
+		logrus.Warn("authentication is disabled, all requests use the apigateway's own credentials")
+		clients = server.NewStaticClientProvider(modelClient)
 	} else {
-		kubeconfig = flag.String(
-			"kubeconfig", "", "absolute path to the kubeconfig file")
-	}
-	flag.Parse()
-
-	// 使用ServiceAccount创建集群配置(InCluster模式) 需要去配置对应的RBAC权限， 默认的sa是default没有获取deployments的list权限
-	if config, err = rest.InClusterConfig(); err != nil {
-		// 使用 kubeconfig 文件来创建集群配置
-		if config, err = clientcmd.BuildConfigFromFlags("", *kubeconfig); err != nil {
-			panic(err.Error())
+		if authenticator, err = newAuthenticator(kubeClient, tokenReview, tokenCacheTTL, oidcOpts); err != nil {
+			logrus.Fatalf("unable to create authenticator: %v", err)
 		}
-	}
-	// TODO: List CR 优雅方式
-	crdClientSet, err := clientsetv1.NewForConfig(config)
-	if err != nil {
-		panic(err)
-	}
-
-	modelBoxes, err := crdClientSet.ModelBoxes("default").List(metav1.ListOptions{})
-	if err != nil {
-		panic(err)
-	}
-
-	fmt.Printf("graceful modelBoxes found: %+v\n", modelBoxes)
-
-	fmt.Println("1 ====================================================================================================")
-
-
-	cl, err := client.New(config, client.Options{})
-	if err != nil {
-		fmt.Println("failed to create client")
-		os.Exit(1)
-	}
-
-	// TODO: List CR 非优雅方式
-	modelBoxList := &modelboxv1.ModelBoxList{}
-
-	err = cl.List(context.Background(), modelBoxList, client.InNamespace("default"))
-	if err != nil {
-		fmt.Printf("failed to list modelBox in namespace default: %v\n", err)
-		os.Exit(1)
-	}
-
-	fmt.Println("2 ====================================================================================================")
-
-
-	//u := &unstructured.UnstructuredList{}
-	//u.SetGroupVersionKind(schema.GroupVersionKind{
-	//	Group:   "model.github.com",
-	//	Kind:    "ModelBoxList",
-	//	Version: "v1",
-	//})
-	//_ = cl.List(context.Background(), u, client.InNamespace("default"))
-	//for _, item := range u.Items {
-	//	fmt.Printf("item: %v\n", item)
-	//}
-
-	// TODO: 创建CR
-	aStr := `{
-    "apiVersion": "model.github.com/v1",
-    "kind": "ModelBox",
-    "metadata": {
-       "name":"modelbox-sample0",
-       "namespace":"default"
-    },
-    "spec": {
-       "image": "nginx:1.7.9",
-       "modelFileURL": "https://model-management.s3.cn-north-1.aws.com/model/example-model.zip",
-       "name": "nginx",
-       "ports": [{
-           "name": "app-port",
-           "port": 80,
-           "targetPort": 80
-       }],
-       "replicas": 1,
-       "resourceType": "small",
-       "rollingUpdate": "30%",
-       "serviceType": "ClusterIP"
-    	}
-	}`
-	m := make(map[string]interface{})
-	err = json.Unmarshal([]byte(aStr), &m)
-
-	u1 := &unstructured.Unstructured{Object: m}
-
-	u1.SetGroupVersionKind(schema.GroupVersionKind{
-		Group:   "model.github.com",
-		Kind:    "ModelBox",
-		Version: "v1",
-	})
-	err = cl.Create(context.Background(), u1)
-	if err != nil {
-		fmt.Printf("cl.Create: %v\n", err)
-	}
-}
-
-func main2() {
-	//ctx := context.Background()
-	var err error
-	var config *rest.Config
-	// inCluster (Pod)、kubeconfig (kubectl)
-	var kubeconfig *string
-
-	if home := homeDir(); home != "" {
-		kubeconfig = flag.String("kubeconfig", filepath.Join(home, ".kube", "config"), "(optional) absolute path to the kubeconfig file")
-	} else {
-		kubeconfig = flag.String(
-			"kubeconfig", "", "absolute path to the kubeconfig file")
-	}
-	flag.Parse()
-
-	// 使用ServiceAccount创建集群配置(InCluster模式) 需要去配置对应的RBAC权限， 默认的sa是default没有获取deployments的list权限
-	if config, err = rest.InClusterConfig(); err != nil {
-		// 使用 kubeconfig 文件来创建集群配置
-		if config, err = clientcmd.BuildConfigFromFlags("", *kubeconfig); err != nil {
-			panic(err.Error())
+		// 以调用方身份访问 API server, 由 Kubernetes RBAC 限制其可以操作的 namespace
+		clients = server.NewImpersonatingClientProvider(config)
+	}
+
+	var inference *server.InferenceProxy
+	if !disableInference {
+		inference = server.NewInferenceProxy(inferenceOpts, modelClient, kubeClient)
+	}
+
+	// watch 长连接不会随 Shutdown 结束, 通过 BaseContext 在关闭时通知它们退出
+	baseCtx, cancelStreams := context.WithCancel(context.Background())
+	httpServer := &http.Server{
+		Addr:    bindAddress,
+		Handler: server.NewServer(clients, authenticator, inference),
+		BaseContext: func(net.Listener) context.Context {
+			return baseCtx
+		},
+	}
+	httpServer.RegisterOnShutdown(cancelStreams)
+
+	// 收到 SIGINT/SIGTERM 后停止接收新请求, 并等待处理中的请求完成
+	idleConnsClosed := make(chan struct{})
+	go func() {
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+		<-sigCh
+		logrus.Info("shutting down apigateway")
+
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := httpServer.Shutdown(ctx); err != nil {
+			logrus.Errorf("graceful shutdown failed: %v", err)
 		}
-	}
-	// TODO: List CR 优雅方式
-	crdClientSet, err := clientsetv1.NewForConfig(config)
-	if err != nil {
-		panic(err)
-	}
-
-	aStr := `{
-    "apiVersion": "model.github.com/v1",
-    "kind": "ModelBox",
-    "metadata": {
-       "name":"modelbox-sample00",
-       "namespace":"default"
-    },
-    "spec": {
-       "image": "nginx:1.7.9",
-       "modelFileURL": "https://model-management.s3.cn-north-1.aws.com/model/example-model.zip",
-       "name": "nginx",
-       "ports": [{
-           "name": "app-port",
-           "port": 80,
-           "targetPort": 80
-       }],
-       "replicas": 1,
-       "resourceType": "small",
-       "rollingUpdate": "30%",
-       "serviceType": "ClusterIP"
-    	}
-	}`
-	m := modelboxv1.ModelBox{}
-	err = json.Unmarshal([]byte(aStr), &m)
+		close(idleConnsClosed)
+	}()
 
-	modelBoxes, err := crdClientSet.ModelBoxes("default").Create(&m, metav1.CreateOptions{})
-	if err != nil {
-		panic(err)
+	logrus.Infof("starting apigateway on %s", bindAddress)
+	if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		logrus.Fatalf("apigateway server: %v", err)
 	}
-	fmt.Printf("modelBoxes found: %+v\n", modelBoxes)
-
+	<-idleConnsClosed
 }
 
-func main3() {
-	//ctx := context.Background()
-	var err error
-	var config *rest.Config
-	// inCluster (Pod)、kubeconfig (kubectl)
-	var kubeconfig *string
-
-	if home := homeDir(); home != "" {
-		kubeconfig = flag.String("kubeconfig", filepath.Join(home, ".kube", "config"), "(optional) absolute path to the kubeconfig file")
-	} else {
-		kubeconfig = flag.String(
-			"kubeconfig", "", "absolute path to the kubeconfig file")
-	}
-	flag.Parse()
-
-	// 使用ServiceAccount创建集群配置(InCluster模式) 需要去配置对应的RBAC权限， 默认的sa是default没有获取deployments的list权限
-	if config, err = rest.InClusterConfig(); err != nil {
-		// 使用 kubeconfig 文件来创建集群配置
-		if config, err = clientcmd.BuildConfigFromFlags("", *kubeconfig); err != nil {
-			panic(err.Error())
+// newAuthenticator 按配置组合 OIDC 与 TokenReview 认证器, OIDC 在本地校验, 优先尝试
+func newAuthenticator(kubeClient kubernetes.Interface, tokenReview bool, tokenCacheTTL time.Duration, oidcOpts auth.OIDCOptions) (auth.TokenAuthenticator, error) {
+	var authenticators []auth.TokenAuthenticator
+	if oidcOpts.IssuerURL != "" {
+		oidcAuthenticator, err := auth.NewOIDCAuthenticator(context.Background(), oidcOpts)
+		if err != nil {
+			return nil, err
 		}
+		authenticators = append(authenticators, oidcAuthenticator)
 	}
-
-	// modified
-	mb := modelboxv1.ModelBox{}
-	crCli, err := NewCRClient(config, SchemeBuilder...)
-	if err != nil {
-		panic(err)
+	if tokenReview {
+		authenticators = append(authenticators, auth.NewTokenReviewAuthenticator(kubeClient.AuthenticationV1().TokenReviews(), tokenCacheTTL))
 	}
-
-	// TODO: operator with controller runtime client
-	if err := crCli.Get(context.Background(), client.ObjectKey{
-		Namespace: metav1.NamespaceDefault,
-		Name:      "modelbox-sample0",
-	}, &mb); err != nil {
-		if k8serrors.IsNotFound(err) {
-			logrus.Errorf("resource not found")
-			return
-		}
-		panic(err)
+	if len(authenticators) == 0 {
+		return nil, fmt.Errorf("no authenticator is enabled, set --oidc-issuer-url or --authentication-token-review")
 	}
-
-	fmt.Printf("mb: %#v\n", mb)
+	return auth.NewUnionAuthenticator(authenticators...), nil
 }
 
 func homeDir() string {
@@ -398,24 +168,3 @@ func homeDir() string {
 	}
 	return os.Getenv("USERPROFILE") // windows
 }
-
-func int32Ptr(i int32) *int32 { return &i }
-
-func NewCRClient(rc *rest.Config, schemes ...func(scheme *runtime.Scheme) error) (client.Client, error) {
-	if rc == nil {
-		return nil, fmt.Errorf("failed to get rest.Config")
-	}
-	sc := runtime.NewScheme()
-	schemeBuilder := &runtime.SchemeBuilder{}
-
-	for _, s := range schemes {
-		schemeBuilder.Register(s)
-	}
-
-	if err := schemeBuilder.AddToScheme(sc); err != nil {
-		logrus.Errorf("failed to add scheme, err: %v", err)
-		return nil, err
-	}
-
-	return client.New(rc, client.Options{Scheme: sc})
-}
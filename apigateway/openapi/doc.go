@@ -0,0 +1,7 @@
+// Package openapi 提供 apigateway 的 OpenAPI 3 文档以及基于同一份 schema 的请求校验.
+//
+// ModelBox 的 schema 取自 controller-gen 根据 Go 类型生成的 CRD, 修改 api/v1 后执行
+// make manifests 即可同步更新.
+package openapi
+
+//go:generate go run gen.go
@@ -0,0 +1,69 @@
+// +build ignore
+
+// gen.go 从 CRD 中提取 ModelBox v1 的 openAPIV3Schema, 生成 zz_generated.schema.go
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"strings"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	crdFile         = "../../config/crd/bases/model.github.com_modelboxes.yaml"
+	boilerplateFile = "../../hack/boilerplate.go.txt"
+	outputFile      = "zz_generated.schema.go"
+	version         = "v1"
+)
+
+func main() {
+	data, err := ioutil.ReadFile(crdFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	crd := &apiextensionsv1.CustomResourceDefinition{}
+	if err := yaml.Unmarshal(data, crd); err != nil {
+		log.Fatalf("decode %s: %v", crdFile, err)
+	}
+
+	var schema *apiextensionsv1.JSONSchemaProps
+	for _, v := range crd.Spec.Versions {
+		if v.Name == version && v.Schema != nil {
+			schema = v.Schema.OpenAPIV3Schema
+		}
+	}
+	if schema == nil {
+		log.Fatalf("no openAPIV3Schema found for version %s in %s", version, crdFile)
+	}
+	schemaJSON, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	boilerplate, err := ioutil.ReadFile(boilerplateFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var buf bytes.Buffer
+	buf.Write(boilerplate)
+	buf.WriteString("\n\n// Code generated by gen.go. DO NOT EDIT.\n\n")
+	buf.WriteString("package openapi\n\n")
+	fmt.Fprintf(&buf, "// modelBoxSchemaJSON ModelBox %s 的 openAPIV3Schema, 来自 %s\n", version, strings.TrimPrefix(crdFile, "../../"))
+	// 描述中可能包含反引号, 拆分后拼接
+	fmt.Fprintf(&buf, "const modelBoxSchemaJSON = `%s`\n", strings.Replace(string(schemaJSON), "`", "` + \"`\" + `", -1))
+
+	out, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(outputFile, out, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
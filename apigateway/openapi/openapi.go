@@ -0,0 +1,328 @@
+package openapi
+
+import (
+	"encoding/json"
+	"sync"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+
+	modelv1 "github.com/sharelinuxs/my-first-opeartor/api/v1"
+)
+
+const (
+	// collectionPath 与 apigateway 的 REST 路径一致
+	collectionPath = "/api/v1/namespaces/{namespace}/modelboxes"
+	itemPath       = collectionPath + "/{name}"
+	predictPath    = "/v1/models/{namespace}/{name}:predict"
+)
+
+var (
+	documentOnce sync.Once
+	document     []byte
+	documentErr  error
+)
+
+// object OpenAPI 文档中的 JSON 对象
+type object = map[string]interface{}
+
+// Document 返回 apigateway 的 OpenAPI 3 文档, ModelBox 的 schema 与 CRD 一致
+func Document() ([]byte, error) {
+	documentOnce.Do(func() {
+		document, documentErr = json.MarshalIndent(buildDocument(), "", "  ")
+	})
+	return document, documentErr
+}
+
+func buildDocument() object {
+	return object{
+		"openapi": "3.0.3",
+		"info": object{
+			"title":       "ModelBox API Gateway",
+			"description": "REST API for managing " + modelv1.GroupVersion.String() + " ModelBoxes.",
+			"version":     modelv1.GroupVersion.Version,
+		},
+		"security": []object{{"bearerAuth": []string{}}},
+		"tags":     []object{{"name": modelv1.Kind}},
+		"paths": object{
+			collectionPath: object{
+				"parameters": []object{ref("parameters", "namespace")},
+				"get": operation("listNamespacedModelBox",
+					"List or watch ModelBoxes. Set watch=true, Accept: text/event-stream or upgrade to a WebSocket to receive watch events.",
+					append(listParameters(), ref("parameters", "lastEventID")), nil,
+					object{
+						"200": object{
+							"description": "OK",
+							"content": object{
+								"application/json":  object{"schema": ref("schemas", "ModelBoxList")},
+								"text/event-stream": object{"schema": ref("schemas", "WatchEvent")},
+							},
+						},
+					}),
+				"post": operation("createNamespacedModelBox", "Create a ModelBox.",
+					writeParameters(), jsonBody("ModelBox", true),
+					object{
+						"201": jsonResponse("Created", "ModelBox"),
+						"409": ref("responses", "Status"),
+						"422": ref("responses", "Status"),
+					}),
+			},
+			itemPath: object{
+				"parameters": []object{ref("parameters", "namespace"), ref("parameters", "name")},
+				"get": operation("readNamespacedModelBox", "Read the specified ModelBox.", nil, nil,
+					object{"200": jsonResponse("OK", "ModelBox")}),
+				"put": operation("replaceNamespacedModelBox", "Replace the specified ModelBox.",
+					writeParameters(), jsonBody("ModelBox", true),
+					object{
+						"200": jsonResponse("OK", "ModelBox"),
+						"409": ref("responses", "Status"),
+						"422": ref("responses", "Status"),
+					}),
+				"patch": operation("patchNamespacedModelBox", "Partially update the specified ModelBox.",
+					append(writeParameters(), ref("parameters", "force")),
+					object{
+						"required": true,
+						"content": object{
+							"application/merge-patch+json": object{"schema": ref("schemas", "Patch")},
+							"application/json-patch+json":  object{"schema": ref("schemas", "Patch")},
+							"application/apply-patch+yaml": object{"schema": ref("schemas", "Patch")},
+						},
+					},
+					object{
+						"200": jsonResponse("OK", "ModelBox"),
+						"415": ref("responses", "Status"),
+						"422": ref("responses", "Status"),
+					}),
+				"delete": operation("deleteNamespacedModelBox", "Delete the specified ModelBox.",
+					[]object{ref("parameters", "dryRun")}, jsonBody("DeleteOptions", false),
+					object{"200": jsonResponse("OK", "Status")}),
+			},
+			predictPath: object{
+				"parameters": []object{ref("parameters", "namespace"), ref("parameters", "name")},
+				"post": operation("predictNamespacedModelBox",
+					"Forward an inference request to the Service of the specified ModelBox. The body is passed through unchanged.",
+					nil,
+					object{
+						"required": true,
+						"content":  object{"application/json": object{"schema": object{"type": "object"}}},
+					},
+					object{
+						"200": object{
+							"description": "Response of the model server",
+							"content":     object{"application/json": object{"schema": object{"type": "object"}}},
+						},
+						"413": ref("responses", "Status"),
+						"429": ref("responses", "Status"),
+						"503": ref("responses", "Status"),
+						"504": ref("responses", "Status"),
+					}),
+			},
+		},
+		"components": object{
+			"securitySchemes": object{
+				"bearerAuth": object{
+					"type":         "http",
+					"scheme":       "bearer",
+					"bearerFormat": "JWT",
+					"description":  "Kubernetes ServiceAccount token or OIDC ID token.",
+				},
+			},
+			"parameters": parameters(),
+			"responses": object{
+				"Status": jsonResponse("Error", "Status"),
+			},
+			"schemas": schemas(),
+		},
+	}
+}
+
+// operation 所有操作都可能返回 401/403/404, 统一加上
+func operation(id, summary string, params []object, body object, responses object) object {
+	for _, code := range []string{"400", "401", "403", "404"} {
+		if _, ok := responses[code]; !ok {
+			responses[code] = ref("responses", "Status")
+		}
+	}
+	op := object{
+		"operationId": id,
+		"summary":     summary,
+		"tags":        []string{modelv1.Kind},
+		"responses":   responses,
+	}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+	if body != nil {
+		op["requestBody"] = body
+	}
+	return op
+}
+
+func ref(kind, name string) object {
+	return object{"$ref": "#/components/" + kind + "/" + name}
+}
+
+func jsonBody(schema string, required bool) object {
+	return object{
+		"required": required,
+		"content":  object{"application/json": object{"schema": ref("schemas", schema)}},
+	}
+}
+
+func jsonResponse(description, schema string) object {
+	return object{
+		"description": description,
+		"content":     object{"application/json": object{"schema": ref("schemas", schema)}},
+	}
+}
+
+func listParameters() []object {
+	names := []string{"labelSelector", "fieldSelector", "limit", "continue", "resourceVersion",
+		"timeoutSeconds", "watch", "allowWatchBookmarks"}
+	params := make([]object, 0, len(names))
+	for _, name := range names {
+		params = append(params, ref("parameters", name))
+	}
+	return params
+}
+
+func writeParameters() []object {
+	return []object{ref("parameters", "dryRun"), ref("parameters", "fieldManager")}
+}
+
+func parameters() object {
+	query := func(name, typ, description string) object {
+		return object{"name": name, "in": "query", "description": description, "schema": object{"type": typ}}
+	}
+	path := func(name, description string) object {
+		return object{"name": name, "in": "path", "required": true, "description": description, "schema": object{"type": "string"}}
+	}
+	return object{
+		"namespace":           path("namespace", "Namespace of the ModelBox."),
+		"name":                path("name", "Name of the ModelBox."),
+		"labelSelector":       query("labelSelector", "string", "Label selector to restrict the list of returned objects."),
+		"fieldSelector":       query("fieldSelector", "string", "Field selector to restrict the list of returned objects."),
+		"limit":               query("limit", "integer", "Maximum number of objects to return in a list call."),
+		"continue":            query("continue", "string", "Continue token returned by a previous list call."),
+		"resourceVersion":     query("resourceVersion", "string", "List or resume a watch from the given resourceVersion."),
+		"timeoutSeconds":      query("timeoutSeconds", "integer", "Timeout for the list/watch call."),
+		"watch":               query("watch", "boolean", "Stream newline delimited WatchEvents instead of returning a list."),
+		"allowWatchBookmarks": query("allowWatchBookmarks", "boolean", "Request BOOKMARK events. Always enabled for SSE and WebSocket."),
+		"dryRun":              query("dryRun", "string", "Set to All to validate the request without persisting it."),
+		"fieldManager":        query("fieldManager", "string", "Name of the actor making the change."),
+		"force":               query("force", "boolean", "Force apply requests, taking ownership of conflicting fields."),
+		"lastEventID": object{
+			"name":        "Last-Event-ID",
+			"in":          "header",
+			"description": "resourceVersion to resume an SSE watch from, sent automatically by EventSource.",
+			"schema":      object{"type": "string"},
+		},
+	}
+}
+
+func schemas() object {
+	modelBox := ModelBoxSchema()
+	// CRD 中 metadata 只声明为 object, 替换为 ObjectMeta 以便生成客户端
+	modelBox.Properties["metadata"] = apiextensionsv1.JSONSchemaProps{Ref: stringPtr("#/components/schemas/ObjectMeta")}
+
+	typeMeta := func(props object) object {
+		props["apiVersion"] = object{"type": "string"}
+		props["kind"] = object{"type": "string"}
+		return props
+	}
+	stringMap := object{"type": "object", "additionalProperties": object{"type": "string"}}
+	return object{
+		"ModelBox": modelBox,
+		"ModelBoxList": object{
+			"type":     "object",
+			"required": []string{"items"},
+			"properties": typeMeta(object{
+				"metadata": ref("schemas", "ListMeta"),
+				"items":    object{"type": "array", "items": ref("schemas", "ModelBox")},
+			}),
+		},
+		"ObjectMeta": object{
+			"type": "object",
+			"properties": object{
+				"name":              object{"type": "string"},
+				"generateName":      object{"type": "string"},
+				"namespace":         object{"type": "string"},
+				"uid":               object{"type": "string", "readOnly": true},
+				"resourceVersion":   object{"type": "string"},
+				"generation":        object{"type": "integer", "format": "int64", "readOnly": true},
+				"creationTimestamp": object{"type": "string", "format": "date-time", "readOnly": true},
+				"deletionTimestamp": object{"type": "string", "format": "date-time", "readOnly": true},
+				"labels":            stringMap,
+				"annotations":       stringMap,
+				"finalizers":        object{"type": "array", "items": object{"type": "string"}},
+			},
+			"additionalProperties": true,
+		},
+		"ListMeta": object{
+			"type": "object",
+			"properties": object{
+				"resourceVersion":    object{"type": "string"},
+				"continue":           object{"type": "string"},
+				"remainingItemCount": object{"type": "integer", "format": "int64"},
+			},
+		},
+		"Status": object{
+			"type": "object",
+			"properties": typeMeta(object{
+				"status":  object{"type": "string", "enum": []string{"Success", "Failure"}},
+				"message": object{"type": "string"},
+				"reason":  object{"type": "string"},
+				"code":    object{"type": "integer", "format": "int32"},
+				"details": object{
+					"type": "object",
+					"properties": object{
+						"name":  object{"type": "string"},
+						"group": object{"type": "string"},
+						"kind":  object{"type": "string"},
+						"causes": object{"type": "array", "items": object{
+							"type": "object",
+							"properties": object{
+								"reason":  object{"type": "string"},
+								"message": object{"type": "string"},
+								"field":   object{"type": "string"},
+							},
+						}},
+					},
+				},
+			}),
+		},
+		"WatchEvent": object{
+			"type":        "object",
+			"description": "A watch event. For SSE the event name is the type and the data is the object.",
+			"required":    []string{"type", "object"},
+			"properties": object{
+				"type": object{"type": "string", "enum": []string{"ADDED", "MODIFIED", "DELETED", "BOOKMARK", "ERROR"}},
+				"object": object{
+					"description": "A ModelBox, or a Status for ERROR events.",
+					"oneOf":       []object{ref("schemas", "ModelBox"), ref("schemas", "Status")},
+				},
+			},
+		},
+		"DeleteOptions": object{
+			"type": "object",
+			"properties": typeMeta(object{
+				"gracePeriodSeconds": object{"type": "integer", "format": "int64"},
+				"propagationPolicy":  object{"type": "string", "enum": []string{"Orphan", "Background", "Foreground"}},
+				"dryRun":             object{"type": "array", "items": object{"type": "string"}},
+				"preconditions": object{
+					"type": "object",
+					"properties": object{
+						"uid":             object{"type": "string"},
+						"resourceVersion": object{"type": "string"},
+					},
+				},
+			}),
+		},
+		"Patch": object{
+			"description": "A JSON merge patch, a JSON patch or a server-side apply configuration, depending on the content type.",
+		},
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
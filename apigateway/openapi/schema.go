@@ -0,0 +1,237 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+var modelBoxSchema = mustParseSchema(modelBoxSchemaJSON)
+
+// patterns 缓存 schema 中 pattern 编译后的正则
+var patterns sync.Map
+
+func mustParseSchema(data string) *apiextensionsv1.JSONSchemaProps {
+	schema := &apiextensionsv1.JSONSchemaProps{}
+	if err := json.Unmarshal([]byte(data), schema); err != nil {
+		panic(fmt.Sprintf("invalid generated schema: %v", err))
+	}
+	return schema
+}
+
+// ModelBoxSchema 返回 ModelBox v1 的 OpenAPI v3 schema, 与 CRD 中的 openAPIV3Schema 一致
+func ModelBoxSchema() *apiextensionsv1.JSONSchemaProps {
+	return modelBoxSchema.DeepCopy()
+}
+
+// ValidateModelBox 按 ModelBox 的 schema 校验请求体, obj 需使用 json.Decoder.UseNumber 解码,
+// 以区分整数与浮点数
+func ValidateModelBox(obj interface{}) field.ErrorList {
+	return Validate(modelBoxSchema, obj, nil)
+}
+
+// Validate 按 CRD 结构化 schema 的语义校验 value:
+// 声明了 properties 的对象不允许出现未知字段, 除非设置了 x-kubernetes-preserve-unknown-fields;
+// 只支持 controller-gen 生成的 schema 用到的关键字
+func Validate(schema *apiextensionsv1.JSONSchemaProps, value interface{}, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	// 与 API server 一样, null 视为未设置
+	if value == nil {
+		return allErrs
+	}
+	if schema.XIntOrString {
+		return validateIntOrString(schema, value, fldPath)
+	}
+
+	switch schema.Type {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return append(allErrs, field.Invalid(fldPath, value, "must be an object"))
+		}
+		allErrs = append(allErrs, validateObject(schema, obj, fldPath)...)
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return append(allErrs, field.Invalid(fldPath, value, "must be an array"))
+		}
+		if schema.MinItems != nil && int64(len(items)) < *schema.MinItems {
+			allErrs = append(allErrs, field.Invalid(fldPath, len(items), fmt.Sprintf("must have at least %d items", *schema.MinItems)))
+		}
+		if schema.MaxItems != nil && int64(len(items)) > *schema.MaxItems {
+			allErrs = append(allErrs, field.TooMany(fldPath, len(items), int(*schema.MaxItems)))
+		}
+		if schema.Items != nil && schema.Items.Schema != nil {
+			for i, item := range items {
+				allErrs = append(allErrs, Validate(schema.Items.Schema, item, fldPath.Index(i))...)
+			}
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return append(allErrs, field.Invalid(fldPath, value, "must be a string"))
+		}
+		allErrs = append(allErrs, validateString(schema, s, fldPath)...)
+	case "integer":
+		n, ok := value.(json.Number)
+		if !ok {
+			return append(allErrs, field.Invalid(fldPath, value, "must be an integer"))
+		}
+		i, err := strconv.ParseInt(string(n), 10, 64)
+		if err != nil {
+			return append(allErrs, field.Invalid(fldPath, value, "must be an integer"))
+		}
+		if schema.Format == "int32" && (i < math.MinInt32 || i > math.MaxInt32) {
+			return append(allErrs, field.Invalid(fldPath, i, "must be a 32-bit integer"))
+		}
+		allErrs = append(allErrs, validateNumber(schema, float64(i), fldPath)...)
+	case "number":
+		n, ok := value.(json.Number)
+		if !ok {
+			return append(allErrs, field.Invalid(fldPath, value, "must be a number"))
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return append(allErrs, field.Invalid(fldPath, value, "must be a number"))
+		}
+		allErrs = append(allErrs, validateNumber(schema, f, fldPath)...)
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return append(allErrs, field.Invalid(fldPath, value, "must be a boolean"))
+		}
+	}
+
+	if len(schema.Enum) > 0 {
+		allErrs = append(allErrs, validateEnum(schema, value, fldPath)...)
+	}
+	return allErrs
+}
+
+func validateObject(schema *apiextensionsv1.JSONSchemaProps, obj map[string]interface{}, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	for _, name := range schema.Required {
+		if value, ok := obj[name]; !ok || value == nil {
+			allErrs = append(allErrs, field.Required(fldPath.Child(name), ""))
+		}
+	}
+
+	// 按字段名排序, 保证错误顺序稳定
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	preserveUnknown := schema.XPreserveUnknownFields != nil && *schema.XPreserveUnknownFields
+	for _, name := range names {
+		childPath := fldPath.Child(name)
+		if property, ok := schema.Properties[name]; ok {
+			allErrs = append(allErrs, Validate(&property, obj[name], childPath)...)
+			continue
+		}
+		switch {
+		case schema.AdditionalProperties != nil && schema.AdditionalProperties.Schema != nil:
+			allErrs = append(allErrs, Validate(schema.AdditionalProperties.Schema, obj[name], childPath)...)
+		case schema.AdditionalProperties != nil && schema.AdditionalProperties.Allows:
+		case len(schema.Properties) == 0 || preserveUnknown:
+			// 未声明 properties 的对象 (如 metadata) 不限制字段
+		default:
+			allErrs = append(allErrs, field.Forbidden(childPath, "unknown field"))
+		}
+	}
+	return allErrs
+}
+
+// validateIntOrString 对应 x-kubernetes-int-or-string, 字符串时才校验 pattern
+func validateIntOrString(schema *apiextensionsv1.JSONSchemaProps, value interface{}, fldPath *field.Path) field.ErrorList {
+	switch v := value.(type) {
+	case json.Number:
+		if _, err := strconv.ParseInt(string(v), 10, 64); err != nil {
+			return field.ErrorList{field.Invalid(fldPath, value, "must be an integer or a string")}
+		}
+		return nil
+	case string:
+		return validateString(schema, v, fldPath)
+	}
+	return field.ErrorList{field.Invalid(fldPath, value, "must be an integer or a string")}
+}
+
+func validateString(schema *apiextensionsv1.JSONSchemaProps, s string, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if schema.MinLength != nil && int64(len(s)) < *schema.MinLength {
+		allErrs = append(allErrs, field.Invalid(fldPath, s, fmt.Sprintf("must be at least %d characters long", *schema.MinLength)))
+	}
+	if schema.MaxLength != nil && int64(len(s)) > *schema.MaxLength {
+		allErrs = append(allErrs, field.TooLong(fldPath, s, int(*schema.MaxLength)))
+	}
+	if schema.Pattern != "" {
+		pattern, err := compilePattern(schema.Pattern)
+		if err != nil {
+			allErrs = append(allErrs, field.InternalError(fldPath, err))
+		} else if !pattern.MatchString(s) {
+			allErrs = append(allErrs, field.Invalid(fldPath, s, fmt.Sprintf("must match the pattern %s", schema.Pattern)))
+		}
+	}
+	return allErrs
+}
+
+func validateNumber(schema *apiextensionsv1.JSONSchemaProps, n float64, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if schema.Minimum != nil {
+		if schema.ExclusiveMinimum && n <= *schema.Minimum {
+			allErrs = append(allErrs, field.Invalid(fldPath, n, fmt.Sprintf("must be greater than %v", *schema.Minimum)))
+		} else if n < *schema.Minimum {
+			allErrs = append(allErrs, field.Invalid(fldPath, n, fmt.Sprintf("must be greater than or equal to %v", *schema.Minimum)))
+		}
+	}
+	if schema.Maximum != nil {
+		if schema.ExclusiveMaximum && n >= *schema.Maximum {
+			allErrs = append(allErrs, field.Invalid(fldPath, n, fmt.Sprintf("must be less than %v", *schema.Maximum)))
+		} else if n > *schema.Maximum {
+			allErrs = append(allErrs, field.Invalid(fldPath, n, fmt.Sprintf("must be less than or equal to %v", *schema.Maximum)))
+		}
+	}
+	return allErrs
+}
+
+func validateEnum(schema *apiextensionsv1.JSONSchemaProps, value interface{}, fldPath *field.Path) field.ErrorList {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return field.ErrorList{field.InternalError(fldPath, err)}
+	}
+	supported := make([]string, 0, len(schema.Enum))
+	for _, enum := range schema.Enum {
+		if string(enum.Raw) == string(data) {
+			return nil
+		}
+		var v interface{}
+		if err := json.Unmarshal(enum.Raw, &v); err != nil {
+			v = string(enum.Raw)
+		}
+		supported = append(supported, fmt.Sprint(v))
+	}
+	return field.ErrorList{field.NotSupported(fldPath, value, supported)}
+}
+
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := patterns.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	patterns.Store(pattern, re)
+	return re, nil
+}
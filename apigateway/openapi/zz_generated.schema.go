@@ -0,0 +1,1343 @@
+/*
+Copyright 2021 Anjie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Code generated by gen.go. DO NOT EDIT.
+
+package openapi
+
+// modelBoxSchemaJSON ModelBox v1 的 openAPIV3Schema, 来自 config/crd/bases/model.github.com_modelboxes.yaml
+const modelBoxSchemaJSON = `{
+  "description": "ModelBox is the Schema for the modelboxes API",
+  "type": "object",
+  "properties": {
+    "apiVersion": {
+      "description": "APIVersion defines the versioned schema of this representation of an object. Servers should convert recognized schemas to the latest internal value, and may reject unrecognized values. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#resources",
+      "type": "string"
+    },
+    "kind": {
+      "description": "Kind is a string value representing the REST resource this object represents. Servers may infer this from the endpoint the client submits requests to. Cannot be updated. In CamelCase. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#types-kinds",
+      "type": "string"
+    },
+    "metadata": {
+      "type": "object"
+    },
+    "spec": {
+      "description": "ModelBoxSpec defines the desired state of ModelBox",
+      "type": "object",
+      "properties": {
+        "args": {
+          "type": "array",
+          "items": {
+            "type": "string"
+          }
+        },
+        "batch": {
+          "description": "BatchSpec 批量推理任务, 输入数据集下载到 /app/input, 结果写入 /app/output",
+          "type": "object",
+          "required": [
+            "inputURL",
+            "outputClaimName"
+          ],
+          "properties": {
+            "activeDeadlineSeconds": {
+              "type": "integer",
+              "format": "int64",
+              "minimum": 1
+            },
+            "backoffLimit": {
+              "type": "integer",
+              "format": "int32",
+              "minimum": 0
+            },
+            "inputCredentialsSecretRef": {
+              "description": "访问输入数据集的凭证, 只挂载到下载输入数据集的容器中",
+              "type": "object",
+              "properties": {
+                "name": {
+                  "description": "Name of the referent. More info: https://kubernetes.io/docs/concepts/overview/working-with-objects/names/#names TODO: Add other useful fields. apiVersion, kind, uid?",
+                  "type": "string"
+                }
+              }
+            },
+            "inputEndpoint": {
+              "type": "string"
+            },
+            "inputURL": {
+              "type": "string",
+              "pattern": "^(https?|s3|gs|oci|pvc|hf)://.+$"
+            },
+            "outputClaimName": {
+              "type": "string"
+            },
+            "outputSubPath": {
+              "type": "string",
+              "pattern": "^[a-zA-Z0-9_-][a-zA-Z0-9._-]*(/[a-zA-Z0-9_-][a-zA-Z0-9._-]*)*$"
+            }
+          }
+        },
+        "command": {
+          "type": "array",
+          "items": {
+            "type": "string"
+          }
+        },
+        "containerPorts": {
+          "description": "推理服务容器的端口, ports 中命名的 targetPort 按名称解析为这里的端口号",
+          "type": "array",
+          "items": {
+            "description": "ContainerPort represents a network port in a single container.",
+            "type": "object",
+            "required": [
+              "containerPort"
+            ],
+            "properties": {
+              "containerPort": {
+                "description": "Number of port to expose on the pod's IP address. This must be a valid port number, 0 \u003c x \u003c 65536.",
+                "type": "integer",
+                "format": "int32"
+              },
+              "hostIP": {
+                "description": "What host IP to bind the external port to.",
+                "type": "string"
+              },
+              "hostPort": {
+                "description": "Number of port to expose on the host. If specified, this must be a valid port number, 0 \u003c x \u003c 65536. If HostNetwork is specified, this must match ContainerPort. Most containers do not need this.",
+                "type": "integer",
+                "format": "int32"
+              },
+              "name": {
+                "description": "If specified, this must be an IANA_SVC_NAME and unique within the pod. Each named port in a pod must have a unique name. Name for the port that can be referred to by services.",
+                "type": "string"
+              },
+              "protocol": {
+                "description": "Protocol for port. Must be UDP, TCP, or SCTP. Defaults to \"TCP\".",
+                "type": "string",
+                "default": "TCP"
+              }
+            }
+          }
+        },
+        "distributed": {
+          "description": "以 StatefulSet 运行分布式推理, 各 Pod 通过 \u003cname\u003e-headless Service 互相发现",
+          "type": "object",
+          "properties": {
+            "masterPort": {
+              "type": "integer",
+              "format": "int32",
+              "maximum": 65535,
+              "minimum": 1
+            }
+          }
+        },
+        "envFrom": {
+          "description": "从 ConfigMap 或 Secret 导入环境变量",
+          "type": "array",
+          "items": {
+            "description": "EnvFromSource represents the source of a set of ConfigMaps",
+            "type": "object",
+            "properties": {
+              "configMapRef": {
+                "description": "The ConfigMap to select from",
+                "type": "object",
+                "properties": {
+                  "name": {
+                    "description": "Name of the referent. More info: https://kubernetes.io/docs/concepts/overview/working-with-objects/names/#names TODO: Add other useful fields. apiVersion, kind, uid?",
+                    "type": "string"
+                  },
+                  "optional": {
+                    "description": "Specify whether the ConfigMap must be defined",
+                    "type": "boolean"
+                  }
+                }
+              },
+              "prefix": {
+                "description": "An optional identifier to prepend to each key in the ConfigMap. Must be a C_IDENTIFIER.",
+                "type": "string"
+              },
+              "secretRef": {
+                "description": "The Secret to select from",
+                "type": "object",
+                "properties": {
+                  "name": {
+                    "description": "Name of the referent. More info: https://kubernetes.io/docs/concepts/overview/working-with-objects/names/#names TODO: Add other useful fields. apiVersion, kind, uid?",
+                    "type": "string"
+                  },
+                  "optional": {
+                    "description": "Specify whether the Secret must be defined",
+                    "type": "boolean"
+                  }
+                }
+              }
+            }
+          }
+        },
+        "envs": {
+          "type": "array",
+          "items": {
+            "description": "EnvVar represents an environment variable present in a Container.",
+            "type": "object",
+            "required": [
+              "name"
+            ],
+            "properties": {
+              "name": {
+                "description": "Name of the environment variable. Must be a C_IDENTIFIER.",
+                "type": "string"
+              },
+              "value": {
+                "description": "Variable references $(VAR_NAME) are expanded using the previous defined environment variables in the container and any service environment variables. If a variable cannot be resolved, the reference in the input string will be unchanged. The $(VAR_NAME) syntax can be escaped with a double $$, ie: $$(VAR_NAME). Escaped references will never be expanded, regardless of whether the variable exists or not. Defaults to \"\".",
+                "type": "string"
+              },
+              "valueFrom": {
+                "description": "Source for the environment variable's value. Cannot be used if value is not empty.",
+                "type": "object",
+                "properties": {
+                  "configMapKeyRef": {
+                    "description": "Selects a key of a ConfigMap.",
+                    "type": "object",
+                    "required": [
+                      "key"
+                    ],
+                    "properties": {
+                      "key": {
+                        "description": "The key to select.",
+                        "type": "string"
+                      },
+                      "name": {
+                        "description": "Name of the referent. More info: https://kubernetes.io/docs/concepts/overview/working-with-objects/names/#names TODO: Add other useful fields. apiVersion, kind, uid?",
+                        "type": "string"
+                      },
+                      "optional": {
+                        "description": "Specify whether the ConfigMap or its key must be defined",
+                        "type": "boolean"
+                      }
+                    }
+                  },
+                  "fieldRef": {
+                    "description": "Selects a field of the pod: supports metadata.name, metadata.namespace, ` + "`" + `metadata.labels['\u003cKEY\u003e']` + "`" + `, ` + "`" + `metadata.annotations['\u003cKEY\u003e']` + "`" + `, spec.nodeName, spec.serviceAccountName, status.hostIP, status.podIP, status.podIPs.",
+                    "type": "object",
+                    "required": [
+                      "fieldPath"
+                    ],
+                    "properties": {
+                      "apiVersion": {
+                        "description": "Version of the schema the FieldPath is written in terms of, defaults to \"v1\".",
+                        "type": "string"
+                      },
+                      "fieldPath": {
+                        "description": "Path of the field to select in the specified API version.",
+                        "type": "string"
+                      }
+                    }
+                  },
+                  "resourceFieldRef": {
+                    "description": "Selects a resource of the container: only resources limits and requests (limits.cpu, limits.memory, limits.ephemeral-storage, requests.cpu, requests.memory and requests.ephemeral-storage) are currently supported.",
+                    "type": "object",
+                    "required": [
+                      "resource"
+                    ],
+                    "properties": {
+                      "containerName": {
+                        "description": "Container name: required for volumes, optional for env vars",
+                        "type": "string"
+                      },
+                      "divisor": {
+                        "description": "Specifies the output format of the exposed resources, defaults to \"1\"",
+                        "pattern": "^(\\+|-)?(([0-9]+(\\.[0-9]*)?)|(\\.[0-9]+))(([KMGTPE]i)|[numkMGTPE]|([eE](\\+|-)?(([0-9]+(\\.[0-9]*)?)|(\\.[0-9]+))))?$",
+                        "anyOf": [
+                          {
+                            "type": "integer"
+                          },
+                          {
+                            "type": "string"
+                          }
+                        ],
+                        "x-kubernetes-int-or-string": true
+                      },
+                      "resource": {
+                        "description": "Required: resource to select",
+                        "type": "string"
+                      }
+                    }
+                  },
+                  "secretKeyRef": {
+                    "description": "Selects a key of a secret in the pod's namespace",
+                    "type": "object",
+                    "required": [
+                      "key"
+                    ],
+                    "properties": {
+                      "key": {
+                        "description": "The key of the secret to select from.  Must be a valid secret key.",
+                        "type": "string"
+                      },
+                      "name": {
+                        "description": "Name of the referent. More info: https://kubernetes.io/docs/concepts/overview/working-with-objects/names/#names TODO: Add other useful fields. apiVersion, kind, uid?",
+                        "type": "string"
+                      },
+                      "optional": {
+                        "description": "Specify whether the Secret or its key must be defined",
+                        "type": "boolean"
+                      }
+                    }
+                  }
+                }
+              }
+            }
+          }
+        },
+        "hotReload": {
+          "description": "HotReloadSpec 模型热更新配置",
+          "type": "object",
+          "properties": {
+            "image": {
+              "type": "string"
+            },
+            "reloadURL": {
+              "type": "string"
+            }
+          }
+        },
+        "idleTimeout": {
+          "description": "空闲超过该时长后缩容到 0, 收到推理请求时由 apigateway 激活, 不设置时不缩容",
+          "type": "string"
+        },
+        "image": {
+          "type": "string"
+        },
+        "imagePullPolicy": {
+          "description": "PullPolicy describes a policy for if/when to pull a container image",
+          "type": "string",
+          "enum": [
+            "Always",
+            "IfNotPresent",
+            "Never"
+          ]
+        },
+        "imagePullSecrets": {
+          "type": "array",
+          "items": {
+            "description": "ImagePullSecret 拉取镜像的 Secret",
+            "type": "object",
+            "required": [
+              "name"
+            ],
+            "properties": {
+              "copy": {
+                "type": "boolean"
+              },
+              "name": {
+                "type": "string"
+              }
+            }
+          }
+        },
+        "lifecycle": {
+          "description": "Lifecycle describes actions that the management system should take in response to container lifecycle events. For the PostStart and PreStop lifecycle handlers, management of the container blocks until the action is complete, unless the container process fails, in which case the handler is aborted.",
+          "type": "object",
+          "properties": {
+            "postStart": {
+              "description": "PostStart is called immediately after a container is created. If the handler fails, the container is terminated and restarted according to its restart policy. Other management of the container blocks until the hook completes. More info: https://kubernetes.io/docs/concepts/containers/container-lifecycle-hooks/#container-hooks",
+              "type": "object",
+              "properties": {
+                "exec": {
+                  "description": "One and only one of the following should be specified. Exec specifies the action to take.",
+                  "type": "object",
+                  "properties": {
+                    "command": {
+                      "description": "Command is the command line to execute inside the container, the working directory for the command  is root ('/') in the container's filesystem. The command is simply exec'd, it is not run inside a shell, so traditional shell instructions ('|', etc) won't work. To use a shell, you need to explicitly call out to that shell. Exit status of 0 is treated as live/healthy and non-zero is unhealthy.",
+                      "type": "array",
+                      "items": {
+                        "type": "string"
+                      }
+                    }
+                  }
+                },
+                "httpGet": {
+                  "description": "HTTPGet specifies the http request to perform.",
+                  "type": "object",
+                  "required": [
+                    "port"
+                  ],
+                  "properties": {
+                    "host": {
+                      "description": "Host name to connect to, defaults to the pod IP. You probably want to set \"Host\" in httpHeaders instead.",
+                      "type": "string"
+                    },
+                    "httpHeaders": {
+                      "description": "Custom headers to set in the request. HTTP allows repeated headers.",
+                      "type": "array",
+                      "items": {
+                        "description": "HTTPHeader describes a custom header to be used in HTTP probes",
+                        "type": "object",
+                        "required": [
+                          "name",
+                          "value"
+                        ],
+                        "properties": {
+                          "name": {
+                            "description": "The header field name",
+                            "type": "string"
+                          },
+                          "value": {
+                            "description": "The header field value",
+                            "type": "string"
+                          }
+                        }
+                      }
+                    },
+                    "path": {
+                      "description": "Path to access on the HTTP server.",
+                      "type": "string"
+                    },
+                    "port": {
+                      "description": "Name or number of the port to access on the container. Number must be in the range 1 to 65535. Name must be an IANA_SVC_NAME.",
+                      "anyOf": [
+                        {
+                          "type": "integer"
+                        },
+                        {
+                          "type": "string"
+                        }
+                      ],
+                      "x-kubernetes-int-or-string": true
+                    },
+                    "scheme": {
+                      "description": "Scheme to use for connecting to the host. Defaults to HTTP.",
+                      "type": "string"
+                    }
+                  }
+                },
+                "tcpSocket": {
+                  "description": "TCPSocket specifies an action involving a TCP port. TCP hooks not yet supported TODO: implement a realistic TCP lifecycle hook",
+                  "type": "object",
+                  "required": [
+                    "port"
+                  ],
+                  "properties": {
+                    "host": {
+                      "description": "Optional: Host name to connect to, defaults to the pod IP.",
+                      "type": "string"
+                    },
+                    "port": {
+                      "description": "Number or name of the port to access on the container. Number must be in the range 1 to 65535. Name must be an IANA_SVC_NAME.",
+                      "anyOf": [
+                        {
+                          "type": "integer"
+                        },
+                        {
+                          "type": "string"
+                        }
+                      ],
+                      "x-kubernetes-int-or-string": true
+                    }
+                  }
+                }
+              }
+            },
+            "preStop": {
+              "description": "PreStop is called immediately before a container is terminated due to an API request or management event such as liveness/startup probe failure, preemption, resource contention, etc. The handler is not called if the container crashes or exits. The reason for termination is passed to the handler. The Pod's termination grace period countdown begins before the PreStop hooked is executed. Regardless of the outcome of the handler, the container will eventually terminate within the Pod's termination grace period. Other management of the container blocks until the hook completes or until the termination grace period is reached. More info: https://kubernetes.io/docs/concepts/containers/container-lifecycle-hooks/#container-hooks",
+              "type": "object",
+              "properties": {
+                "exec": {
+                  "description": "One and only one of the following should be specified. Exec specifies the action to take.",
+                  "type": "object",
+                  "properties": {
+                    "command": {
+                      "description": "Command is the command line to execute inside the container, the working directory for the command  is root ('/') in the container's filesystem. The command is simply exec'd, it is not run inside a shell, so traditional shell instructions ('|', etc) won't work. To use a shell, you need to explicitly call out to that shell. Exit status of 0 is treated as live/healthy and non-zero is unhealthy.",
+                      "type": "array",
+                      "items": {
+                        "type": "string"
+                      }
+                    }
+                  }
+                },
+                "httpGet": {
+                  "description": "HTTPGet specifies the http request to perform.",
+                  "type": "object",
+                  "required": [
+                    "port"
+                  ],
+                  "properties": {
+                    "host": {
+                      "description": "Host name to connect to, defaults to the pod IP. You probably want to set \"Host\" in httpHeaders instead.",
+                      "type": "string"
+                    },
+                    "httpHeaders": {
+                      "description": "Custom headers to set in the request. HTTP allows repeated headers.",
+                      "type": "array",
+                      "items": {
+                        "description": "HTTPHeader describes a custom header to be used in HTTP probes",
+                        "type": "object",
+                        "required": [
+                          "name",
+                          "value"
+                        ],
+                        "properties": {
+                          "name": {
+                            "description": "The header field name",
+                            "type": "string"
+                          },
+                          "value": {
+                            "description": "The header field value",
+                            "type": "string"
+                          }
+                        }
+                      }
+                    },
+                    "path": {
+                      "description": "Path to access on the HTTP server.",
+                      "type": "string"
+                    },
+                    "port": {
+                      "description": "Name or number of the port to access on the container. Number must be in the range 1 to 65535. Name must be an IANA_SVC_NAME.",
+                      "anyOf": [
+                        {
+                          "type": "integer"
+                        },
+                        {
+                          "type": "string"
+                        }
+                      ],
+                      "x-kubernetes-int-or-string": true
+                    },
+                    "scheme": {
+                      "description": "Scheme to use for connecting to the host. Defaults to HTTP.",
+                      "type": "string"
+                    }
+                  }
+                },
+                "tcpSocket": {
+                  "description": "TCPSocket specifies an action involving a TCP port. TCP hooks not yet supported TODO: implement a realistic TCP lifecycle hook",
+                  "type": "object",
+                  "required": [
+                    "port"
+                  ],
+                  "properties": {
+                    "host": {
+                      "description": "Optional: Host name to connect to, defaults to the pod IP.",
+                      "type": "string"
+                    },
+                    "port": {
+                      "description": "Number or name of the port to access on the container. Number must be in the range 1 to 65535. Name must be an IANA_SVC_NAME.",
+                      "anyOf": [
+                        {
+                          "type": "integer"
+                        },
+                        {
+                          "type": "string"
+                        }
+                      ],
+                      "x-kubernetes-int-or-string": true
+                    }
+                  }
+                }
+              }
+            }
+          }
+        },
+        "livenessProbe": {
+          "description": "Probe describes a health check to be performed against a container to determine whether it is alive or ready to receive traffic.",
+          "type": "object",
+          "properties": {
+            "exec": {
+              "description": "One and only one of the following should be specified. Exec specifies the action to take.",
+              "type": "object",
+              "properties": {
+                "command": {
+                  "description": "Command is the command line to execute inside the container, the working directory for the command  is root ('/') in the container's filesystem. The command is simply exec'd, it is not run inside a shell, so traditional shell instructions ('|', etc) won't work. To use a shell, you need to explicitly call out to that shell. Exit status of 0 is treated as live/healthy and non-zero is unhealthy.",
+                  "type": "array",
+                  "items": {
+                    "type": "string"
+                  }
+                }
+              }
+            },
+            "failureThreshold": {
+              "description": "Minimum consecutive failures for the probe to be considered failed after having succeeded. Defaults to 3. Minimum value is 1.",
+              "type": "integer",
+              "format": "int32"
+            },
+            "httpGet": {
+              "description": "HTTPGet specifies the http request to perform.",
+              "type": "object",
+              "required": [
+                "port"
+              ],
+              "properties": {
+                "host": {
+                  "description": "Host name to connect to, defaults to the pod IP. You probably want to set \"Host\" in httpHeaders instead.",
+                  "type": "string"
+                },
+                "httpHeaders": {
+                  "description": "Custom headers to set in the request. HTTP allows repeated headers.",
+                  "type": "array",
+                  "items": {
+                    "description": "HTTPHeader describes a custom header to be used in HTTP probes",
+                    "type": "object",
+                    "required": [
+                      "name",
+                      "value"
+                    ],
+                    "properties": {
+                      "name": {
+                        "description": "The header field name",
+                        "type": "string"
+                      },
+                      "value": {
+                        "description": "The header field value",
+                        "type": "string"
+                      }
+                    }
+                  }
+                },
+                "path": {
+                  "description": "Path to access on the HTTP server.",
+                  "type": "string"
+                },
+                "port": {
+                  "description": "Name or number of the port to access on the container. Number must be in the range 1 to 65535. Name must be an IANA_SVC_NAME.",
+                  "anyOf": [
+                    {
+                      "type": "integer"
+                    },
+                    {
+                      "type": "string"
+                    }
+                  ],
+                  "x-kubernetes-int-or-string": true
+                },
+                "scheme": {
+                  "description": "Scheme to use for connecting to the host. Defaults to HTTP.",
+                  "type": "string"
+                }
+              }
+            },
+            "initialDelaySeconds": {
+              "description": "Number of seconds after the container has started before liveness probes are initiated. More info: https://kubernetes.io/docs/concepts/workloads/pods/pod-lifecycle#container-probes",
+              "type": "integer",
+              "format": "int32"
+            },
+            "periodSeconds": {
+              "description": "How often (in seconds) to perform the probe. Default to 10 seconds. Minimum value is 1.",
+              "type": "integer",
+              "format": "int32"
+            },
+            "successThreshold": {
+              "description": "Minimum consecutive successes for the probe to be considered successful after having failed. Defaults to 1. Must be 1 for liveness and startup. Minimum value is 1.",
+              "type": "integer",
+              "format": "int32"
+            },
+            "tcpSocket": {
+              "description": "TCPSocket specifies an action involving a TCP port. TCP hooks not yet supported TODO: implement a realistic TCP lifecycle hook",
+              "type": "object",
+              "required": [
+                "port"
+              ],
+              "properties": {
+                "host": {
+                  "description": "Optional: Host name to connect to, defaults to the pod IP.",
+                  "type": "string"
+                },
+                "port": {
+                  "description": "Number or name of the port to access on the container. Number must be in the range 1 to 65535. Name must be an IANA_SVC_NAME.",
+                  "anyOf": [
+                    {
+                      "type": "integer"
+                    },
+                    {
+                      "type": "string"
+                    }
+                  ],
+                  "x-kubernetes-int-or-string": true
+                }
+              }
+            },
+            "timeoutSeconds": {
+              "description": "Number of seconds after which the probe times out. Defaults to 1 second. Minimum value is 1. More info: https://kubernetes.io/docs/concepts/workloads/pods/pod-lifecycle#container-probes",
+              "type": "integer",
+              "format": "int32"
+            }
+          }
+        },
+        "modelFileURL": {
+          "type": "string"
+        },
+        "models": {
+          "type": "array",
+          "items": {
+            "description": "ModelSource 模型文件来源",
+            "type": "object",
+            "required": [
+              "name",
+              "url"
+            ],
+            "properties": {
+              "credentialsSecretRef": {
+                "description": "访问模型地址的凭证, 只挂载到下载模型的容器中",
+                "type": "object",
+                "properties": {
+                  "name": {
+                    "description": "Name of the referent. More info: https://kubernetes.io/docs/concepts/overview/working-with-objects/names/#names TODO: Add other useful fields. apiVersion, kind, uid?",
+                    "type": "string"
+                  }
+                }
+              },
+              "digest": {
+                "type": "string",
+                "pattern": "^sha256:[a-f0-9]{64}$"
+              },
+              "endpoint": {
+                "type": "string"
+              },
+              "name": {
+                "type": "string",
+                "maxLength": 50,
+                "pattern": "^[a-z0-9]([-a-z0-9]*[a-z0-9])?$"
+              },
+              "serviceAccountToken": {
+                "description": "ServiceAccountTokenProjection 投射到下载模型容器中的 ServiceAccount token",
+                "type": "object",
+                "required": [
+                  "audience"
+                ],
+                "properties": {
+                  "audience": {
+                    "type": "string"
+                  },
+                  "expirationSeconds": {
+                    "type": "integer",
+                    "format": "int64",
+                    "minimum": 600
+                  }
+                }
+              },
+              "subPath": {
+                "type": "string",
+                "pattern": "^[a-zA-Z0-9_-][a-zA-Z0-9._-]*(/[a-zA-Z0-9_-][a-zA-Z0-9._-]*)*$"
+              },
+              "url": {
+                "type": "string",
+                "pattern": "^(https?|s3|gs|oci|pvc|hf)://.+$"
+              }
+            }
+          }
+        },
+        "name": {
+          "description": "Name is an example field of ModelBox. Edit modelbox_types.go to remove/update",
+          "type": "string"
+        },
+        "networkAccess": {
+          "description": "只允许指定的客户端访问推理服务, 由控制器创建同名的 NetworkPolicy",
+          "type": "object",
+          "properties": {
+            "allowGateway": {
+              "type": "boolean"
+            },
+            "allowModelDownload": {
+              "type": "boolean"
+            },
+            "allowedNamespaces": {
+              "type": "array",
+              "items": {
+                "type": "string"
+              }
+            },
+            "allowedPods": {
+              "type": "array",
+              "items": {
+                "description": "A label selector is a label query over a set of resources. The result of matchLabels and matchExpressions are ANDed. An empty label selector matches all objects. A null label selector matches no objects.",
+                "type": "object",
+                "properties": {
+                  "matchExpressions": {
+                    "description": "matchExpressions is a list of label selector requirements. The requirements are ANDed.",
+                    "type": "array",
+                    "items": {
+                      "description": "A label selector requirement is a selector that contains values, a key, and an operator that relates the key and values.",
+                      "type": "object",
+                      "required": [
+                        "key",
+                        "operator"
+                      ],
+                      "properties": {
+                        "key": {
+                          "description": "key is the label key that the selector applies to.",
+                          "type": "string"
+                        },
+                        "operator": {
+                          "description": "operator represents a key's relationship to a set of values. Valid operators are In, NotIn, Exists and DoesNotExist.",
+                          "type": "string"
+                        },
+                        "values": {
+                          "description": "values is an array of string values. If the operator is In or NotIn, the values array must be non-empty. If the operator is Exists or DoesNotExist, the values array must be empty. This array is replaced during a strategic merge patch.",
+                          "type": "array",
+                          "items": {
+                            "type": "string"
+                          }
+                        }
+                      }
+                    }
+                  },
+                  "matchLabels": {
+                    "description": "matchLabels is a map of {key,value} pairs. A single {key,value} in the matchLabels map is equivalent to an element of matchExpressions, whose key field is \"key\", the operator is \"In\", and the values array contains only \"value\". The requirements are ANDed.",
+                    "type": "object",
+                    "additionalProperties": {
+                      "type": "string"
+                    }
+                  }
+                }
+              }
+            },
+            "modelDownloadCIDRs": {
+              "type": "array",
+              "items": {
+                "type": "string"
+              }
+            }
+          }
+        },
+        "ports": {
+          "type": "array",
+          "items": {
+            "description": "ServicePort contains information on service's port.",
+            "type": "object",
+            "required": [
+              "port"
+            ],
+            "properties": {
+              "appProtocol": {
+                "description": "The application protocol for this port. This field follows standard Kubernetes label syntax. Un-prefixed names are reserved for IANA standard service names (as per RFC-6335 and http://www.iana.org/assignments/service-names). Non-standard protocols should use prefixed names such as mycompany.com/my-custom-protocol. This is a beta field that is guarded by the ServiceAppProtocol feature gate and enabled by default.",
+                "type": "string"
+              },
+              "name": {
+                "description": "The name of this port within the service. This must be a DNS_LABEL. All ports within a ServiceSpec must have unique names. When considering the endpoints for a Service, this must match the 'name' field in the EndpointPort. Optional if only one ServicePort is defined on this service.",
+                "type": "string"
+              },
+              "nodePort": {
+                "description": "The port on each node on which this service is exposed when type=NodePort or LoadBalancer. Usually assigned by the system. If specified, it will be allocated to the service if unused or else creation of the service will fail. Default is to auto-allocate a port if the ServiceType of this Service requires one. More info: https://kubernetes.io/docs/concepts/services-networking/service/#type-nodeport",
+                "type": "integer",
+                "format": "int32"
+              },
+              "port": {
+                "description": "The port that will be exposed by this service.",
+                "type": "integer",
+                "format": "int32"
+              },
+              "protocol": {
+                "description": "The IP protocol for this port. Supports \"TCP\", \"UDP\", and \"SCTP\". Default is TCP.",
+                "type": "string",
+                "default": "TCP"
+              },
+              "targetPort": {
+                "description": "Number or name of the port to access on the pods targeted by the service. Number must be in the range 1 to 65535. Name must be an IANA_SVC_NAME. If this is a string, it will be looked up as a named port in the target Pod's container ports. If this is not specified, the value of the 'port' field is used (an identity map). This field is ignored for services with clusterIP=None, and should be omitted or set equal to the 'port' field. More info: https://kubernetes.io/docs/concepts/services-networking/service/#defining-a-service",
+                "anyOf": [
+                  {
+                    "type": "integer"
+                  },
+                  {
+                    "type": "string"
+                  }
+                ],
+                "x-kubernetes-int-or-string": true
+              }
+            }
+          }
+        },
+        "prefetch": {
+          "description": "PrefetchPolicy 模型预热配置",
+          "type": "object",
+          "properties": {
+            "cachePath": {
+              "type": "string",
+              "pattern": "^/.+$"
+            },
+            "nodeSelector": {
+              "type": "object",
+              "additionalProperties": {
+                "type": "string"
+              }
+            },
+            "tolerations": {
+              "type": "array",
+              "items": {
+                "description": "The pod this Toleration is attached to tolerates any taint that matches the triple \u003ckey,value,effect\u003e using the matching operator \u003coperator\u003e.",
+                "type": "object",
+                "properties": {
+                  "effect": {
+                    "description": "Effect indicates the taint effect to match. Empty means match all taint effects. When specified, allowed values are NoSchedule, PreferNoSchedule and NoExecute.",
+                    "type": "string"
+                  },
+                  "key": {
+                    "description": "Key is the taint key that the toleration applies to. Empty means match all taint keys. If the key is empty, operator must be Exists; this combination means to match all values and all keys.",
+                    "type": "string"
+                  },
+                  "operator": {
+                    "description": "Operator represents a key's relationship to the value. Valid operators are Exists and Equal. Defaults to Equal. Exists is equivalent to wildcard for value, so that a pod can tolerate all taints of a particular category.",
+                    "type": "string"
+                  },
+                  "tolerationSeconds": {
+                    "description": "TolerationSeconds represents the period of time the toleration (which must be of effect NoExecute, otherwise this field is ignored) tolerates the taint. By default, it is not set, which means tolerate the taint forever (do not evict). Zero and negative values will be treated as 0 (evict immediately) by the system.",
+                    "type": "integer",
+                    "format": "int64"
+                  },
+                  "value": {
+                    "description": "Value is the taint value the toleration matches to. If the operator is Exists, the value should be empty, otherwise just a regular string.",
+                    "type": "string"
+                  }
+                }
+              }
+            }
+          }
+        },
+        "readinessProbe": {
+          "description": "Probe describes a health check to be performed against a container to determine whether it is alive or ready to receive traffic.",
+          "type": "object",
+          "properties": {
+            "exec": {
+              "description": "One and only one of the following should be specified. Exec specifies the action to take.",
+              "type": "object",
+              "properties": {
+                "command": {
+                  "description": "Command is the command line to execute inside the container, the working directory for the command  is root ('/') in the container's filesystem. The command is simply exec'd, it is not run inside a shell, so traditional shell instructions ('|', etc) won't work. To use a shell, you need to explicitly call out to that shell. Exit status of 0 is treated as live/healthy and non-zero is unhealthy.",
+                  "type": "array",
+                  "items": {
+                    "type": "string"
+                  }
+                }
+              }
+            },
+            "failureThreshold": {
+              "description": "Minimum consecutive failures for the probe to be considered failed after having succeeded. Defaults to 3. Minimum value is 1.",
+              "type": "integer",
+              "format": "int32"
+            },
+            "httpGet": {
+              "description": "HTTPGet specifies the http request to perform.",
+              "type": "object",
+              "required": [
+                "port"
+              ],
+              "properties": {
+                "host": {
+                  "description": "Host name to connect to, defaults to the pod IP. You probably want to set \"Host\" in httpHeaders instead.",
+                  "type": "string"
+                },
+                "httpHeaders": {
+                  "description": "Custom headers to set in the request. HTTP allows repeated headers.",
+                  "type": "array",
+                  "items": {
+                    "description": "HTTPHeader describes a custom header to be used in HTTP probes",
+                    "type": "object",
+                    "required": [
+                      "name",
+                      "value"
+                    ],
+                    "properties": {
+                      "name": {
+                        "description": "The header field name",
+                        "type": "string"
+                      },
+                      "value": {
+                        "description": "The header field value",
+                        "type": "string"
+                      }
+                    }
+                  }
+                },
+                "path": {
+                  "description": "Path to access on the HTTP server.",
+                  "type": "string"
+                },
+                "port": {
+                  "description": "Name or number of the port to access on the container. Number must be in the range 1 to 65535. Name must be an IANA_SVC_NAME.",
+                  "anyOf": [
+                    {
+                      "type": "integer"
+                    },
+                    {
+                      "type": "string"
+                    }
+                  ],
+                  "x-kubernetes-int-or-string": true
+                },
+                "scheme": {
+                  "description": "Scheme to use for connecting to the host. Defaults to HTTP.",
+                  "type": "string"
+                }
+              }
+            },
+            "initialDelaySeconds": {
+              "description": "Number of seconds after the container has started before liveness probes are initiated. More info: https://kubernetes.io/docs/concepts/workloads/pods/pod-lifecycle#container-probes",
+              "type": "integer",
+              "format": "int32"
+            },
+            "periodSeconds": {
+              "description": "How often (in seconds) to perform the probe. Default to 10 seconds. Minimum value is 1.",
+              "type": "integer",
+              "format": "int32"
+            },
+            "successThreshold": {
+              "description": "Minimum consecutive successes for the probe to be considered successful after having failed. Defaults to 1. Must be 1 for liveness and startup. Minimum value is 1.",
+              "type": "integer",
+              "format": "int32"
+            },
+            "tcpSocket": {
+              "description": "TCPSocket specifies an action involving a TCP port. TCP hooks not yet supported TODO: implement a realistic TCP lifecycle hook",
+              "type": "object",
+              "required": [
+                "port"
+              ],
+              "properties": {
+                "host": {
+                  "description": "Optional: Host name to connect to, defaults to the pod IP.",
+                  "type": "string"
+                },
+                "port": {
+                  "description": "Number or name of the port to access on the container. Number must be in the range 1 to 65535. Name must be an IANA_SVC_NAME.",
+                  "anyOf": [
+                    {
+                      "type": "integer"
+                    },
+                    {
+                      "type": "string"
+                    }
+                  ],
+                  "x-kubernetes-int-or-string": true
+                }
+              }
+            },
+            "timeoutSeconds": {
+              "description": "Number of seconds after which the probe times out. Defaults to 1 second. Minimum value is 1. More info: https://kubernetes.io/docs/concepts/workloads/pods/pod-lifecycle#container-probes",
+              "type": "integer",
+              "format": "int32"
+            }
+          }
+        },
+        "replicas": {
+          "type": "integer",
+          "format": "int32"
+        },
+        "resourceType": {
+          "type": "string"
+        },
+        "resources": {
+          "description": "ResourceRequirements describes the compute resource requirements.",
+          "type": "object",
+          "properties": {
+            "limits": {
+              "description": "Limits describes the maximum amount of compute resources allowed. More info: https://kubernetes.io/docs/concepts/configuration/manage-compute-resources-container/",
+              "type": "object",
+              "additionalProperties": {
+                "pattern": "^(\\+|-)?(([0-9]+(\\.[0-9]*)?)|(\\.[0-9]+))(([KMGTPE]i)|[numkMGTPE]|([eE](\\+|-)?(([0-9]+(\\.[0-9]*)?)|(\\.[0-9]+))))?$",
+                "anyOf": [
+                  {
+                    "type": "integer"
+                  },
+                  {
+                    "type": "string"
+                  }
+                ],
+                "x-kubernetes-int-or-string": true
+              }
+            },
+            "requests": {
+              "description": "Requests describes the minimum amount of compute resources required. If Requests is omitted for a container, it defaults to Limits if that is explicitly specified, otherwise to an implementation-defined value. More info: https://kubernetes.io/docs/concepts/configuration/manage-compute-resources-container/",
+              "type": "object",
+              "additionalProperties": {
+                "pattern": "^(\\+|-)?(([0-9]+(\\.[0-9]*)?)|(\\.[0-9]+))(([KMGTPE]i)|[numkMGTPE]|([eE](\\+|-)?(([0-9]+(\\.[0-9]*)?)|(\\.[0-9]+))))?$",
+                "anyOf": [
+                  {
+                    "type": "integer"
+                  },
+                  {
+                    "type": "string"
+                  }
+                ],
+                "x-kubernetes-int-or-string": true
+              }
+            }
+          }
+        },
+        "rollingUpdate": {
+          "type": "string"
+        },
+        "serviceAccount": {
+          "description": "ServiceAccountSpec 控制器创建的专用 ServiceAccount",
+          "type": "object",
+          "properties": {
+            "annotations": {
+              "type": "object",
+              "additionalProperties": {
+                "type": "string"
+              }
+            },
+            "create": {
+              "type": "boolean"
+            },
+            "imagePullSecrets": {
+              "type": "array",
+              "items": {
+                "description": "LocalObjectReference contains enough information to let you locate the referenced object inside the same namespace.",
+                "type": "object",
+                "properties": {
+                  "name": {
+                    "description": "Name of the referent. More info: https://kubernetes.io/docs/concepts/overview/working-with-objects/names/#names TODO: Add other useful fields. apiVersion, kind, uid?",
+                    "type": "string"
+                  }
+                }
+              }
+            }
+          }
+        },
+        "serviceAccountName": {
+          "description": "Pod 使用的 ServiceAccount, 默认为命名空间的 default",
+          "type": "string"
+        },
+        "serviceType": {
+          "description": "Service Type string describes ingress methods for a service",
+          "type": "string"
+        },
+        "templateRef": {
+          "description": "引用的 ModelBoxTemplate 或 ClusterModelBoxTemplate, 模板中的字段作为默认值",
+          "type": "object",
+          "required": [
+            "name"
+          ],
+          "properties": {
+            "kind": {
+              "type": "string",
+              "enum": [
+                "ModelBoxTemplate",
+                "ClusterModelBoxTemplate"
+              ]
+            },
+            "name": {
+              "type": "string"
+            }
+          }
+        },
+        "terminationGracePeriodSeconds": {
+          "type": "integer",
+          "format": "int64",
+          "minimum": 0
+        },
+        "workingDir": {
+          "type": "string"
+        },
+        "workloadType": {
+          "type": "string",
+          "enum": [
+            "Deployment",
+            "StatefulSet",
+            "BatchJob"
+          ]
+        }
+      }
+    },
+    "status": {
+      "description": "ModelBoxStatus defines the observed state of ModelBox 描述app的状态信息",
+      "type": "object",
+      "properties": {
+        "availableReplicas": {
+          "description": "Total number of available pods (ready for at least minReadySeconds) targeted by this deployment.",
+          "type": "integer",
+          "format": "int32"
+        },
+        "batch": {
+          "description": "BatchStatus 批量推理任务的状态",
+          "type": "object",
+          "properties": {
+            "active": {
+              "type": "integer",
+              "format": "int32"
+            },
+            "completionTime": {
+              "type": "string",
+              "format": "date-time"
+            },
+            "failed": {
+              "type": "integer",
+              "format": "int32"
+            },
+            "message": {
+              "type": "string"
+            },
+            "output": {
+              "type": "string"
+            },
+            "phase": {
+              "type": "string"
+            },
+            "startTime": {
+              "type": "string",
+              "format": "date-time"
+            }
+          }
+        },
+        "collisionCount": {
+          "description": "Count of hash collisions for the Deployment. The Deployment controller uses this field as a collision avoidance mechanism when it needs to create the name for the newest ReplicaSet.",
+          "type": "integer",
+          "format": "int32"
+        },
+        "conditions": {
+          "description": "Represents the latest available observations of a deployment's current state.",
+          "type": "array",
+          "items": {
+            "description": "DeploymentCondition describes the state of a deployment at a certain point.",
+            "type": "object",
+            "required": [
+              "status",
+              "type"
+            ],
+            "properties": {
+              "lastTransitionTime": {
+                "description": "Last time the condition transitioned from one status to another.",
+                "type": "string",
+                "format": "date-time"
+              },
+              "lastUpdateTime": {
+                "description": "The last time this condition was updated.",
+                "type": "string",
+                "format": "date-time"
+              },
+              "message": {
+                "description": "A human readable message indicating details about the transition.",
+                "type": "string"
+              },
+              "reason": {
+                "description": "The reason for the condition's last transition.",
+                "type": "string"
+              },
+              "status": {
+                "description": "Status of the condition, one of True, False, Unknown.",
+                "type": "string"
+              },
+              "type": {
+                "description": "Type of deployment condition.",
+                "type": "string"
+              }
+            }
+          }
+        },
+        "modelRevision": {
+          "type": "string"
+        },
+        "models": {
+          "type": "array",
+          "items": {
+            "description": "ModelStatus 模型的加载状态, State 为 Pending、Loading、Loaded 或 Failed",
+            "type": "object",
+            "required": [
+              "loadedReplicas",
+              "name",
+              "state"
+            ],
+            "properties": {
+              "loadedReplicas": {
+                "type": "integer",
+                "format": "int32"
+              },
+              "message": {
+                "type": "string"
+              },
+              "name": {
+                "type": "string"
+              },
+              "state": {
+                "type": "string"
+              }
+            }
+          }
+        },
+        "observedGeneration": {
+          "description": "The generation observed by the deployment controller.",
+          "type": "integer",
+          "format": "int64"
+        },
+        "policyViolations": {
+          "type": "array",
+          "items": {
+            "type": "string"
+          }
+        },
+        "readyReplicas": {
+          "description": "Total number of ready pods targeted by this deployment.",
+          "type": "integer",
+          "format": "int32"
+        },
+        "reloads": {
+          "type": "array",
+          "items": {
+            "description": "PodReloadStatus 单个 Pod 的热更新结果, State 为 Reloading、Reloaded、Failed 或 Unknown",
+            "type": "object",
+            "required": [
+              "pod",
+              "state"
+            ],
+            "properties": {
+              "message": {
+                "type": "string"
+              },
+              "pod": {
+                "type": "string"
+              },
+              "revision": {
+                "type": "string"
+              },
+              "state": {
+                "type": "string"
+              }
+            }
+          }
+        },
+        "replicas": {
+          "description": "Total number of non-terminated pods targeted by this deployment (their labels match the selector).",
+          "type": "integer",
+          "format": "int32"
+        },
+        "resolvedImages": {
+          "type": "array",
+          "items": {
+            "description": "ResolvedImage 镜像 tag 解析得到的 digest",
+            "type": "object",
+            "required": [
+              "digest",
+              "image"
+            ],
+            "properties": {
+              "digest": {
+                "type": "string"
+              },
+              "image": {
+                "type": "string"
+              }
+            }
+          }
+        },
+        "unavailableReplicas": {
+          "description": "Total number of unavailable pods targeted by this deployment. This is the total number of pods that are still required for the deployment to have 100% available capacity. They may either be pods that are running but not yet available or pods that still have not been created.",
+          "type": "integer",
+          "format": "int32"
+        },
+        "updatedReplicas": {
+          "description": "Total number of non-terminated pods targeted by this deployment that have the desired template spec.",
+          "type": "integer",
+          "format": "int32"
+        }
+      }
+    }
+  }
+}`
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+
+	modelv1 "github.com/sharelinuxs/my-first-opeartor/api/v1"
+	modelv2 "github.com/sharelinuxs/my-first-opeartor/api/v2"
+	clientset "github.com/sharelinuxs/my-first-opeartor/apigateway/clientset"
+)
+
+// activationPollInterval 等待 ModelBox 激活时检查 Endpoints 的间隔
+const activationPollInterval = 500 * time.Millisecond
+
+// activator 为配置了 idleTimeout 的 ModelBox 记录推理流量, 并在其缩容到 0 后激活.
+// 流量与激活都通过 last-activity 注解通知控制器, 由控制器负责实际的扩缩容,
+// 因此 activator 使用 apigateway 自身的身份访问 API server, 调用方不需要 patch 权限
+type activator struct {
+	modelClient    clientset.Interface
+	kubeClient     kubernetes.Interface
+	timeout        time.Duration
+	reportInterval time.Duration
+
+	mu          sync.Mutex
+	lastReport  map[string]time.Time
+	activations map[string]*activation
+}
+
+// activation 同一个 ModelBox 的并发请求共享一次激活
+type activation struct {
+	done chan struct{}
+	err  error
+}
+
+func newActivator(modelClient clientset.Interface, kubeClient kubernetes.Interface, timeout, reportInterval time.Duration) *activator {
+	return &activator{
+		modelClient:    modelClient,
+		kubeClient:     kubeClient,
+		timeout:        timeout,
+		reportInterval: reportInterval,
+		lastReport:     map[string]time.Time{},
+		activations:    map[string]*activation{},
+	}
+}
+
+// recordActivity 更新 last-activity 注解. 为避免每个请求都写 API server, 同一个 ModelBox
+// 在 reportInterval 内只上报一次, 上报间隔不超过 idleTimeout 的一半, 保证有流量时不会被缩容
+func (a *activator) recordActivity(modelBox *modelv1.ModelBox, idleTimeout time.Duration) {
+	interval := a.reportInterval
+	if half := idleTimeout / 2; half < interval {
+		interval = half
+	}
+	key := modelBox.Namespace + "/" + modelBox.Name
+	now := time.Now()
+
+	a.mu.Lock()
+	if now.Sub(a.lastReport[key]) < interval {
+		a.mu.Unlock()
+		return
+	}
+	a.lastReport[key] = now
+	a.mu.Unlock()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := a.patchActivity(ctx, modelBox.Namespace, modelBox.Name, now); err != nil {
+			logrus.Warnf("report activity of modelbox %s: %v", key, err)
+			// 上报失败时允许下一个请求重试
+			a.mu.Lock()
+			delete(a.lastReport, key)
+			a.mu.Unlock()
+		}
+	}()
+}
+
+// activate 等待 ModelBox 的 Service 有就绪的 Endpoints, 已缩容到 0 时通知控制器恢复副本数.
+// spec 为合并了模板的 spec, 副本数由用户设置为 0 时不激活
+func (a *activator) activate(ctx context.Context, modelBox *modelv1.ModelBox, spec *modelv2.ModelBoxSpec) error {
+	if spec.Scaling.Replicas != nil && *spec.Scaling.Replicas == 0 {
+		return k8serrors.NewServiceUnavailable(
+			fmt.Sprintf("modelbox %s/%s is scaled to 0 replicas", modelBox.Namespace, modelBox.Name))
+	}
+	ready, err := a.endpointsReady(ctx, modelBox.Namespace, modelBox.Name)
+	if err != nil || ready {
+		return err
+	}
+
+	key := modelBox.Namespace + "/" + modelBox.Name
+	a.mu.Lock()
+	act, ok := a.activations[key]
+	if !ok {
+		act = &activation{done: make(chan struct{})}
+		a.activations[key] = act
+		go a.run(key, modelBox.Namespace, modelBox.Name, act)
+	}
+	a.mu.Unlock()
+
+	select {
+	case <-act.done:
+		return act.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run 更新 last-activity 注解后等待 Pod 就绪, 不受单个请求取消的影响
+func (a *activator) run(key, namespace, name string, act *activation) {
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
+	defer cancel()
+	defer func() {
+		a.mu.Lock()
+		delete(a.activations, key)
+		a.mu.Unlock()
+		close(act.done)
+	}()
+
+	logrus.Infof("activating modelbox %s", key)
+	activations.WithLabelValues(namespace, name).Inc()
+	if err := a.patchActivity(ctx, namespace, name, start); err != nil {
+		act.err = err
+		return
+	}
+	a.mu.Lock()
+	a.lastReport[key] = start
+	a.mu.Unlock()
+
+	err := wait.PollImmediateUntil(activationPollInterval, func() (bool, error) {
+		return a.endpointsReady(ctx, namespace, name)
+	}, ctx.Done())
+	if err == wait.ErrWaitTimeout {
+		err = k8serrors.NewTimeoutError(fmt.Sprintf("modelbox %s was not activated within %s", key, a.timeout), 0)
+	}
+	if err != nil {
+		logrus.Warnf("activate modelbox %s: %v", key, err)
+		act.err = err
+		return
+	}
+	activationDuration.WithLabelValues(namespace, name).Observe(time.Since(start).Seconds())
+	logrus.Infof("modelbox %s activated in %s", key, time.Since(start).Round(time.Millisecond))
+}
+
+// endpointsReady Service 至少有一个就绪的 Pod 地址
+func (a *activator) endpointsReady(ctx context.Context, namespace, name string) (bool, error) {
+	endpoints, err := a.kubeClient.CoreV1().Endpoints(namespace).Get(ctx, name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	for _, subset := range endpoints.Subsets {
+		if len(subset.Addresses) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (a *activator) patchActivity(ctx context.Context, namespace, name string, at time.Time) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{modelv2.LastActivityAnnotation: at.UTC().Format(time.RFC3339)},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = a.modelClient.ModelV1().ModelBoxes(namespace).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
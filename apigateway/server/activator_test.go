@@ -0,0 +1,278 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	modelv2 "github.com/sharelinuxs/my-first-opeartor/api/v2"
+	"github.com/sharelinuxs/my-first-opeartor/apigateway/clientset/fake"
+)
+
+func newReadyEndpoints() *corev1.Endpoints {
+	return &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "resnet", Namespace: "default"},
+		Subsets:    []corev1.EndpointSubset{{Addresses: []corev1.EndpointAddress{{IP: "10.0.0.1"}}}},
+	}
+}
+
+// countPatches 返回 modelClient 上 patch 请求的计数
+func countPatches(client *fake.Clientset) int {
+	n := 0
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "patch" {
+			n++
+		}
+	}
+	return n
+}
+
+// waitForPatches 上报流量是异步的, 等待 patch 请求数达到 want
+func waitForPatches(t *testing.T, client *fake.Clientset, want int) {
+	t.Helper()
+	err := wait.PollImmediate(time.Millisecond, 5*time.Second, func() (bool, error) {
+		return countPatches(client) >= want, nil
+	})
+	if err != nil {
+		t.Fatalf("got %d patches, want %d", countPatches(client), want)
+	}
+}
+
+// TestActivateCoalesces 并发请求共享一次激活, 只更新一次 last-activity 注解
+func TestActivateCoalesces(t *testing.T) {
+	const requests = 5
+	modelBox := newInferenceModelBox()
+	modelClient := fake.NewSimpleClientset(modelBox.DeepCopy())
+	kubeClient := kubefake.NewSimpleClientset()
+
+	// 所有请求都检查过 Endpoints 后才放行激活的 patch, 保证它们等待的是同一次激活
+	var gets int32
+	kubeClient.PrependReactor("get", "endpoints", func(k8stesting.Action) (bool, runtime.Object, error) {
+		atomic.AddInt32(&gets, 1)
+		return false, nil, nil
+	})
+	release := make(chan struct{})
+	modelClient.PrependReactor("patch", "modelboxes", func(k8stesting.Action) (bool, runtime.Object, error) {
+		<-release
+		return false, nil, nil
+	})
+
+	a := newActivator(modelClient, kubeClient, 5*time.Second, time.Minute)
+	spec := &modelv2.ModelBoxSpec{}
+	errs := make(chan error, requests)
+	for i := 0; i < requests; i++ {
+		go func() { errs <- a.activate(context.Background(), modelBox, spec) }()
+	}
+	if err := wait.PollImmediate(time.Millisecond, 5*time.Second, func() (bool, error) {
+		return atomic.LoadInt32(&gets) >= requests, nil
+	}); err != nil {
+		t.Fatalf("only %d requests checked the endpoints", atomic.LoadInt32(&gets))
+	}
+	if err := kubeClient.Tracker().Add(newReadyEndpoints()); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+
+	for i := 0; i < requests; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("activate: %v", err)
+		}
+	}
+	if n := countPatches(modelClient); n != 1 {
+		t.Errorf("got %d patches, want 1", n)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.activations) != 0 {
+		t.Errorf("got %d activations left, want 0", len(a.activations))
+	}
+	if _, ok := a.lastReport["default/resnet"]; !ok {
+		t.Error("activation was not recorded as a report")
+	}
+}
+
+func TestActivate(t *testing.T) {
+	tests := []struct {
+		name        string
+		replicas    *int32
+		ready       bool
+		patchErr    error
+		timeout     time.Duration
+		cancel      bool
+		wantPatches int
+		wantErr     func(error) bool
+	}{
+		{
+			name:    "endpoints ready",
+			ready:   true,
+			wantErr: func(err error) bool { return err == nil },
+		},
+		{
+			name:     "scaled to 0 replicas by the user",
+			replicas: int32Ptr(0),
+			wantErr:  k8serrors.IsServiceUnavailable,
+		},
+		{
+			name:        "activation times out",
+			timeout:     50 * time.Millisecond,
+			wantPatches: 1,
+			wantErr:     k8serrors.IsTimeout,
+		},
+		{
+			name:        "patch fails",
+			patchErr:    k8serrors.NewForbidden(modelv2.GroupVersion.WithResource("modelboxes").GroupResource(), "resnet", nil),
+			wantPatches: 1,
+			wantErr:     k8serrors.IsForbidden,
+		},
+		{
+			name:        "request canceled",
+			cancel:      true,
+			wantPatches: 1,
+			wantErr:     func(err error) bool { return err == context.Canceled },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modelBox := newInferenceModelBox()
+			modelClient := fake.NewSimpleClientset(modelBox.DeepCopy())
+			var objs []runtime.Object
+			if tt.ready {
+				objs = append(objs, newReadyEndpoints())
+			}
+			kubeClient := kubefake.NewSimpleClientset(objs...)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			modelClient.PrependReactor("patch", "modelboxes", func(k8stesting.Action) (bool, runtime.Object, error) {
+				if tt.cancel {
+					cancel()
+				}
+				return tt.patchErr != nil, nil, tt.patchErr
+			})
+			timeout := tt.timeout
+			if timeout == 0 {
+				timeout = 5 * time.Second
+			}
+
+			a := newActivator(modelClient, kubeClient, timeout, time.Minute)
+			err := a.activate(ctx, modelBox, &modelv2.ModelBoxSpec{Scaling: modelv2.ScalingSpec{Replicas: tt.replicas}})
+			if !tt.wantErr(err) {
+				t.Errorf("got error %v", err)
+			}
+			if n := countPatches(modelClient); n != tt.wantPatches {
+				t.Errorf("got %d patches, want %d", n, tt.wantPatches)
+			}
+		})
+	}
+}
+
+// TestActivateRetriesAfterFailure 激活失败后下一个请求重新激活
+func TestActivateRetriesAfterFailure(t *testing.T) {
+	modelBox := newInferenceModelBox()
+	modelClient := fake.NewSimpleClientset(modelBox.DeepCopy())
+	kubeClient := kubefake.NewSimpleClientset()
+	var once sync.Once
+	modelClient.PrependReactor("patch", "modelboxes", func(k8stesting.Action) (bool, runtime.Object, error) {
+		failed := false
+		once.Do(func() { failed = true })
+		if failed {
+			return true, nil, k8serrors.NewServiceUnavailable("etcd unavailable")
+		}
+		if err := kubeClient.Tracker().Add(newReadyEndpoints()); err != nil {
+			t.Error(err)
+		}
+		return false, nil, nil
+	})
+
+	a := newActivator(modelClient, kubeClient, 5*time.Second, time.Minute)
+	if err := a.activate(context.Background(), modelBox, &modelv2.ModelBoxSpec{}); !k8serrors.IsServiceUnavailable(err) {
+		t.Fatalf("got error %v, want ServiceUnavailable", err)
+	}
+	if err := a.activate(context.Background(), modelBox, &modelv2.ModelBoxSpec{}); err != nil {
+		t.Fatalf("got error %v after retrying", err)
+	}
+	if n := countPatches(modelClient); n != 2 {
+		t.Errorf("got %d patches, want 2", n)
+	}
+}
+
+func TestRecordActivity(t *testing.T) {
+	tests := []struct {
+		name           string
+		reportInterval time.Duration
+		idleTimeout    time.Duration
+		patchErr       error
+		wantPatches    int
+	}{
+		{
+			name:           "once per report interval",
+			reportInterval: time.Minute,
+			idleTimeout:    time.Hour,
+			wantPatches:    1,
+		},
+		{
+			name:           "interval capped at half the idle timeout",
+			reportInterval: time.Minute,
+			idleTimeout:    2 * time.Millisecond,
+			wantPatches:    2,
+		},
+		{
+			name:           "failed reports are retried",
+			reportInterval: time.Minute,
+			idleTimeout:    time.Hour,
+			patchErr:       k8serrors.NewServiceUnavailable("etcd unavailable"),
+			wantPatches:    2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modelBox := newInferenceModelBox()
+			modelClient := fake.NewSimpleClientset(modelBox.DeepCopy())
+			modelClient.PrependReactor("patch", "modelboxes", func(k8stesting.Action) (bool, runtime.Object, error) {
+				return tt.patchErr != nil, nil, tt.patchErr
+			})
+			a := newActivator(modelClient, kubefake.NewSimpleClientset(), time.Second, tt.reportInterval)
+
+			a.recordActivity(modelBox, tt.idleTimeout)
+			waitForPatches(t, modelClient, 1)
+			// 上报失败后会删除记录, 等待异步的 patch 处理完成
+			if tt.patchErr != nil {
+				if err := wait.PollImmediate(time.Millisecond, 5*time.Second, func() (bool, error) {
+					a.mu.Lock()
+					defer a.mu.Unlock()
+					_, ok := a.lastReport["default/resnet"]
+					return !ok, nil
+				}); err != nil {
+					t.Fatal("failed report was not cleared")
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			a.recordActivity(modelBox, tt.idleTimeout)
+			waitForPatches(t, modelClient, tt.wantPatches)
+			// 给可能多出的异步 patch 留出时间
+			time.Sleep(20 * time.Millisecond)
+			if n := countPatches(modelClient); n != tt.wantPatches {
+				t.Errorf("got %d patches, want %d", n, tt.wantPatches)
+			}
+			if tt.patchErr != nil {
+				return
+			}
+			got, err := modelClient.ModelV1().ModelBoxes("default").Get(context.Background(), "resnet", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := time.Parse(time.RFC3339, got.Annotations[modelv2.LastActivityAnnotation]); err != nil {
+				t.Errorf("got %s annotation %q: %v", modelv2.LastActivityAnnotation, got.Annotations[modelv2.LastActivityAnnotation], err)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/cache"
+	"k8s.io/client-go/rest"
+
+	"github.com/sharelinuxs/my-first-opeartor/apigateway/auth"
+	clientset "github.com/sharelinuxs/my-first-opeartor/apigateway/clientset"
+)
+
+// ClientProvider 返回处理请求时访问 API server 使用的 clientset
+type ClientProvider interface {
+	ClientFor(ctx context.Context) (clientset.Interface, error)
+}
+
+// staticClientProvider 所有请求共用同一个 clientset, 即以 apigateway 自身的权限访问 API server
+type staticClientProvider struct {
+	client clientset.Interface
+}
+
+// NewStaticClientProvider 所有请求都使用 client, 仅用于本地开发或测试
+func NewStaticClientProvider(client clientset.Interface) ClientProvider {
+	return &staticClientProvider{client: client}
+}
+
+func (p *staticClientProvider) ClientFor(context.Context) (clientset.Interface, error) {
+	return p.client, nil
+}
+
+const (
+	// clientCacheSize 缓存的 impersonate 客户端数量上限
+	clientCacheSize = 1024
+	// clientCacheTTL 客户端的缓存时间, 过期后重新创建
+	clientCacheTTL = 10 * time.Minute
+)
+
+// impersonatingClientProvider 以调用方身份 impersonate 访问 API server,
+// 调用方能操作哪些 namespace 的 ModelBox 完全由 Kubernetes RBAC 决定
+type impersonatingClientProvider struct {
+	config *rest.Config
+	// 按 impersonate 的用户、组与 extra 缓存 clientset, 避免每个请求都创建客户端
+	cache *cache.LRUExpireCache
+}
+
+// NewImpersonatingClientProvider config 对应的身份需要拥有 users/groups/userextras 的 impersonate 权限
+func NewImpersonatingClientProvider(config *rest.Config) ClientProvider {
+	return &impersonatingClientProvider{
+		config: config,
+		cache:  cache.NewLRUExpireCache(clientCacheSize),
+	}
+}
+
+func (p *impersonatingClientProvider) ClientFor(ctx context.Context) (clientset.Interface, error) {
+	user, ok := auth.UserFrom(ctx)
+	if !ok {
+		return nil, k8serrors.NewUnauthorized("no authenticated user found in request")
+	}
+	impersonate := rest.ImpersonationConfig{
+		UserName: user.Name,
+		Groups:   user.Groups,
+		Extra:    user.Extra,
+	}
+	// 身份的任何部分不同都使用不同的客户端, extra 的 key 由 json 排序
+	key, err := json.Marshal(impersonate)
+	if err != nil {
+		return nil, err
+	}
+	if client, ok := p.cache.Get(string(key)); ok {
+		return client.(clientset.Interface), nil
+	}
+	config := rest.CopyConfig(p.config)
+	config.Impersonate = impersonate
+	client, err := clientset.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	p.cache.Add(string(key), client, clientCacheTTL)
+	return client, nil
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/rest"
+
+	"github.com/sharelinuxs/my-first-opeartor/apigateway/auth"
+)
+
+func TestImpersonatingClientProviderCache(t *testing.T) {
+	p := NewImpersonatingClientProvider(&rest.Config{Host: "https://127.0.0.1:6443"})
+	clientFor := func(user *auth.UserInfo) interface{} {
+		t.Helper()
+		client, err := p.ClientFor(auth.WithUser(context.Background(), user))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return client
+	}
+
+	alice := clientFor(&auth.UserInfo{Name: "alice", Groups: []string{"ml"}})
+	if again := clientFor(&auth.UserInfo{Name: "alice", Groups: []string{"ml"}}); again != alice {
+		t.Error("the same user got a new client")
+	}
+	others := []*auth.UserInfo{
+		{Name: "bob", Groups: []string{"ml"}},
+		{Name: "alice", Groups: []string{"ml", "admins"}},
+		{Name: "alice", Groups: []string{"ml"}, Extra: map[string][]string{"scopes": {"read"}}},
+	}
+	for _, user := range others {
+		if clientFor(user) == alice {
+			t.Errorf("user %+v got the client of alice", user)
+		}
+	}
+
+	if _, err := p.ClientFor(context.Background()); !k8serrors.IsUnauthorized(err) {
+		t.Errorf("got error %v without a user, want Unauthorized", err)
+	}
+}
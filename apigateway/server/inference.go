@@ -0,0 +1,278 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+
+	modelv1 "github.com/sharelinuxs/my-first-opeartor/api/v1"
+	modelv2 "github.com/sharelinuxs/my-first-opeartor/api/v2"
+	clientset "github.com/sharelinuxs/my-first-opeartor/apigateway/clientset"
+)
+
+// InferenceOptions 推理代理的配置
+type InferenceOptions struct {
+	// ClusterDomain 集群域名, 用于拼接 Service 的完整域名
+	ClusterDomain string
+	// Timeout 单个推理请求 (包括重试) 的超时时间, 0 表示不限制
+	Timeout time.Duration
+	// Retries 连接失败时的重试次数, 只重试请求尚未发出的连接错误
+	Retries int
+	// RetryBackoff 首次重试前的等待时间, 之后每次翻倍
+	RetryBackoff time.Duration
+	// MaxConcurrency 每个 ModelBox 同时处理的请求数上限, 0 表示不限制
+	MaxConcurrency int
+	// MaxRequestBytes 请求体大小上限, 重试时需要重放请求体, 因此请求体会被完整读入内存
+	MaxRequestBytes int64
+	// ActivationTimeout 等待缩容到 0 的 ModelBox 激活的最长时间, 不计入 Timeout
+	ActivationTimeout time.Duration
+	// ActivityReportInterval 同一个 ModelBox 上报流量的最小间隔
+	ActivityReportInterval time.Duration
+}
+
+// InferenceProxy 将推理请求转发到 ModelBox 对应的 Service
+type InferenceProxy struct {
+	opts      InferenceOptions
+	transport http.RoundTripper
+	activator *activator
+
+	mu       sync.Mutex
+	limiters map[string]chan struct{}
+}
+
+// NewInferenceProxy 创建推理代理. modelClient 与 kubeClient 使用 apigateway 自身的身份,
+// 用于为配置了 idleTimeout 的 ModelBox 上报流量和激活, 为 nil 时不支持缩容到 0 的 ModelBox 的激活
+func NewInferenceProxy(opts InferenceOptions, modelClient clientset.Interface, kubeClient kubernetes.Interface) *InferenceProxy {
+	if opts.ClusterDomain == "" {
+		opts.ClusterDomain = "cluster.local"
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// 同一个模型的请求较为集中, 保留更多空闲连接以复用
+	transport.MaxIdleConnsPerHost = 32
+	var act *activator
+	if modelClient != nil && kubeClient != nil {
+		act = newActivator(modelClient, kubeClient, opts.ActivationTimeout, opts.ActivityReportInterval)
+	}
+	return &InferenceProxy{
+		opts:      opts,
+		activator: act,
+		transport: &retryTransport{
+			next:    transport,
+			retries: opts.Retries,
+			backoff: opts.RetryBackoff,
+		},
+		limiters: map[string]chan struct{}{},
+	}
+}
+
+// serve 将请求转发到 modelBox 的 Service, upstreamPath 为推理服务的请求路径.
+// 调用方需要先确认请求者有权限访问 modelBox
+func (p *InferenceProxy) serve(w http.ResponseWriter, r *http.Request, modelBox *modelv1.ModelBox, upstreamPath string) {
+	start := time.Now()
+	namespace, name := modelBox.Namespace, modelBox.Name
+	recorder := &statusRecorder{ResponseWriter: w}
+	defer func() {
+		code := recorder.status
+		if code == 0 {
+			code = http.StatusOK
+		}
+		requestsTotal.WithLabelValues(namespace, name, strconv.Itoa(code)).Inc()
+		requestDuration.WithLabelValues(namespace, name).Observe(time.Since(start).Seconds())
+	}()
+
+	spec, err := appliedSpec(modelBox)
+	if err != nil {
+		writeError(recorder, err)
+		return
+	}
+	target, err := p.serviceURL(modelBox, spec.Exposure.Ports)
+	if err != nil {
+		writeError(recorder, err)
+		return
+	}
+
+	release, ok := p.acquire(namespace + "/" + name)
+	if !ok {
+		writeError(recorder, k8serrors.NewTooManyRequests(
+			fmt.Sprintf("too many concurrent inference requests for modelbox %s/%s", namespace, name), 1))
+		return
+	}
+	defer release()
+	inflightRequests.WithLabelValues(namespace, name).Inc()
+	defer inflightRequests.WithLabelValues(namespace, name).Dec()
+
+	// 读取完整的请求体, 以便连接失败时重放
+	body, err := ioutil.ReadAll(http.MaxBytesReader(recorder, r.Body, p.opts.MaxRequestBytes))
+	if err != nil {
+		writeError(recorder, k8serrors.NewRequestEntityTooLargeError(err.Error()))
+		return
+	}
+
+	// 配置了 idleTimeout 的 ModelBox 可能已缩容到 0, 请求在此等待 Pod 就绪
+	if spec.Scaling.IdleTimeout != nil && p.activator != nil {
+		if err := p.activator.activate(r.Context(), modelBox, spec); err != nil {
+			p.handleError(recorder, r, modelBox, err)
+			return
+		}
+		p.activator.recordActivity(modelBox, spec.Scaling.IdleTimeout.Duration)
+	}
+
+	ctx := r.Context()
+	if p.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.opts.Timeout)
+		defer cancel()
+	}
+	outreq := r.WithContext(withRetryMetrics(ctx, namespace, name))
+	outreq.ContentLength = int64(len(body))
+	outreq.Body = ioutil.NopCloser(bytes.NewReader(body))
+	outreq.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+
+	reverseProxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = target.Scheme
+			req.URL.Host = target.Host
+			req.URL.Path = upstreamPath
+			req.URL.RawPath = ""
+			req.Host = target.Host
+			// 认证信息只用于 apigateway, 不转发给模型服务
+			req.Header.Del("Authorization")
+		},
+		Transport: p.transport,
+		// 推理结果可能以流的形式返回, 立即刷新给客户端
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			p.handleError(w, req, modelBox, err)
+		},
+	}
+	reverseProxy.ServeHTTP(recorder, outreq)
+}
+
+// appliedSpec ModelBox 实际生效的 spec. 端口与 idleTimeout 可能由模板提供, v1 对象中没有,
+// 因此优先使用控制器记录的合并了模板的 spec, 控制器尚未处理该 ModelBox 时按 v1 的字段转换
+func appliedSpec(modelBox *modelv1.ModelBox) (*modelv2.ModelBoxSpec, error) {
+	if data, ok := modelBox.Annotations[modelv2.AppliedSpecAnnotation]; ok {
+		spec := &modelv2.ModelBoxSpec{}
+		if err := json.Unmarshal([]byte(data), spec); err == nil {
+			return spec, nil
+		}
+		logrus.Warnf("modelbox %s/%s has a malformed %s annotation", modelBox.Namespace, modelBox.Name, modelv2.AppliedSpecAnnotation)
+	}
+	hub := &modelv2.ModelBox{}
+	if err := modelBox.DeepCopy().ConvertTo(hub); err != nil {
+		return nil, k8serrors.NewInternalError(err)
+	}
+	return &hub.Spec, nil
+}
+
+// serviceURL 控制器创建的 Service 与 ModelBox 同名, 端口与 Service 一致, 优先使用名为 http 的端口, 否则使用第一个 TCP 端口
+func (p *InferenceProxy) serviceURL(modelBox *modelv1.ModelBox, ports []corev1.ServicePort) (*url.URL, error) {
+	var port *corev1.ServicePort
+	for i := range ports {
+		candidate := &ports[i]
+		if candidate.Protocol != "" && candidate.Protocol != corev1.ProtocolTCP {
+			continue
+		}
+		if candidate.Name == "http" {
+			port = candidate
+			break
+		}
+		if port == nil {
+			port = candidate
+		}
+	}
+	if port == nil {
+		return nil, k8serrors.NewServiceUnavailable(
+			fmt.Sprintf("modelbox %s/%s does not expose any TCP port", modelBox.Namespace, modelBox.Name))
+	}
+	host := fmt.Sprintf("%s.%s.svc.%s", modelBox.Name, modelBox.Namespace, p.opts.ClusterDomain)
+	return &url.URL{Scheme: "http", Host: net.JoinHostPort(host, strconv.Itoa(int(port.Port)))}, nil
+}
+
+// acquire 占用 key 对应模型的一个并发名额, 名额用尽时立即返回 false, 由客户端稍后重试
+func (p *InferenceProxy) acquire(key string) (func(), bool) {
+	if p.opts.MaxConcurrency <= 0 {
+		return func() {}, true
+	}
+	p.mu.Lock()
+	limiter, ok := p.limiters[key]
+	if !ok {
+		limiter = make(chan struct{}, p.opts.MaxConcurrency)
+		p.limiters[key] = limiter
+	}
+	p.mu.Unlock()
+
+	select {
+	case limiter <- struct{}{}:
+		return func() { <-limiter }, true
+	default:
+		return nil, false
+	}
+}
+
+// handleError 将转发失败转换为 metav1.Status: 超时返回 504, 连接失败返回 503
+func (p *InferenceProxy) handleError(w http.ResponseWriter, r *http.Request, modelBox *modelv1.ModelBox, err error) {
+	if _, ok := err.(k8serrors.APIStatus); ok {
+		// 激活失败等已经是 metav1.Status 的错误原样返回
+		writeError(w, err)
+		return
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		writeError(w, k8serrors.NewTimeoutError(
+			fmt.Sprintf("inference request to modelbox %s/%s timed out after %s", modelBox.Namespace, modelBox.Name, p.opts.Timeout), 0))
+	case errors.Is(err, context.Canceled):
+		// 客户端已断开, 无需返回响应
+		logrus.Debugf("inference request to modelbox %s/%s canceled by client", modelBox.Namespace, modelBox.Name)
+		w.WriteHeader(statusClientClosedRequest)
+	default:
+		logrus.Warnf("inference request to modelbox %s/%s failed: %v", modelBox.Namespace, modelBox.Name, err)
+		writeError(w, k8serrors.NewServiceUnavailable(
+			fmt.Sprintf("modelbox %s/%s is unavailable: %v", modelBox.Namespace, modelBox.Name, err)))
+	}
+}
+
+// statusRecorder 记录响应状态码用于指标统计
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher, ReverseProxy 依赖它及时刷新流式响应
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,354 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+
+	modelv1 "github.com/sharelinuxs/my-first-opeartor/api/v1"
+	modelv2 "github.com/sharelinuxs/my-first-opeartor/api/v2"
+	"github.com/sharelinuxs/my-first-opeartor/apigateway/clientset/fake"
+)
+
+func int32Ptr(i int32) *int32 { return &i }
+
+// withAppliedSpec 模拟控制器记录的合并了模板的 spec
+func withAppliedSpec(t *testing.T, modelBox *modelv1.ModelBox, spec modelv2.ModelBoxSpec) *modelv1.ModelBox {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if modelBox.Annotations == nil {
+		modelBox.Annotations = map[string]string{}
+	}
+	modelBox.Annotations[modelv2.AppliedSpecAnnotation] = string(data)
+	return modelBox
+}
+
+func newInferenceModelBox() *modelv1.ModelBox {
+	return &modelv1.ModelBox{
+		ObjectMeta: metav1.ObjectMeta{Name: "resnet", Namespace: "default"},
+		Spec: modelv1.ModelBoxSpec{
+			Image:       "resnet:1",
+			TemplateRef: &modelv1.TemplateReference{Kind: "ClusterModelBoxTemplate", Name: "gpu"},
+		},
+	}
+}
+
+func TestServiceURL(t *testing.T) {
+	templatePorts := modelv2.ModelBoxSpec{
+		Serving: modelv2.ServingSpec{Image: "resnet:1"},
+		Exposure: modelv2.ExposureSpec{Ports: []corev1.ServicePort{
+			{Name: "grpc", Port: 8500},
+			{Name: "http", Port: 8501, TargetPort: intstr.FromString("http")},
+		}},
+	}
+	tests := []struct {
+		name     string
+		modelBox func() *modelv1.ModelBox
+		want     string
+		wantErr  bool
+	}{
+		{
+			name: "ports from the template",
+			modelBox: func() *modelv1.ModelBox {
+				return withAppliedSpec(t, newInferenceModelBox(), templatePorts)
+			},
+			want: "http://resnet.default.svc.cluster.local:8501",
+		},
+		{
+			name: "ports from the ModelBox before the controller records the spec",
+			modelBox: func() *modelv1.ModelBox {
+				m := newInferenceModelBox()
+				m.Spec.Ports = []corev1.ServicePort{{Port: 80}}
+				return m
+			},
+			want: "http://resnet.default.svc.cluster.local:80",
+		},
+		{
+			name: "malformed annotation falls back to the ModelBox",
+			modelBox: func() *modelv1.ModelBox {
+				m := newInferenceModelBox()
+				m.Spec.Ports = []corev1.ServicePort{{Port: 80}}
+				m.Annotations = map[string]string{modelv2.AppliedSpecAnnotation: "{"}
+				return m
+			},
+			want: "http://resnet.default.svc.cluster.local:80",
+		},
+		{
+			name: "UDP ports are skipped",
+			modelBox: func() *modelv1.ModelBox {
+				return withAppliedSpec(t, newInferenceModelBox(), modelv2.ModelBoxSpec{
+					Exposure: modelv2.ExposureSpec{Ports: []corev1.ServicePort{
+						{Name: "metrics", Port: 9125, Protocol: corev1.ProtocolUDP},
+						{Name: "grpc", Port: 8500, Protocol: corev1.ProtocolTCP},
+					}},
+				})
+			},
+			want: "http://resnet.default.svc.cluster.local:8500",
+		},
+		{
+			name:     "no ports",
+			modelBox: newInferenceModelBox,
+			wantErr:  true,
+		},
+	}
+	p := NewInferenceProxy(InferenceOptions{}, nil, nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modelBox := tt.modelBox()
+			spec, err := appliedSpec(modelBox)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := p.serviceURL(modelBox, spec.Exposure.Ports)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, wantErr %t", err, tt.wantErr)
+			}
+			if err == nil && got.String() != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestServeActivatesWithTemplateIdleTimeout idleTimeout 由模板提供时同样需要激活已缩容到 0 的 ModelBox
+func TestServeActivatesWithTemplateIdleTimeout(t *testing.T) {
+	tests := []struct {
+		name         string
+		spec         modelv2.ModelBoxSpec
+		wantCode     int
+		wantActivate bool
+	}{
+		{
+			name: "idle timeout from the template",
+			spec: modelv2.ModelBoxSpec{
+				Scaling:  modelv2.ScalingSpec{IdleTimeout: &metav1.Duration{Duration: 10 * time.Minute}},
+				Exposure: modelv2.ExposureSpec{Ports: []corev1.ServicePort{{Port: 80}}},
+			},
+			// Pod 始终没有就绪, 等待激活超时
+			wantCode:     http.StatusGatewayTimeout,
+			wantActivate: true,
+		},
+		{
+			name: "scaled to 0 replicas by the user",
+			spec: modelv2.ModelBoxSpec{
+				Scaling:  modelv2.ScalingSpec{Replicas: int32Ptr(0), IdleTimeout: &metav1.Duration{Duration: 10 * time.Minute}},
+				Exposure: modelv2.ExposureSpec{Ports: []corev1.ServicePort{{Port: 80}}},
+			},
+			wantCode: http.StatusServiceUnavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modelBox := withAppliedSpec(t, newInferenceModelBox(), tt.spec)
+			modelClient := fake.NewSimpleClientset(modelBox.DeepCopy())
+			p := NewInferenceProxy(InferenceOptions{
+				MaxRequestBytes:        1 << 20,
+				ActivationTimeout:      200 * time.Millisecond,
+				ActivityReportInterval: time.Minute,
+			}, modelClient, kubefake.NewSimpleClientset())
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/v1/models/default/resnet:predict", strings.NewReader("{}"))
+			p.serve(w, r, modelBox, "/v1/models/resnet:predict")
+			if w.Code != tt.wantCode {
+				t.Errorf("got status %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+
+			activated := false
+			for _, action := range modelClient.Actions() {
+				activated = activated || action.GetVerb() == "patch"
+			}
+			if activated != tt.wantActivate {
+				t.Errorf("got activation %t, want %t", activated, tt.wantActivate)
+			}
+			if !tt.wantActivate {
+				return
+			}
+			got, err := modelClient.Tracker().Get(modelv1.GroupVersion.WithResource("modelboxes"), "default", "resnet")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := got.(*modelv1.ModelBox).Annotations[modelv2.LastActivityAnnotation]; !ok {
+				t.Errorf("activation did not set the %s annotation", modelv2.LastActivityAnnotation)
+			}
+		})
+	}
+}
+
+// newTestProxy 使用 next 代替到模型服务的连接
+func newTestProxy(opts InferenceOptions, next http.RoundTripper) *InferenceProxy {
+	if opts.MaxRequestBytes == 0 {
+		opts.MaxRequestBytes = 1 << 20
+	}
+	p := NewInferenceProxy(opts, nil, nil)
+	p.transport = &retryTransport{next: next, retries: opts.Retries, backoff: time.Millisecond}
+	return p
+}
+
+func TestServeForwards(t *testing.T) {
+	var upstream *http.Request
+	next := &fakeTransport{handle: func(req *http.Request) (*http.Response, error) {
+		upstream = req
+		return &http.Response{
+			StatusCode: http.StatusCreated,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       ioutil.NopCloser(strings.NewReader(`{"predictions":[1]}`)),
+			Request:    req,
+		}, nil
+	}}
+	p := newTestProxy(InferenceOptions{}, next)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/v1/models/default/resnet:predict?verbose=1", strings.NewReader(`{"instances":[1]}`))
+	r.Header.Set("Authorization", "Bearer token")
+	p.serve(w, r, newTestModelBox("resnet", nil), "/v1/models/resnet:predict")
+
+	if w.Code != http.StatusCreated || w.Body.String() != `{"predictions":[1]}` {
+		t.Errorf("got response %d %s", w.Code, w.Body.String())
+	}
+	if upstream == nil {
+		t.Fatal("request was not forwarded")
+	}
+	if got := upstream.URL.String(); got != "http://resnet.default.svc.cluster.local:80/v1/models/resnet:predict?verbose=1" {
+		t.Errorf("got upstream URL %s", got)
+	}
+	if upstream.Header.Get("Authorization") != "" {
+		t.Error("Authorization header forwarded to the model server")
+	}
+	if next.bodies[0] != `{"instances":[1]}` {
+		t.Errorf("got upstream body %q", next.bodies[0])
+	}
+}
+
+func TestServeErrors(t *testing.T) {
+	tests := []struct {
+		name         string
+		opts         InferenceOptions
+		modelBox     func() *modelv1.ModelBox
+		errs         []error
+		handle       func(req *http.Request) (*http.Response, error)
+		body         string
+		wantCode     int
+		wantAttempts int
+	}{
+		{
+			name:         "connection refused after retries",
+			opts:         InferenceOptions{Retries: 2},
+			errs:         []error{errDial, errDial, errDial},
+			wantCode:     http.StatusServiceUnavailable,
+			wantAttempts: 3,
+		},
+		{
+			name:         "connected on retry",
+			opts:         InferenceOptions{Retries: 2},
+			errs:         []error{errDial},
+			wantCode:     http.StatusOK,
+			wantAttempts: 2,
+		},
+		{
+			name: "timeout",
+			opts: InferenceOptions{Timeout: 20 * time.Millisecond},
+			handle: func(req *http.Request) (*http.Response, error) {
+				<-req.Context().Done()
+				return nil, req.Context().Err()
+			},
+			wantCode:     http.StatusGatewayTimeout,
+			wantAttempts: 1,
+		},
+		{
+			name:     "request body too large",
+			opts:     InferenceOptions{MaxRequestBytes: 8},
+			body:     `{"instances":[1,2,3]}`,
+			wantCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name: "no TCP port",
+			modelBox: func() *modelv1.ModelBox {
+				m := newTestModelBox("resnet", nil)
+				m.Spec.Ports = []corev1.ServicePort{{Port: 53, Protocol: corev1.ProtocolUDP}}
+				return m
+			},
+			wantCode: http.StatusServiceUnavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := &fakeTransport{errs: tt.errs, handle: tt.handle}
+			p := newTestProxy(tt.opts, next)
+			modelBox := newTestModelBox("resnet", nil)
+			if tt.modelBox != nil {
+				modelBox = tt.modelBox()
+			}
+			body := tt.body
+			if body == "" {
+				body = "{}"
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/v1/models/default/resnet:predict", strings.NewReader(body))
+			p.serve(w, r, modelBox, "/v1/models/resnet:predict")
+			if w.Code != tt.wantCode {
+				t.Errorf("got status %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if tt.wantCode != http.StatusOK {
+				var status metav1.Status
+				if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil || status.Code != int32(tt.wantCode) {
+					t.Errorf("got body %s, want a Status with code %d", w.Body.String(), tt.wantCode)
+				}
+			}
+			if next.attempts() != tt.wantAttempts {
+				t.Errorf("got %d attempts, want %d", next.attempts(), tt.wantAttempts)
+			}
+		})
+	}
+}
+
+// TestServeConcurrencyLimit 名额用尽时立即返回 429, 不同的 ModelBox 互不影响
+func TestServeConcurrencyLimit(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	next := &fakeTransport{handle: func(req *http.Request) (*http.Response, error) {
+		if strings.HasPrefix(req.URL.Host, "resnet.") {
+			started <- struct{}{}
+			<-release
+		}
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: ioutil.NopCloser(strings.NewReader("{}")), Request: req}, nil
+	}}
+	p := newTestProxy(InferenceOptions{MaxConcurrency: 1}, next)
+	serveModel := func(name string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/models/default/"+name+":predict", strings.NewReader("{}"))
+		p.serve(w, r, newTestModelBox(name, nil), "/v1/models/"+name+":predict")
+		return w
+	}
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- serveModel("resnet") }()
+	<-started
+	if w := serveModel("resnet"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("got status %d for the second request, want 429", w.Code)
+	}
+	if w := serveModel("bert"); w.Code != http.StatusOK {
+		t.Errorf("got status %d for another ModelBox, want 200", w.Code)
+	}
+	close(release)
+	if w := <-done; w.Code != http.StatusOK {
+		t.Errorf("got status %d for the first request, want 200", w.Code)
+	}
+	// 名额释放后可以继续处理
+	go func() { <-started }()
+	if w := serveModel("resnet"); w.Code != http.StatusOK {
+		t.Errorf("got status %d after the slot was released, want 200", w.Code)
+	}
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// statusClientClosedRequest 客户端在响应前断开连接, 仅用于指标统计, 与 nginx 的 499 一致
+const statusClientClosedRequest = 499
+
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "apigateway",
+		Subsystem: "inference",
+		Name:      "requests_total",
+		Help:      "Total number of inference requests by ModelBox and HTTP status code.",
+	}, []string{"namespace", "modelbox", "code"})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "apigateway",
+		Subsystem: "inference",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of inference requests by ModelBox, including retries.",
+		Buckets:   []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"namespace", "modelbox"})
+
+	inflightRequests = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "apigateway",
+		Subsystem: "inference",
+		Name:      "inflight_requests",
+		Help:      "Number of inference requests currently being forwarded by ModelBox.",
+	}, []string{"namespace", "modelbox"})
+
+	upstreamRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "apigateway",
+		Subsystem: "inference",
+		Name:      "upstream_retries_total",
+		Help:      "Total number of inference requests retried after a connection error by ModelBox.",
+	}, []string{"namespace", "modelbox"})
+
+	activations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "apigateway",
+		Subsystem: "inference",
+		Name:      "activations_total",
+		Help:      "Total number of activations of ModelBoxes scaled to zero.",
+	}, []string{"namespace", "modelbox"})
+
+	activationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "apigateway",
+		Subsystem: "inference",
+		Name:      "activation_duration_seconds",
+		Help:      "Time from requesting activation of a ModelBox until its Service has ready endpoints.",
+		Buckets:   []float64{1, 2.5, 5, 10, 20, 30, 60, 120, 300, 600},
+	}, []string{"namespace", "modelbox"})
+)
+
+func init() {
+	prometheus.MustRegister(requestsTotal, requestDuration, inflightRequests, upstreamRetries, activations, activationDuration)
+}
+
+// retryMetricsKey context 中保存重试指标所属的 ModelBox
+type retryMetricsKey struct{}
+
+func withRetryMetrics(ctx context.Context, namespace, name string) context.Context {
+	return context.WithValue(ctx, retryMetricsKey{}, upstreamRetries.WithLabelValues(namespace, name))
+}
+
+func retryCounterFrom(ctx context.Context) prometheus.Counter {
+	counter, _ := ctx.Value(retryMetricsKey{}).(prometheus.Counter)
+	return counter
+}
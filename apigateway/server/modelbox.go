@@ -0,0 +1,235 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+
+	clientsetv1 "github.com/sharelinuxs/my-first-opeartor/apigateway/clientset/v1"
+)
+
+// maxRequestBodyBytes 请求体大小上限, 与 kube-apiserver 保持一致
+const maxRequestBodyBytes = 3 * 1024 * 1024
+
+// optionsGroupVersion ListOptions/CreateOptions 等参数所在的版本
+var optionsGroupVersion = schema.GroupVersion{Version: "v1"}
+
+func (s *Server) listModelBoxes(w http.ResponseWriter, r *http.Request, namespace string) {
+	opts := metav1.ListOptions{}
+	if err := decodeOptions(r, &opts); err != nil {
+		writeError(w, err)
+		return
+	}
+	modelBoxes, err := s.modelBoxes(r, namespace)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	list, err := modelBoxes.List(r.Context(), opts)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) getModelBox(w http.ResponseWriter, r *http.Request, namespace, name string) {
+	opts := metav1.GetOptions{}
+	if err := decodeOptions(r, &opts); err != nil {
+		writeError(w, err)
+		return
+	}
+	modelBoxes, err := s.modelBoxes(r, namespace)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	modelBox, err := modelBoxes.Get(r.Context(), name, opts)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, modelBox)
+}
+
+func (s *Server) createModelBox(w http.ResponseWriter, r *http.Request, namespace string) {
+	opts := metav1.CreateOptions{}
+	if err := decodeOptions(r, &opts); err != nil {
+		writeError(w, err)
+		return
+	}
+	modelBox, err := decodeModelBox(r, namespace)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if errs := validateModelBox(modelBox); len(errs) > 0 {
+		writeError(w, k8serrors.NewInvalid(modelBoxGroupKind, modelBox.Name, errs))
+		return
+	}
+	modelBoxes, err := s.modelBoxes(r, namespace)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	created, err := modelBoxes.Create(r.Context(), modelBox, opts)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, created)
+}
+
+func (s *Server) updateModelBox(w http.ResponseWriter, r *http.Request, namespace, name string) {
+	opts := metav1.UpdateOptions{}
+	if err := decodeOptions(r, &opts); err != nil {
+		writeError(w, err)
+		return
+	}
+	modelBox, err := decodeModelBox(r, namespace)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if modelBox.Name != name {
+		writeError(w, k8serrors.NewBadRequest(fmt.Sprintf("the name of the object (%s) does not match the name on the URL (%s)", modelBox.Name, name)))
+		return
+	}
+	if errs := validateModelBox(modelBox); len(errs) > 0 {
+		writeError(w, k8serrors.NewInvalid(modelBoxGroupKind, modelBox.Name, errs))
+		return
+	}
+	modelBoxes, err := s.modelBoxes(r, namespace)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	updated, err := modelBoxes.Update(r.Context(), modelBox, opts)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, updated)
+}
+
+func (s *Server) patchModelBox(w http.ResponseWriter, r *http.Request, namespace, name string) {
+	opts := metav1.PatchOptions{}
+	if err := decodeOptions(r, &opts); err != nil {
+		writeError(w, err)
+		return
+	}
+	patchType, err := patchTypeFor(r.Header.Get("Content-Type"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	data, err := readBody(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if !json.Valid(data) && patchType != types.ApplyPatchType {
+		writeError(w, k8serrors.NewBadRequest("the patch body is not valid JSON"))
+		return
+	}
+	modelBoxes, err := s.modelBoxes(r, namespace)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	patched, err := modelBoxes.Patch(r.Context(), name, patchType, data, opts)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, patched)
+}
+
+func (s *Server) deleteModelBox(w http.ResponseWriter, r *http.Request, namespace, name string) {
+	opts := metav1.DeleteOptions{}
+	if err := decodeOptions(r, &opts); err != nil {
+		writeError(w, err)
+		return
+	}
+	// 与 kube-apiserver 一样, DeleteOptions 也可以放在请求体中
+	data, err := readBody(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &opts); err != nil {
+			writeError(w, k8serrors.NewBadRequest(err.Error()))
+			return
+		}
+	}
+	modelBoxes, err := s.modelBoxes(r, namespace)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := modelBoxes.Delete(r.Context(), name, opts); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, &metav1.Status{
+		TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+		Status:   metav1.StatusSuccess,
+		Code:     http.StatusOK,
+		Details: &metav1.StatusDetails{
+			Name:  name,
+			Group: modelBoxGroupResource.Group,
+			Kind:  modelBoxGroupResource.Resource,
+		},
+	})
+}
+
+// decodeOptions 将 query 参数解析为 ListOptions/CreateOptions 等
+func decodeOptions(r *http.Request, opts runtime.Object) error {
+	if err := clientsetv1.ParameterCodec.DecodeParameters(r.URL.Query(), optionsGroupVersion, opts); err != nil {
+		return k8serrors.NewBadRequest(err.Error())
+	}
+	return nil
+}
+
+// readBody 读取请求体, 超过 maxRequestBodyBytes 返回 413
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(r.Body, maxRequestBodyBytes+1))
+	if err != nil {
+		return nil, k8serrors.NewBadRequest(err.Error())
+	}
+	if len(data) > maxRequestBodyBytes {
+		return nil, k8serrors.NewRequestEntityTooLargeError(fmt.Sprintf("limit is %d", maxRequestBodyBytes))
+	}
+	return data, nil
+}
+
+// patchTypeFor 根据 Content-Type 选择 patch 类型, CRD 不支持 strategic merge patch
+func patchTypeFor(contentType string) (types.PatchType, error) {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		contentType = mediaType
+	}
+	switch types.PatchType(contentType) {
+	case "", "application/json", types.MergePatchType:
+		return types.MergePatchType, nil
+	case types.JSONPatchType:
+		return types.JSONPatchType, nil
+	case types.ApplyPatchType:
+		return types.ApplyPatchType, nil
+	}
+	return "", k8serrors.NewGenericServerResponse(http.StatusUnsupportedMediaType, "patch", modelBoxGroupResource, "",
+		fmt.Sprintf("the body of the request was in an unknown format - accepted media types include: %s, %s, %s",
+			types.MergePatchType, types.JSONPatchType, types.ApplyPatchType), 0, false)
+}
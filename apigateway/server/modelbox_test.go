@@ -0,0 +1,340 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	modelv1 "github.com/sharelinuxs/my-first-opeartor/api/v1"
+	"github.com/sharelinuxs/my-first-opeartor/apigateway/clientset/fake"
+)
+
+const modelBoxesPath = "/api/v1/namespaces/default/modelboxes"
+
+func newTestModelBox(name string, labels map[string]string) *modelv1.ModelBox {
+	return &modelv1.ModelBox{
+		TypeMeta:   metav1.TypeMeta{APIVersion: modelv1.GroupVersion.String(), Kind: modelv1.Kind},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: labels},
+		Spec: modelv1.ModelBoxSpec{
+			Image: name + ":1",
+			Ports: []corev1.ServicePort{{Port: 80}},
+		},
+	}
+}
+
+// newTestServer 使用 fake clientset 且不做认证的 apigateway
+func newTestServer(objs ...runtime.Object) (*Server, *fake.Clientset) {
+	client := fake.NewSimpleClientset(objs...)
+	return NewServer(NewStaticClientProvider(client), nil, nil), client
+}
+
+func serve(s *Server, method, path, contentType, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	return w
+}
+
+func toJSON(t *testing.T, obj interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// checkResponse 检查状态码, out 不为 nil 时将响应解析到 out 中
+func checkResponse(t *testing.T, w *httptest.ResponseRecorder, wantCode int, out interface{}) {
+	t.Helper()
+	if w.Code != wantCode {
+		t.Fatalf("got status %d, want %d: %s", w.Code, wantCode, w.Body.String())
+	}
+	if out != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+			t.Fatalf("decode response %s: %v", w.Body.String(), err)
+		}
+	}
+}
+
+func getModelBox(t *testing.T, client *fake.Clientset, name string) (*modelv1.ModelBox, error) {
+	t.Helper()
+	obj, err := client.Tracker().Get(modelv1.GroupVersion.WithResource("modelboxes"), "default", name)
+	if err != nil {
+		return nil, err
+	}
+	return obj.(*modelv1.ModelBox), nil
+}
+
+func TestListModelBoxes(t *testing.T) {
+	other := newTestModelBox("bert", nil)
+	other.Namespace = "other"
+	s, _ := newTestServer(
+		newTestModelBox("resnet", map[string]string{"team": "vision"}),
+		newTestModelBox("yolo", map[string]string{"team": "vision"}),
+		newTestModelBox("gpt", map[string]string{"team": "nlp"}),
+		other,
+	)
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{query: "", want: []string{"gpt", "resnet", "yolo"}},
+		{query: "?labelSelector=team%3Dvision", want: []string{"resnet", "yolo"}},
+		{query: "?labelSelector=team%3Daudio"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			var list modelv1.ModelBoxList
+			checkResponse(t, serve(s, http.MethodGet, modelBoxesPath+tt.query, "", ""), http.StatusOK, &list)
+			var names []string
+			for _, item := range list.Items {
+				names = append(names, item.Name)
+			}
+			if strings.Join(names, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("got %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetModelBox(t *testing.T) {
+	s, _ := newTestServer(newTestModelBox("resnet", nil))
+
+	var got modelv1.ModelBox
+	checkResponse(t, serve(s, http.MethodGet, modelBoxesPath+"/resnet", "", ""), http.StatusOK, &got)
+	if got.Spec.Image != "resnet:1" {
+		t.Errorf("got image %s, want resnet:1", got.Spec.Image)
+	}
+
+	var status metav1.Status
+	checkResponse(t, serve(s, http.MethodGet, modelBoxesPath+"/bert", "", ""), http.StatusNotFound, &status)
+	if status.Reason != metav1.StatusReasonNotFound || status.Kind != "Status" {
+		t.Errorf("got status %+v, want a NotFound Status", status)
+	}
+}
+
+func TestCreateModelBox(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       func(t *testing.T) string
+		wantCode   int
+		wantReason metav1.StatusReason
+	}{
+		{
+			name:     "created",
+			body:     func(t *testing.T) string { return toJSON(t, newTestModelBox("bert", nil)) },
+			wantCode: http.StatusCreated,
+		},
+		{
+			name: "apiVersion, kind and namespace default to the request",
+			body: func(t *testing.T) string {
+				return `{"metadata":{"name":"bert"},"spec":{"image":"bert:1","ports":[{"port":80}]}}`
+			},
+			wantCode: http.StatusCreated,
+		},
+		{
+			name:       "already exists",
+			body:       func(t *testing.T) string { return toJSON(t, newTestModelBox("resnet", nil)) },
+			wantCode:   http.StatusConflict,
+			wantReason: metav1.StatusReasonAlreadyExists,
+		},
+		{
+			name: "namespace mismatch",
+			body: func(t *testing.T) string {
+				m := newTestModelBox("bert", nil)
+				m.Namespace = "other"
+				return toJSON(t, m)
+			},
+			wantCode:   http.StatusBadRequest,
+			wantReason: metav1.StatusReasonBadRequest,
+		},
+		{
+			name: "unknown field",
+			body: func(t *testing.T) string {
+				return `{"metadata":{"name":"bert"},"spec":{"image":"bert:1","imageTag":"1"}}`
+			},
+			wantCode:   http.StatusUnprocessableEntity,
+			wantReason: metav1.StatusReasonInvalid,
+		},
+		{
+			name: "missing image",
+			body: func(t *testing.T) string {
+				m := newTestModelBox("bert", nil)
+				m.Spec.Image = ""
+				return toJSON(t, m)
+			},
+			wantCode:   http.StatusUnprocessableEntity,
+			wantReason: metav1.StatusReasonInvalid,
+		},
+		{
+			name: "image and ports from a template",
+			body: func(t *testing.T) string {
+				return `{"metadata":{"name":"bert"},"spec":{"templateRef":{"name":"gpu"}}}`
+			},
+			wantCode: http.StatusCreated,
+		},
+		{
+			name: "ports set with a template are validated",
+			body: func(t *testing.T) string {
+				return `{"metadata":{"name":"bert"},"spec":{"templateRef":{"name":"gpu"},"ports":[{"port":0}]}}`
+			},
+			wantCode:   http.StatusUnprocessableEntity,
+			wantReason: metav1.StatusReasonInvalid,
+		},
+		{
+			name: "missing ports",
+			body: func(t *testing.T) string {
+				return `{"metadata":{"name":"bert"},"spec":{"image":"bert:1"}}`
+			},
+			wantCode:   http.StatusUnprocessableEntity,
+			wantReason: metav1.StatusReasonInvalid,
+		},
+		{
+			name:       "empty body",
+			body:       func(t *testing.T) string { return "" },
+			wantCode:   http.StatusBadRequest,
+			wantReason: metav1.StatusReasonBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, client := newTestServer(newTestModelBox("resnet", nil))
+			w := serve(s, http.MethodPost, modelBoxesPath, "application/json", tt.body(t))
+			if tt.wantCode != http.StatusCreated {
+				var status metav1.Status
+				checkResponse(t, w, tt.wantCode, &status)
+				if status.Reason != tt.wantReason {
+					t.Errorf("got reason %s, want %s", status.Reason, tt.wantReason)
+				}
+				return
+			}
+			var created modelv1.ModelBox
+			checkResponse(t, w, tt.wantCode, &created)
+			if _, err := getModelBox(t, client, created.Name); err != nil {
+				t.Errorf("created ModelBox not stored: %v", err)
+			}
+		})
+	}
+}
+
+func TestUpdateModelBox(t *testing.T) {
+	s, client := newTestServer(newTestModelBox("resnet", nil))
+
+	updated := newTestModelBox("resnet", nil)
+	updated.Spec.Image = "resnet:2"
+	checkResponse(t, serve(s, http.MethodPut, modelBoxesPath+"/resnet", "application/json", toJSON(t, updated)), http.StatusOK, nil)
+	stored, err := getModelBox(t, client, "resnet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Spec.Image != "resnet:2" {
+		t.Errorf("got image %s, want resnet:2", stored.Spec.Image)
+	}
+
+	checkResponse(t, serve(s, http.MethodPut, modelBoxesPath+"/bert", "application/json", toJSON(t, updated)), http.StatusBadRequest, nil)
+	missing := newTestModelBox("bert", nil)
+	checkResponse(t, serve(s, http.MethodPut, modelBoxesPath+"/bert", "application/json", toJSON(t, missing)), http.StatusNotFound, nil)
+}
+
+func TestPatchModelBox(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantCode    int
+		wantImage   string
+	}{
+		{
+			name:        "merge patch",
+			contentType: "application/merge-patch+json",
+			body:        `{"spec":{"image":"resnet:2"}}`,
+			wantCode:    http.StatusOK,
+			wantImage:   "resnet:2",
+		},
+		{
+			name:      "plain JSON is a merge patch",
+			body:      `{"spec":{"image":"resnet:3"}}`,
+			wantCode:  http.StatusOK,
+			wantImage: "resnet:3",
+		},
+		{
+			name:        "JSON patch",
+			contentType: "application/json-patch+json",
+			body:        `[{"op":"replace","path":"/spec/image","value":"resnet:4"}]`,
+			wantCode:    http.StatusOK,
+			wantImage:   "resnet:4",
+		},
+		{
+			name:        "strategic merge patch is not supported",
+			contentType: "application/strategic-merge-patch+json",
+			body:        `{"spec":{"image":"resnet:2"}}`,
+			wantCode:    http.StatusUnsupportedMediaType,
+			wantImage:   "resnet:1",
+		},
+		{
+			name:        "invalid JSON",
+			contentType: "application/merge-patch+json",
+			body:        `{"spec":`,
+			wantCode:    http.StatusBadRequest,
+			wantImage:   "resnet:1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, client := newTestServer(newTestModelBox("resnet", nil))
+			checkResponse(t, serve(s, http.MethodPatch, modelBoxesPath+"/resnet", tt.contentType, tt.body), tt.wantCode, nil)
+			stored, err := getModelBox(t, client, "resnet")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.Spec.Image != tt.wantImage {
+				t.Errorf("got image %s, want %s", stored.Spec.Image, tt.wantImage)
+			}
+		})
+	}
+}
+
+func TestDeleteModelBox(t *testing.T) {
+	s, client := newTestServer(newTestModelBox("resnet", nil))
+
+	var status metav1.Status
+	checkResponse(t, serve(s, http.MethodDelete, modelBoxesPath+"/resnet", "", `{"propagationPolicy":"Foreground"}`), http.StatusOK, &status)
+	if status.Status != metav1.StatusSuccess || status.Details == nil || status.Details.Name != "resnet" {
+		t.Errorf("got status %+v, want Success for resnet", status)
+	}
+	if _, err := getModelBox(t, client, "resnet"); err == nil {
+		t.Error("ModelBox still exists after delete")
+	}
+
+	checkResponse(t, serve(s, http.MethodDelete, modelBoxesPath+"/resnet", "", ""), http.StatusNotFound, nil)
+	checkResponse(t, serve(s, http.MethodDelete, modelBoxesPath+"/bert", "", "{"), http.StatusBadRequest, nil)
+}
+
+func TestServeModelBoxesRouting(t *testing.T) {
+	s, _ := newTestServer()
+	tests := []struct {
+		method   string
+		path     string
+		wantCode int
+	}{
+		{http.MethodDelete, modelBoxesPath, http.StatusMethodNotAllowed},
+		{http.MethodPost, modelBoxesPath + "/resnet", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/api/v1/namespaces/default/pods", http.StatusNotFound},
+		{http.MethodGet, "/api/v1/namespaces/default/modelboxes/resnet/status", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			checkResponse(t, serve(s, tt.method, tt.path, "", ""), tt.wantCode, nil)
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// retryTransport 在连接模型服务失败时重试. 只重试建立连接阶段的错误,
+// 此时请求尚未发出, 即使推理请求不是幂等的也可以安全重试
+type retryTransport struct {
+	next    http.RoundTripper
+	retries int
+	backoff time.Duration
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	backoff := t.backoff
+	for attempt := 0; ; attempt++ {
+		attemptReq := req
+		if attempt > 0 {
+			attemptReq = req.Clone(req.Context())
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				attemptReq.Body = body
+			}
+		}
+		resp, err := t.next.RoundTrip(attemptReq)
+		if err == nil || attempt >= t.retries || !isDialError(err) {
+			return resp, err
+		}
+
+		// Pod 重启或滚动更新时连接会短暂失败, 等待后重试
+		if counter := retryCounterFrom(req.Context()); counter != nil {
+			counter.Inc()
+		}
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// isDialError 判断错误是否发生在建立连接阶段
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return opErr.Op == "dial"
+	}
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr)
+}
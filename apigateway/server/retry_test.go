@@ -0,0 +1,122 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeTransport 依次返回 errs 中的错误, 用完后返回 200, 并记录每次收到的请求体
+type fakeTransport struct {
+	mu     sync.Mutex
+	errs   []error
+	bodies []string
+	// handle 不为 nil 时由它处理请求
+	handle func(req *http.Request) (*http.Response, error)
+}
+
+func (t *fakeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body := ""
+	if req.Body != nil {
+		data, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		body = string(data)
+	}
+	t.mu.Lock()
+	t.bodies = append(t.bodies, body)
+	var err error
+	if len(t.errs) > 0 {
+		err, t.errs = t.errs[0], t.errs[1:]
+	}
+	t.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if t.handle != nil {
+		return t.handle(req)
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(strings.NewReader(`{"predictions":[]}`)),
+		Request:    req,
+	}, nil
+}
+
+func (t *fakeTransport) attempts() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.bodies)
+}
+
+var errDial = &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+func TestRetryTransport(t *testing.T) {
+	errReset := &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}
+	tests := []struct {
+		name         string
+		errs         []error
+		retries      int
+		wantAttempts int
+		wantErr      error
+	}{
+		{name: "no error", retries: 2, wantAttempts: 1},
+		{name: "dial error retried", errs: []error{errDial, errDial}, retries: 2, wantAttempts: 3},
+		{name: "DNS error retried", errs: []error{&net.DNSError{Err: "no such host"}}, retries: 2, wantAttempts: 2},
+		{name: "retries exhausted", errs: []error{errDial, errDial, errDial}, retries: 2, wantAttempts: 3, wantErr: errDial},
+		// 请求可能已经发出, 推理请求不一定是幂等的
+		{name: "read error not retried", errs: []error{errReset}, retries: 2, wantAttempts: 1, wantErr: errReset},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := &fakeTransport{errs: tt.errs}
+			transport := &retryTransport{next: next, retries: tt.retries, backoff: time.Millisecond}
+			req, err := http.NewRequest(http.MethodPost, "http://resnet.default.svc:80/v1/models/resnet:predict", strings.NewReader("{}"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := transport.RoundTrip(req)
+			if err != tt.wantErr {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+			if err == nil {
+				resp.Body.Close()
+			}
+			if next.attempts() != tt.wantAttempts {
+				t.Errorf("got %d attempts, want %d", next.attempts(), tt.wantAttempts)
+			}
+			// 重试时重放完整的请求体
+			for i, body := range next.bodies {
+				if body != "{}" {
+					t.Errorf("attempt %d got body %q, want {}", i, body)
+				}
+			}
+		})
+	}
+}
+
+// TestRetryTransportCanceled 等待重试期间请求取消时立即返回
+func TestRetryTransportCanceled(t *testing.T) {
+	next := &fakeTransport{errs: []error{errDial}}
+	transport := &retryTransport{next: next, retries: 1, backoff: time.Hour}
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://resnet.default.svc:80/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if _, err := transport.RoundTrip(req); err != context.Canceled {
+		t.Errorf("got error %v, want context.Canceled", err)
+	}
+	if next.attempts() != 1 {
+		t.Errorf("got %d attempts, want 1", next.attempts())
+	}
+}
@@ -0,0 +1,240 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/sharelinuxs/my-first-opeartor/apigateway/auth"
+	clientsetv1 "github.com/sharelinuxs/my-first-opeartor/apigateway/clientset/v1"
+	"github.com/sharelinuxs/my-first-opeartor/apigateway/openapi"
+)
+
+const (
+	// modelBoxPathPrefix ModelBox REST 接口前缀, 与 kube-apiserver 的路径保持一致
+	// /api/v1/namespaces/{namespace}/modelboxes[/{name}]
+	modelBoxPathPrefix = "/api/v1/namespaces/"
+	modelBoxResource   = "modelboxes"
+
+	// inferencePathPrefix 推理接口前缀 /v1/models/{namespace}/{name}:predict
+	inferencePathPrefix = "/v1/models/"
+	predictVerb         = ":predict"
+)
+
+// Server 基于 clientset 对外提供 ModelBox 的 HTTP 接口
+type Server struct {
+	clients       ClientProvider
+	authenticator auth.TokenAuthenticator
+	inference     *InferenceProxy
+	mux           *http.ServeMux
+}
+
+// NewServer 创建 apigateway HTTP 服务, authenticator 为 nil 时不做认证, inference 为 nil 时不提供推理接口
+func NewServer(clients ClientProvider, authenticator auth.TokenAuthenticator, inference *InferenceProxy) *Server {
+	s := &Server{
+		clients:       clients,
+		authenticator: authenticator,
+		inference:     inference,
+		mux:           http.NewServeMux(),
+	}
+	s.mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	})
+	// OpenAPI 文档不包含敏感信息, 无需认证, 便于生成客户端
+	s.mux.HandleFunc("/openapi.json", serveOpenAPI)
+	s.mux.Handle("/metrics", promhttp.Handler())
+	s.mux.HandleFunc(modelBoxPathPrefix, s.authenticate(s.serveModelBoxes))
+	if inference != nil {
+		s.mux.HandleFunc(inferencePathPrefix, s.authenticate(s.serveInference))
+	}
+	return s
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// serveOpenAPI 返回 OpenAPI 3 文档
+func serveOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, k8serrors.NewMethodNotSupported(modelBoxGroupResource, r.Method))
+		return
+	}
+	document, err := openapi.Document()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(document)
+}
+
+// authenticate 校验请求的 bearer token, 并将调用方身份保存到请求的 context 中
+func (s *Server) authenticate(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.authenticator == nil {
+			next(w, r)
+			return
+		}
+		token, ok := auth.BearerToken(r)
+		if !ok {
+			writeUnauthorized(w, "a bearer token is required")
+			return
+		}
+		user, ok, err := s.authenticator.AuthenticateToken(r.Context(), token)
+		if err != nil {
+			logrus.Debugf("authenticate request: %v", err)
+		}
+		if !ok {
+			writeUnauthorized(w, "invalid bearer token")
+			return
+		}
+		next(w, r.WithContext(auth.WithUser(r.Context(), user)))
+	}
+}
+
+// modelBoxes 返回以调用方身份访问 namespace 下 ModelBox 的客户端
+func (s *Server) modelBoxes(r *http.Request, namespace string) (clientsetv1.ModelBoxInterface, error) {
+	client, err := s.clients.ClientFor(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	return client.ModelV1().ModelBoxes(namespace), nil
+}
+
+// serveModelBoxes 根据路径和方法分发 ModelBox 请求
+func (s *Server) serveModelBoxes(w http.ResponseWriter, r *http.Request) {
+	namespace, name, ok := parseModelBoxPath(r.URL.Path)
+	if !ok {
+		writeError(w, k8serrors.NewNotFound(modelBoxGroupResource, r.URL.Path))
+		return
+	}
+
+	logrus.Debugf("%s %s", r.Method, r.URL.Path)
+	if isWatchRequest(r) {
+		s.watchModelBoxes(w, r, namespace, name)
+		return
+	}
+	if name == "" {
+		switch r.Method {
+		case http.MethodGet:
+			s.listModelBoxes(w, r, namespace)
+		case http.MethodPost:
+			s.createModelBox(w, r, namespace)
+		default:
+			writeError(w, k8serrors.NewMethodNotSupported(modelBoxGroupResource, r.Method))
+		}
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.getModelBox(w, r, namespace, name)
+	case http.MethodPut:
+		s.updateModelBox(w, r, namespace, name)
+	case http.MethodPatch:
+		s.patchModelBox(w, r, namespace, name)
+	case http.MethodDelete:
+		s.deleteModelBox(w, r, namespace, name)
+	default:
+		writeError(w, k8serrors.NewMethodNotSupported(modelBoxGroupResource, r.Method))
+	}
+}
+
+// serveInference 将推理请求转发到 ModelBox 的 Service.
+// 转发前以调用方身份读取 ModelBox, 没有 get 权限的调用方无法访问该模型
+func (s *Server) serveInference(w http.ResponseWriter, r *http.Request) {
+	namespace, name, ok := parseInferencePath(r.URL.Path)
+	if !ok {
+		writeError(w, k8serrors.NewNotFound(modelBoxGroupResource, r.URL.Path))
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeError(w, k8serrors.NewMethodNotSupported(modelBoxGroupResource, r.Method))
+		return
+	}
+
+	modelBoxes, err := s.modelBoxes(r, namespace)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	modelBox, err := modelBoxes.Get(r.Context(), name, metav1.GetOptions{})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	// 模型服务使用 TensorFlow Serving 的 REST 路径 /v1/models/{name}:predict
+	s.inference.serve(w, r, modelBox, inferencePathPrefix+name+predictVerb)
+}
+
+// parseInferencePath 解析 /v1/models/{namespace}/{name}:predict
+func parseInferencePath(path string) (namespace, name string, ok bool) {
+	if !strings.HasSuffix(path, predictVerb) {
+		return "", "", false
+	}
+	parts := strings.Split(strings.TrimSuffix(strings.TrimPrefix(path, inferencePathPrefix), predictVerb), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// parseModelBoxPath 解析 /api/v1/namespaces/{namespace}/modelboxes[/{name}]
+func parseModelBoxPath(path string) (namespace, name string, ok bool) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(path, modelBoxPathPrefix), "/"), "/")
+	switch {
+	case len(parts) == 2 && parts[0] != "" && parts[1] == modelBoxResource:
+		return parts[0], "", true
+	case len(parts) == 3 && parts[0] != "" && parts[1] == modelBoxResource && parts[2] != "":
+		return parts[0], parts[2], true
+	}
+	return "", "", false
+}
+
+// writeJSON 以 JSON 格式返回对象
+func writeJSON(w http.ResponseWriter, code int, obj interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(obj); err != nil {
+		logrus.Errorf("write response: %v", err)
+	}
+}
+
+// writeError 将错误转换为 metav1.Status 返回, HTTP 状态码取自 k8serrors
+func writeError(w http.ResponseWriter, err error) {
+	status := statusFor(err)
+	if status.Code >= http.StatusInternalServerError {
+		logrus.Errorf("request failed: %v", err)
+	}
+	writeJSON(w, int(status.Code), &status)
+}
+
+func writeUnauthorized(w http.ResponseWriter, reason string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="apigateway"`)
+	writeError(w, k8serrors.NewUnauthorized(reason))
+}
+
+// statusFor 将错误转换为 metav1.Status, 非 APIStatus 的错误视为 500
+func statusFor(err error) metav1.Status {
+	var status metav1.Status
+	if apiStatus, ok := err.(k8serrors.APIStatus); ok {
+		status = apiStatus.Status()
+	} else {
+		status = k8serrors.NewInternalError(err).ErrStatus
+	}
+	if status.Code == 0 {
+		status.Code = http.StatusInternalServerError
+	}
+	status.Kind = "Status"
+	status.APIVersion = "v1"
+	return status
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	modelv1 "github.com/sharelinuxs/my-first-opeartor/api/v1"
+	"github.com/sharelinuxs/my-first-opeartor/apigateway/openapi"
+)
+
+var (
+	modelBoxGroupResource = modelv1.GroupVersion.WithResource("modelboxes").GroupResource()
+	modelBoxGroupKind     = modelv1.GroupVersion.WithKind(modelv1.Kind).GroupKind()
+)
+
+// decodeModelBox 解析请求体中的 ModelBox, 先按 CRD 生成的 schema 校验 (包括未知字段);
+// 未设置 apiVersion/kind/namespace 时使用默认值, 设置了则必须与请求一致
+func decodeModelBox(r *http.Request, namespace string) (*modelv1.ModelBox, error) {
+	data, err := readBody(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, k8serrors.NewBadRequest("request body is required")
+	}
+
+	var raw interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, k8serrors.NewBadRequest(fmt.Sprintf("unable to decode ModelBox: %v", err))
+	}
+	if errs := openapi.ValidateModelBox(raw); len(errs) > 0 {
+		return nil, k8serrors.NewInvalid(modelBoxGroupKind, nameOf(raw), errs)
+	}
+
+	modelBox := &modelv1.ModelBox{}
+	if err := json.Unmarshal(data, modelBox); err != nil {
+		return nil, k8serrors.NewBadRequest(fmt.Sprintf("unable to decode ModelBox: %v", err))
+	}
+
+	gvk := modelv1.GroupVersion.WithKind(modelv1.Kind)
+	if modelBox.APIVersion == "" && modelBox.Kind == "" {
+		modelBox.SetGroupVersionKind(gvk)
+	}
+	if modelBox.GroupVersionKind() != gvk {
+		return nil, k8serrors.NewBadRequest(fmt.Sprintf("expected %s, got %s", gvk, modelBox.GroupVersionKind()))
+	}
+	if modelBox.Namespace == "" {
+		modelBox.Namespace = namespace
+	}
+	if modelBox.Namespace != namespace {
+		return nil, k8serrors.NewBadRequest(fmt.Sprintf("the namespace of the object (%s) does not match the namespace on the request (%s)", modelBox.Namespace, namespace))
+	}
+	return modelBox, nil
+}
+
+// nameOf 从未解析为 ModelBox 的请求体中取出 metadata.name, 用于错误信息
+func nameOf(raw interface{}) string {
+	obj, _ := raw.(map[string]interface{})
+	metadata, _ := obj["metadata"].(map[string]interface{})
+	name, _ := metadata["name"].(string)
+	return name
+}
+
+// validateModelBox 校验 schema 无法表达的约束, 只检查控制器生成 Deployment/Service 时依赖的字段
+func validateModelBox(modelBox *modelv1.ModelBox) field.ErrorList {
+	var allErrs field.ErrorList
+
+	namePath := field.NewPath("metadata", "name")
+	if modelBox.Name == "" {
+		allErrs = append(allErrs, field.Required(namePath, ""))
+	} else {
+		// 控制器会创建同名 Service, 名称需满足 DNS-1035 label
+		for _, msg := range validation.IsDNS1035Label(modelBox.Name) {
+			allErrs = append(allErrs, field.Invalid(namePath, modelBox.Name, msg))
+		}
+	}
+
+	allErrs = append(allErrs, validateModelBoxSpec(&modelBox.Spec, field.NewPath("spec"))...)
+	return allErrs
+}
+
+func validateModelBoxSpec(spec *modelv1.ModelBoxSpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	// 引用模板时镜像与端口可以由模板提供, 合并后的 spec 由控制器校验
+	fromTemplate := spec.TemplateRef != nil
+	if spec.Image == "" && !fromTemplate {
+		allErrs = append(allErrs, field.Required(fldPath.Child("image"), ""))
+	}
+	if spec.ModelFileURL != "" {
+		if u, err := url.Parse(spec.ModelFileURL); err != nil || u.Scheme == "" {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("modelFileURL"), spec.ModelFileURL, "must be an absolute URL"))
+		}
+	}
+	if spec.ResourceType == "custom" && len(spec.Resources.Limits) == 0 && len(spec.Resources.Requests) == 0 {
+		allErrs = append(allErrs, field.Required(fldPath.Child("resources"), "resources are required when resourceType is custom"))
+	}
+	if spec.RollingUpdate != "" {
+		rollingUpdate := intstr.Parse(spec.RollingUpdate)
+		if value, err := intstr.GetValueFromIntOrPercent(&rollingUpdate, 100, true); err != nil || value < 0 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("rollingUpdate"), spec.RollingUpdate, "must be a non-negative integer or percentage, e.g. 30%"))
+		}
+	}
+	// 批量推理不创建 Service, 可以不配置端口
+	if len(spec.Ports) > 0 || (spec.WorkloadType != "BatchJob" && !fromTemplate) {
+		allErrs = append(allErrs, validatePorts(spec.Ports, fldPath.Child("ports"))...)
+	}
+	if spec.Distributed != nil && spec.WorkloadType != "" && spec.WorkloadType != "StatefulSet" {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("workloadType"), spec.WorkloadType, "must be StatefulSet when distributed is set"))
+	}
+	if spec.WorkloadType == "BatchJob" && spec.Batch == nil {
+		allErrs = append(allErrs, field.Required(fldPath.Child("batch"), "batch is required when workloadType is BatchJob"))
+	}
+
+	return allErrs
+}
+
+func validatePorts(ports []corev1.ServicePort, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if len(ports) == 0 {
+		return append(allErrs, field.Required(fldPath, "at least one port is required"))
+	}
+	names := sets.NewString()
+	for i, port := range ports {
+		idxPath := fldPath.Index(i)
+		// 多个端口时 Service 要求每个端口都有唯一的名称
+		if len(ports) > 1 && port.Name == "" {
+			allErrs = append(allErrs, field.Required(idxPath.Child("name"), "name is required when there is more than one port"))
+		}
+		if port.Name != "" {
+			if names.Has(port.Name) {
+				allErrs = append(allErrs, field.Duplicate(idxPath.Child("name"), port.Name))
+			}
+			names.Insert(port.Name)
+		}
+		for _, msg := range validation.IsValidPortNum(int(port.Port)) {
+			allErrs = append(allErrs, field.Invalid(idxPath.Child("port"), port.Port, msg))
+		}
+		if port.TargetPort.Type == intstr.Int && port.TargetPort.IntVal != 0 {
+			for _, msg := range validation.IsValidPortNum(port.TargetPort.IntValue()) {
+				allErrs = append(allErrs, field.Invalid(idxPath.Child("targetPort"), port.TargetPort.IntVal, msg))
+			}
+		}
+	}
+	return allErrs
+}
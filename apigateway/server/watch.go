@@ -0,0 +1,329 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/websocket"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+
+	modelv1 "github.com/sharelinuxs/my-first-opeartor/api/v1"
+	"github.com/sharelinuxs/my-first-opeartor/apigateway/auth"
+	clientsetv1 "github.com/sharelinuxs/my-first-opeartor/apigateway/clientset/v1"
+)
+
+const (
+	// watchHeartbeatInterval SSE 心跳间隔, 避免空闲连接被代理/负载均衡断开
+	watchHeartbeatInterval = 30 * time.Second
+	// sseRetryMillis 通知浏览器 EventSource 断线后的重连间隔
+	sseRetryMillis = 3000
+)
+
+// watchEncoder 将 watch 事件写入不同的传输协议: JSON 流、SSE、WebSocket
+type watchEncoder interface {
+	// Encode 写入一个事件, resourceVersion 为事件对象的版本, 用于断线续传
+	Encode(event *metav1.WatchEvent, resourceVersion string) error
+	// Heartbeat 写入心跳, 协议不支持时为空操作
+	Heartbeat() error
+}
+
+// isWatchRequest 判断 GET 请求是否为 watch 请求:
+// ?watch=true (与 kube-apiserver 相同)、Accept: text/event-stream (SSE) 或 WebSocket 升级请求
+func isWatchRequest(r *http.Request) bool {
+	if r.Method != http.MethodGet {
+		return false
+	}
+	if isWebSocketRequest(r) || acceptsEventStream(r) {
+		return true
+	}
+	switch r.URL.Query().Get("watch") {
+	case "true", "1":
+		return true
+	}
+	return false
+}
+
+func isWebSocketRequest(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+func acceptsEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// watchModelBoxes 将 ModelBoxInterface.Watch 以流的形式推送给客户端,
+// name 不为空时只 watch 该 ModelBox
+func (s *Server) watchModelBoxes(w http.ResponseWriter, r *http.Request, namespace, name string) {
+	opts := metav1.ListOptions{}
+	if err := decodeOptions(r, &opts); err != nil {
+		writeError(w, err)
+		return
+	}
+	if name != "" {
+		selector := fields.OneTermEqualSelector("metadata.name", name)
+		if opts.FieldSelector != "" {
+			parsed, err := fields.ParseSelector(opts.FieldSelector)
+			if err != nil {
+				writeError(w, k8serrors.NewBadRequest(err.Error()))
+				return
+			}
+			selector = fields.AndSelectors(parsed, selector)
+		}
+		opts.FieldSelector = selector.String()
+	}
+	// EventSource 重连时会通过 Last-Event-ID 带上最后收到的事件 id, 即 resourceVersion
+	if lastEventID := r.Header.Get("Last-Event-ID"); lastEventID != "" {
+		opts.ResourceVersion = lastEventID
+	}
+	opts.Watch = true
+
+	modelBoxes, err := s.modelBoxes(r, namespace)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	switch {
+	case isWebSocketRequest(r):
+		// 浏览器无法方便地设置 query 参数以外的选项, 默认开启 bookmark
+		opts.AllowWatchBookmarks = true
+		watchWebSocket(w, r, modelBoxes, opts)
+	case acceptsEventStream(r):
+		opts.AllowWatchBookmarks = true
+		watchEventStream(w, r, modelBoxes, opts)
+	default:
+		watchJSONStream(w, r, modelBoxes, opts)
+	}
+}
+
+// watchJSONStream 以换行分隔的 metav1.WatchEvent 返回, 格式与 kube-apiserver 一致, clientset 可直接使用
+func watchJSONStream(w http.ResponseWriter, r *http.Request, modelBoxes clientsetv1.ModelBoxInterface, opts metav1.ListOptions) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, k8serrors.NewInternalError(fmt.Errorf("streaming is not supported")))
+		return
+	}
+	watcher, err := modelBoxes.Watch(r.Context(), opts)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	streamWatch(r.Context(), watcher, &jsonStreamEncoder{encoder: json.NewEncoder(w), flusher: flusher})
+}
+
+// watchEventStream 以 Server-Sent Events 推送事件, 事件 id 为对象的 resourceVersion,
+// 浏览器断线重连时会自动带上 Last-Event-ID 从断点继续
+func watchEventStream(w http.ResponseWriter, r *http.Request, modelBoxes clientsetv1.ModelBoxInterface, opts metav1.ListOptions) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, k8serrors.NewInternalError(fmt.Errorf("streaming is not supported")))
+		return
+	}
+	watcher, err := modelBoxes.Watch(r.Context(), opts)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// 关闭 nginx 的响应缓冲, 否则事件会被攒批发送
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	encoder := &sseEncoder{w: w, flusher: flusher}
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", sseRetryMillis); err != nil {
+		watcher.Stop()
+		return
+	}
+	flusher.Flush()
+
+	streamWatch(r.Context(), watcher, encoder)
+}
+
+// watchWebSocket 通过 WebSocket 推送事件, 每个消息为一个 JSON 格式的 metav1.WatchEvent
+func watchWebSocket(w http.ResponseWriter, r *http.Request, modelBoxes clientsetv1.ModelBoxInterface, opts metav1.ListOptions) {
+	// 不使用 websocket.Handler, 它会拒绝没有 Origin 的非浏览器客户端
+	wsServer := websocket.Server{Handshake: selectWebSocketProtocol, Handler: func(conn *websocket.Conn) {
+		defer conn.Close()
+
+		// 连接被 hijack 后 r.Context() 不会随客户端断开而取消, 通过读取连接感知断开
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		go func() {
+			_, _ = io.Copy(ioutil.Discard, conn)
+			cancel()
+		}()
+
+		encoder := &websocketEncoder{conn: conn}
+		watcher, err := modelBoxes.Watch(ctx, opts)
+		if err != nil {
+			status := statusFor(err)
+			if event, err := newWatchEvent(watch.Error, &status); err == nil {
+				_ = encoder.Encode(event, "")
+			}
+			return
+		}
+		streamWatch(ctx, watcher, encoder)
+	}}
+	wsServer.ServeHTTP(w, r)
+}
+
+// selectWebSocketProtocol 选择客户端提供的第一个子协议, 携带 token 的子协议不能回显给客户端
+func selectWebSocketProtocol(config *websocket.Config, _ *http.Request) error {
+	var selected []string
+	for _, protocol := range config.Protocol {
+		if !strings.HasPrefix(protocol, auth.WebSocketProtocolPrefix) {
+			selected = []string{protocol}
+			break
+		}
+	}
+	config.Protocol = selected
+	return nil
+}
+
+// streamWatch 持续将 watcher 的事件写入 encoder, 直到客户端断开、watch 结束或出现 ERROR 事件
+func streamWatch(ctx context.Context, watcher watch.Interface, encoder watchEncoder) {
+	defer watcher.Stop()
+
+	ticker := time.NewTicker(watchHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := encoder.Heartbeat(); err != nil {
+				return
+			}
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return
+			}
+			out, err := newWatchEvent(event.Type, event.Object)
+			if err != nil {
+				logrus.Errorf("encode watch event: %v", err)
+				return
+			}
+			if err := encoder.Encode(out, resourceVersionOf(event)); err != nil {
+				logrus.Debugf("write watch event: %v", err)
+				return
+			}
+			// ERROR 事件后 watch 已不可用, 例如 410 Gone 时客户端需要重新 list
+			if event.Type == watch.Error {
+				return
+			}
+		}
+	}
+}
+
+// newWatchEvent 补全对象的 apiVersion/kind 并转换为 metav1.WatchEvent
+func newWatchEvent(eventType watch.EventType, obj runtime.Object) (*metav1.WatchEvent, error) {
+	switch o := obj.(type) {
+	case *modelv1.ModelBox:
+		o = o.DeepCopy()
+		o.SetGroupVersionKind(modelv1.GroupVersion.WithKind(modelv1.Kind))
+		obj = o
+	case *metav1.Status:
+		o = o.DeepCopy()
+		o.Kind = "Status"
+		o.APIVersion = "v1"
+		obj = o
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	return &metav1.WatchEvent{
+		Type:   string(eventType),
+		Object: runtime.RawExtension{Raw: data},
+	}, nil
+}
+
+// resourceVersionOf 返回事件对象的 resourceVersion, BOOKMARK 事件也携带该字段
+func resourceVersionOf(event watch.Event) string {
+	if event.Type == watch.Error {
+		return ""
+	}
+	accessor, err := meta.Accessor(event.Object)
+	if err != nil {
+		return ""
+	}
+	return accessor.GetResourceVersion()
+}
+
+type jsonStreamEncoder struct {
+	encoder *json.Encoder
+	flusher http.Flusher
+}
+
+func (e *jsonStreamEncoder) Encode(event *metav1.WatchEvent, _ string) error {
+	if err := e.encoder.Encode(event); err != nil {
+		return err
+	}
+	e.flusher.Flush()
+	return nil
+}
+
+// Heartbeat kube-apiserver 的 JSON 流没有心跳, 保持一致
+func (e *jsonStreamEncoder) Heartbeat() error {
+	return nil
+}
+
+type sseEncoder struct {
+	w       io.Writer
+	flusher http.Flusher
+}
+
+// Encode 写入 SSE 事件, event 为 ADDED/MODIFIED/DELETED/BOOKMARK/ERROR, data 为对象本身
+func (e *sseEncoder) Encode(event *metav1.WatchEvent, resourceVersion string) error {
+	var b strings.Builder
+	if resourceVersion != "" {
+		fmt.Fprintf(&b, "id: %s\n", resourceVersion)
+	}
+	fmt.Fprintf(&b, "event: %s\ndata: %s\n\n", event.Type, event.Object.Raw)
+	if _, err := io.WriteString(e.w, b.String()); err != nil {
+		return err
+	}
+	e.flusher.Flush()
+	return nil
+}
+
+// Heartbeat 以 SSE 注释行作为心跳, EventSource 会忽略
+func (e *sseEncoder) Heartbeat() error {
+	if _, err := io.WriteString(e.w, ": heartbeat\n\n"); err != nil {
+		return err
+	}
+	e.flusher.Flush()
+	return nil
+}
+
+type websocketEncoder struct {
+	conn *websocket.Conn
+}
+
+func (e *websocketEncoder) Encode(event *metav1.WatchEvent, _ string) error {
+	return websocket.JSON.Send(e.conn, event)
+}
+
+// Heartbeat x/net/websocket 不支持主动发送 ping, 由客户端负责保活
+func (e *websocketEncoder) Heartbeat() error {
+	return nil
+}
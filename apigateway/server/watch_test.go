@@ -0,0 +1,244 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+	k8stesting "k8s.io/client-go/testing"
+
+	modelv1 "github.com/sharelinuxs/my-first-opeartor/api/v1"
+	"github.com/sharelinuxs/my-first-opeartor/apigateway/auth"
+	"github.com/sharelinuxs/my-first-opeartor/apigateway/clientset/fake"
+)
+
+// watchStarted 关闭返回的 channel 时 watch 已建立, 之后的修改一定会产生事件; restrictions 记录 watch 的参数
+func watchStarted(client *fake.Clientset) (<-chan struct{}, *k8stesting.WatchRestrictions) {
+	started := make(chan struct{})
+	restrictions := &k8stesting.WatchRestrictions{}
+	var once sync.Once
+	client.PrependWatchReactor("*", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		w, err := client.Tracker().Watch(action.GetResource(), action.GetNamespace())
+		once.Do(func() {
+			*restrictions = action.(k8stesting.WatchAction).GetWatchRestrictions()
+			close(started)
+		})
+		return true, w, err
+	})
+	return started, restrictions
+}
+
+// createAfterWatch watch 建立后创建 ModelBox
+func createAfterWatch(t *testing.T, client *fake.Clientset, started <-chan struct{}, modelBox *modelv1.ModelBox) {
+	t.Helper()
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch was not started")
+	}
+	if err := client.Tracker().Create(modelv1.GroupVersion.WithResource("modelboxes"), modelBox, modelBox.Namespace); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkWatchEvent 事件为 ADDED, 对象补全了 apiVersion 与 kind
+func checkWatchEvent(t *testing.T, event metav1.WatchEvent, name string) {
+	t.Helper()
+	if event.Type != string(watch.Added) {
+		t.Errorf("got event type %s, want ADDED", event.Type)
+	}
+	var modelBox modelv1.ModelBox
+	if err := json.Unmarshal(event.Object.Raw, &modelBox); err != nil {
+		t.Fatal(err)
+	}
+	if modelBox.Name != name || modelBox.Kind != modelv1.Kind || modelBox.APIVersion != modelv1.GroupVersion.String() {
+		t.Errorf("got object %s %s/%s, want %s %s", modelBox.Name, modelBox.APIVersion, modelBox.Kind, name, modelv1.Kind)
+	}
+}
+
+func TestIsWatchRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		query  string
+		header map[string]string
+		want   bool
+	}{
+		{name: "list", method: http.MethodGet},
+		{name: "watch=true", method: http.MethodGet, query: "?watch=true", want: true},
+		{name: "watch=1", method: http.MethodGet, query: "?watch=1", want: true},
+		{name: "watch=false", method: http.MethodGet, query: "?watch=false"},
+		{name: "event stream", method: http.MethodGet, header: map[string]string{"Accept": "text/event-stream"}, want: true},
+		{name: "websocket", method: http.MethodGet, header: map[string]string{"Upgrade": "WebSocket"}, want: true},
+		{name: "not a GET", method: http.MethodPost, query: "?watch=true"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, modelBoxesPath+tt.query, nil)
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+			if got := isWatchRequest(r); got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatchJSONStream(t *testing.T) {
+	s, client := newTestServer()
+	started, restrictions := watchStarted(client)
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + modelBoxesPath + "/resnet?watch=true&resourceVersion=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("got status %d and Content-Type %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	createAfterWatch(t, client, started, newTestModelBox("resnet", nil))
+
+	var event metav1.WatchEvent
+	if err := json.NewDecoder(resp.Body).Decode(&event); err != nil {
+		t.Fatal(err)
+	}
+	checkWatchEvent(t, event, "resnet")
+	if restrictions.ResourceVersion != "3" {
+		t.Errorf("got resourceVersion %q, want 3", restrictions.ResourceVersion)
+	}
+	if !restrictions.Fields.Matches(fields.Set{"metadata.name": "resnet"}) || restrictions.Fields.Matches(fields.Set{"metadata.name": "bert"}) {
+		t.Errorf("got field selector %s, want metadata.name=resnet", restrictions.Fields)
+	}
+}
+
+func TestWatchEventStream(t *testing.T) {
+	s, client := newTestServer()
+	started, restrictions := watchStarted(client)
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+modelBoxesPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	// 断线重连时从 Last-Event-ID 继续
+	req.Header.Set("Last-Event-ID", "5")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("got Content-Type %s, want text/event-stream", resp.Header.Get("Content-Type"))
+	}
+	modelBox := newTestModelBox("resnet", nil)
+	modelBox.ResourceVersion = "6"
+	createAfterWatch(t, client, started, modelBox)
+
+	// retry 之后是一个完整的事件, 以空行结束
+	reader := bufio.NewReader(resp.Body)
+	var lines []string
+	for len(lines) < 5 {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read event stream after %q: %v", lines, err)
+		}
+		lines = append(lines, strings.TrimSuffix(line, "\n"))
+	}
+	if lines[0] != "retry: 3000" || lines[1] != "" || lines[2] != "id: 6" || lines[3] != "event: ADDED" || !strings.HasPrefix(lines[4], "data: ") {
+		t.Fatalf("got event stream %q", lines)
+	}
+	var obj modelv1.ModelBox
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(lines[4], "data: ")), &obj); err != nil || obj.Name != "resnet" {
+		t.Errorf("got data %s: %v", lines[4], err)
+	}
+	if restrictions.ResourceVersion != "5" {
+		t.Errorf("got resourceVersion %q, want the Last-Event-ID 5", restrictions.ResourceVersion)
+	}
+}
+
+func TestWatchWebSocket(t *testing.T) {
+	s, client := newTestServer()
+	started, _ := watchStarted(client)
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	config, err := websocket.NewConfig("ws"+strings.TrimPrefix(server.URL, "http")+modelBoxesPath, "http://localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 携带 token 的子协议不能回显给客户端
+	config.Protocol = []string{auth.WebSocketProtocolPrefix + "dG9rZW4", "watch.v1"}
+	conn, err := websocket.DialConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if protocol := conn.Config().Protocol; len(protocol) != 1 || protocol[0] != "watch.v1" {
+		t.Errorf("got protocol %v, want watch.v1", protocol)
+	}
+	createAfterWatch(t, client, started, newTestModelBox("resnet", nil))
+
+	var event metav1.WatchEvent
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := websocket.JSON.Receive(conn, &event); err != nil {
+		t.Fatal(err)
+	}
+	checkWatchEvent(t, event, "resnet")
+}
+
+// recordingEncoder 记录写入的事件类型
+type recordingEncoder struct {
+	types []string
+}
+
+func (e *recordingEncoder) Encode(event *metav1.WatchEvent, _ string) error {
+	e.types = append(e.types, event.Type)
+	return nil
+}
+
+func (e *recordingEncoder) Heartbeat() error {
+	return nil
+}
+
+// TestStreamWatchStopsOnError ERROR 事件之后 watch 不再可用, 结束推送
+func TestStreamWatchStopsOnError(t *testing.T) {
+	watcher := watch.NewFakeWithChanSize(3, false)
+	watcher.Add(newTestModelBox("resnet", nil))
+	watcher.Error(&metav1.Status{Status: metav1.StatusFailure, Code: http.StatusGone, Reason: metav1.StatusReasonExpired})
+	watcher.Add(newTestModelBox("bert", nil))
+
+	encoder := &recordingEncoder{}
+	done := make(chan struct{})
+	go func() {
+		streamWatch(context.Background(), watcher, encoder)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("streamWatch did not return after the ERROR event")
+	}
+	if strings.Join(encoder.types, ",") != "ADDED,ERROR" {
+		t.Errorf("got events %v, want ADDED,ERROR", encoder.types)
+	}
+	if !watcher.IsStopped() {
+		t.Error("watcher not stopped")
+	}
+}
@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	modelv2 "github.com/sharelinuxs/my-first-opeartor/api/v2"
+)
+
+const (
+	// batchInputName 输入数据集按名为 batch-input 的模型下载, 同时作为下载容器与存储卷名称的一部分
+	batchInputName = "batch-input"
+	// batchInputMountPath 输入数据集在容器中的目录
+	batchInputMountPath = "/app/input"
+	// batchOutputMountPath 结果在推理服务容器中的目录
+	batchOutputMountPath = "/app/output"
+	// batchOutputVolume 写入结果的 PVC 存储卷
+	batchOutputVolume = "batch-output"
+)
+
+// batchInputs 批量推理的输入数据集, 与模型使用相同的下载方式, 不是批量推理时为空
+func batchInputs(modelbox *modelv2.ModelBox) []modelv2.ModelSource {
+	if workloadType(modelbox) != modelv2.WorkloadBatchJob || modelbox.Spec.Batch == nil {
+		return nil
+	}
+	input := modelbox.Spec.Batch.Input
+	input.Name = batchInputName
+	input.SubPath = ""
+	return []modelv2.ModelSource{input}
+}
+
+// batchOutputSubPath 结果在 PVC 中的目录, 默认为 ModelBox 的名称
+func batchOutputSubPath(modelbox *modelv2.ModelBox) string {
+	if modelbox.Spec.Batch.Output.SubPath != "" {
+		return modelbox.Spec.Batch.Output.SubPath
+	}
+	return modelbox.Name
+}
+
+// batchOutputURL 结果所在的位置, 与 pvc:// 模型地址的格式一致
+func batchOutputURL(modelbox *modelv2.ModelBox) string {
+	return fmt.Sprintf("pvc://%s/%s", modelbox.Spec.Batch.Output.ClaimName, batchOutputSubPath(modelbox))
+}
+
+// NewBatchJob 批量推理的 Job. Pod 模板与 Deployment 相同, 另外由 InitContainer 下载输入数据集,
+// 推理服务容器以只读方式挂载输入数据集, 结果写入 PVC. 通用容器不会退出, 不加入 Job 的 Pod 中.
+// 调用前 ModelBox 需要通过 validateWorkload 的检查, 此时 spec.batch 及其输入与输出均已设置
+func NewBatchJob(modelbox *modelv2.ModelBox) *batchv1.Job {
+	deploy := NewDeploy(modelbox)
+	template := deploy.Spec.Template
+	podSpec := &template.Spec
+	// 只保留推理服务容器, 按名称查找而不依赖它在容器列表中的位置
+	var containers []corev1.Container
+	for _, c := range podSpec.Containers {
+		if c.Name == modelbox.Name {
+			containers = append(containers, c)
+		}
+	}
+	podSpec.Containers = containers
+	podSpec.RestartPolicy = corev1.RestartPolicyNever
+
+	// workloadType 为 BatchJob 且设置了 spec.batch 时只有一个输入
+	inputs := batchInputs(modelbox)
+	inputMount := corev1.VolumeMount{Name: batchInputName, MountPath: batchInputMountPath}
+	fetcher := newModelFetcher(modelbox, inputs, 0, inputs[0], batchInputMountPath)
+	fetcher.VolumeMounts = append(fetcher.VolumeMounts, inputMount)
+	podSpec.InitContainers = append(podSpec.InitContainers, fetcher)
+
+	container := &podSpec.Containers[0]
+	container.Env = append([]corev1.EnvVar{
+		{Name: "INPUT_DIR", Value: batchInputMountPath},
+		{Name: "OUTPUT_DIR", Value: batchOutputMountPath},
+	}, container.Env...)
+	inputMount.ReadOnly = true
+	container.VolumeMounts = append(container.VolumeMounts, inputMount, corev1.VolumeMount{
+		Name:      batchOutputVolume,
+		MountPath: batchOutputMountPath,
+		SubPath:   batchOutputSubPath(modelbox),
+	})
+
+	podSpec.Volumes = append(podSpec.Volumes,
+		corev1.Volume{
+			Name:         batchInputName,
+			VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+		},
+		corev1.Volume{
+			Name: batchOutputVolume,
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: modelbox.Spec.Batch.Output.ClaimName},
+			},
+		},
+	)
+	podSpec.Volumes = append(podSpec.Volumes, newPVCVolumes(inputs)...)
+	podSpec.Volumes = append(podSpec.Volumes, newCredentialsVolumes(inputs)...)
+
+	return &batchv1.Job{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Job",
+			APIVersion: "batch/v1",
+		},
+		ObjectMeta: deploy.ObjectMeta,
+		Spec: batchv1.JobSpec{
+			BackoffLimit:          modelbox.Spec.Batch.BackoffLimit,
+			ActiveDeadlineSeconds: modelbox.Spec.Batch.ActiveDeadlineSeconds,
+			Template:              template,
+		},
+	}
+}
+
+// newBatchStatus 按 Job 的状态计算批量推理任务的阶段
+func newBatchStatus(modelbox *modelv2.ModelBox, job *batchv1.Job) *modelv2.BatchStatus {
+	status := &modelv2.BatchStatus{
+		Phase:          modelv2.BatchPending,
+		Active:         job.Status.Active,
+		Failed:         job.Status.Failed,
+		StartTime:      job.Status.StartTime,
+		CompletionTime: job.Status.CompletionTime,
+		Output:         batchOutputURL(modelbox),
+	}
+	for _, c := range job.Status.Conditions {
+		if c.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batchv1.JobComplete:
+			status.Phase = modelv2.BatchSucceeded
+		case batchv1.JobFailed:
+			status.Phase = modelv2.BatchFailed
+			status.Message = c.Message
+		}
+	}
+	if status.Phase == modelv2.BatchPending && status.Active > 0 {
+		status.Phase = modelv2.BatchRunning
+	}
+	return status
+}
+
+// batchFinished 任务是否刚刚结束, 结束时只记录一次事件
+func batchFinished(old, status *modelv2.BatchStatus) bool {
+	if status == nil || (status.Phase != modelv2.BatchSucceeded && status.Phase != modelv2.BatchFailed) {
+		return false
+	}
+	return old == nil || old.Phase != status.Phase
+}
@@ -0,0 +1,231 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	modelv2 "github.com/sharelinuxs/my-first-opeartor/api/v2"
+)
+
+// newBatchModelBox 以 BatchJob 运行的 ModelBox, 输入来自 S3, 结果写入 results PVC
+func newBatchModelBox() *modelv2.ModelBox {
+	modelbox := newTestModelBox()
+	modelbox.Spec.WorkloadType = modelv2.WorkloadBatchJob
+	modelbox.Spec.Batch = &modelv2.BatchSpec{
+		Input: modelv2.ModelSource{
+			URL:                  "s3://datasets/images/",
+			CredentialsSecretRef: &corev1.LocalObjectReference{Name: "s3-credentials"},
+		},
+		Output:       modelv2.BatchOutput{ClaimName: "results"},
+		BackoffLimit: int32Ptr(2),
+	}
+	return modelbox
+}
+
+func TestNewBatchJob(t *testing.T) {
+	tests := []struct {
+		name        string
+		modify      func(*modelv2.ModelBox)
+		wantSubPath string
+	}{
+		{
+			name:        "output defaults to the ModelBox name",
+			wantSubPath: "resnet",
+		},
+		{
+			name:        "output sub path",
+			modify:      func(m *modelv2.ModelBox) { m.Spec.Batch.Output.SubPath = "runs/1" },
+			wantSubPath: "runs/1",
+		},
+		{
+			name: "input from a PVC",
+			modify: func(m *modelv2.ModelBox) {
+				m.Spec.Batch.Input = modelv2.ModelSource{URL: "pvc://datasets/images"}
+			},
+			wantSubPath: "resnet",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modelbox := newBatchModelBox()
+			if tt.modify != nil {
+				tt.modify(modelbox)
+			}
+
+			job := NewBatchJob(modelbox)
+			if job.Name != "resnet" || len(job.OwnerReferences) != 1 {
+				t.Errorf("got Job %s with owners %v", job.Name, job.OwnerReferences)
+			}
+			if !reflect.DeepEqual(job.Spec.BackoffLimit, int32Ptr(2)) {
+				t.Errorf("got backoff limit %v, want 2", job.Spec.BackoffLimit)
+			}
+			podSpec := job.Spec.Template.Spec
+			if podSpec.RestartPolicy != corev1.RestartPolicyNever {
+				t.Errorf("got restart policy %q", podSpec.RestartPolicy)
+			}
+			// 通用容器不会退出, 只保留推理服务容器
+			if got := containerNames(podSpec.Containers); !reflect.DeepEqual(got, []string{"resnet"}) {
+				t.Errorf("got containers %v, want only the serving container", got)
+			}
+
+			// 输入数据集在模型之后下载
+			wantInit := []string{"fetch-model", "fetch-batch-input"}
+			if got := containerNames(podSpec.InitContainers); !reflect.DeepEqual(got, wantInit) {
+				t.Fatalf("got init containers %v, want %v", got, wantInit)
+			}
+			fetcher := podSpec.InitContainers[1]
+			if !hasArg(fetcher, "--url="+modelbox.Spec.Batch.Input.URL) || !hasArg(fetcher, "--dir=/app/input") {
+				t.Errorf("got fetcher args %v", fetcher.Args)
+			}
+			if mount := findVolumeMount(&fetcher, batchInputName); mount == nil || mount.ReadOnly {
+				t.Errorf("got fetcher input mount %+v, want writable", mount)
+			}
+
+			serving := &podSpec.Containers[0]
+			if mount := findVolumeMount(serving, batchInputName); mount == nil || mount.MountPath != "/app/input" || !mount.ReadOnly {
+				t.Errorf("got input mount %+v, want read-only at /app/input", mount)
+			}
+			if mount := findVolumeMount(serving, batchOutputVolume); mount == nil || mount.MountPath != "/app/output" || mount.SubPath != tt.wantSubPath {
+				t.Errorf("got output mount %+v, want /app/output with sub path %s", mount, tt.wantSubPath)
+			}
+			wantEnv := []corev1.EnvVar{{Name: "INPUT_DIR", Value: "/app/input"}, {Name: "OUTPUT_DIR", Value: "/app/output"}}
+			if !reflect.DeepEqual(serving.Env[:2], wantEnv) {
+				t.Errorf("got env %v, want %v first", serving.Env, wantEnv)
+			}
+
+			var output *corev1.Volume
+			for i := range podSpec.Volumes {
+				if podSpec.Volumes[i].Name == batchOutputVolume {
+					output = &podSpec.Volumes[i]
+				}
+			}
+			if output == nil || output.PersistentVolumeClaim == nil || output.PersistentVolumeClaim.ClaimName != "results" {
+				t.Errorf("got output volume %+v, want PVC results", output)
+			}
+			if !hasVolume(podSpec.Volumes, batchInputName) {
+				t.Error("input volume missing")
+			}
+			// 输入的凭证与 PVC 只挂载到下载输入的容器中
+			if credentials := credentialsVolumePrefix + batchInputName; modelbox.Spec.Batch.Input.CredentialsSecretRef != nil {
+				if !hasVolume(podSpec.Volumes, credentials) || findVolumeMount(&fetcher, credentials) == nil {
+					t.Errorf("input credentials %s not mounted into the fetcher", credentials)
+				}
+				if findVolumeMount(serving, credentials) != nil {
+					t.Errorf("input credentials %s mounted into the serving container", credentials)
+				}
+			}
+			if claim := "pvc-" + batchInputName; modelbox.Spec.Batch.Input.CredentialsSecretRef == nil {
+				if !hasVolume(podSpec.Volumes, claim) || findVolumeMount(&fetcher, claim) == nil {
+					t.Errorf("input PVC %s not mounted into the fetcher", claim)
+				}
+			}
+		})
+	}
+}
+
+func TestNewBatchStatus(t *testing.T) {
+	start := metav1.Now()
+	tests := []struct {
+		name        string
+		status      batchv1.JobStatus
+		wantPhase   modelv2.BatchPhase
+		wantMessage string
+	}{
+		{
+			name:      "pending",
+			wantPhase: modelv2.BatchPending,
+		},
+		{
+			name:      "running",
+			status:    batchv1.JobStatus{Active: 1, StartTime: &start},
+			wantPhase: modelv2.BatchRunning,
+		},
+		{
+			name: "succeeded",
+			status: batchv1.JobStatus{
+				StartTime:      &start,
+				CompletionTime: &start,
+				Conditions:     []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}},
+			},
+			wantPhase: modelv2.BatchSucceeded,
+		},
+		{
+			name: "failed",
+			status: batchv1.JobStatus{
+				Failed:     3,
+				Conditions: []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Message: "Job has reached the specified backoff limit"}},
+			},
+			wantPhase:   modelv2.BatchFailed,
+			wantMessage: "Job has reached the specified backoff limit",
+		},
+		{
+			name: "conditions that are not true are ignored",
+			status: batchv1.JobStatus{
+				Active:     1,
+				Conditions: []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionFalse, Message: "not yet"}},
+			},
+			wantPhase: modelv2.BatchRunning,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modelbox := newBatchModelBox()
+			modelbox.Spec.Batch.Output.SubPath = "runs/1"
+			status := newBatchStatus(modelbox, &batchv1.Job{Status: tt.status})
+			want := &modelv2.BatchStatus{
+				Phase:          tt.wantPhase,
+				Message:        tt.wantMessage,
+				Active:         tt.status.Active,
+				Failed:         tt.status.Failed,
+				StartTime:      tt.status.StartTime,
+				CompletionTime: tt.status.CompletionTime,
+				Output:         "pvc://results/runs/1",
+			}
+			if !reflect.DeepEqual(status, want) {
+				t.Errorf("got status %+v, want %+v", status, want)
+			}
+		})
+	}
+}
+
+func TestBatchFinished(t *testing.T) {
+	tests := []struct {
+		name   string
+		old    *modelv2.BatchStatus
+		status *modelv2.BatchStatus
+		want   bool
+	}{
+		{name: "not a batch", want: false},
+		{name: "running", status: &modelv2.BatchStatus{Phase: modelv2.BatchRunning}, want: false},
+		{
+			name:   "just succeeded",
+			old:    &modelv2.BatchStatus{Phase: modelv2.BatchRunning},
+			status: &modelv2.BatchStatus{Phase: modelv2.BatchSucceeded},
+			want:   true,
+		},
+		{name: "failed without a previous status", status: &modelv2.BatchStatus{Phase: modelv2.BatchFailed}, want: true},
+		{
+			name:   "already succeeded",
+			old:    &modelv2.BatchStatus{Phase: modelv2.BatchSucceeded},
+			status: &modelv2.BatchStatus{Phase: modelv2.BatchSucceeded},
+			want:   false,
+		},
+		{
+			name:   "rerun failed after succeeding",
+			old:    &modelv2.BatchStatus{Phase: modelv2.BatchSucceeded},
+			status: &modelv2.BatchStatus{Phase: modelv2.BatchFailed},
+			want:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := batchFinished(tt.old, tt.status); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
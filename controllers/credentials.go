@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/sharelinuxs/my-first-opeartor/agent/modelsync"
+	modelv2 "github.com/sharelinuxs/my-first-opeartor/api/v2"
+)
+
+const (
+	// credentialsMountPath 模型凭证在下载容器中的挂载路径, 每个模型一个子目录
+	credentialsMountPath = "/var/run/secrets/modelbox"
+	// serviceAccountTokenFile 投射的 ServiceAccount token 在凭证目录中的文件名
+	serviceAccountTokenFile = "serviceaccount-token"
+	// credentialsVolumePrefix 模型凭证存储卷的名称前缀, 后接模型名称
+	credentialsVolumePrefix = "credentials-"
+)
+
+// hasCredentials 模型是否配置了凭证
+func hasCredentials(model modelv2.ModelSource) bool {
+	return model.CredentialsSecretRef != nil || model.ServiceAccountToken != nil
+}
+
+// credentialsDir 模型凭证在下载容器中的目录
+func credentialsDir(index int, model modelv2.ModelSource) string {
+	return path.Join(credentialsMountPath, modelName(index, model))
+}
+
+// newCredentialsVolumes 每个配置了凭证的模型一个 projected 存储卷, 包含 Secret 中的所有 key 以及投射的 ServiceAccount token,
+// Secret 更新或 token 轮换后 kubelet 会自动刷新其中的文件
+func newCredentialsVolumes(models []modelv2.ModelSource) []corev1.Volume {
+	var volumes []corev1.Volume
+	for i, model := range models {
+		if !hasCredentials(model) {
+			continue
+		}
+		var sources []corev1.VolumeProjection
+		if model.CredentialsSecretRef != nil {
+			sources = append(sources, corev1.VolumeProjection{
+				Secret: &corev1.SecretProjection{LocalObjectReference: *model.CredentialsSecretRef},
+			})
+		}
+		if token := model.ServiceAccountToken; token != nil {
+			sources = append(sources, corev1.VolumeProjection{
+				ServiceAccountToken: &corev1.ServiceAccountTokenProjection{
+					Audience:          token.Audience,
+					ExpirationSeconds: token.ExpirationSeconds,
+					Path:              serviceAccountTokenFile,
+				},
+			})
+		}
+		volumes = append(volumes, corev1.Volume{
+			Name: credentialsVolumePrefix + modelName(i, model),
+			VolumeSource: corev1.VolumeSource{
+				Projected: &corev1.ProjectedVolumeSource{Sources: sources},
+			},
+		})
+	}
+	return volumes
+}
+
+// newCredentialsVolumeMounts 以只读方式挂载模型凭证, 只用于下载模型的容器
+func newCredentialsVolumeMounts(models []modelv2.ModelSource) []corev1.VolumeMount {
+	var mounts []corev1.VolumeMount
+	for i, model := range models {
+		if hasCredentials(model) {
+			mounts = append(mounts, newCredentialsVolumeMount(i, model))
+		}
+	}
+	return mounts
+}
+
+func newCredentialsVolumeMount(index int, model modelv2.ModelSource) corev1.VolumeMount {
+	return corev1.VolumeMount{
+		Name:      credentialsVolumePrefix + modelName(index, model),
+		MountPath: credentialsDir(index, model),
+		ReadOnly:  true,
+	}
+}
+
+// validateModels 检查模型与批量推理输入数据集的地址以及引用的凭证 Secret, 不合法时记录事件并返回错误, 不会创建或更新 Deployment.
+// 读取 Secret 时直接访问 API server 而不是缓存, 控制器不需要 list/watch 所有 Secret
+func (r *ModelBoxReconciler) validateModels(ctx context.Context, modelbox *modelv2.ModelBox) error {
+	// 批量推理的输入数据集按名为 batch-input 的模型检查
+	models := append(append([]modelv2.ModelSource{}, effectiveModels(modelbox)...), batchInputs(modelbox)...)
+	for i, model := range models {
+		if err := modelsync.ValidateURL(model.URL); err != nil {
+			err = fmt.Errorf("model %s: %v", modelName(i, model), err)
+			r.Recorder.Event(modelbox, corev1.EventTypeWarning, "InvalidModelURL", err.Error())
+			return err
+		}
+		if model.CredentialsSecretRef == nil {
+			continue
+		}
+		secret := &corev1.Secret{}
+		key := client.ObjectKey{Namespace: modelbox.Namespace, Name: model.CredentialsSecretRef.Name}
+		err := r.APIReader.Get(ctx, key, secret)
+		if errors.IsNotFound(err) {
+			err = fmt.Errorf("credentials secret %q of model %s not found", key.Name, modelName(i, model))
+			r.Recorder.Event(modelbox, corev1.EventTypeWarning, "CredentialsSecretNotFound", err.Error())
+			return err
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/diff"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	modelv2 "github.com/sharelinuxs/my-first-opeartor/api/v2"
+)
+
+func int64Ptr(i int64) *int64 { return &i }
+
+func TestNewCredentialsVolumes(t *testing.T) {
+	secret := corev1.VolumeProjection{
+		Secret: &corev1.SecretProjection{LocalObjectReference: corev1.LocalObjectReference{Name: "s3"}},
+	}
+	token := corev1.VolumeProjection{
+		ServiceAccountToken: &corev1.ServiceAccountTokenProjection{
+			Audience:          "sts.amazonaws.com",
+			ExpirationSeconds: int64Ptr(3600),
+			Path:              serviceAccountTokenFile,
+		},
+	}
+	projected := func(name string, sources ...corev1.VolumeProjection) corev1.Volume {
+		return corev1.Volume{
+			Name:         name,
+			VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{Sources: sources}},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		models []modelv2.ModelSource
+		want   []corev1.Volume
+	}{
+		{
+			name:   "no credentials",
+			models: []modelv2.ModelSource{{Name: "resnet", URL: "https://models.example.com/resnet"}},
+		},
+		{
+			name: "secret",
+			models: []modelv2.ModelSource{
+				{Name: "resnet", URL: "s3://models/resnet/", CredentialsSecretRef: &corev1.LocalObjectReference{Name: "s3"}},
+			},
+			want: []corev1.Volume{projected("credentials-resnet", secret)},
+		},
+		{
+			name: "service account token",
+			models: []modelv2.ModelSource{
+				{Name: "resnet", URL: "s3://models/resnet/", ServiceAccountToken: &modelv2.ServiceAccountTokenProjection{
+					Audience: "sts.amazonaws.com", ExpirationSeconds: int64Ptr(3600),
+				}},
+			},
+			want: []corev1.Volume{projected("credentials-resnet", token)},
+		},
+		{
+			name: "secret and token share one volume",
+			models: []modelv2.ModelSource{
+				{
+					Name:                 "resnet",
+					URL:                  "s3://models/resnet/",
+					CredentialsSecretRef: &corev1.LocalObjectReference{Name: "s3"},
+					ServiceAccountToken:  &modelv2.ServiceAccountTokenProjection{Audience: "sts.amazonaws.com", ExpirationSeconds: int64Ptr(3600)},
+				},
+			},
+			want: []corev1.Volume{projected("credentials-resnet", secret, token)},
+		},
+		{
+			name: "only models with credentials, unnamed models by index",
+			models: []modelv2.ModelSource{
+				{Name: "public", URL: "https://models.example.com/public"},
+				{URL: "s3://models/private/", CredentialsSecretRef: &corev1.LocalObjectReference{Name: "s3"}},
+			},
+			want: []corev1.Volume{projected("credentials-model-1", secret)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newCredentialsVolumes(tt.models)
+			if !equality.Semantic.DeepEqual(got, tt.want) {
+				t.Errorf("volumes mismatch:\n%s", diff.ObjectReflectDiff(tt.want, got))
+			}
+		})
+	}
+}
+
+// TestSpecModelCredentialsLayout spec.model 的凭证只挂载到 fetch-model 中, 推理服务容器看不到
+func TestSpecModelCredentialsLayout(t *testing.T) {
+	modelbox := newTestModelBox()
+	modelbox.Spec.Model = modelv2.ModelSource{
+		URL:                  "s3://models/resnet/",
+		CredentialsSecretRef: &corev1.LocalObjectReference{Name: "s3"},
+		ServiceAccountToken:  &modelv2.ServiceAccountTokenProjection{Audience: "sts.amazonaws.com"},
+	}
+	podSpec := NewDeploy(modelbox).Spec.Template.Spec
+
+	var volume *corev1.Volume
+	for i := range podSpec.Volumes {
+		if podSpec.Volumes[i].Name == "credentials-model" {
+			volume = &podSpec.Volumes[i]
+		}
+	}
+	if volume == nil || volume.Projected == nil || len(volume.Projected.Sources) != 2 {
+		t.Fatalf("got credentials volume %+v, want a projected volume with the secret and the token", volume)
+	}
+
+	fetcher := findContainer(podSpec.InitContainers, "fetch-model")
+	if fetcher == nil {
+		t.Fatalf("no fetch-model init container in %v", containerNames(podSpec.InitContainers))
+	}
+	mount := findVolumeMount(fetcher, "credentials-model")
+	if mount == nil || mount.MountPath != "/var/run/secrets/modelbox/model" || !mount.ReadOnly {
+		t.Errorf("got credentials mount %+v, want read-only /var/run/secrets/modelbox/model", mount)
+	}
+	if !hasArg(*fetcher, "--credentials-dir=/var/run/secrets/modelbox/model") {
+		t.Errorf("args %v do not contain --credentials-dir", fetcher.Args)
+	}
+	if len(fetcher.EnvFrom) != 1 || fetcher.EnvFrom[0].SecretRef == nil || fetcher.EnvFrom[0].SecretRef.Name != "s3" {
+		t.Errorf("got envFrom %+v, want secret s3", fetcher.EnvFrom)
+	}
+	tokenFile := ""
+	for _, env := range fetcher.Env {
+		if env.Name == "AWS_WEB_IDENTITY_TOKEN_FILE" {
+			tokenFile = env.Value
+		}
+	}
+	if tokenFile != "/var/run/secrets/modelbox/model/serviceaccount-token" {
+		t.Errorf("got AWS_WEB_IDENTITY_TOKEN_FILE %q", tokenFile)
+	}
+
+	serving := findContainer(podSpec.Containers, modelbox.Name)
+	if serving == nil {
+		t.Fatal("no serving container")
+	}
+	if findVolumeMount(serving, "credentials-model") != nil {
+		t.Error("credentials mounted into the serving container")
+	}
+	if len(serving.EnvFrom) != 0 {
+		t.Errorf("serving container got envFrom %+v", serving.EnvFrom)
+	}
+}
+
+func TestValidateModelsMissingSecret(t *testing.T) {
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "s3", Namespace: "default"}}
+	tests := []struct {
+		name      string
+		modify    func(*modelv2.ModelBox)
+		objs      []*corev1.Secret
+		wantEvent string
+	}{
+		{
+			name: "spec.model secret exists",
+			modify: func(m *modelv2.ModelBox) {
+				m.Spec.Model.CredentialsSecretRef = &corev1.LocalObjectReference{Name: "s3"}
+			},
+			objs: []*corev1.Secret{secret},
+		},
+		{
+			name: "spec.model secret missing",
+			modify: func(m *modelv2.ModelBox) {
+				m.Spec.Model.CredentialsSecretRef = &corev1.LocalObjectReference{Name: "s3"}
+			},
+			wantEvent: `CredentialsSecretNotFound credentials secret "s3" of model model not found`,
+		},
+		{
+			name: "models secret missing",
+			modify: func(m *modelv2.ModelBox) {
+				m.Spec.Models = []modelv2.ModelSource{
+					{Name: "public", URL: "https://models.example.com/public"},
+					{Name: "private", URL: "s3://models/private/", CredentialsSecretRef: &corev1.LocalObjectReference{Name: "private"}},
+				}
+			},
+			objs:      []*corev1.Secret{secret},
+			wantEvent: `CredentialsSecretNotFound credentials secret "private" of model private not found`,
+		},
+		{
+			name: "batch input secret missing",
+			modify: func(m *modelv2.ModelBox) {
+				m.Spec.WorkloadType = modelv2.WorkloadBatchJob
+				m.Spec.Batch = &modelv2.BatchSpec{
+					Input:  modelv2.ModelSource{URL: "s3://datasets/images/", CredentialsSecretRef: &corev1.LocalObjectReference{Name: "datasets"}},
+					Output: modelv2.BatchOutput{ClaimName: "results"},
+				}
+			},
+			wantEvent: `CredentialsSecretNotFound credentials secret "datasets" of model batch-input not found`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modelbox := newTestModelBox()
+			tt.modify(modelbox)
+			r, recorder := newTestReconciler(t)
+			for _, obj := range tt.objs {
+				if err := r.Create(context.Background(), obj.DeepCopy()); err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := r.validateModels(context.Background(), modelbox)
+			if (err != nil) != (tt.wantEvent != "") {
+				t.Fatalf("got error %v, want error %t", err, tt.wantEvent != "")
+			}
+			select {
+			case event := <-recorder.Events:
+				if event != "Warning "+tt.wantEvent {
+					t.Errorf("got event %q, want %q", event, "Warning "+tt.wantEvent)
+				}
+			default:
+				if tt.wantEvent != "" {
+					t.Errorf("no event recorded, want %q", tt.wantEvent)
+				}
+			}
+		})
+	}
+}
+
+// TestReconcileMissingSecret 凭证 Secret 不存在时不创建 Deployment, 避免 Pod 无法启动
+func TestReconcileMissingSecret(t *testing.T) {
+	modelbox := newTestModelBox()
+	modelbox.Spec.Model.CredentialsSecretRef = &corev1.LocalObjectReference{Name: "s3"}
+	r, _ := newTestReconciler(t, modelbox)
+	ctx := context.Background()
+	key := types.NamespacedName{Namespace: modelbox.Namespace, Name: modelbox.Name}
+
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err == nil {
+		t.Fatal("expected reconcile to fail while the secret is missing")
+	}
+	if err := r.Get(ctx, key, &appsv1.Deployment{}); !errors.IsNotFound(err) {
+		t.Fatalf("got error %v getting the Deployment, want NotFound", err)
+	}
+
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "s3", Namespace: "default"}}
+	if err := r.Create(ctx, secret); err != nil {
+		t.Fatal(err)
+	}
+	reconcileModelBox(t, r, modelbox)
+	deploy := &appsv1.Deployment{}
+	if err := r.Get(ctx, key, deploy); err != nil {
+		t.Fatal(err)
+	}
+	names := strings.Join(containerNames(deploy.Spec.Template.Spec.InitContainers), ",")
+	if names != "fetch-model" {
+		t.Errorf("got init containers %s, want fetch-model", names)
+	}
+}
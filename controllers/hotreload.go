@@ -0,0 +1,336 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/sharelinuxs/my-first-opeartor/agent/modelsync"
+	modelv2 "github.com/sharelinuxs/my-first-opeartor/api/v2"
+)
+
+const (
+	// modelConfigVolume 挂载模型配置 ConfigMap 的存储卷
+	modelConfigVolume = "model-config"
+	// modelConfigMountPath 模型配置在 agent 容器中的挂载路径
+	modelConfigMountPath = "/etc/modelbox"
+	// modelSyncContainer 启动前下载模型的 InitContainer
+	modelSyncContainer = "model-sync"
+	// modelReloaderContainer 监视模型配置并热更新的 sidecar
+	modelReloaderContainer = "model-reloader"
+	// agentStatusPort sidecar 返回同步状态的端口
+	agentStatusPort = 9090
+	// reloadRequeueInterval 热更新未完成时重新检查各 Pod 状态的间隔
+	reloadRequeueInterval = 5 * time.Second
+)
+
+// AgentImage 下载模型的 agent 的默认镜像, 由 manager 的 --agent-image 参数设置
+var AgentImage = "modelbox-agent:latest"
+
+// agentStatusClient 获取 sidecar 同步状态, 超时较短以免阻塞 Reconcile
+var agentStatusClient = &http.Client{Timeout: 2 * time.Second}
+
+// modelConfigName 保存模型配置的 ConfigMap 名称
+func modelConfigName(modelbox *modelv2.ModelBox) string {
+	return modelbox.Name + "-models"
+}
+
+// newModelConfig 热更新模式下 sidecar 与预热 DaemonSet 使用的模型配置
+func newModelConfig(modelbox *modelv2.ModelBox) *modelsync.Config {
+	config := &modelsync.Config{Models: []modelsync.Model{}}
+	for i, model := range effectiveModels(modelbox) {
+		m := modelsync.Model{
+			Name:     modelName(i, model),
+			URL:      model.URL,
+			Digest:   model.Digest,
+			Path:     strings.TrimPrefix(modelDir(i, model), modelMountPath+"/"),
+			Endpoint: model.Endpoint,
+		}
+		if hasCredentials(model) {
+			m.CredentialsDir = credentialsDir(i, model)
+		}
+		config.Models = append(config.Models, m)
+	}
+	return config
+}
+
+// NewModelConfigMap 创建保存模型配置的 ConfigMap, 修改模型地址只会更新该 ConfigMap, 不会改变 Pod 模板
+func NewModelConfigMap(modelbox *modelv2.ModelBox) (*corev1.ConfigMap, error) {
+	data, err := newModelConfig(modelbox).Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "ConfigMap",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            modelConfigName(modelbox),
+			Namespace:       modelbox.Namespace,
+			Labels:          map[string]string{"modelbox": modelbox.Name},
+			OwnerReferences: makeOwnerReferences(modelbox),
+		},
+		Data: map[string]string{modelsync.ConfigFileName: string(data)},
+	}, nil
+}
+
+// reconcileModelConfig 开启热更新或预热时创建或更新模型配置, 都关闭后删除
+func (r *ModelBoxReconciler) reconcileModelConfig(ctx context.Context, modelbox *modelv2.ModelBox) error {
+	current := &corev1.ConfigMap{}
+	err := r.Get(ctx, client.ObjectKey{Namespace: modelbox.Namespace, Name: modelConfigName(modelbox)}, current)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	exists := err == nil
+
+	if modelbox.Spec.HotReload == nil && modelbox.Spec.Prefetch == nil {
+		if exists && metav1.IsControlledBy(current, modelbox) {
+			return client.IgnoreNotFound(r.Delete(ctx, current))
+		}
+		return nil
+	}
+
+	desired, err := NewModelConfigMap(modelbox)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return r.Create(ctx, desired)
+	}
+	if equality.Semantic.DeepEqual(current.Data, desired.Data) {
+		return nil
+	}
+	current.Data = desired.Data
+	return r.Update(ctx, current)
+}
+
+// agentImage 下载模型的 InitContainer 与热更新 sidecar 使用的镜像, 解析了 digest 时按 digest 引用
+func agentImage(modelbox *modelv2.ModelBox) string {
+	return pinnedImage(modelbox, agentImageName(modelbox))
+}
+
+// agentImageName agent 镜像, hotReload.image 优先
+func agentImageName(modelbox *modelv2.ModelBox) string {
+	if modelbox.Spec.HotReload != nil && modelbox.Spec.HotReload.Image != "" {
+		return modelbox.Spec.HotReload.Image
+	}
+	return AgentImage
+}
+
+// agentVolumeMounts agent 同时负责下载所有模型, 挂载所有模型引用的 PVC 与凭证
+func agentVolumeMounts(modelbox *modelv2.ModelBox) []corev1.VolumeMount {
+	mounts := []corev1.VolumeMount{
+		{
+			Name:      "model-volume",
+			MountPath: modelMountPath,
+		},
+		{
+			Name:      modelConfigVolume,
+			MountPath: modelConfigMountPath,
+			ReadOnly:  true,
+		},
+	}
+	if modelbox.Spec.Prefetch != nil {
+		mounts = append(mounts, newModelCacheVolumeMount(true))
+	}
+	mounts = append(mounts, newPVCVolumeMounts(effectiveModels(modelbox))...)
+	return append(mounts, newCredentialsVolumeMounts(effectiveModels(modelbox))...)
+}
+
+// agentCacheArgs 配置了预热时 agent 优先从节点缓存复制模型
+func agentCacheArgs(modelbox *modelv2.ModelBox) []string {
+	if modelbox.Spec.Prefetch == nil {
+		return nil
+	}
+	return []string{"--cache-dir=" + modelsync.CacheMountPath}
+}
+
+// newModelSyncContainer 推理服务启动前由 agent 下载模型, 与 sidecar 使用相同的目录结构
+func newModelSyncContainer(modelbox *modelv2.ModelBox) corev1.Container {
+	return corev1.Container{
+		Name:            modelSyncContainer,
+		Image:           agentImage(modelbox),
+		ImagePullPolicy: modelbox.Spec.ImagePullPolicy,
+		Args: append([]string{
+			"--config=" + path.Join(modelConfigMountPath, modelsync.ConfigFileName),
+			"--root=" + modelMountPath,
+			"--once",
+		}, agentCacheArgs(modelbox)...),
+		Resources:                newResourceTypeRequirements("small"),
+		Env:                      modelbox.Spec.Serving.Env,
+		TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+		VolumeMounts:             agentVolumeMounts(modelbox),
+	}
+}
+
+// newModelReloader 监视模型配置的 sidecar. 参数中不包含模型地址, 模型变化不会触发滚动更新
+func newModelReloader(modelbox *modelv2.ModelBox) corev1.Container {
+	args := []string{
+		"--config=" + path.Join(modelConfigMountPath, modelsync.ConfigFileName),
+		"--root=" + modelMountPath,
+		"--status-address=:" + strconv.Itoa(agentStatusPort),
+	}
+	if modelbox.Spec.HotReload.ReloadURL != "" {
+		args = append(args, "--reload-url="+modelbox.Spec.HotReload.ReloadURL)
+	}
+	args = append(args, agentCacheArgs(modelbox)...)
+	return corev1.Container{
+		Name:            modelReloaderContainer,
+		Image:           agentImage(modelbox),
+		ImagePullPolicy: modelbox.Spec.ImagePullPolicy,
+		Args:            args,
+		Resources:       newResourceTypeRequirements("small"),
+		Env:             modelbox.Spec.Serving.Env,
+		Ports: []corev1.ContainerPort{
+			{
+				Name:          "agent-status",
+				ContainerPort: agentStatusPort,
+			},
+		},
+		VolumeMounts: agentVolumeMounts(modelbox),
+	}
+}
+
+func newModelConfigVolume(modelbox *modelv2.ModelBox) corev1.Volume {
+	return corev1.Volume{
+		Name: modelConfigVolume,
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: modelConfigName(modelbox)},
+			},
+		},
+	}
+}
+
+// newReloadStatuses 获取各 Pod 中 sidecar 的同步状态, 与最新的模型配置版本比较,
+// 返回各模型的加载状态、各 Pod 的热更新结果以及所有 Pod 是否都已加载最新配置
+func newReloadStatuses(ctx context.Context, modelbox *modelv2.ModelBox, pods []corev1.Pod) (string, []modelv2.ModelStatus, []modelv2.PodReloadStatus, bool, error) {
+	configMap, err := NewModelConfigMap(modelbox)
+	if err != nil {
+		return "", nil, nil, false, err
+	}
+	revision := modelsync.Revision([]byte(configMap.Data[modelsync.ConfigFileName]))
+
+	var active []*corev1.Pod
+	for i := range pods {
+		if pods[i].DeletionTimestamp == nil {
+			active = append(active, &pods[i])
+		}
+	}
+	reports := make([]*modelsync.Status, len(active))
+	probeErrs := make([]error, len(active))
+	var wg sync.WaitGroup
+	for i, pod := range active {
+		if pod.Status.Phase != corev1.PodRunning || pod.Status.PodIP == "" {
+			probeErrs[i] = fmt.Errorf("pod is %s", pod.Status.Phase)
+			continue
+		}
+		wg.Add(1)
+		go func(i int, pod *corev1.Pod) {
+			defer wg.Done()
+			reports[i], probeErrs[i] = probeAgentStatus(ctx, pod.Status.PodIP)
+		}(i, pod)
+	}
+	wg.Wait()
+
+	done := len(active) > 0
+	var reloads []modelv2.PodReloadStatus
+	for i, pod := range active {
+		reload := modelv2.PodReloadStatus{Pod: pod.Name}
+		report := reports[i]
+		switch {
+		case report == nil:
+			reload.State = modelv2.ReloadUnknown
+			reload.Message = probeErrs[i].Error()
+		case report.State == modelsync.StateFailed:
+			reload.Revision = report.Revision
+			reload.State = modelv2.ReloadFailed
+			reload.Message = report.Message
+		case report.State == modelsync.StateReady && report.Revision == revision:
+			reload.Revision = report.Revision
+			reload.State = modelv2.ReloadSucceeded
+		default:
+			reload.Revision = report.Revision
+			reload.State = modelv2.ReloadInProgress
+		}
+		done = done && reload.State == modelv2.ReloadSucceeded
+		reloads = append(reloads, reload)
+	}
+
+	// 各模型的状态取自已加载最新配置的 Pod 中 sidecar 的报告
+	var models []modelv2.ModelStatus
+	for _, model := range newModelConfig(modelbox).Models {
+		status := modelv2.ModelStatus{Name: model.Name, State: modelv2.ModelPending}
+		var syncing bool
+		var failures []string
+		for i, pod := range active {
+			report := reports[i]
+			if report == nil {
+				continue
+			}
+			for _, m := range report.Models {
+				if m.Name != model.Name {
+					continue
+				}
+				switch {
+				case m.State == modelsync.StateFailed:
+					failures = append(failures, fmt.Sprintf("%s: %s", pod.Name, m.Message))
+				case report.Revision == revision && report.State == modelsync.StateReady:
+					status.LoadedReplicas++
+				default:
+					syncing = true
+				}
+			}
+			if report.State == modelsync.StateSyncing {
+				syncing = true
+			}
+		}
+		switch {
+		case len(failures) > 0:
+			status.State = modelv2.ModelFailed
+			status.Message = strings.Join(failures, "; ")
+		case len(active) > 0 && status.LoadedReplicas == int32(len(active)):
+			status.State = modelv2.ModelLoaded
+		case syncing || status.LoadedReplicas > 0:
+			status.State = modelv2.ModelLoading
+		}
+		models = append(models, status)
+	}
+	return revision, models, reloads, done, nil
+}
+
+// probeAgentStatus 请求 Pod 中 sidecar 的 /status 接口
+func probeAgentStatus(ctx context.Context, podIP string) (*modelsync.Status, error) {
+	url := "http://" + net.JoinHostPort(podIP, strconv.Itoa(agentStatusPort)) + modelsync.StatusPath
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := agentStatusClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get %s: %s", url, resp.Status)
+	}
+	status := &modelsync.Status{}
+	if err := json.NewDecoder(resp.Body).Decode(status); err != nil {
+		return nil, fmt.Errorf("decode %s: %v", url, err)
+	}
+	return status, nil
+}
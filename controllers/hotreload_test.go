@@ -0,0 +1,238 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/diff"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/sharelinuxs/my-first-opeartor/agent/modelsync"
+	modelv2 "github.com/sharelinuxs/my-first-opeartor/api/v2"
+)
+
+func hasVolume(volumes []corev1.Volume, name string) bool {
+	for _, v := range volumes {
+		if v.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func containerNames(containers []corev1.Container) []string {
+	var names []string
+	for _, c := range containers {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+func hasArg(c corev1.Container, arg string) bool {
+	for _, a := range c.Args {
+		if a == arg {
+			return true
+		}
+	}
+	return false
+}
+
+func findContainer(containers []corev1.Container, name string) *corev1.Container {
+	for i := range containers {
+		if containers[i].Name == name {
+			return &containers[i]
+		}
+	}
+	return nil
+}
+
+func findVolumeMount(c *corev1.Container, name string) *corev1.VolumeMount {
+	for i := range c.VolumeMounts {
+		if c.VolumeMounts[i].Name == name {
+			return &c.VolumeMounts[i]
+		}
+	}
+	return nil
+}
+
+func TestNewDeployHotReload(t *testing.T) {
+	defer func(image string) { AgentImage = image }(AgentImage)
+	AgentImage = "agent:1"
+
+	tests := []struct {
+		name           string
+		hotReload      *modelv2.HotReloadSpec
+		wantInit       []string
+		wantContainers []string
+		wantImage      string
+		wantReloadURL  bool
+	}{
+		{
+			name:           "disabled",
+			wantInit:       []string{"fetch-model"},
+			wantContainers: []string{"resnet", "db-container"},
+		},
+		{
+			name:           "default agent image",
+			hotReload:      &modelv2.HotReloadSpec{},
+			wantInit:       []string{modelSyncContainer},
+			wantContainers: []string{"resnet", "db-container", modelReloaderContainer},
+			wantImage:      "agent:1",
+		},
+		{
+			name:           "reload URL and image",
+			hotReload:      &modelv2.HotReloadSpec{ReloadURL: "http://localhost:8080/reload", Image: "agent:2"},
+			wantInit:       []string{modelSyncContainer},
+			wantContainers: []string{"resnet", "db-container", modelReloaderContainer},
+			wantImage:      "agent:2",
+			wantReloadURL:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modelbox := newTestModelBox()
+			modelbox.Spec.HotReload = tt.hotReload
+			podSpec := NewDeploy(modelbox).Spec.Template.Spec
+
+			if got := containerNames(podSpec.InitContainers); strings.Join(got, ",") != strings.Join(tt.wantInit, ",") {
+				t.Errorf("got init containers %v, want %v", got, tt.wantInit)
+			}
+			if got := containerNames(podSpec.Containers); strings.Join(got, ",") != strings.Join(tt.wantContainers, ",") {
+				t.Errorf("got containers %v, want %v", got, tt.wantContainers)
+			}
+			if hasVolume(podSpec.Volumes, modelConfigVolume) != (tt.hotReload != nil) {
+				t.Errorf("got volumes %v, want %s only with hot reload", podSpec.Volumes, modelConfigVolume)
+			}
+			if tt.hotReload == nil {
+				return
+			}
+
+			sync := findContainer(podSpec.InitContainers, modelSyncContainer)
+			reloader := findContainer(podSpec.Containers, modelReloaderContainer)
+			for _, c := range []*corev1.Container{sync, reloader} {
+				if c.Image != tt.wantImage {
+					t.Errorf("%s: got image %s, want %s", c.Name, c.Image, tt.wantImage)
+				}
+				if !hasArg(*c, "--config=/etc/modelbox/"+modelsync.ConfigFileName) || !hasArg(*c, "--root="+modelMountPath) {
+					t.Errorf("%s: got args %v", c.Name, c.Args)
+				}
+				if m := findVolumeMount(c, modelConfigVolume); m == nil || !m.ReadOnly {
+					t.Errorf("%s: got mounts %v, want %s mounted read-only", c.Name, c.VolumeMounts, modelConfigVolume)
+				}
+				// 模型地址只写入 ConfigMap
+				for _, arg := range c.Args {
+					if strings.Contains(arg, modelbox.Spec.Model.URL) {
+						t.Errorf("%s: arg %s contains the model URL", c.Name, arg)
+					}
+				}
+			}
+			if !hasArg(*sync, "--once") || hasArg(*reloader, "--once") {
+				t.Errorf("got model-sync args %v and reloader args %v, want --once only on model-sync", sync.Args, reloader.Args)
+			}
+			if hasArg(*reloader, "--reload-url=http://localhost:8080/reload") != tt.wantReloadURL {
+				t.Errorf("got reloader args %v", reloader.Args)
+			}
+			if len(reloader.Ports) != 1 || reloader.Ports[0].ContainerPort != agentStatusPort {
+				t.Errorf("got reloader ports %v, want %d", reloader.Ports, agentStatusPort)
+			}
+		})
+	}
+}
+
+// TestHotReloadModelChangeKeepsPodTemplate 热更新模式下修改模型地址不触发滚动更新
+func TestHotReloadModelChangeKeepsPodTemplate(t *testing.T) {
+	modelbox := newTestModelBox()
+	modelbox.Spec.HotReload = &modelv2.HotReloadSpec{}
+	before := NewDeploy(modelbox).Spec.Template
+
+	modelbox.Spec.Model.URL = "https://models.example.com/resnet-v2.tar.gz"
+	modelbox.Spec.Model.Digest = "sha256:" + strings.Repeat("c", 64)
+	after := NewDeploy(modelbox).Spec.Template
+	if !equality.Semantic.DeepEqual(before, after) {
+		t.Errorf("pod template changed with the model:\n%s", diff.ObjectReflectDiff(before, after))
+	}
+
+	// 不开启热更新时模型变化需要重新创建 Pod
+	modelbox.Spec.HotReload = nil
+	if equality.Semantic.DeepEqual(NewDeploy(modelbox).Spec.Template, before) {
+		t.Error("pod template did not change without hot reload")
+	}
+}
+
+func TestNewModelConfigMap(t *testing.T) {
+	modelbox := newTestModelBox()
+	modelbox.Spec.Models = []modelv2.ModelSource{
+		{Name: "resnet", URL: "s3://models/resnet/", Endpoint: "http://minio:9000"},
+		{URL: "hf://org/bert", SubPath: "nlp/bert", Digest: "main"},
+	}
+	cm, err := NewModelConfigMap(modelbox)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cm.Name != "resnet-models" || len(cm.OwnerReferences) != 1 || cm.Labels["modelbox"] != "resnet" {
+		t.Errorf("got ConfigMap %s with owners %v and labels %v", cm.Name, cm.OwnerReferences, cm.Labels)
+	}
+	var config modelsync.Config
+	if err := json.Unmarshal([]byte(cm.Data[modelsync.ConfigFileName]), &config); err != nil {
+		t.Fatal(err)
+	}
+	want := modelsync.Config{Models: []modelsync.Model{
+		{Name: "resnet", URL: "s3://models/resnet/", Path: "resnet", Endpoint: "http://minio:9000"},
+		{Name: "model-1", URL: "hf://org/bert", Digest: "main", Path: "nlp/bert"},
+	}}
+	if !equality.Semantic.DeepEqual(config, want) {
+		t.Errorf("got config %+v, want %+v", config, want)
+	}
+}
+
+// TestReconcileModelConfig 开启热更新时创建并更新 ConfigMap, 关闭后删除
+func TestReconcileModelConfig(t *testing.T) {
+	r, _ := newTestReconciler(t)
+	ctx := context.Background()
+	modelbox := newTestModelBox()
+	key := client.ObjectKey{Namespace: "default", Name: modelConfigName(modelbox)}
+	config := func() string {
+		t.Helper()
+		cm := &corev1.ConfigMap{}
+		if err := r.Get(ctx, key, cm); err != nil {
+			t.Fatal(err)
+		}
+		return cm.Data[modelsync.ConfigFileName]
+	}
+
+	if err := r.reconcileModelConfig(ctx, modelbox); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Get(ctx, key, &corev1.ConfigMap{}); !errors.IsNotFound(err) {
+		t.Fatalf("got error %v without hot reload, want NotFound", err)
+	}
+
+	modelbox.Spec.HotReload = &modelv2.HotReloadSpec{}
+	if err := r.reconcileModelConfig(ctx, modelbox); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(config(), "resnet.tar.gz") {
+		t.Errorf("got config %s", config())
+	}
+
+	modelbox.Spec.Model.URL = "https://models.example.com/resnet-v2.tar.gz"
+	if err := r.reconcileModelConfig(ctx, modelbox); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(config(), "resnet-v2.tar.gz") {
+		t.Errorf("got config %s after changing the model", config())
+	}
+
+	modelbox.Spec.HotReload = nil
+	if err := r.reconcileModelConfig(ctx, modelbox); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Get(ctx, key, &corev1.ConfigMap{}); !errors.IsNotFound(err) {
+		t.Errorf("got error %v after disabling hot reload, want NotFound", err)
+	}
+}
@@ -0,0 +1,402 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/sharelinuxs/my-first-opeartor/agent/modelsync"
+	modelv2 "github.com/sharelinuxs/my-first-opeartor/api/v2"
+)
+
+// manifestMediaTypes 解析 digest 时接受的 manifest 类型, 多架构镜像取 index 的 digest
+var manifestMediaTypes = []string{
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+}
+
+var (
+	// UtilityImage 通用容器使用的镜像, 由 manager 的 --utility-image 参数设置
+	UtilityImage = "busybox:1.33.1"
+	// AllowedRegistries 允许 ModelBox 使用的镜像仓库, 由 manager 的 --allowed-registries 参数设置, 为空时不限制
+	AllowedRegistries []string
+	// ResolveDigests 是否将镜像 tag 解析为 digest, 由 manager 的 --resolve-digests 参数设置
+	ResolveDigests bool
+)
+
+// registryClient 访问镜像仓库的 Distribution API
+var registryClient = &http.Client{Timeout: 10 * time.Second}
+
+// imageResolveRetryInterval 解析 digest 失败后重新解析的间隔
+const imageResolveRetryInterval = time.Minute
+
+// normalizeImage 补全镜像的仓库地址, 不带仓库地址的镜像属于 docker.io
+func normalizeImage(image string) string {
+	if i := strings.Index(image, "/"); i < 0 || !strings.ContainsAny(image[:i], ".:") && image[:i] != "localhost" {
+		return "docker.io/" + image
+	}
+	return image
+}
+
+// hasDigest 镜像是否已经按 digest 引用
+func hasDigest(image string) bool {
+	return strings.Contains(image, "@")
+}
+
+// specImages ModelBox 中指定的镜像, 受控制器与命名空间策略的仓库限制
+func specImages(modelbox *modelv2.ModelBox) []string {
+	images := []string{modelbox.Spec.Serving.Image}
+	if modelbox.Spec.HotReload != nil && modelbox.Spec.HotReload.Image != "" {
+		images = append(images, modelbox.Spec.HotReload.Image)
+	}
+	return images
+}
+
+// podImages ModelBox 的 Pod 与预热 DaemonSet 中使用的所有镜像, 不包含 status 中解析的 digest
+func podImages(modelbox *modelv2.ModelBox) []string {
+	images := []string{modelbox.Spec.Serving.Image, UtilityImage}
+	if modelbox.Spec.HotReload != nil || len(effectiveModels(modelbox)) > 0 || len(batchInputs(modelbox)) > 0 || modelbox.Spec.Prefetch != nil {
+		images = append(images, agentImageName(modelbox))
+	}
+	seen := map[string]bool{}
+	unique := images[:0]
+	for _, image := range images {
+		if !seen[image] {
+			seen[image] = true
+			unique = append(unique, image)
+		}
+	}
+	return unique
+}
+
+// pinnedImage status 中记录了 digest 时返回 image@digest, 否则原样返回
+func pinnedImage(modelbox *modelv2.ModelBox, image string) string {
+	for _, resolved := range modelbox.Status.ResolvedImages {
+		if resolved.Image == image {
+			return image + "@" + resolved.Digest
+		}
+	}
+	return image
+}
+
+// registryViolations ModelBox 中不属于控制器允许的仓库的镜像
+func registryViolations(modelbox *modelv2.ModelBox) []string {
+	if len(AllowedRegistries) == 0 {
+		return nil
+	}
+	var violations []string
+	for _, image := range specImages(modelbox) {
+		if !imageAllowed(image, AllowedRegistries) {
+			violations = append(violations, fmt.Sprintf("image %q is not from a registry allowed by the controller, allowed registries: %s",
+				image, strings.Join(AllowedRegistries, ", ")))
+		}
+	}
+	return violations
+}
+
+// resolveImages 检查镜像仓库, 开启 digest 解析时将 Pod 使用的镜像 tag 解析为 digest 并记录在 status 中.
+// 已记录的镜像不再重新解析, 之后创建的 Pod 与 spec 变化前的 Pod 使用相同的镜像.
+// 仓库暂时无法访问时不阻塞 Reconcile, 产生事件后未解析的镜像按 tag 拉取, 返回重新解析的间隔
+func (r *ModelBoxReconciler) resolveImages(ctx context.Context, modelbox *modelv2.ModelBox) (time.Duration, error) {
+	if violations := registryViolations(modelbox); len(violations) > 0 {
+		err := fmt.Errorf("%s", strings.Join(violations, "; "))
+		r.Recorder.Event(modelbox, corev1.EventTypeWarning, "ImageNotAllowed", err.Error())
+		return 0, err
+	}
+
+	var requeueAfter time.Duration
+	var resolved []modelv2.ResolvedImage
+	if ResolveDigests {
+		var credentials map[string]registryAuth
+		for _, image := range podImages(modelbox) {
+			if hasDigest(image) {
+				continue
+			}
+			digest := ""
+			for _, previous := range modelbox.Status.ResolvedImages {
+				if previous.Image == image {
+					digest = previous.Digest
+				}
+			}
+			if digest == "" {
+				if credentials == nil {
+					var err error
+					if credentials, err = r.registryCredentials(ctx, modelbox); err != nil {
+						return 0, err
+					}
+				}
+				var err error
+				if digest, err = resolveDigest(ctx, image, credentials); err != nil {
+					r.Recorder.Eventf(modelbox, corev1.EventTypeWarning, "ImageResolveFailed", "resolve digest of %s: %v", image, err)
+					requeueAfter = imageResolveRetryInterval
+					continue
+				}
+				r.Recorder.Eventf(modelbox, corev1.EventTypeNormal, "ImageResolved", "resolved %s to %s", image, digest)
+			}
+			resolved = append(resolved, modelv2.ResolvedImage{Image: image, Digest: digest})
+		}
+	}
+	if equality.Semantic.DeepEqual(resolved, modelbox.Status.ResolvedImages) {
+		return requeueAfter, nil
+	}
+	updated := modelbox.DeepCopy()
+	updated.Status.ResolvedImages = resolved
+	if err := r.Status().Patch(ctx, updated, client.MergeFrom(modelbox)); err != nil {
+		return 0, err
+	}
+	modelbox.Status.ResolvedImages = resolved
+	return requeueAfter, nil
+}
+
+// registryAuth 访问镜像仓库使用的用户名与密码
+type registryAuth struct {
+	Username string
+	Password string
+}
+
+// dockerConfig kubernetes.io/dockerconfigjson 中 auths 的取值, kubernetes.io/dockercfg 的内容即为 auths
+type dockerConfig map[string]struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Auth     string `json:"auth"`
+}
+
+// registryCredentials 按仓库地址读取 ModelBox 拉取镜像 Secret 中的凭证, 设置了 copy 的 Secret 读取集中管理的命名空间中的源 Secret,
+// 复制可能在解析之后才完成. Secret 不经过缓存读取, 不存在或格式不正确的 Secret 忽略, 由拉取镜像时报告
+func (r *ModelBoxReconciler) registryCredentials(ctx context.Context, modelbox *modelv2.ModelBox) (map[string]registryAuth, error) {
+	credentials := map[string]registryAuth{}
+	for _, ref := range modelbox.Spec.ImagePullSecrets {
+		namespace := modelbox.Namespace
+		if ref.Copy && PullSecretNamespace != "" {
+			namespace = PullSecretNamespace
+		}
+		secret := &corev1.Secret{}
+		if err := r.APIReader.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, secret); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		var auths dockerConfig
+		switch secret.Type {
+		case corev1.SecretTypeDockerConfigJson:
+			var config struct {
+				Auths dockerConfig `json:"auths"`
+			}
+			if err := json.Unmarshal(secret.Data[corev1.DockerConfigJsonKey], &config); err != nil {
+				continue
+			}
+			auths = config.Auths
+		case corev1.SecretTypeDockercfg:
+			if err := json.Unmarshal(secret.Data[corev1.DockerConfigKey], &auths); err != nil {
+				continue
+			}
+		}
+		for server, entry := range auths {
+			auth := registryAuth{Username: entry.Username, Password: entry.Password}
+			if auth.Username == "" && entry.Auth != "" {
+				decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+				if err != nil {
+					continue
+				}
+				parts := strings.SplitN(string(decoded), ":", 2)
+				auth.Username = parts[0]
+				if len(parts) == 2 {
+					auth.Password = parts[1]
+				}
+			}
+			// 先出现的 Secret 优先, 与 kubelet 拉取镜像时的顺序一致
+			if registry := credentialRegistry(server); registry != "" {
+				if _, ok := credentials[registry]; !ok {
+					credentials[registry] = auth
+				}
+			}
+		}
+	}
+	return credentials, nil
+}
+
+// credentialRegistry docker 配置中的仓库地址去掉协议与路径, Docker Hub 的各种写法统一为 parseImage 返回的地址
+func credentialRegistry(server string) string {
+	server = strings.TrimPrefix(strings.TrimPrefix(server, "https://"), "http://")
+	if i := strings.Index(server, "/"); i >= 0 {
+		server = server[:i]
+	}
+	switch server {
+	case "docker.io", "index.docker.io", "registry-1.docker.io":
+		return "registry-1.docker.io"
+	}
+	return server
+}
+
+// parseImage 拆分为仓库地址、镜像名称与 manifest 引用, docker.io 的官方镜像位于 library 下.
+// 带 digest 的镜像引用 digest, 否则引用 tag, 默认 tag 为 latest
+func parseImage(image string) (string, string, string) {
+	name := normalizeImage(image)
+	i := strings.Index(name, "/")
+	registry, repo := name[:i], name[i+1:]
+	reference := ""
+	if j := strings.Index(repo, "@"); j >= 0 {
+		repo, reference = repo[:j], repo[j+1:]
+	}
+	if j := strings.LastIndex(repo, ":"); j > strings.LastIndex(repo, "/") {
+		if reference == "" {
+			reference = repo[j+1:]
+		}
+		repo = repo[:j]
+	}
+	if reference == "" {
+		reference = "latest"
+	}
+	if registry == "docker.io" {
+		registry = "registry-1.docker.io"
+		if !strings.Contains(repo, "/") {
+			repo = "library/" + repo
+		}
+	}
+	return registry, repo, reference
+}
+
+// resolveDigest 按 Distribution API 查询 tag 对应的 manifest digest, credentials 中有该仓库的凭证时使用 Basic 认证或换取 Bearer token.
+// 优先读取 HEAD 返回的 Docker-Content-Digest, 仓库不返回时下载 manifest 计算
+func resolveDigest(ctx context.Context, image string, credentials map[string]registryAuth) (string, error) {
+	registry, repo, reference := parseImage(image)
+	var auth *registryAuth
+	if a, ok := credentials[registry]; ok {
+		auth = &a
+	}
+	scheme := "https"
+	if strings.HasPrefix(registry, "localhost") || strings.HasPrefix(registry, "127.0.0.1") {
+		scheme = "http"
+	}
+	manifestURL := scheme + "://" + registry + "/v2/" + repo + "/manifests/" + reference
+
+	resp, err := registryRequest(ctx, http.MethodHead, manifestURL, auth)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if digest := resp.Header.Get("Docker-Content-Digest"); digest != "" {
+		return digest, nil
+	}
+	if resp, err = registryRequest(ctx, http.MethodGet, manifestURL, auth); err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if digest := resp.Header.Get("Docker-Content-Digest"); digest != "" {
+		return digest, nil
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, resp.Body); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("sha256:%x", hash.Sum(nil)), nil
+}
+
+// registryRequest 发送请求, 收到 401 时按 WWW-Authenticate 质询使用 Basic 认证或换取 Bearer token 后重试一次
+func registryRequest(ctx context.Context, method, target string, auth *registryAuth) (*http.Response, error) {
+	do := func(authorization string) (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, method, target, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		return registryClient.Do(req)
+	}
+	resp, err := do("")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		authorization, err := registryAuthorization(ctx, challenge, auth)
+		if err != nil {
+			return nil, err
+		}
+		if resp, err = do(authorization); err != nil {
+			return nil, err
+		}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s: %s", method, target, resp.Status)
+	}
+	return resp, nil
+}
+
+// registryAuthorization 按质询生成 Authorization 头, Basic 质询需要凭证, Bearer 质询没有凭证时换取匿名 token
+func registryAuthorization(ctx context.Context, challenge string, auth *registryAuth) (string, error) {
+	scheme, params := modelsync.ParseChallenge(challenge)
+	switch {
+	case strings.EqualFold(scheme, "basic") && auth != nil:
+		return "Basic " + basicAuth(auth), nil
+	case strings.EqualFold(scheme, "bearer") && params["realm"] != "":
+		token, err := registryToken(ctx, params, auth)
+		if err != nil {
+			return "", err
+		}
+		return "Bearer " + token, nil
+	case strings.EqualFold(scheme, "basic"):
+		return "", fmt.Errorf("registry requires basic auth, no credentials in the image pull secrets")
+	}
+	return "", fmt.Errorf("unsupported registry auth challenge %q", challenge)
+}
+
+func basicAuth(auth *registryAuth) string {
+	return base64.StdEncoding.EncodeToString([]byte(auth.Username + ":" + auth.Password))
+}
+
+// registryToken 按 Bearer 质询的参数换取 token, 有凭证时以 Basic 认证请求
+func registryToken(ctx context.Context, params map[string]string, auth *registryAuth) (string, error) {
+	query := url.Values{}
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	if params["scope"] != "" {
+		query.Set("scope", params["scope"])
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, params["realm"]+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	if auth != nil {
+		req.SetBasicAuth(auth.Username, auth.Password)
+	}
+	resp, err := registryClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("get registry token: %s", resp.Status)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("decode registry token: %v", err)
+	}
+	if token.Token != "" {
+		return token.Token, nil
+	}
+	return token.AccessToken, nil
+}
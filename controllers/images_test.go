@@ -0,0 +1,251 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	modelv2 "github.com/sharelinuxs/my-first-opeartor/api/v2"
+)
+
+func TestParseImage(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+	tests := []struct {
+		image         string
+		wantRegistry  string
+		wantRepo      string
+		wantReference string
+	}{
+		{"busybox", "registry-1.docker.io", "library/busybox", "latest"},
+		{"busybox:1.33.1", "registry-1.docker.io", "library/busybox", "1.33.1"},
+		{"org/resnet:1", "registry-1.docker.io", "org/resnet", "1"},
+		{"docker.io/resnet:2", "registry-1.docker.io", "library/resnet", "2"},
+		{"registry.example.com/ml/resnet:1", "registry.example.com", "ml/resnet", "1"},
+		{"registry.example.com:5000/ml/resnet", "registry.example.com:5000", "ml/resnet", "latest"},
+		{"localhost/resnet:1", "localhost", "resnet", "1"},
+		{"127.0.0.1:5000/resnet:1", "127.0.0.1:5000", "resnet", "1"},
+		{"resnet@" + digest, "registry-1.docker.io", "library/resnet", digest},
+		{"registry.example.com:5000/ml/resnet:1@" + digest, "registry.example.com:5000", "ml/resnet", digest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			registry, repo, reference := parseImage(tt.image)
+			if registry != tt.wantRegistry || repo != tt.wantRepo || reference != tt.wantReference {
+				t.Errorf("got %s %s %s, want %s %s %s", registry, repo, reference, tt.wantRegistry, tt.wantRepo, tt.wantReference)
+			}
+		})
+	}
+}
+
+// testRegistry 按 Distribution API 的 Bearer 质询流程返回 manifest, token 服务要求 robot/secret 凭证
+type testRegistry struct {
+	*httptest.Server
+	manifest string
+	// omitDigest HEAD 与 GET 都不返回 Docker-Content-Digest
+	omitDigest bool
+	// fail 所有请求返回 503
+	fail bool
+}
+
+const testRegistryToken = "registry-token"
+
+func newTestRegistry(t *testing.T) *testRegistry {
+	r := &testRegistry{manifest: `{"schemaVersion":2}`}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, req *http.Request) {
+		username, password, ok := req.BasicAuth()
+		if !ok || username != "robot" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		query := req.URL.Query()
+		if query.Get("service") != "test-registry" || query.Get("scope") != "repository:ml/resnet:pull" {
+			t.Errorf("got token request %s, want service test-registry and scope repository:ml/resnet:pull", req.URL.RawQuery)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, `{"token":%q}`, testRegistryToken)
+	})
+	mux.HandleFunc("/v2/ml/resnet/manifests/1", func(w http.ResponseWriter, req *http.Request) {
+		if r.fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if req.Header.Get("Authorization") != "Bearer "+testRegistryToken {
+			w.Header().Set("WWW-Authenticate",
+				fmt.Sprintf(`Bearer realm="%s/token",service="test-registry",scope="repository:ml/resnet:pull"`, r.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if !r.omitDigest {
+			w.Header().Set("Docker-Content-Digest", fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(r.manifest))))
+		}
+		if req.Method == http.MethodGet {
+			fmt.Fprint(w, r.manifest)
+		}
+	})
+	r.Server = httptest.NewServer(mux)
+	t.Cleanup(r.Close)
+	return r
+}
+
+// host 不带协议的仓库地址, 127.0.0.1 的仓库使用 http
+func (r *testRegistry) host() string {
+	return strings.TrimPrefix(r.URL, "http://")
+}
+
+func TestResolveDigest(t *testing.T) {
+	robot := map[string]registryAuth{}
+	wrong := map[string]registryAuth{}
+	tests := []struct {
+		name        string
+		credentials map[string]registryAuth
+		omitDigest  bool
+		wantErr     bool
+	}{
+		{name: "bearer token with credentials", credentials: robot},
+		{name: "manifest digest computed without the header", credentials: robot, omitDigest: true},
+		{name: "anonymous token rejected", wantErr: true},
+		{name: "wrong credentials", credentials: wrong, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := newTestRegistry(t)
+			registry.omitDigest = tt.omitDigest
+			robot[registry.host()] = registryAuth{Username: "robot", Password: "secret"}
+			wrong[registry.host()] = registryAuth{Username: "robot", Password: "wrong"}
+
+			digest, err := resolveDigest(context.Background(), registry.host()+"/ml/resnet:1", tt.credentials)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, wantErr %t", err, tt.wantErr)
+			}
+			want := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(registry.manifest)))
+			if err == nil && digest != want {
+				t.Errorf("got digest %s, want %s", digest, want)
+			}
+		})
+	}
+}
+
+func TestRegistryCredentials(t *testing.T) {
+	defer func(namespace string) { PullSecretNamespace = namespace }(PullSecretNamespace)
+	PullSecretNamespace = "registry-secrets"
+
+	auth := base64.StdEncoding.EncodeToString([]byte("hub-user:hub:password"))
+	dockerConfigJSON := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "hub", Namespace: "default"},
+		Type:       corev1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{corev1.DockerConfigJsonKey: []byte(`{"auths":{` +
+			`"https://index.docker.io/v1/":{"auth":"` + auth + `"},` +
+			`"registry.example.com":{"username":"robot","password":"secret"}}}`)},
+	}
+	dockercfg := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "quay", Namespace: "default"},
+		Type:       corev1.SecretTypeDockercfg,
+		Data: map[string][]byte{corev1.DockerConfigKey: []byte(`{` +
+			`"https://quay.io":{"username":"quay-user","password":"quay-password"},` +
+			`"registry.example.com":{"username":"shadowed","password":"shadowed"}}`)},
+	}
+	// 设置了 copy 的 Secret 读取源 Secret, ModelBox 命名空间中的副本可能还不存在
+	source := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "shared", Namespace: "registry-secrets"},
+		Type:       corev1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{corev1.DockerConfigJsonKey: []byte(
+			`{"auths":{"http://localhost:5000/v2/":{"username":"local","password":"local"}}}`)},
+	}
+	opaque := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "opaque", Namespace: "default"},
+		Data:       map[string][]byte{"username": []byte("ignored")},
+	}
+
+	modelbox := newTestModelBox()
+	modelbox.Spec.ImagePullSecrets = []modelv2.ImagePullSecret{
+		{Name: "hub"}, {Name: "quay"}, {Name: "shared", Copy: true}, {Name: "opaque"}, {Name: "missing"},
+	}
+	r, _ := newTestReconciler(t, dockerConfigJSON, dockercfg, source, opaque)
+	got, err := r.registryCredentials(context.Background(), modelbox)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]registryAuth{
+		"registry-1.docker.io": {Username: "hub-user", Password: "hub:password"},
+		"registry.example.com": {Username: "robot", Password: "secret"},
+		"quay.io":              {Username: "quay-user", Password: "quay-password"},
+		"localhost:5000":       {Username: "local", Password: "local"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got credentials %+v, want %+v", got, want)
+	}
+}
+
+// TestResolveImagesFailure 仓库无法访问时不阻塞 Reconcile, 保留已记录的 digest 并重新解析
+func TestResolveImagesFailure(t *testing.T) {
+	defer func(resolve bool, utility, agent string) {
+		ResolveDigests, UtilityImage, AgentImage = resolve, utility, agent
+	}(ResolveDigests, UtilityImage, AgentImage)
+
+	registry := newTestRegistry(t)
+	registry.fail = true
+	ResolveDigests = true
+	UtilityImage = registry.host() + "/ml/resnet:1"
+	AgentImage = UtilityImage
+
+	pinned := modelv2.ResolvedImage{Image: "resnet:1", Digest: "sha256:" + strings.Repeat("b", 64)}
+	modelbox := newTestModelBox()
+	modelbox.Status.ResolvedImages = []modelv2.ResolvedImage{pinned}
+	r, recorder := newTestReconciler(t, modelbox.DeepCopy())
+
+	requeueAfter, err := r.resolveImages(context.Background(), modelbox)
+	if err != nil {
+		t.Fatalf("resolveImages failed: %v", err)
+	}
+	if requeueAfter != imageResolveRetryInterval {
+		t.Errorf("got requeueAfter %s, want %s", requeueAfter, imageResolveRetryInterval)
+	}
+	if !reflect.DeepEqual(modelbox.Status.ResolvedImages, []modelv2.ResolvedImage{pinned}) {
+		t.Errorf("got resolved images %+v, want the pinned digest kept", modelbox.Status.ResolvedImages)
+	}
+	if image := pinnedImage(modelbox, UtilityImage); image != UtilityImage {
+		t.Errorf("got utility image %s, want the tag until it resolves", image)
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.HasPrefix(event, "Warning ImageResolveFailed") {
+			t.Errorf("got event %q, want ImageResolveFailed", event)
+		}
+	default:
+		t.Error("no ImageResolveFailed event recorded")
+	}
+
+	// 仓库恢复后解析未记录的镜像, 已记录的 digest 不变
+	registry.fail = false
+	modelbox.Spec.ImagePullSecrets = []modelv2.ImagePullSecret{{Name: "registry"}}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "registry", Namespace: "default"},
+		Type:       corev1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{corev1.DockerConfigJsonKey: []byte(
+			fmt.Sprintf(`{"auths":{%q:{"username":"robot","password":"secret"}}}`, registry.host()))},
+	}
+	if err := r.Create(context.Background(), secret); err != nil {
+		t.Fatal(err)
+	}
+	if requeueAfter, err = r.resolveImages(context.Background(), modelbox); err != nil || requeueAfter != 0 {
+		t.Fatalf("got requeueAfter %s and error %v after the registry recovered", requeueAfter, err)
+	}
+	want := []modelv2.ResolvedImage{
+		pinned,
+		{Image: UtilityImage, Digest: fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(registry.manifest)))},
+	}
+	if !reflect.DeepEqual(modelbox.Status.ResolvedImages, want) {
+		t.Errorf("got resolved images %+v, want %+v", modelbox.Status.ResolvedImages, want)
+	}
+}
@@ -19,22 +19,33 @@ package controllers
 import (
 	"context"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/retry"
 	"reflect"
+	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
-	modelv1 "github.com/sharelinuxs/my-first-opeartor/api/v1"
+	modelv2 "github.com/sharelinuxs/my-first-opeartor/api/v2"
 )
 
 var (
-	oldSpecAnnotation = "modelbox.model.github.com/last-oldSpec"
+	oldSpecAnnotation = modelv2.AppliedSpecAnnotation
 )
 
 // ModelBoxReconciler reconciles a ModelBox object
@@ -42,11 +53,27 @@ type ModelBoxReconciler struct {
 	client.Client
 	Log    logr.Logger
 	Scheme *runtime.Scheme
+	// APIReader 不经过缓存直接读取 API server, 用于读取凭证与拉取镜像的 Secret
+	APIReader client.Reader
+	Recorder  record.EventRecorder
 }
 
 //+kubebuilder:rbac:groups=model.github.com,resources=modelboxes,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=model.github.com,resources=modelboxes/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=model.github.com,resources=modelboxes/finalizers,verbs=update
+//+kubebuilder:rbac:groups=model.github.com,resources=modelboxtemplates;clustermodelboxtemplates,verbs=get;list;watch
+//+kubebuilder:rbac:groups=model.github.com,resources=modelboxpolicies,verbs=get;list;watch
+//+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=apps,resources=daemonsets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;create;update;delete
+//+kubebuilder:rbac:groups="",resources=serviceaccounts,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -64,7 +91,7 @@ func (r *ModelBoxReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 	log.Info("modelbox reconciling")
 
 	// 1. 首先获取 modelbox 实例
-	var modelBoxInstance modelv1.ModelBox
+	var modelBoxInstance modelv2.ModelBox
 	err := r.Get(ctx, req.NamespacedName, &modelBoxInstance)
 	if err != nil {
 		if client.IgnoreNotFound(err) != nil {
@@ -82,104 +109,278 @@ func (r *ModelBoxReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		return ctrl.Result{}, nil
 	}
 
+	// 合并引用的模板, 之后的资源都按合并后的 spec 创建. 注解中记录的也是合并后的 spec, 模板变化时会更新 Deployment
+	modelbox, err := r.applyTemplate(ctx, &modelBoxInstance)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// 工作负载类型与分布式推理、批量推理的配置冲突时不创建工作负载
+	if err := validateWorkload(modelbox); err != nil {
+		r.Recorder.Event(modelbox, corev1.EventTypeWarning, "InvalidWorkload", err.Error())
+		return ctrl.Result{}, err
+	}
+
+	// 模型地址不支持或引用的凭证 Secret 不存在时不创建或更新 Deployment, 避免 Pod 无法启动
+	if err := r.validateModels(ctx, modelbox); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Service 端口引用了不存在的容器端口时流量无法转发
+	if err := validatePorts(modelbox); err != nil {
+		r.Recorder.Event(modelbox, corev1.EventTypeWarning, "InvalidPorts", err.Error())
+		return ctrl.Result{}, err
+	}
+
+	// 镜像不在允许的仓库中时不创建 Deployment, 开启 digest 解析时 Pod 按 status 中记录的 digest 拉取镜像
+	imageRequeueAfter, err := r.resolveImages(ctx, modelbox)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// 专用的 ServiceAccount 需要在 Deployment 与预热 DaemonSet 之前创建
+	if err := r.reconcileServiceAccount(ctx, modelbox); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// 从集中管理的命名空间复制拉取镜像的 Secret
+	if err := r.reconcilePullSecrets(ctx, modelbox); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// 热更新模式下模型配置保存在 ConfigMap 中, 需要在 Deployment 之前创建
+	if err := r.reconcileModelConfig(ctx, modelbox); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// 预热 DaemonSet 按同一份模型配置在节点上提前下载模型
+	if err := r.reconcilePrefetch(ctx, modelbox); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// 只允许指定的客户端访问推理服务
+	if err := r.reconcileNetworkPolicy(ctx, modelbox); err != nil {
+		return ctrl.Result{}, err
+	}
+
 	// 2、如果不存在关联的资源，是不是应该去创建
 	// 如果存在关联的资源，是不是要判断是否需要更新
-	deploy := &appsv1.Deployment{}
-	if err := r.Get(ctx, req.NamespacedName, deploy); err != nil && errors.IsNotFound(err) {
+	// 分布式推理的 Pod 通过 headless Service 互相发现, 需要在 StatefulSet 之前创建
+	if err := r.reconcileHeadlessService(ctx, modelbox); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.Get(ctx, req.NamespacedName, emptyWorkload(modelbox)); err != nil && errors.IsNotFound(err) {
 		// 关联Annotations
-		data, err := json.Marshal(modelBoxInstance.Spec)
-		if err != nil {
-			return ctrl.Result{}, err
-		}
-		if modelBoxInstance.Annotations != nil {
-			modelBoxInstance.Annotations[oldSpecAnnotation] = string(data)
-		} else {
-			modelBoxInstance.Annotations = map[string]string{
-				oldSpecAnnotation: string(data),
-			}
-		}
-		// 重新更新modelBoxInstance
-		if err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
-			return r.Update(ctx, &modelBoxInstance)
-		}); err != nil {
+		if err := r.saveSpecAnnotation(ctx, &modelBoxInstance, modelbox.Spec); err != nil {
 			return ctrl.Result{}, err
 		}
 
-		// Deployment 不存在，创建关联的资源
-		newDeploy := NewDeploy(&modelBoxInstance)
-		if err := r.Create(ctx, newDeploy); err != nil {
-			r.Log.Error(err, "create deployment error")
+		// 工作负载不存在，创建关联的资源. 切换为分布式运行或切换回来时会删除之前的工作负载
+		if err := r.createWorkload(ctx, modelbox); err != nil {
+			r.Log.Error(err, "create workload error")
 			// 重新入队列，重试一次。
 			return ctrl.Result{}, err
 		}
 
-		// 判断Service是否存在，不存在直接创建 Service
-		newService := NewService(&modelBoxInstance)
-		if err := r.Create(ctx, newService); err != nil {
+		// 判断Service是否存在，不存在直接创建 Service. 切换工作负载类型时 Service 已存在, 按新的 spec 更新
+		// 批量推理不对外提供服务, 从在线推理切换过来时删除之前的 Service
+		if workloadType(modelbox) == modelv2.WorkloadBatchJob {
+			if err := r.deleteService(ctx, modelbox); err != nil {
+				return ctrl.Result{}, err
+			}
+		} else if err := r.Create(ctx, NewService(modelbox)); err != nil && !errors.IsAlreadyExists(err) {
 			r.Log.Error(err, "create service error")
 			// 重新入队列，重试一次。
 			return ctrl.Result{}, err
+		} else if err != nil {
+			if err := r.updateService(ctx, modelbox); err != nil {
+				return ctrl.Result{}, err
+			}
 		}
 
-		// 创建成功，直接返回
-		return ctrl.Result{}, nil
+		// 创建成功，配置了空闲超时时在到期后重新入队
+		return r.reconcileScaleToZero(ctx, modelbox)
 	}
 
-	log.Info("modelbox instance ", "image:", modelBoxInstance.Spec.Image, "name:", modelBoxInstance.Name)
+	log.Info("modelbox instance ", "image:", modelbox.Spec.Serving.Image, "name:", modelbox.Name)
 
 	// Todo: 更新逻辑, 是不是应该需要判断是否需要更新 (yaml文件是否发生了变化)
 	// 旧的配置文件可以从annotations中获取，需要在创建资源清单的时候，就把当前配置写入注解中。
 	// old Yaml --> Yaml Diff
-	oldSpec := modelv1.ModelBoxSpec{}
+	oldSpec := modelv2.ModelBoxSpec{}
 	if err := json.Unmarshal([]byte(modelBoxInstance.Annotations[oldSpecAnnotation]), &oldSpec); err != nil {
 		// 获取上一个版本配置失败，重新入队列，重试一次
 		return ctrl.Result{}, err
 	}
 
 	// 是不是就可以来和新旧的对象进行比较，如果不一致是不是就应该更新。
-	if !reflect.DeepEqual(modelBoxInstance.Spec, oldSpec) {
-		// 应该去更新关联资源
-		newDeploy := NewDeploy(&modelBoxInstance)
-		oldDeploy := &appsv1.Deployment{}
-		if err := r.Get(ctx, req.NamespacedName, oldDeploy); err != nil {
-			// 如果查询失败，再次尝试一次查询
-			return ctrl.Result{}, err
-		}
-		// 此处并非是删除oldDeploy 而是用newDeploy.Spec替换OldDeploySpec
-		// 然后直接更新oldDeploy即可。
-		oldDeploy.Spec = newDeploy.Spec
+	if !reflect.DeepEqual(modelbox.Spec, oldSpec) {
+		// 应该去更新关联资源. 已缩容到 0 的 ModelBox 更新配置时保持缩容, 避免被短暂拉起
 		// 注意，一般情况不会直接调用Update进行更新,防止资源被其他控制器锁定更新操作，使用重试机制进行更新。
-		if err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
-			return r.Update(ctx, oldDeploy)
-		}); err != nil {
+		if err := r.updateWorkload(ctx, modelbox); err != nil {
 			return ctrl.Result{}, err
 		}
 
 		// 更新: Service,
-		newService := NewService(&modelBoxInstance)
-		oldService := &corev1.Service{}
-		if err := r.Get(ctx, req.NamespacedName, oldService); err != nil {
-			// 如果查询失败，再次尝试一次查询
-			return ctrl.Result{}, err
+		if workloadType(modelbox) != modelv2.WorkloadBatchJob {
+			if err := r.updateService(ctx, modelbox); err != nil {
+				return ctrl.Result{}, err
+			}
 		}
-		// Todo: 判断Ports是否有变化, 目前暴力实现整体覆盖更新
-		newService.Spec.ClusterIP = oldService.Spec.ClusterIP
-		oldService.Spec = newService.Spec
-		if err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
-			return r.Update(ctx, oldService)
-		}); err != nil {
+
+		// 更新成功后记录新的 spec, 之后的 Pod、模板、策略事件不会再次覆盖工作负载与 Service
+		if err := r.saveSpecAnnotation(ctx, &modelBoxInstance, modelbox.Spec); err != nil {
 			return ctrl.Result{}, err
 		}
 	}
 
-	return ctrl.Result{}, nil
+	// 3. 同步工作负载状态与各模型的加载状态
+	requeueAfter, err := r.reconcileStatus(ctx, modelbox)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if imageRequeueAfter > 0 && (requeueAfter == 0 || imageRequeueAfter < requeueAfter) {
+		requeueAfter = imageRequeueAfter
+	}
+
+	// 4. 空闲缩容到 0 以及收到请求后的激活
+	result, err := r.reconcileScaleToZero(ctx, modelbox)
+	if err == nil && requeueAfter > 0 && (result.RequeueAfter == 0 || requeueAfter < result.RequeueAfter) {
+		result.RequeueAfter = requeueAfter
+	}
+	return result, err
+}
+
+// reconcileStatus 将 Deployment 或 StatefulSet 的状态与各 Pod 中模型的下载状态写入 ModelBox 的 status.
+// 热更新模式下 Pod 不会因模型变化而更新, 各 Pod 的加载结果由 sidecar 上报, 未完成时返回重新检查的间隔
+func (r *ModelBoxReconciler) reconcileStatus(ctx context.Context, modelbox *modelv2.ModelBox) (time.Duration, error) {
+	workloadStatus, batchStatus, err := r.workloadStatus(ctx, modelbox)
+	if err != nil {
+		return 0, client.IgnoreNotFound(err)
+	}
+	var pods corev1.PodList
+	if err := r.List(ctx, &pods, client.InNamespace(modelbox.Namespace), client.MatchingLabels{"modelbox": modelbox.Name}); err != nil {
+		return 0, err
+	}
+
+	var requeueAfter time.Duration
+	status := modelv2.ModelBoxStatus{DeploymentStatus: workloadStatus, ResolvedImages: modelbox.Status.ResolvedImages, Batch: batchStatus}
+	if batchFinished(modelbox.Status.Batch, batchStatus) {
+		if batchStatus.Phase == modelv2.BatchSucceeded {
+			r.Recorder.Eventf(modelbox, corev1.EventTypeNormal, "BatchSucceeded", "batch inference finished, results written to %s", batchStatus.Output)
+		} else {
+			r.Recorder.Event(modelbox, corev1.EventTypeWarning, "BatchFailed", batchStatus.Message)
+		}
+	}
+	if modelbox.Spec.HotReload != nil {
+		revision, models, reloads, done, err := newReloadStatuses(ctx, modelbox, pods.Items)
+		if err != nil {
+			return 0, err
+		}
+		status.ModelRevision = revision
+		status.Models = models
+		status.Reloads = reloads
+		if !done && len(pods.Items) > 0 {
+			requeueAfter = reloadRequeueInterval
+		}
+	} else {
+		status.Models = newModelStatuses(modelbox, pods.Items)
+	}
+	// webhook 只拒绝新的违规, 策略创建之前已存在的违规在这里报告
+	violations, err := checkPolicies(ctx, r.Client, modelbox)
+	if err != nil {
+		return 0, err
+	}
+	status.PolicyViolations = violations
+	if len(violations) > 0 && !equality.Semantic.DeepEqual(violations, modelbox.Status.PolicyViolations) {
+		r.Recorder.Event(modelbox, corev1.EventTypeWarning, "PolicyViolation", strings.Join(violations, "; "))
+	}
+	if equality.Semantic.DeepEqual(status, modelbox.Status) {
+		return requeueAfter, nil
+	}
+	// 在副本上 Patch, 返回的对象不会覆盖合并了模板的 spec
+	updated := modelbox.DeepCopy()
+	updated.Status = status
+	if err := r.Status().Patch(ctx, updated, client.MergeFrom(modelbox)); err != nil {
+		return 0, err
+	}
+	modelbox.Status = status
+	return requeueAfter, nil
+}
+
+// saveSpecAnnotation 在 ModelBox 的注解中记录合并了模板的 spec, 用于判断之后是否需要更新关联资源.
+// 使用 merge patch 只修改该注解, 不会覆盖其他客户端同时做的修改
+func (r *ModelBoxReconciler) saveSpecAnnotation(ctx context.Context, instance *modelv2.ModelBox, spec modelv2.ModelBoxSpec) error {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return err
+	}
+	if instance.Annotations[oldSpecAnnotation] == string(data) {
+		return nil
+	}
+	patch := client.MergeFrom(instance.DeepCopy())
+	if instance.Annotations == nil {
+		instance.Annotations = map[string]string{}
+	}
+	instance.Annotations[oldSpecAnnotation] = string(data)
+	return r.Patch(ctx, instance, patch)
+}
+
+// updateService 用新的 spec 覆盖 Service, 保留分配的 ClusterIP
+func (r *ModelBoxReconciler) updateService(ctx context.Context, modelbox *modelv2.ModelBox) error {
+	newService := NewService(modelbox)
+	oldService := &corev1.Service{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(modelbox), oldService); err != nil {
+		// 如果查询失败，再次尝试一次查询
+		return err
+	}
+	// Todo: 判断Ports是否有变化, 目前暴力实现整体覆盖更新
+	newService.Spec.ClusterIP = oldService.Spec.ClusterIP
+	oldService.Spec = newService.Spec
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		return r.Update(ctx, oldService)
+	})
+}
+
+// deleteService 删除 ModelBox 创建的 Service
+func (r *ModelBoxReconciler) deleteService(ctx context.Context, modelbox *modelv2.ModelBox) error {
+	service := &corev1.Service{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(modelbox), service); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !metav1.IsControlledBy(service, modelbox) {
+		return nil
+	}
+	return client.IgnoreNotFound(r.Delete(ctx, service))
+}
+
+// podToModelBox Pod 状态变化时重新计算所属 ModelBox 的模型加载状态
+func podToModelBox(obj client.Object) []reconcile.Request {
+	name, ok := obj.GetLabels()["modelbox"]
+	if !ok {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: obj.GetNamespace(), Name: name}}}
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *ModelBoxReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &modelv2.ModelBox{}, templateRefIndex, indexTemplateRef); err != nil {
+		return err
+	}
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&modelv1.ModelBox{}).
+		For(&modelv2.ModelBox{}).
 		Owns(&appsv1.Deployment{}).
+		Owns(&appsv1.StatefulSet{}).
+		Owns(&batchv1.Job{}).
 		Owns(&corev1.Service{}).
+		Owns(&corev1.ConfigMap{}).
+		Owns(&appsv1.DaemonSet{}).
+		Owns(&networkingv1.NetworkPolicy{}).
+		Owns(&corev1.ServiceAccount{}).
+		Watches(&source.Kind{Type: &corev1.Pod{}}, handler.EnqueueRequestsFromMapFunc(podToModelBox)).
+		Watches(&source.Kind{Type: &modelv2.ModelBoxTemplate{}}, handler.EnqueueRequestsFromMapFunc(r.templateToModelBoxes)).
+		Watches(&source.Kind{Type: &modelv2.ClusterModelBoxTemplate{}}, handler.EnqueueRequestsFromMapFunc(r.templateToModelBoxes)).
+		Watches(&source.Kind{Type: &modelv2.ModelBoxPolicy{}}, handler.EnqueueRequestsFromMapFunc(r.policyToModelBoxes)).
 		Complete(r)
 }
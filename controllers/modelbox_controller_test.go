@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	modelv2 "github.com/sharelinuxs/my-first-opeartor/api/v2"
+)
+
+// newTestReconciler 使用 fake client 的控制器, 返回的 FakeRecorder 记录产生的事件
+func newTestReconciler(t *testing.T, objs ...client.Object) (*ModelBoxReconciler, *record.FakeRecorder) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := modelv2.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+	recorder := record.NewFakeRecorder(100)
+	return &ModelBoxReconciler{
+		Client:    c,
+		Log:       logf.NullLogger{},
+		Scheme:    scheme,
+		APIReader: c,
+		Recorder:  recorder,
+	}, recorder
+}
+
+func int32Ptr(i int32) *int32 { return &i }
+
+func newTestModelBox() *modelv2.ModelBox {
+	return &modelv2.ModelBox{
+		ObjectMeta: metav1.ObjectMeta{Name: "resnet", Namespace: "default", UID: "resnet-uid"},
+		Spec: modelv2.ModelBoxSpec{
+			Model:    modelv2.ModelSource{URL: "https://models.example.com/resnet.tar.gz"},
+			Serving:  modelv2.ServingSpec{Image: "resnet:1"},
+			Scaling:  modelv2.ScalingSpec{Replicas: int32Ptr(1)},
+			Exposure: modelv2.ExposureSpec{Ports: []corev1.ServicePort{{Port: 80}}},
+		},
+	}
+}
+
+func reconcileModelBox(t *testing.T, r *ModelBoxReconciler, modelbox *modelv2.ModelBox) {
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: modelbox.Namespace, Name: modelbox.Name}}
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+}
+
+func TestReconcileRefreshesSpecAnnotation(t *testing.T) {
+	r, _ := newTestReconciler(t, newTestModelBox())
+	ctx := context.Background()
+	key := types.NamespacedName{Namespace: "default", Name: "resnet"}
+	reconcileModelBox(t, r, newTestModelBox())
+
+	// 修改镜像后更新 Deployment, 注解记录新的 spec
+	modelbox := &modelv2.ModelBox{}
+	if err := r.Get(ctx, key, modelbox); err != nil {
+		t.Fatal(err)
+	}
+	modelbox.Spec.Serving.Image = "resnet:2"
+	if err := r.Update(ctx, modelbox); err != nil {
+		t.Fatal(err)
+	}
+	reconcileModelBox(t, r, modelbox)
+
+	deploy := &appsv1.Deployment{}
+	if err := r.Get(ctx, key, deploy); err != nil {
+		t.Fatal(err)
+	}
+	if image := deploy.Spec.Template.Spec.Containers[0].Image; image != "resnet:2" {
+		t.Fatalf("got Deployment image %s, want resnet:2", image)
+	}
+	if err := r.Get(ctx, key, modelbox); err != nil {
+		t.Fatal(err)
+	}
+	var saved modelv2.ModelBoxSpec
+	if err := json.Unmarshal([]byte(modelbox.Annotations[oldSpecAnnotation]), &saved); err != nil {
+		t.Fatal(err)
+	}
+	if saved.Serving.Image != "resnet:2" {
+		t.Errorf("got image %s in the spec annotation, want resnet:2", saved.Serving.Image)
+	}
+
+	// spec 未变化时再次协调 (例如 Pod 事件) 不会重写 Deployment 与 Service
+	service := &corev1.Service{}
+	if err := r.Get(ctx, key, service); err != nil {
+		t.Fatal(err)
+	}
+	reconcileModelBox(t, r, modelbox)
+	current := &appsv1.Deployment{}
+	if err := r.Get(ctx, key, current); err != nil {
+		t.Fatal(err)
+	}
+	if current.ResourceVersion != deploy.ResourceVersion {
+		t.Errorf("Deployment rewritten without a spec change: resourceVersion %s -> %s", deploy.ResourceVersion, current.ResourceVersion)
+	}
+	currentService := &corev1.Service{}
+	if err := r.Get(ctx, key, currentService); err != nil {
+		t.Fatal(err)
+	}
+	if currentService.ResourceVersion != service.ResourceVersion {
+		t.Errorf("Service rewritten without a spec change: resourceVersion %s -> %s", service.ResourceVersion, currentService.ResourceVersion)
+	}
+}
@@ -0,0 +1,245 @@
+package controllers
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/sharelinuxs/my-first-opeartor/agent/modelsync"
+	modelv2 "github.com/sharelinuxs/my-first-opeartor/api/v2"
+)
+
+const (
+	// modelMountPath 模型存储卷在容器中的挂载路径
+	modelMountPath = "/app/model"
+	// modelFetcherPrefix 下载模型的 InitContainer 名称前缀, 后接模型名称
+	modelFetcherPrefix = "fetch-"
+)
+
+// effectiveModels 需要下载的模型: 配置了 models 时为 models,
+// 否则 spec.model 作为名为 model 的单个模型, 下载到 /app/model/model
+func effectiveModels(modelbox *modelv2.ModelBox) []modelv2.ModelSource {
+	if len(modelbox.Spec.Models) > 0 {
+		return modelbox.Spec.Models
+	}
+	if modelbox.Spec.Model.URL != "" {
+		model := modelbox.Spec.Model
+		model.Name = "model"
+		model.SubPath = ""
+		return []modelv2.ModelSource{model}
+	}
+	return nil
+}
+
+// modelName models 中未设置名称的模型按下标命名
+func modelName(index int, model modelv2.ModelSource) string {
+	if model.Name != "" {
+		return model.Name
+	}
+	return fmt.Sprintf("model-%d", index)
+}
+
+// modelDir 模型在容器中的目录, subPath 默认为模型名称
+func modelDir(index int, model modelv2.ModelSource) string {
+	subPath := model.SubPath
+	if subPath == "" {
+		subPath = modelName(index, model)
+	}
+	return path.Join(modelMountPath, subPath)
+}
+
+// newModelFetchers 每个模型一个 InitContainer, 通过各自的容器状态即可得到每个模型的加载状态.
+// 下载由 agent 完成, 按模型地址的 scheme 选择下载方式
+func newModelFetchers(modelbox *modelv2.ModelBox) []corev1.Container {
+	models := effectiveModels(modelbox)
+	var containers []corev1.Container
+	for i, model := range models {
+		containers = append(containers, newModelFetcher(modelbox, models, i, model, modelDir(i, model)))
+	}
+	return containers
+}
+
+// newModelFetcher 将 models 中下标为 index 的模型下载到 dir, models 决定 PVC 与凭证存储卷的名称
+func newModelFetcher(modelbox *modelv2.ModelBox, models []modelv2.ModelSource, index int, model modelv2.ModelSource, dir string) corev1.Container {
+	args := []string{
+		"--url=" + model.URL,
+		"--dir=" + dir,
+	}
+	if model.Digest != "" {
+		args = append(args, "--digest="+model.Digest)
+	}
+	if model.Endpoint != "" {
+		args = append(args, "--endpoint="+model.Endpoint)
+	}
+	args = append(args, agentCacheArgs(modelbox)...)
+	env := append([]corev1.EnvVar{}, modelbox.Spec.Serving.Env...)
+	mounts := []corev1.VolumeMount{
+		{
+			Name:      "model-volume",
+			MountPath: modelMountPath,
+		},
+	}
+	if modelbox.Spec.Prefetch != nil {
+		mounts = append(mounts, newModelCacheVolumeMount(true))
+	}
+	mounts = append(mounts, newPVCVolumeMounts(models, model)...)
+	// 凭证只挂载到当前模型的下载容器中, Secret 中的 key 同时作为环境变量, 供对象存储等客户端使用
+	var envFrom []corev1.EnvFromSource
+	if hasCredentials(model) {
+		args = append(args, "--credentials-dir="+credentialsDir(index, model))
+		mounts = append(mounts, newCredentialsVolumeMount(index, model))
+	}
+	if model.CredentialsSecretRef != nil {
+		envFrom = append(envFrom, corev1.EnvFromSource{
+			SecretRef: &corev1.SecretEnvSource{LocalObjectReference: *model.CredentialsSecretRef},
+		})
+	}
+	if model.ServiceAccountToken != nil {
+		env = append(env, corev1.EnvVar{
+			Name:  "AWS_WEB_IDENTITY_TOKEN_FILE",
+			Value: path.Join(credentialsDir(index, model), serviceAccountTokenFile),
+		})
+	}
+	return corev1.Container{
+		Name:            modelFetcherPrefix + modelName(index, model),
+		Image:           agentImage(modelbox),
+		ImagePullPolicy: modelbox.Spec.ImagePullPolicy,
+		Args:            args,
+		Resources:       newResourceTypeRequirements("small"),
+		Env:             env,
+		EnvFrom:         envFrom,
+		// 下载失败时以日志末尾作为终止信息, 展示在 status.models 中
+		TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+		VolumeMounts:             mounts,
+	}
+}
+
+// pvcClaim pvc://claim/path 形式的模型所在的 PVC
+func pvcClaim(model modelv2.ModelSource) (string, bool) {
+	u, err := url.Parse(model.URL)
+	if err != nil || u.Scheme != "pvc" || u.Host == "" {
+		return "", false
+	}
+	return u.Host, true
+}
+
+// pvcVolumeName PVC 存储卷以第一个引用它的模型命名, 多个模型引用同一个 PVC 时只挂载一次
+func pvcVolumeName(models []modelv2.ModelSource, claim string) string {
+	for i, model := range models {
+		if c, ok := pvcClaim(model); ok && c == claim {
+			return "pvc-" + modelName(i, model)
+		}
+	}
+	return ""
+}
+
+// newPVCVolumes pvc:// 模型引用的 PVC, 以只读方式挂载到下载模型的容器中
+func newPVCVolumes(models []modelv2.ModelSource) []corev1.Volume {
+	var volumes []corev1.Volume
+	seen := map[string]bool{}
+	for _, model := range models {
+		claim, ok := pvcClaim(model)
+		if !ok || seen[claim] {
+			continue
+		}
+		seen[claim] = true
+		volumes = append(volumes, corev1.Volume{
+			Name: pvcVolumeName(models, claim),
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: claim,
+					ReadOnly:  true,
+				},
+			},
+		})
+	}
+	return volumes
+}
+
+// newPVCVolumeMounts 挂载 only 中的模型引用的 PVC, only 为空时挂载所有模型引用的 PVC
+func newPVCVolumeMounts(models []modelv2.ModelSource, only ...modelv2.ModelSource) []corev1.VolumeMount {
+	if len(only) == 0 {
+		only = models
+	}
+	var mounts []corev1.VolumeMount
+	seen := map[string]bool{}
+	for _, model := range only {
+		claim, ok := pvcClaim(model)
+		if !ok || seen[claim] {
+			continue
+		}
+		seen[claim] = true
+		mounts = append(mounts, corev1.VolumeMount{
+			Name:      pvcVolumeName(models, claim),
+			MountPath: path.Join(modelsync.PVCMountPath, claim),
+			ReadOnly:  true,
+		})
+	}
+	return mounts
+}
+
+// newModelStatuses 根据各 Pod 中下载容器的状态汇总每个模型的加载状态:
+// 任一 Pod 下载失败为 Failed, 所有 Pod 都下载完成为 Loaded, 有 Pod 正在下载为 Loading, 否则为 Pending
+func newModelStatuses(modelbox *modelv2.ModelBox, pods []corev1.Pod) []modelv2.ModelStatus {
+	activePods := int32(0)
+	for i := range pods {
+		if pods[i].DeletionTimestamp == nil {
+			activePods++
+		}
+	}
+
+	var statuses []modelv2.ModelStatus
+	for i, model := range effectiveModels(modelbox) {
+		name := modelName(i, model)
+		status := modelv2.ModelStatus{Name: name, State: modelv2.ModelPending}
+		var running bool
+		var failures []string
+		for j := range pods {
+			pod := &pods[j]
+			if pod.DeletionTimestamp != nil {
+				continue
+			}
+			containerStatus := initContainerStatus(pod, modelFetcherPrefix+name)
+			if containerStatus == nil {
+				continue
+			}
+			switch {
+			case containerStatus.State.Terminated != nil && containerStatus.State.Terminated.ExitCode == 0:
+				status.LoadedReplicas++
+			case containerStatus.State.Running != nil:
+				running = true
+			case containerStatus.LastTerminationState.Terminated != nil && containerStatus.LastTerminationState.Terminated.ExitCode != 0:
+				// 下载失败后容器会重启, 失败信息保存在上一次的终止状态中
+				failures = append(failures, fmt.Sprintf("%s: %s", pod.Name,
+					strings.TrimSpace(containerStatus.LastTerminationState.Terminated.Message)))
+			case containerStatus.State.Terminated != nil:
+				failures = append(failures, fmt.Sprintf("%s: %s", pod.Name,
+					strings.TrimSpace(containerStatus.State.Terminated.Message)))
+			}
+		}
+
+		switch {
+		case len(failures) > 0:
+			status.State = modelv2.ModelFailed
+			status.Message = strings.Join(failures, "; ")
+		case activePods > 0 && status.LoadedReplicas == activePods:
+			status.State = modelv2.ModelLoaded
+		case running || status.LoadedReplicas > 0:
+			status.State = modelv2.ModelLoading
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+func initContainerStatus(pod *corev1.Pod, name string) *corev1.ContainerStatus {
+	for i := range pod.Status.InitContainerStatuses {
+		if pod.Status.InitContainerStatuses[i].Name == name {
+			return &pod.Status.InitContainerStatuses[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	modelv2 "github.com/sharelinuxs/my-first-opeartor/api/v2"
+)
+
+func TestNewInitContainers(t *testing.T) {
+	tests := []struct {
+		name     string
+		modify   func(*modelv2.ModelBox)
+		want     []string
+		wantDirs []string
+	}{
+		{
+			name:     "spec.model",
+			want:     []string{"fetch-model"},
+			wantDirs: []string{"/app/model/model"},
+		},
+		{
+			name:   "no model",
+			modify: func(m *modelv2.ModelBox) { m.Spec.Model = modelv2.ModelSource{} },
+		},
+		{
+			name: "models take precedence over spec.model",
+			modify: func(m *modelv2.ModelBox) {
+				m.Spec.Models = []modelv2.ModelSource{
+					{Name: "resnet", URL: "s3://models/resnet/"},
+					{URL: "hf://org/bert", SubPath: "nlp/bert"},
+				}
+			},
+			want:     []string{"fetch-resnet", "fetch-model-1"},
+			wantDirs: []string{"/app/model/resnet", "/app/model/nlp/bert"},
+		},
+		{
+			name:   "hot reload",
+			modify: func(m *modelv2.ModelBox) { m.Spec.HotReload = &modelv2.HotReloadSpec{} },
+			want:   []string{"model-sync"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modelbox := newTestModelBox()
+			if tt.modify != nil {
+				tt.modify(modelbox)
+			}
+			containers := newInitContainers(modelbox)
+			if got := containerNames(containers); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("got init containers %v, want %v", got, tt.want)
+			}
+			for i, dir := range tt.wantDirs {
+				if !hasArg(containers[i], "--dir="+dir) {
+					t.Errorf("%s: args %v do not contain --dir=%s", containers[i].Name, containers[i].Args, dir)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateModelsChecksSpecModel(t *testing.T) {
+	modelbox := newTestModelBox()
+	modelbox.Spec.Model.URL = "ftp://models.example.com/resnet"
+	r, recorder := newTestReconciler(t)
+	if err := r.validateModels(context.Background(), modelbox); err == nil {
+		t.Fatal("expected spec.model URL to be rejected")
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "InvalidModelURL") || !strings.Contains(event, "model model") {
+		t.Errorf("got event %q, want InvalidModelURL for model model", event)
+	}
+}
@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	modelv2 "github.com/sharelinuxs/my-first-opeartor/api/v2"
+)
+
+// namespaceNameLabel API server 为每个命名空间自动添加的名称标签
+const namespaceNameLabel = "kubernetes.io/metadata.name"
+
+var (
+	// GatewayNamespace apigateway 所在的命名空间, 由 manager 的 --gateway-namespace 参数设置, 为空时匹配所有命名空间
+	GatewayNamespace string
+	// GatewayPodLabels apigateway Pod 的标签, 由 manager 的 --gateway-pod-labels 参数设置
+	GatewayPodLabels = map[string]string{"app": "apigateway"}
+	// ControllerNamespace 控制器所在的命名空间, 由 manager 的 --controller-namespace 参数设置, 为空时匹配所有命名空间
+	ControllerNamespace string
+	// ControllerPodLabels 控制器 Pod 的标签, 与 config/manager 中的 Deployment 一致
+	ControllerPodLabels = map[string]string{"control-plane": "controller-manager"}
+)
+
+// namespacedPeer 指定命名空间中带有标签的 Pod, namespace 为空时匹配所有命名空间
+func namespacedPeer(namespace string, podLabels map[string]string) networkingv1.NetworkPolicyPeer {
+	peer := networkingv1.NetworkPolicyPeer{
+		PodSelector:       &metav1.LabelSelector{MatchLabels: podLabels},
+		NamespaceSelector: &metav1.LabelSelector{},
+	}
+	if namespace != "" {
+		peer.NamespaceSelector.MatchLabels = map[string]string{namespaceNameLabel: namespace}
+	}
+	return peer
+}
+
+// servingPorts Service 转发到的推理服务端口
+func servingPorts(modelbox *modelv2.ModelBox) []networkingv1.NetworkPolicyPort {
+	var ports []networkingv1.NetworkPolicyPort
+	for _, svcPort := range newServicePorts(modelbox) {
+		port := svcPort.TargetPort
+		if port.Type == intstr.Int && port.IntVal == 0 {
+			port = intstr.FromInt(int(svcPort.Port))
+		}
+		protocol := portProtocol(svcPort.Protocol)
+		ports = append(ports, networkingv1.NetworkPolicyPort{Protocol: &protocol, Port: &port})
+	}
+	return ports
+}
+
+// NewNetworkPolicy 入站只允许指定的客户端访问推理服务端口以及控制器访问 sidecar 的状态端口,
+// 出站只允许 DNS 与下载模型. 下载模型的 InitContainer 与热更新 sidecar 位于同一 Pod 中, 出站规则对整个 Pod 生效
+func NewNetworkPolicy(modelbox *modelv2.ModelBox) *networkingv1.NetworkPolicy {
+	access := modelbox.Spec.NetworkAccess
+
+	var clients []networkingv1.NetworkPolicyPeer
+	for _, namespace := range access.AllowedNamespaces {
+		clients = append(clients, networkingv1.NetworkPolicyPeer{
+			NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{namespaceNameLabel: namespace}},
+		})
+	}
+	for i := range access.AllowedPods {
+		clients = append(clients, networkingv1.NetworkPolicyPeer{PodSelector: access.AllowedPods[i].DeepCopy()})
+	}
+	if access.AllowGateway == nil || *access.AllowGateway {
+		clients = append(clients, namespacedPeer(GatewayNamespace, GatewayPodLabels))
+	}
+	var ingress []networkingv1.NetworkPolicyIngressRule
+	if ports := servingPorts(modelbox); len(clients) > 0 && len(ports) > 0 {
+		ingress = append(ingress, networkingv1.NetworkPolicyIngressRule{From: clients, Ports: ports})
+	}
+	if modelbox.Spec.HotReload != nil {
+		tcp := corev1.ProtocolTCP
+		statusPort := intstr.FromInt(agentStatusPort)
+		ingress = append(ingress, networkingv1.NetworkPolicyIngressRule{
+			From:  []networkingv1.NetworkPolicyPeer{namespacedPeer(ControllerNamespace, ControllerPodLabels)},
+			Ports: []networkingv1.NetworkPolicyPort{{Protocol: &tcp, Port: &statusPort}},
+		})
+	}
+
+	udp, tcp := corev1.ProtocolUDP, corev1.ProtocolTCP
+	dns := intstr.FromInt(53)
+	egress := []networkingv1.NetworkPolicyEgressRule{
+		{Ports: []networkingv1.NetworkPolicyPort{{Protocol: &udp, Port: &dns}, {Protocol: &tcp, Port: &dns}}},
+	}
+	if access.AllowModelDownload == nil || *access.AllowModelDownload {
+		download := networkingv1.NetworkPolicyEgressRule{}
+		for _, cidr := range access.ModelDownloadCIDRs {
+			download.To = append(download.To, networkingv1.NetworkPolicyPeer{IPBlock: &networkingv1.IPBlock{CIDR: cidr}})
+		}
+		egress = append(egress, download)
+	}
+	// 分布式推理组中的 Pod 之间需要互相通信, 通信端口由推理框架决定, 不限制端口
+	if isDistributed(modelbox) {
+		group := networkingv1.NetworkPolicyPeer{
+			PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"modelbox": modelbox.Name}},
+		}
+		ingress = append(ingress, networkingv1.NetworkPolicyIngressRule{From: []networkingv1.NetworkPolicyPeer{group}})
+		egress = append(egress, networkingv1.NetworkPolicyEgressRule{To: []networkingv1.NetworkPolicyPeer{group}})
+	}
+
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            modelbox.Name,
+			Namespace:       modelbox.Namespace,
+			OwnerReferences: makeOwnerReferences(modelbox),
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"modelbox": modelbox.Name}},
+			Ingress:     ingress,
+			Egress:      egress,
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress},
+		},
+	}
+}
+
+// reconcileNetworkPolicy 配置了 networkAccess 时创建或更新 NetworkPolicy, 删除配置后删除
+func (r *ModelBoxReconciler) reconcileNetworkPolicy(ctx context.Context, modelbox *modelv2.ModelBox) error {
+	current := &networkingv1.NetworkPolicy{}
+	err := r.Get(ctx, client.ObjectKeyFromObject(modelbox), current)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	exists := err == nil
+
+	if modelbox.Spec.NetworkAccess == nil {
+		if exists && metav1.IsControlledBy(current, modelbox) {
+			return client.IgnoreNotFound(r.Delete(ctx, current))
+		}
+		return nil
+	}
+
+	desired := NewNetworkPolicy(modelbox)
+	if !exists {
+		return r.Create(ctx, desired)
+	}
+	if equality.Semantic.DeepEqual(desired.Spec, current.Spec) {
+		return nil
+	}
+	current.Spec = desired.Spec
+	return r.Update(ctx, current)
+}
@@ -0,0 +1,185 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	modelv2 "github.com/sharelinuxs/my-first-opeartor/api/v2"
+)
+
+func boolPtr(b bool) *bool { return &b }
+
+func tcpPort(port intstr.IntOrString) networkingv1.NetworkPolicyPort {
+	protocol := corev1.ProtocolTCP
+	return networkingv1.NetworkPolicyPort{Protocol: &protocol, Port: &port}
+}
+
+func TestNewNetworkPolicy(t *testing.T) {
+	defer func(namespace string) { GatewayNamespace = namespace }(GatewayNamespace)
+	GatewayNamespace = "modelbox-system"
+
+	gateway := networkingv1.NetworkPolicyPeer{
+		PodSelector:       &metav1.LabelSelector{MatchLabels: map[string]string{"app": "apigateway"}},
+		NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{namespaceNameLabel: "modelbox-system"}},
+	}
+	controller := networkingv1.NetworkPolicyPeer{
+		PodSelector:       &metav1.LabelSelector{MatchLabels: map[string]string{"control-plane": "controller-manager"}},
+		NamespaceSelector: &metav1.LabelSelector{},
+	}
+	clients := networkingv1.NetworkPolicyPeer{
+		PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"role": "client"}},
+	}
+	group := networkingv1.NetworkPolicyPeer{
+		PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"modelbox": "resnet"}},
+	}
+	team := networkingv1.NetworkPolicyPeer{
+		NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{namespaceNameLabel: "team-a"}},
+	}
+	dns := networkingv1.NetworkPolicyEgressRule{Ports: func() []networkingv1.NetworkPolicyPort {
+		udp := corev1.ProtocolUDP
+		port := intstr.FromInt(53)
+		return []networkingv1.NetworkPolicyPort{{Protocol: &udp, Port: &port}, tcpPort(port)}
+	}()}
+
+	tests := []struct {
+		name        string
+		access      modelv2.NetworkAccessSpec
+		modify      func(*modelv2.ModelBox)
+		wantIngress []networkingv1.NetworkPolicyIngressRule
+		wantEgress  []networkingv1.NetworkPolicyEgressRule
+	}{
+		{
+			name: "gateway only by default",
+			wantIngress: []networkingv1.NetworkPolicyIngressRule{
+				{From: []networkingv1.NetworkPolicyPeer{gateway}, Ports: []networkingv1.NetworkPolicyPort{tcpPort(intstr.FromInt(80))}},
+			},
+			wantEgress: []networkingv1.NetworkPolicyEgressRule{dns, {}},
+		},
+		{
+			name: "allowed namespaces and pods",
+			access: modelv2.NetworkAccessSpec{
+				AllowedNamespaces: []string{"team-a"},
+				AllowedPods:       []metav1.LabelSelector{*clients.PodSelector},
+				AllowGateway:      boolPtr(false),
+			},
+			wantIngress: []networkingv1.NetworkPolicyIngressRule{
+				{From: []networkingv1.NetworkPolicyPeer{team, clients}, Ports: []networkingv1.NetworkPolicyPort{tcpPort(intstr.FromInt(80))}},
+			},
+			wantEgress: []networkingv1.NetworkPolicyEgressRule{dns, {}},
+		},
+		{
+			name:       "no clients denies all ingress",
+			access:     modelv2.NetworkAccessSpec{AllowGateway: boolPtr(false)},
+			wantEgress: []networkingv1.NetworkPolicyEgressRule{dns, {}},
+		},
+		{
+			name: "target ports of the Service",
+			modify: func(m *modelv2.ModelBox) {
+				m.Spec.Exposure.Ports = []corev1.ServicePort{{Name: "http", Port: 80, TargetPort: intstr.FromInt(8080)}}
+			},
+			wantIngress: []networkingv1.NetworkPolicyIngressRule{
+				{From: []networkingv1.NetworkPolicyPeer{gateway}, Ports: []networkingv1.NetworkPolicyPort{tcpPort(intstr.FromInt(8080))}},
+			},
+			wantEgress: []networkingv1.NetworkPolicyEgressRule{dns, {}},
+		},
+		{
+			name:   "controller reaches the hot reload sidecar",
+			access: modelv2.NetworkAccessSpec{AllowGateway: boolPtr(false)},
+			modify: func(m *modelv2.ModelBox) { m.Spec.HotReload = &modelv2.HotReloadSpec{} },
+			wantIngress: []networkingv1.NetworkPolicyIngressRule{
+				{From: []networkingv1.NetworkPolicyPeer{controller}, Ports: []networkingv1.NetworkPolicyPort{tcpPort(intstr.FromInt(agentStatusPort))}},
+			},
+			wantEgress: []networkingv1.NetworkPolicyEgressRule{dns, {}},
+		},
+		{
+			name:   "model download restricted to CIDRs",
+			access: modelv2.NetworkAccessSpec{AllowGateway: boolPtr(false), ModelDownloadCIDRs: []string{"10.1.0.0/16"}},
+			wantEgress: []networkingv1.NetworkPolicyEgressRule{dns, {
+				To: []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: "10.1.0.0/16"}}},
+			}},
+		},
+		{
+			name:   "distributed group reaches each other on any port",
+			access: modelv2.NetworkAccessSpec{AllowGateway: boolPtr(false)},
+			modify: func(m *modelv2.ModelBox) { m.Spec.Distributed = &modelv2.DistributedSpec{} },
+			wantIngress: []networkingv1.NetworkPolicyIngressRule{
+				{From: []networkingv1.NetworkPolicyPeer{group}},
+			},
+			wantEgress: []networkingv1.NetworkPolicyEgressRule{dns, {}, {To: []networkingv1.NetworkPolicyPeer{group}}},
+		},
+		{
+			name:       "model download disabled",
+			access:     modelv2.NetworkAccessSpec{AllowGateway: boolPtr(false), AllowModelDownload: boolPtr(false)},
+			wantEgress: []networkingv1.NetworkPolicyEgressRule{dns},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modelbox := newTestModelBox()
+			modelbox.Spec.NetworkAccess = tt.access.DeepCopy()
+			if tt.modify != nil {
+				tt.modify(modelbox)
+			}
+			np := NewNetworkPolicy(modelbox)
+			if np.Name != "resnet" || len(np.OwnerReferences) != 1 || np.Spec.PodSelector.MatchLabels["modelbox"] != "resnet" {
+				t.Errorf("got NetworkPolicy %s with owners %v selecting %v", np.Name, np.OwnerReferences, np.Spec.PodSelector)
+			}
+			if len(np.Spec.PolicyTypes) != 2 {
+				t.Errorf("got policy types %v, want Ingress and Egress", np.Spec.PolicyTypes)
+			}
+			if !reflect.DeepEqual(np.Spec.Ingress, tt.wantIngress) {
+				t.Errorf("got ingress %+v, want %+v", np.Spec.Ingress, tt.wantIngress)
+			}
+			if !reflect.DeepEqual(np.Spec.Egress, tt.wantEgress) {
+				t.Errorf("got egress %+v, want %+v", np.Spec.Egress, tt.wantEgress)
+			}
+		})
+	}
+}
+
+// TestReconcileNetworkPolicy 配置 networkAccess 后创建 NetworkPolicy, 修改后更新, 删除配置后删除
+func TestReconcileNetworkPolicy(t *testing.T) {
+	r, _ := newTestReconciler(t)
+	ctx := context.Background()
+	modelbox := newTestModelBox()
+	key := client.ObjectKeyFromObject(modelbox)
+
+	if err := r.reconcileNetworkPolicy(ctx, modelbox); err != nil {
+		t.Fatal(err)
+	}
+	np := &networkingv1.NetworkPolicy{}
+	if err := r.Get(ctx, key, np); !errors.IsNotFound(err) {
+		t.Fatalf("got error %v without networkAccess, want NotFound", err)
+	}
+
+	modelbox.Spec.NetworkAccess = &modelv2.NetworkAccessSpec{}
+	if err := r.reconcileNetworkPolicy(ctx, modelbox); err != nil {
+		t.Fatal(err)
+	}
+	modelbox.Spec.NetworkAccess.AllowModelDownload = boolPtr(false)
+	if err := r.reconcileNetworkPolicy(ctx, modelbox); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Get(ctx, key, np); err != nil {
+		t.Fatal(err)
+	}
+	if len(np.Spec.Egress) != 1 {
+		t.Errorf("got egress %+v after disabling model download, want DNS only", np.Spec.Egress)
+	}
+
+	modelbox.Spec.NetworkAccess = nil
+	if err := r.reconcileNetworkPolicy(ctx, modelbox); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Get(ctx, key, np); !errors.IsNotFound(err) {
+		t.Errorf("got error %v after removing networkAccess, want NotFound", err)
+	}
+}
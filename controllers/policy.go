@@ -0,0 +1,288 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	modelv2 "github.com/sharelinuxs/my-first-opeartor/api/v2"
+)
+
+// ValidatePath ModelBox validating webhook 的路径
+const ValidatePath = "/validate-model-github-com-v2-modelbox"
+
+//+kubebuilder:webhook:path=/validate-model-github-com-v2-modelbox,mutating=false,failurePolicy=fail,sideEffects=None,groups=model.github.com,resources=modelboxes,verbs=create;update,versions=v2,name=vmodelbox.kb.io,admissionReviewVersions={v1,v1beta1}
+
+// ModelBoxValidator 创建或修改 ModelBox 时检查端口、控制器允许的镜像仓库与命名空间中的 ModelBoxPolicy, 违反时拒绝.
+// v1 的请求由 API server 转换为 v2 后发送
+type ModelBoxValidator struct {
+	Client  client.Client
+	decoder *admission.Decoder
+}
+
+// InjectDecoder 由 webhook server 注入
+func (v *ModelBoxValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+// Handle 只检查 spec 的变化, 控制器与 apigateway 更新注解时不会因已存在的违规而失败
+func (v *ModelBoxValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	modelbox := &modelv2.ModelBox{}
+	if err := v.decoder.Decode(req, modelbox); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	var old *modelv2.ModelBox
+	if req.Operation == admissionv1.Update {
+		old = &modelv2.ModelBox{}
+		if err := v.decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if equality.Semantic.DeepEqual(old.Spec, modelbox.Spec) {
+			return admission.Allowed("")
+		}
+	}
+	if err := validateSpecChanges(old, modelbox); err != nil {
+		return admission.Denied(err.Error())
+	}
+
+	// 模板可能晚于 ModelBox 创建, 此时只检查 ModelBox 自身的字段并返回警告, 由控制器在模板创建后报告违规.
+	// 命名的 targetPort 可能引用模板中的容器端口, 只在合并模板后检查
+	var warnings []string
+	desired, err := resolveTemplate(ctx, v.Client, modelbox)
+	switch {
+	case errors.IsNotFound(err):
+		ref := modelbox.Spec.TemplateRef
+		warnings = append(warnings, fmt.Sprintf("%s %q not found, the ModelBox is not deployed until it exists", templateKind(ref), ref.Name))
+		desired = modelbox
+	case err != nil:
+		return admission.Errored(http.StatusInternalServerError, err)
+	default:
+		if err := validatePorts(desired); err != nil {
+			return admission.Denied(err.Error())
+		}
+	}
+	if err := validateWorkload(desired); err != nil {
+		return admission.Denied(err.Error()).WithWarnings(warnings...)
+	}
+	violations, err := checkPolicies(ctx, v.Client, desired)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	violations = append(registryViolations(desired), violations...)
+	if len(violations) > 0 {
+		return admission.Denied(strings.Join(violations, "; ")).WithWarnings(warnings...)
+	}
+	return admission.Allowed("").WithWarnings(warnings...)
+}
+
+// modelURLPattern 与 v2 schema 中 model.url 的校验一致
+var modelURLPattern = regexp.MustCompile(`^(https?|s3|gs|oci|pvc|hf)://.+$`)
+
+// validateSpecChanges 检查 v1 schema 不校验的字段. v1 保持与旧版本兼容, 已存在的对象可能带有不合法的值,
+// 只检查本次请求修改了的字段, old 为 nil 表示创建
+func validateSpecChanges(old, modelbox *modelv2.ModelBox) error {
+	spec := &modelbox.Spec
+	var oldSpec modelv2.ModelBoxSpec
+	if old != nil {
+		oldSpec = old.Spec
+	}
+	if replicas := spec.Scaling.Replicas; replicas != nil && *replicas < 0 &&
+		(oldSpec.Scaling.Replicas == nil || *oldSpec.Scaling.Replicas != *replicas) {
+		return fmt.Errorf("replicas %d must be greater than or equal to 0", *replicas)
+	}
+	if url := spec.Model.URL; url != "" && url != oldSpec.Model.URL && !modelURLPattern.MatchString(url) {
+		return fmt.Errorf("model URL %q must use one of the schemes http, https, s3, gs, oci, pvc, hf", url)
+	}
+	if serviceType := spec.Exposure.ServiceType; serviceType != oldSpec.Exposure.ServiceType {
+		switch serviceType {
+		case "", corev1.ServiceTypeClusterIP, corev1.ServiceTypeNodePort, corev1.ServiceTypeLoadBalancer:
+		default:
+			return fmt.Errorf("service type %s is not supported, supported types: ClusterIP, NodePort, LoadBalancer", serviceType)
+		}
+	}
+	if profile := spec.Serving.ResourceProfile; profile != oldSpec.Serving.ResourceProfile {
+		switch profile {
+		case "", modelv2.ResourceProfileSmall, modelv2.ResourceProfileMedium, modelv2.ResourceProfileLarge, modelv2.ResourceProfileCustom:
+		default:
+			return fmt.Errorf("resource profile %q is not supported, supported profiles: small, medium, large, custom", profile)
+		}
+	}
+	return nil
+}
+
+// checkPolicies 按命名空间中的所有策略检查合并了模板的 ModelBox, 返回违反的规则
+func checkPolicies(ctx context.Context, c client.Reader, modelbox *modelv2.ModelBox) ([]string, error) {
+	var policies modelv2.ModelBoxPolicyList
+	if err := c.List(ctx, &policies, client.InNamespace(modelbox.Namespace)); err != nil {
+		return nil, err
+	}
+	if len(policies.Items) == 0 {
+		return nil, nil
+	}
+
+	var used corev1.ResourceList
+	for _, policy := range policies.Items {
+		if len(policy.Spec.MaxTotalResources) > 0 {
+			var err error
+			if used, err = namespaceResourceUsage(ctx, c, modelbox); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	var violations []string
+	for i := range policies.Items {
+		violations = append(violations, policyViolations(&policies.Items[i], modelbox, used)...)
+	}
+	return violations, nil
+}
+
+// policyViolations 单个策略的检查结果, used 为包括该 ModelBox 在内的命名空间资源总量
+func policyViolations(policy *modelv2.ModelBoxPolicy, modelbox *modelv2.ModelBox, used corev1.ResourceList) []string {
+	var violations []string
+	spec := &policy.Spec
+	if spec.MaxReplicas != nil && desiredReplicas(modelbox) > *spec.MaxReplicas {
+		violations = append(violations, fmt.Sprintf("policy %s: replicas %d exceeds the maximum %d",
+			policy.Name, desiredReplicas(modelbox), *spec.MaxReplicas))
+	}
+	if len(spec.AllowedResourceProfiles) > 0 {
+		profile := modelbox.Spec.Serving.ResourceProfile
+		var allowed []string
+		found := false
+		for _, p := range spec.AllowedResourceProfiles {
+			allowed = append(allowed, string(p))
+			found = found || p == profile
+		}
+		if !found {
+			violations = append(violations, fmt.Sprintf("policy %s: resource profile %q is not allowed, allowed profiles: %s",
+				policy.Name, profile, strings.Join(allowed, ", ")))
+		}
+	}
+	if len(spec.AllowedImageRegistries) > 0 {
+		for _, image := range specImages(modelbox) {
+			if !imageAllowed(image, spec.AllowedImageRegistries) {
+				violations = append(violations, fmt.Sprintf("policy %s: image %q is not from an allowed registry, allowed registries: %s",
+					policy.Name, image, strings.Join(spec.AllowedImageRegistries, ", ")))
+			}
+		}
+	}
+	if len(spec.AllowedServiceTypes) > 0 {
+		serviceType := modelbox.Spec.Exposure.ServiceType
+		if serviceType == "" {
+			serviceType = corev1.ServiceTypeClusterIP
+		}
+		var allowed []string
+		found := false
+		for _, t := range spec.AllowedServiceTypes {
+			allowed = append(allowed, string(t))
+			found = found || t == serviceType
+		}
+		if !found {
+			violations = append(violations, fmt.Sprintf("policy %s: service type %s is not allowed, allowed types: %s",
+				policy.Name, serviceType, strings.Join(allowed, ", ")))
+		}
+	}
+	names := make([]string, 0, len(spec.MaxTotalResources))
+	for name := range spec.MaxTotalResources {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		limit := spec.MaxTotalResources[corev1.ResourceName(name)]
+		if total, ok := used[corev1.ResourceName(name)]; ok && total.Cmp(limit) > 0 {
+			violations = append(violations, fmt.Sprintf("policy %s: total %s %s of all ModelBoxes exceeds the maximum %s",
+				policy.Name, name, total.String(), limit.String()))
+		}
+	}
+	return violations
+}
+
+// imageAllowed 镜像的完整名称以允许的仓库为前缀, 不带仓库地址的镜像属于 docker.io
+func imageAllowed(image string, registries []string) bool {
+	name := normalizeImage(image)
+	for _, registry := range registries {
+		registry = strings.TrimSuffix(registry, "/")
+		if name == registry || strings.HasPrefix(name, registry+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// modelBoxResources 推理服务容器的 requests, 未设置时取 limits, 乘以期望副本数. 缩容到 0 的 ModelBox 随时可能被激活, 同样计入
+func modelBoxResources(modelbox *modelv2.ModelBox) corev1.ResourceList {
+	rr := newResourceRequirements(modelbox)
+	replicas := int64(desiredReplicas(modelbox))
+	usage := corev1.ResourceList{}
+	for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+		quantity, ok := rr.Requests[name]
+		if !ok {
+			quantity, ok = rr.Limits[name]
+		}
+		if !ok {
+			continue
+		}
+		total := resource.NewMilliQuantity(quantity.MilliValue()*replicas, quantity.Format)
+		usage[name] = *total
+	}
+	return usage
+}
+
+// namespaceResourceUsage 命名空间中所有 ModelBox 的资源总量, modelbox 替换同名的已有 ModelBox
+func namespaceResourceUsage(ctx context.Context, c client.Reader, modelbox *modelv2.ModelBox) (corev1.ResourceList, error) {
+	var modelboxes modelv2.ModelBoxList
+	if err := c.List(ctx, &modelboxes, client.InNamespace(modelbox.Namespace)); err != nil {
+		return nil, err
+	}
+	used := modelBoxResources(modelbox)
+	for i := range modelboxes.Items {
+		other := &modelboxes.Items[i]
+		if other.Name == modelbox.Name || other.DeletionTimestamp != nil {
+			continue
+		}
+		// 模板不存在的 ModelBox 不会被部署, 按自身的字段计算
+		desired, err := resolveTemplate(ctx, c, other)
+		if err != nil && !errors.IsNotFound(err) {
+			return nil, err
+		}
+		if err == nil {
+			other = desired
+		}
+		for name, quantity := range modelBoxResources(other) {
+			total := used[name]
+			total.Add(quantity)
+			used[name] = total
+		}
+	}
+	return used, nil
+}
+
+// policyToModelBoxes 策略变化时重新检查命名空间中的所有 ModelBox
+func (r *ModelBoxReconciler) policyToModelBoxes(obj client.Object) []reconcile.Request {
+	var modelboxes modelv2.ModelBoxList
+	if err := r.List(context.Background(), &modelboxes, client.InNamespace(obj.GetNamespace())); err != nil {
+		r.Log.Error(err, "list modelboxes of policy", "policy", obj.GetName())
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(modelboxes.Items))
+	for _, modelbox := range modelboxes.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Namespace: modelbox.Namespace, Name: modelbox.Name},
+		})
+	}
+	return requests
+}
@@ -0,0 +1,400 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	modelv2 "github.com/sharelinuxs/my-first-opeartor/api/v2"
+)
+
+func TestValidateSpecChanges(t *testing.T) {
+	valid := &modelv2.ModelBox{
+		Spec: modelv2.ModelBoxSpec{
+			Model:    modelv2.ModelSource{URL: "s3://models/resnet/"},
+			Serving:  modelv2.ServingSpec{Image: "resnet:1", ResourceProfile: modelv2.ResourceProfileSmall},
+			Scaling:  modelv2.ScalingSpec{Replicas: int32Ptr(1)},
+			Exposure: modelv2.ExposureSpec{ServiceType: corev1.ServiceTypeClusterIP},
+		},
+	}
+	// legacy 通过旧版本 v1 schema 创建, 带有现在不允许的值
+	legacy := valid.DeepCopy()
+	legacy.Spec.Model.URL = "models/resnet"
+	legacy.Spec.Serving.ResourceProfile = "gpu"
+	legacy.Spec.Exposure.ServiceType = corev1.ServiceTypeExternalName
+	legacy.Spec.Scaling.Replicas = int32Ptr(-1)
+
+	tests := []struct {
+		name    string
+		old     *modelv2.ModelBox
+		modify  func(*modelv2.ModelBox)
+		wantErr bool
+	}{
+		{name: "valid create"},
+		{name: "empty fields", modify: func(m *modelv2.ModelBox) { m.Spec = modelv2.ModelBoxSpec{} }},
+		{
+			name:    "negative replicas",
+			modify:  func(m *modelv2.ModelBox) { m.Spec.Scaling.Replicas = int32Ptr(-1) },
+			wantErr: true,
+		},
+		{
+			name:    "model URL without scheme",
+			modify:  func(m *modelv2.ModelBox) { m.Spec.Model.URL = "models/resnet" },
+			wantErr: true,
+		},
+		{
+			name:    "unsupported model URL scheme",
+			modify:  func(m *modelv2.ModelBox) { m.Spec.Model.URL = "ftp://models/resnet" },
+			wantErr: true,
+		},
+		{
+			name:    "ExternalName service",
+			modify:  func(m *modelv2.ModelBox) { m.Spec.Exposure.ServiceType = corev1.ServiceTypeExternalName },
+			wantErr: true,
+		},
+		{
+			name:    "unknown resource profile",
+			modify:  func(m *modelv2.ModelBox) { m.Spec.Serving.ResourceProfile = "gpu" },
+			wantErr: true,
+		},
+		{
+			name:   "legacy object updating another field",
+			old:    legacy,
+			modify: func(m *modelv2.ModelBox) { *m = *legacy.DeepCopy(); m.Spec.Serving.Image = "resnet:2" },
+		},
+		{
+			name: "legacy object changing to another invalid value",
+			old:  legacy,
+			modify: func(m *modelv2.ModelBox) {
+				*m = *legacy.DeepCopy()
+				m.Spec.Serving.ResourceProfile = "tpu"
+			},
+			wantErr: true,
+		},
+		{
+			name:   "legacy object fixing invalid values",
+			old:    legacy,
+			modify: func(m *modelv2.ModelBox) {},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modelbox := valid.DeepCopy()
+			if tt.modify != nil {
+				tt.modify(modelbox)
+			}
+			err := validateSpecChanges(tt.old, modelbox)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, wantErr %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// checkViolations violations 与 want 一一对应, 每条都包含 want 中的片段
+func checkViolations(t *testing.T, violations, want []string) {
+	t.Helper()
+	if len(violations) != len(want) {
+		t.Fatalf("got violations %q, want %d violations", violations, len(want))
+	}
+	for i := range want {
+		if !strings.Contains(violations[i], want[i]) {
+			t.Errorf("got violation %q, want it to contain %q", violations[i], want[i])
+		}
+	}
+}
+
+func TestPolicyViolations(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy modelv2.ModelBoxPolicySpec
+		modify func(*modelv2.ModelBox)
+		used   corev1.ResourceList
+		want   []string
+	}{
+		{name: "empty policy"},
+		{
+			name:   "replicas within the maximum",
+			policy: modelv2.ModelBoxPolicySpec{MaxReplicas: int32Ptr(2)},
+			modify: func(m *modelv2.ModelBox) { m.Spec.Scaling.Replicas = int32Ptr(2) },
+		},
+		{
+			name:   "replicas exceed the maximum",
+			policy: modelv2.ModelBoxPolicySpec{MaxReplicas: int32Ptr(2)},
+			modify: func(m *modelv2.ModelBox) { m.Spec.Scaling.Replicas = int32Ptr(3) },
+			want:   []string{"policy limits: replicas 3 exceeds the maximum 2"},
+		},
+		{
+			name:   "unset replicas count as 1",
+			policy: modelv2.ModelBoxPolicySpec{MaxReplicas: int32Ptr(0)},
+			modify: func(m *modelv2.ModelBox) { m.Spec.Scaling.Replicas = nil },
+			want:   []string{"replicas 1 exceeds the maximum 0"},
+		},
+		{
+			name:   "allowed resource profile",
+			policy: modelv2.ModelBoxPolicySpec{AllowedResourceProfiles: []modelv2.ResourceProfile{modelv2.ResourceProfileSmall, modelv2.ResourceProfileMedium}},
+			modify: func(m *modelv2.ModelBox) { m.Spec.Serving.ResourceProfile = modelv2.ResourceProfileMedium },
+		},
+		{
+			name:   "resource profile not allowed",
+			policy: modelv2.ModelBoxPolicySpec{AllowedResourceProfiles: []modelv2.ResourceProfile{modelv2.ResourceProfileSmall, modelv2.ResourceProfileMedium}},
+			modify: func(m *modelv2.ModelBox) { m.Spec.Serving.ResourceProfile = modelv2.ResourceProfileLarge },
+			want:   []string{`resource profile "large" is not allowed, allowed profiles: small, medium`},
+		},
+		{
+			name:   "unset resource profile not allowed",
+			policy: modelv2.ModelBoxPolicySpec{AllowedResourceProfiles: []modelv2.ResourceProfile{modelv2.ResourceProfileSmall}},
+			want:   []string{`resource profile "" is not allowed`},
+		},
+		{
+			name:   "image from an allowed registry",
+			policy: modelv2.ModelBoxPolicySpec{AllowedImageRegistries: []string{"registry.example.com/ml/"}},
+			modify: func(m *modelv2.ModelBox) { m.Spec.Serving.Image = "registry.example.com/ml/resnet:1" },
+		},
+		{
+			name:   "image prefix is not a registry path",
+			policy: modelv2.ModelBoxPolicySpec{AllowedImageRegistries: []string{"registry.example.com/ml"}},
+			modify: func(m *modelv2.ModelBox) { m.Spec.Serving.Image = "registry.example.com/mlops/resnet:1" },
+			want:   []string{`image "registry.example.com/mlops/resnet:1" is not from an allowed registry`},
+		},
+		{
+			name:   "image without a registry belongs to docker.io",
+			policy: modelv2.ModelBoxPolicySpec{AllowedImageRegistries: []string{"docker.io"}},
+		},
+		{
+			name:   "hot reload image is checked",
+			policy: modelv2.ModelBoxPolicySpec{AllowedImageRegistries: []string{"docker.io"}},
+			modify: func(m *modelv2.ModelBox) {
+				m.Spec.HotReload = &modelv2.HotReloadSpec{Image: "quay.io/modelbox/agent:1"}
+			},
+			want: []string{`image "quay.io/modelbox/agent:1" is not from an allowed registry, allowed registries: docker.io`},
+		},
+		{
+			name:   "unset service type counts as ClusterIP",
+			policy: modelv2.ModelBoxPolicySpec{AllowedServiceTypes: []corev1.ServiceType{corev1.ServiceTypeClusterIP}},
+		},
+		{
+			name:   "service type not allowed",
+			policy: modelv2.ModelBoxPolicySpec{AllowedServiceTypes: []corev1.ServiceType{corev1.ServiceTypeClusterIP}},
+			modify: func(m *modelv2.ModelBox) { m.Spec.Exposure.ServiceType = corev1.ServiceTypeLoadBalancer },
+			want:   []string{"service type LoadBalancer is not allowed, allowed types: ClusterIP"},
+		},
+		{
+			name: "total resources at the maximum",
+			policy: modelv2.ModelBoxPolicySpec{MaxTotalResources: corev1.ResourceList{
+				corev1.ResourceCPU: resource.MustParse("4"),
+			}},
+			used: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("4000m")},
+		},
+		{
+			name: "total resources exceed the maximum",
+			policy: modelv2.ModelBoxPolicySpec{MaxTotalResources: corev1.ResourceList{
+				corev1.ResourceMemory: resource.MustParse("8Gi"),
+				corev1.ResourceCPU:    resource.MustParse("4"),
+			}},
+			used: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("5"),
+				corev1.ResourceMemory: resource.MustParse("10Gi"),
+			},
+			want: []string{
+				"total cpu 5 of all ModelBoxes exceeds the maximum 4",
+				"total memory 10Gi of all ModelBoxes exceeds the maximum 8Gi",
+			},
+		},
+		{
+			name: "every rule reported",
+			policy: modelv2.ModelBoxPolicySpec{
+				MaxReplicas:             int32Ptr(1),
+				AllowedResourceProfiles: []modelv2.ResourceProfile{modelv2.ResourceProfileSmall},
+				AllowedServiceTypes:     []corev1.ServiceType{corev1.ServiceTypeClusterIP},
+			},
+			modify: func(m *modelv2.ModelBox) {
+				m.Spec.Scaling.Replicas = int32Ptr(2)
+				m.Spec.Exposure.ServiceType = corev1.ServiceTypeNodePort
+			},
+			want: []string{"replicas 2", "resource profile", "service type NodePort"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modelbox := newTestModelBox()
+			if tt.modify != nil {
+				tt.modify(modelbox)
+			}
+			policy := &modelv2.ModelBoxPolicy{ObjectMeta: metav1.ObjectMeta{Name: "limits", Namespace: "default"}, Spec: tt.policy}
+			checkViolations(t, policyViolations(policy, modelbox, tt.used), tt.want)
+		})
+	}
+}
+
+// TestCheckPoliciesTotalResources 资源总量包括命名空间中的其他 ModelBox, 按合并模板后的 spec 计算
+func TestCheckPoliciesTotalResources(t *testing.T) {
+	newModelBox := func(name, namespace string, profile modelv2.ResourceProfile, replicas int32) *modelv2.ModelBox {
+		return &modelv2.ModelBox{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec: modelv2.ModelBoxSpec{
+				Serving: modelv2.ServingSpec{Image: name + ":1", ResourceProfile: profile},
+				Scaling: modelv2.ScalingSpec{Replicas: int32Ptr(replicas)},
+			},
+		}
+	}
+	policy := &modelv2.ModelBoxPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "quota", Namespace: "default"},
+		Spec: modelv2.ModelBoxPolicySpec{MaxTotalResources: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("4"),
+			corev1.ResourceMemory: resource.MustParse("10Gi"),
+		}},
+	}
+	// 2 cpu, 4Gi
+	bert := newModelBox("bert", "default", modelv2.ResourceProfileSmall, 2)
+	// 模板提供 medium 规格: 2 cpu, 4Gi
+	gpt := newModelBox("gpt", "default", "", 1)
+	gpt.Spec.TemplateRef = &modelv2.TemplateReference{Name: "medium"}
+	template := &modelv2.ModelBoxTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "medium", Namespace: "default"},
+		Spec:       modelv2.ModelBoxTemplateSpec{Serving: modelv2.ServingSpec{ResourceProfile: modelv2.ResourceProfileMedium}},
+	}
+	// 模板不存在的 ModelBox 按自身的字段计算, 没有资源
+	orphan := newModelBox("orphan", "default", "", 3)
+	orphan.Spec.TemplateRef = &modelv2.TemplateReference{Name: "missing"}
+	// 正在删除的 ModelBox, 其他命名空间中的 ModelBox 与被替换的同名 ModelBox 都不计入
+	deleting := newModelBox("old", "default", modelv2.ResourceProfileLarge, 3)
+	deleting.DeletionTimestamp = &metav1.Time{Time: metav1.Now().Time}
+	deleting.Finalizers = []string{"model.github.com/finalizer"}
+	otherNamespace := newModelBox("bert", "other", modelv2.ResourceProfileLarge, 3)
+	stored := newModelBox("resnet", "default", modelv2.ResourceProfileLarge, 3)
+
+	tests := []struct {
+		name     string
+		replicas int32
+		want     []string
+	}{
+		{
+			name:     "within the maximum",
+			replicas: 0,
+		},
+		{
+			// 1 + 2 + 2 = 5 cpu, 2 + 4 + 4 = 10Gi
+			name:     "exceeds the maximum",
+			replicas: 1,
+			want:     []string{"policy quota: total cpu 5 of all ModelBoxes exceeds the maximum 4"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objs := []client.Object{policy, bert, gpt, template, orphan, deleting, otherNamespace, stored}
+			var copies []client.Object
+			for _, obj := range objs {
+				copies = append(copies, obj.DeepCopyObject().(client.Object))
+			}
+			r, _ := newTestReconciler(t, copies...)
+			modelbox := newModelBox("resnet", "default", modelv2.ResourceProfileSmall, tt.replicas)
+			violations, err := checkPolicies(context.Background(), r.Client, modelbox)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkViolations(t, violations, tt.want)
+		})
+	}
+}
+
+func TestModelBoxValidatorTemplates(t *testing.T) {
+	template := &modelv2.ModelBoxTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "serving", Namespace: "default"},
+		Spec: modelv2.ModelBoxTemplateSpec{Serving: modelv2.ServingSpec{
+			Ports: []corev1.ContainerPort{{Name: "http", ContainerPort: 8501}},
+		}},
+	}
+	namedPort := []corev1.ServicePort{{Port: 80, TargetPort: intstr.FromString("http")}}
+
+	tests := []struct {
+		name        string
+		modify      func(*modelv2.ModelBox)
+		wantAllowed bool
+		wantWarning bool
+	}{
+		{
+			name: "named port from the template",
+			modify: func(m *modelv2.ModelBox) {
+				m.Spec.TemplateRef = &modelv2.TemplateReference{Name: "serving"}
+				m.Spec.Exposure.Ports = namedPort
+			},
+			wantAllowed: true,
+		},
+		{
+			name:   "named port not found",
+			modify: func(m *modelv2.ModelBox) { m.Spec.Exposure.Ports = namedPort },
+		},
+		{
+			name: "template not found",
+			modify: func(m *modelv2.ModelBox) {
+				m.Spec.TemplateRef = &modelv2.TemplateReference{Name: "missing"}
+				m.Spec.Exposure.Ports = namedPort
+			},
+			wantAllowed: true,
+			wantWarning: true,
+		},
+		{
+			name: "template not found still validates the workload",
+			modify: func(m *modelv2.ModelBox) {
+				m.Spec.TemplateRef = &modelv2.TemplateReference{Name: "missing"}
+				m.Spec.Distributed = &modelv2.DistributedSpec{}
+				m.Spec.WorkloadType = modelv2.WorkloadDeployment
+			},
+			wantWarning: true,
+		},
+		{
+			name: "template not found still checks policies",
+			modify: func(m *modelv2.ModelBox) {
+				m.Spec.TemplateRef = &modelv2.TemplateReference{Name: "missing"}
+				m.Spec.Scaling.Replicas = int32Ptr(5)
+			},
+			wantWarning: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := &modelv2.ModelBoxPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "limits", Namespace: "default"},
+				Spec:       modelv2.ModelBoxPolicySpec{MaxReplicas: int32Ptr(4)},
+			}
+			r, _ := newTestReconciler(t, template, policy)
+			decoder, err := admission.NewDecoder(r.Scheme)
+			if err != nil {
+				t.Fatal(err)
+			}
+			validator := &ModelBoxValidator{Client: r.Client}
+			if err := validator.InjectDecoder(decoder); err != nil {
+				t.Fatal(err)
+			}
+
+			modelbox := newTestModelBox()
+			modelbox.TypeMeta = metav1.TypeMeta{APIVersion: modelv2.GroupVersion.String(), Kind: "ModelBox"}
+			tt.modify(modelbox)
+			raw, err := json.Marshal(modelbox)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp := validator.Handle(context.Background(), admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Object:    runtime.RawExtension{Raw: raw},
+			}})
+			if resp.Allowed != tt.wantAllowed {
+				t.Errorf("got allowed %t, want %t: %v", resp.Allowed, tt.wantAllowed, resp.Result)
+			}
+			if (len(resp.Warnings) > 0) != tt.wantWarning {
+				t.Errorf("got warnings %q, want warning %t", resp.Warnings, tt.wantWarning)
+			}
+		})
+	}
+}
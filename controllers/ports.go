@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	modelv2 "github.com/sharelinuxs/my-first-opeartor/api/v2"
+)
+
+// portProtocol 未设置协议时为 TCP
+func portProtocol(protocol corev1.Protocol) corev1.Protocol {
+	if protocol == "" {
+		return corev1.ProtocolTCP
+	}
+	return protocol
+}
+
+// servingContainerPorts 推理服务容器的端口. 未配置 serving.ports 时按 Service 端口中数字的 targetPort 生成,
+// 沿用 Service 端口的名称与协议, targetPort 未设置时与 port 相同
+func servingContainerPorts(modelbox *modelv2.ModelBox) []corev1.ContainerPort {
+	if len(modelbox.Spec.Serving.Ports) > 0 {
+		return modelbox.Spec.Serving.Ports
+	}
+	var ports []corev1.ContainerPort
+	seen := map[string]bool{}
+	for _, svcPort := range modelbox.Spec.Exposure.Ports {
+		if svcPort.TargetPort.Type == intstr.String {
+			continue
+		}
+		number := svcPort.TargetPort.IntVal
+		if number == 0 {
+			number = svcPort.Port
+		}
+		protocol := portProtocol(svcPort.Protocol)
+		// 多个 Service 端口转发到同一个容器端口时只声明一次
+		key := fmt.Sprintf("%d/%s", number, protocol)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		ports = append(ports, corev1.ContainerPort{Name: svcPort.Name, ContainerPort: number, Protocol: protocol})
+	}
+	return ports
+}
+
+// resolveTargetPort 将 Service 端口的 targetPort 解析为容器端口号, 找不到对应的容器端口时返回错误
+func resolveTargetPort(modelbox *modelv2.ModelBox, svcPort corev1.ServicePort) (int32, error) {
+	protocol := portProtocol(svcPort.Protocol)
+	for _, port := range servingContainerPorts(modelbox) {
+		if portProtocol(port.Protocol) != protocol {
+			continue
+		}
+		switch {
+		case svcPort.TargetPort.Type == intstr.String && port.Name == svcPort.TargetPort.StrVal:
+			return port.ContainerPort, nil
+		case svcPort.TargetPort.Type == intstr.Int && port.ContainerPort == svcPort.TargetPort.IntVal:
+			return port.ContainerPort, nil
+		case svcPort.TargetPort.Type == intstr.Int && svcPort.TargetPort.IntVal == 0 && port.ContainerPort == svcPort.Port:
+			return port.ContainerPort, nil
+		}
+	}
+	return 0, fmt.Errorf("service port %s references unknown container port %s/%s",
+		servicePortName(svcPort), svcPort.TargetPort.String(), protocol)
+}
+
+func servicePortName(svcPort corev1.ServicePort) string {
+	if svcPort.Name != "" {
+		return svcPort.Name
+	}
+	return fmt.Sprint(svcPort.Port)
+}
+
+// validatePorts Service 端口引用的容器端口都必须存在
+func validatePorts(modelbox *modelv2.ModelBox) error {
+	for _, svcPort := range modelbox.Spec.Exposure.Ports {
+		if _, err := resolveTargetPort(modelbox, svcPort); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newServicePorts Service 端口, targetPort 统一解析为容器端口号. 无法解析的端口保持原样, 由 validatePorts 提前拒绝
+func newServicePorts(modelbox *modelv2.ModelBox) []corev1.ServicePort {
+	var ports []corev1.ServicePort
+	for _, svcPort := range modelbox.Spec.Exposure.Ports {
+		if number, err := resolveTargetPort(modelbox, svcPort); err == nil {
+			svcPort.TargetPort = intstr.FromInt(int(number))
+		}
+		ports = append(ports, svcPort)
+	}
+	return ports
+}
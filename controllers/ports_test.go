@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestServingContainerPorts(t *testing.T) {
+	tests := []struct {
+		name         string
+		servingPorts []corev1.ContainerPort
+		servicePorts []corev1.ServicePort
+		want         []corev1.ContainerPort
+	}{
+		{
+			name:         "targetPort defaults to port",
+			servicePorts: []corev1.ServicePort{{Name: "http", Port: 8501}},
+			want:         []corev1.ContainerPort{{Name: "http", ContainerPort: 8501, Protocol: corev1.ProtocolTCP}},
+		},
+		{
+			name: "numeric targetPorts declared once",
+			servicePorts: []corev1.ServicePort{
+				{Name: "http", Port: 80, TargetPort: intstr.FromInt(8080)},
+				{Name: "http-alt", Port: 8080},
+				{Name: "metrics", Port: 9125, Protocol: corev1.ProtocolUDP},
+			},
+			want: []corev1.ContainerPort{
+				{Name: "http", ContainerPort: 8080, Protocol: corev1.ProtocolTCP},
+				{Name: "metrics", ContainerPort: 9125, Protocol: corev1.ProtocolUDP},
+			},
+		},
+		{
+			name:         "named targetPorts are not declared",
+			servicePorts: []corev1.ServicePort{{Name: "grpc", Port: 8500, TargetPort: intstr.FromString("grpc")}},
+		},
+		{
+			name:         "serving.ports take precedence",
+			servingPorts: []corev1.ContainerPort{{Name: "grpc", ContainerPort: 8500}},
+			servicePorts: []corev1.ServicePort{{Name: "grpc", Port: 80, TargetPort: intstr.FromString("grpc")}},
+			want:         []corev1.ContainerPort{{Name: "grpc", ContainerPort: 8500}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modelbox := newTestModelBox()
+			modelbox.Spec.Serving.Ports = tt.servingPorts
+			modelbox.Spec.Exposure.Ports = tt.servicePorts
+			if got := servingContainerPorts(modelbox); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			if got := findContainer(NewDeploy(modelbox).Spec.Template.Spec.Containers, "resnet").Ports; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got serving container ports %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewServicePorts(t *testing.T) {
+	servingPorts := []corev1.ContainerPort{
+		{Name: "http", ContainerPort: 8501},
+		{Name: "grpc", ContainerPort: 8500},
+		{Name: "metrics", ContainerPort: 9125, Protocol: corev1.ProtocolUDP},
+	}
+	tests := []struct {
+		name           string
+		servicePort    corev1.ServicePort
+		wantTargetPort intstr.IntOrString
+		wantErr        bool
+	}{
+		{
+			name:           "named targetPort resolved to the container port",
+			servicePort:    corev1.ServicePort{Name: "http", Port: 80, TargetPort: intstr.FromString("http")},
+			wantTargetPort: intstr.FromInt(8501),
+		},
+		{
+			name:           "numeric targetPort",
+			servicePort:    corev1.ServicePort{Name: "grpc", Port: 8500, TargetPort: intstr.FromInt(8500)},
+			wantTargetPort: intstr.FromInt(8500),
+		},
+		{
+			name:           "targetPort defaults to port",
+			servicePort:    corev1.ServicePort{Name: "grpc", Port: 8500},
+			wantTargetPort: intstr.FromInt(8500),
+		},
+		{
+			name:           "UDP port",
+			servicePort:    corev1.ServicePort{Name: "metrics", Port: 9125, Protocol: corev1.ProtocolUDP, TargetPort: intstr.FromString("metrics")},
+			wantTargetPort: intstr.FromInt(9125),
+		},
+		{
+			name:           "unknown name",
+			servicePort:    corev1.ServicePort{Name: "admin", Port: 81, TargetPort: intstr.FromString("admin")},
+			wantTargetPort: intstr.FromString("admin"),
+			wantErr:        true,
+		},
+		{
+			name:           "protocol mismatch",
+			servicePort:    corev1.ServicePort{Name: "metrics", Port: 9125, TargetPort: intstr.FromString("metrics")},
+			wantTargetPort: intstr.FromString("metrics"),
+			wantErr:        true,
+		},
+		{
+			name:           "undeclared port number",
+			servicePort:    corev1.ServicePort{Port: 80},
+			wantTargetPort: intstr.FromInt(0),
+			wantErr:        true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modelbox := newTestModelBox()
+			modelbox.Spec.Serving.Ports = servingPorts
+			modelbox.Spec.Exposure.Ports = []corev1.ServicePort{tt.servicePort}
+
+			if err := validatePorts(modelbox); (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, wantErr %t", err, tt.wantErr)
+			}
+			// 无法解析的端口保持原样
+			got := newServicePorts(modelbox)
+			if len(got) != 1 || got[0].TargetPort != tt.wantTargetPort {
+				t.Errorf("got service ports %+v, want targetPort %s", got, tt.wantTargetPort.String())
+			}
+			if service := NewService(modelbox); !reflect.DeepEqual(service.Spec.Ports, got) {
+				t.Errorf("got Service ports %+v, want %+v", service.Spec.Ports, got)
+			}
+		})
+	}
+}
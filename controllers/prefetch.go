@@ -0,0 +1,190 @@
+package controllers
+
+import (
+	"context"
+	"path"
+	"sort"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/sharelinuxs/my-first-opeartor/agent/modelsync"
+	modelv2 "github.com/sharelinuxs/my-first-opeartor/api/v2"
+)
+
+const (
+	// defaultPrefetchCachePath 节点上模型缓存的默认目录
+	defaultPrefetchCachePath = "/var/lib/modelbox/cache"
+	// modelCacheVolume 挂载节点本地模型缓存的存储卷
+	modelCacheVolume = "model-cache"
+	// prefetchContainer 预热 DaemonSet 中下载模型的容器
+	prefetchContainer = "prefetch"
+	// prefetchLabel 预热 Pod 的标签, 与推理服务 Pod 的 modelbox 标签区分, 避免被 Service 选中
+	prefetchLabel = "modelbox-prefetch"
+	// prefetchInterval 预热容器检查模型配置的间隔
+	prefetchInterval = "30s"
+)
+
+// prefetchName 预热 DaemonSet 的名称
+func prefetchName(modelbox *modelv2.ModelBox) string {
+	return modelbox.Name + "-prefetch"
+}
+
+// prefetchHostPath ModelBox 在节点上的缓存目录, 按命名空间与名称隔离, 各 ModelBox 的缓存互不清理, 也无法读取其他命名空间的模型
+func prefetchHostPath(modelbox *modelv2.ModelBox) string {
+	cachePath := modelbox.Spec.Prefetch.CachePath
+	if cachePath == "" {
+		cachePath = defaultPrefetchCachePath
+	}
+	return path.Join(cachePath, modelbox.Namespace, modelbox.Name)
+}
+
+// newModelCacheVolume 节点本地模型缓存, 预热 Pod 尚未运行的节点上目录为空, 下载模型的容器回退到从模型地址下载
+func newModelCacheVolume(modelbox *modelv2.ModelBox) corev1.Volume {
+	hostPathType := corev1.HostPathDirectoryOrCreate
+	return corev1.Volume{
+		Name: modelCacheVolume,
+		VolumeSource: corev1.VolumeSource{
+			HostPath: &corev1.HostPathVolumeSource{
+				Path: prefetchHostPath(modelbox),
+				Type: &hostPathType,
+			},
+		},
+	}
+}
+
+// newModelCacheVolumeMount 推理服务 Pod 中以只读方式挂载, 只有预热 Pod 可以写入
+func newModelCacheVolumeMount(readOnly bool) corev1.VolumeMount {
+	return corev1.VolumeMount{
+		Name:      modelCacheVolume,
+		MountPath: modelsync.CacheMountPath,
+		ReadOnly:  readOnly,
+	}
+}
+
+// newPrefetchAffinity 推理服务 Pod 优先调度到预热的节点, 资源不足时仍可调度到其他节点
+func newPrefetchAffinity(modelbox *modelv2.ModelBox) *corev1.Affinity {
+	if modelbox.Spec.Prefetch == nil || len(modelbox.Spec.Prefetch.NodeSelector) == 0 {
+		return nil
+	}
+	var expressions []corev1.NodeSelectorRequirement
+	for key, value := range modelbox.Spec.Prefetch.NodeSelector {
+		expressions = append(expressions, corev1.NodeSelectorRequirement{
+			Key:      key,
+			Operator: corev1.NodeSelectorOpIn,
+			Values:   []string{value},
+		})
+	}
+	// map 的遍历顺序不固定, 排序后 Pod 模板才不会在每次 Reconcile 时变化
+	sort.Slice(expressions, func(i, j int) bool { return expressions[i].Key < expressions[j].Key })
+	return &corev1.Affinity{
+		NodeAffinity: &corev1.NodeAffinity{
+			PreferredDuringSchedulingIgnoredDuringExecution: []corev1.PreferredSchedulingTerm{
+				{
+					Weight:     100,
+					Preference: corev1.NodeSelectorTerm{MatchExpressions: expressions},
+				},
+			},
+		},
+	}
+}
+
+// NewPrefetchDaemonSet 在匹配的节点上按模型配置预先下载模型到节点本地缓存. 模型配置来自 <name>-models ConfigMap,
+// 修改模型地址只会更新 ConfigMap, 预热 Pod 下载新版本后清理不再使用的旧版本
+func NewPrefetchDaemonSet(modelbox *modelv2.ModelBox) *appsv1.DaemonSet {
+	labels := map[string]string{prefetchLabel: modelbox.Name}
+	models := effectiveModels(modelbox)
+	mounts := []corev1.VolumeMount{
+		newModelCacheVolumeMount(false),
+		{
+			Name:      modelConfigVolume,
+			MountPath: modelConfigMountPath,
+			ReadOnly:  true,
+		},
+	}
+	mounts = append(mounts, newCredentialsVolumeMounts(models)...)
+	volumes := []corev1.Volume{newModelCacheVolume(modelbox), newModelConfigVolume(modelbox)}
+	volumes = append(volumes, newCredentialsVolumes(models)...)
+
+	return &appsv1.DaemonSet{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "DaemonSet",
+			APIVersion: "apps/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            prefetchName(modelbox),
+			Namespace:       modelbox.Namespace,
+			Labels:          labels,
+			OwnerReferences: makeOwnerReferences(modelbox),
+		},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					NodeSelector: modelbox.Spec.Prefetch.NodeSelector,
+					Tolerations:  modelbox.Spec.Prefetch.Tolerations,
+					// 与推理服务使用相同的身份下载模型
+					ServiceAccountName: serviceAccountName(modelbox),
+					ImagePullSecrets:   imagePullSecrets(modelbox),
+					Containers: []corev1.Container{
+						{
+							Name:            prefetchContainer,
+							Image:           agentImage(modelbox),
+							ImagePullPolicy: modelbox.Spec.ImagePullPolicy,
+							Args: []string{
+								"--config=" + path.Join(modelConfigMountPath, modelsync.ConfigFileName),
+								"--cache-dir=" + modelsync.CacheMountPath,
+								"--interval=" + prefetchInterval,
+								"--prefetch",
+							},
+							Resources:    newResourceTypeRequirements("small"),
+							Env:          modelbox.Spec.Serving.Env,
+							VolumeMounts: mounts,
+						},
+					},
+					Volumes: volumes,
+				},
+			},
+		},
+	}
+}
+
+// reconcilePrefetch 配置了 prefetch 时创建或更新预热 DaemonSet, 删除配置后删除
+func (r *ModelBoxReconciler) reconcilePrefetch(ctx context.Context, modelbox *modelv2.ModelBox) error {
+	current := &appsv1.DaemonSet{}
+	err := r.Get(ctx, client.ObjectKey{Namespace: modelbox.Namespace, Name: prefetchName(modelbox)}, current)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	exists := err == nil
+
+	if modelbox.Spec.Prefetch == nil {
+		if exists && metav1.IsControlledBy(current, modelbox) {
+			return client.IgnoreNotFound(r.Delete(ctx, current))
+		}
+		return nil
+	}
+	if len(effectiveModels(modelbox)) == 0 {
+		// 没有需要下载的模型, DaemonSet 只会清理缓存
+		r.Recorder.Event(modelbox, corev1.EventTypeWarning, "NothingToPrefetch",
+			"prefetch requires spec.model or spec.models")
+	}
+
+	desired := NewPrefetchDaemonSet(modelbox)
+	if !exists {
+		return r.Create(ctx, desired)
+	}
+	// API server 会为 Pod 模板填充默认值, 只比较我们设置的字段
+	if equality.Semantic.DeepDerivative(desired.Spec, current.Spec) {
+		return nil
+	}
+	current.Spec = desired.Spec
+	return r.Update(ctx, current)
+}
@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/sharelinuxs/my-first-opeartor/agent/modelsync"
+	modelv2 "github.com/sharelinuxs/my-first-opeartor/api/v2"
+)
+
+func TestNewPrefetchDaemonSet(t *testing.T) {
+	tolerations := []corev1.Toleration{{Key: "nvidia.com/gpu", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule}}
+	tests := []struct {
+		name         string
+		prefetch     *modelv2.PrefetchPolicy
+		wantHostPath string
+	}{
+		{
+			name:         "default cache path",
+			prefetch:     &modelv2.PrefetchPolicy{},
+			wantHostPath: "/var/lib/modelbox/cache/default/resnet",
+		},
+		{
+			name: "GPU nodes with a custom cache path",
+			prefetch: &modelv2.PrefetchPolicy{
+				NodeSelector: map[string]string{"accelerator": "a100"},
+				Tolerations:  tolerations,
+				CachePath:    "/mnt/models",
+			},
+			wantHostPath: "/mnt/models/default/resnet",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modelbox := newTestModelBox()
+			modelbox.Spec.Prefetch = tt.prefetch
+			ds := NewPrefetchDaemonSet(modelbox)
+
+			if ds.Name != "resnet-prefetch" || len(ds.OwnerReferences) != 1 {
+				t.Errorf("got DaemonSet %s with owners %v", ds.Name, ds.OwnerReferences)
+			}
+			// 预热 Pod 不能被推理服务的 Service 选中
+			labels := ds.Spec.Template.Labels
+			if _, ok := labels["modelbox"]; ok || labels[prefetchLabel] != "resnet" {
+				t.Errorf("got pod labels %v", labels)
+			}
+			podSpec := ds.Spec.Template.Spec
+			if !reflect.DeepEqual(podSpec.NodeSelector, tt.prefetch.NodeSelector) || !reflect.DeepEqual(podSpec.Tolerations, tt.prefetch.Tolerations) {
+				t.Errorf("got nodeSelector %v and tolerations %v", podSpec.NodeSelector, podSpec.Tolerations)
+			}
+			volume := newModelCacheVolume(modelbox)
+			if volume.HostPath.Path != tt.wantHostPath || !hasVolume(podSpec.Volumes, modelCacheVolume) || !hasVolume(podSpec.Volumes, modelConfigVolume) {
+				t.Errorf("got volumes %v, want the cache at %s", podSpec.Volumes, tt.wantHostPath)
+			}
+			c := findContainer(podSpec.Containers, prefetchContainer)
+			if c == nil {
+				t.Fatalf("got containers %v, want %s", containerNames(podSpec.Containers), prefetchContainer)
+			}
+			if !hasArg(*c, "--prefetch") || !hasArg(*c, "--cache-dir="+modelsync.CacheMountPath) {
+				t.Errorf("got args %v", c.Args)
+			}
+			// 只有预热 Pod 可以写入缓存
+			if m := findVolumeMount(c, modelCacheVolume); m == nil || m.ReadOnly {
+				t.Errorf("got cache mount %v, want writable", m)
+			}
+		})
+	}
+}
+
+func TestNewDeployPrefetch(t *testing.T) {
+	modelbox := newTestModelBox()
+	modelbox.Spec.Prefetch = &modelv2.PrefetchPolicy{NodeSelector: map[string]string{"zone": "a", "accelerator": "a100"}}
+	podSpec := NewDeploy(modelbox).Spec.Template.Spec
+
+	fetcher := findContainer(podSpec.InitContainers, "fetch-model")
+	if fetcher == nil {
+		t.Fatalf("got init containers %v", containerNames(podSpec.InitContainers))
+	}
+	if !hasArg(*fetcher, "--cache-dir="+modelsync.CacheMountPath) {
+		t.Errorf("got fetcher args %v", fetcher.Args)
+	}
+	if m := findVolumeMount(fetcher, modelCacheVolume); m == nil || !m.ReadOnly {
+		t.Errorf("got cache mount %v, want read-only", m)
+	}
+	if !hasVolume(podSpec.Volumes, modelCacheVolume) {
+		t.Errorf("got volumes %v, want %s", podSpec.Volumes, modelCacheVolume)
+	}
+	// 优先调度到预热的节点, 表达式按 key 排序
+	want := []corev1.NodeSelectorRequirement{
+		{Key: "accelerator", Operator: corev1.NodeSelectorOpIn, Values: []string{"a100"}},
+		{Key: "zone", Operator: corev1.NodeSelectorOpIn, Values: []string{"a"}},
+	}
+	if podSpec.Affinity == nil || podSpec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution != nil ||
+		!reflect.DeepEqual(podSpec.Affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution[0].Preference.MatchExpressions, want) {
+		t.Errorf("got affinity %+v, want preferred %v", podSpec.Affinity, want)
+	}
+
+	modelbox.Spec.Prefetch.NodeSelector = nil
+	if affinity := newPrefetchAffinity(modelbox); affinity != nil {
+		t.Errorf("got affinity %+v without a nodeSelector, want nil", affinity)
+	}
+	modelbox.Spec.Prefetch = nil
+	podSpec = NewDeploy(modelbox).Spec.Template.Spec
+	if hasVolume(podSpec.Volumes, modelCacheVolume) || hasArg(podSpec.InitContainers[0], "--cache-dir="+modelsync.CacheMountPath) {
+		t.Error("cache mounted without prefetch")
+	}
+}
+
+// TestReconcilePrefetch 配置 prefetch 后创建 DaemonSet, 修改后更新, 删除配置后删除
+func TestReconcilePrefetch(t *testing.T) {
+	r, recorder := newTestReconciler(t)
+	ctx := context.Background()
+	modelbox := newTestModelBox()
+	key := client.ObjectKey{Namespace: "default", Name: prefetchName(modelbox)}
+
+	modelbox.Spec.Prefetch = &modelv2.PrefetchPolicy{}
+	if err := r.reconcilePrefetch(ctx, modelbox); err != nil {
+		t.Fatal(err)
+	}
+	modelbox.Spec.Prefetch.NodeSelector = map[string]string{"accelerator": "a100"}
+	if err := r.reconcilePrefetch(ctx, modelbox); err != nil {
+		t.Fatal(err)
+	}
+	ds := &appsv1.DaemonSet{}
+	if err := r.Get(ctx, key, ds); err != nil {
+		t.Fatal(err)
+	}
+	if ds.Spec.Template.Spec.NodeSelector["accelerator"] != "a100" {
+		t.Errorf("got nodeSelector %v after the update", ds.Spec.Template.Spec.NodeSelector)
+	}
+
+	modelbox.Spec.Prefetch = nil
+	if err := r.reconcilePrefetch(ctx, modelbox); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Get(ctx, key, ds); !errors.IsNotFound(err) {
+		t.Errorf("got error %v after removing prefetch, want NotFound", err)
+	}
+
+	// 没有模型时仍然创建, 同时提示
+	modelbox.Spec.Model = modelv2.ModelSource{}
+	modelbox.Spec.Prefetch = &modelv2.PrefetchPolicy{}
+	if err := r.reconcilePrefetch(ctx, modelbox); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, "NothingToPrefetch") {
+			t.Errorf("got event %q, want NothingToPrefetch", event)
+		}
+	default:
+		t.Error("no NothingToPrefetch event recorded")
+	}
+}
@@ -0,0 +1,149 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	modelv2 "github.com/sharelinuxs/my-first-opeartor/api/v2"
+)
+
+// pullSecretCopyLabel 控制器复制的拉取镜像 Secret 的标签, 同一命名空间的多个 ModelBox 共用一份副本
+const pullSecretCopyLabel = "modelbox-pull-secret-copy"
+
+// PullSecretNamespace 集中管理拉取镜像 Secret 的命名空间, 由 manager 的 --pull-secret-namespace 参数设置, 为空时不允许复制
+var PullSecretNamespace string
+
+// imagePullSecrets Pod 引用的拉取镜像 Secret
+func imagePullSecrets(modelbox *modelv2.ModelBox) []corev1.LocalObjectReference {
+	var refs []corev1.LocalObjectReference
+	for _, secret := range modelbox.Spec.ImagePullSecrets {
+		refs = append(refs, corev1.LocalObjectReference{Name: secret.Name})
+	}
+	return refs
+}
+
+// pullSecretOwner 副本的 ownerReference, 不作为 controller, 所有引用它的 ModelBox 删除后由垃圾回收删除副本
+func pullSecretOwner(modelbox *modelv2.ModelBox) metav1.OwnerReference {
+	owner := makeOwnerReferences(modelbox)[0]
+	controller := false
+	owner.Controller = &controller
+	return owner
+}
+
+// removeOwner 去掉 ModelBox 的 ownerReference, 返回是否存在
+func removeOwner(obj metav1.Object, modelbox *modelv2.ModelBox) bool {
+	refs := obj.GetOwnerReferences()
+	for i, ref := range refs {
+		if ref.UID == modelbox.UID {
+			obj.SetOwnerReferences(append(refs[:i:i], refs[i+1:]...))
+			return true
+		}
+	}
+	return false
+}
+
+// reconcilePullSecrets 将设置了 copy 的拉取镜像 Secret 从集中管理的命名空间复制到 ModelBox 的命名空间, 需要在 Deployment 之前完成.
+// Secret 不经过缓存读取, 控制器不会 watch 集群中的所有 Secret, 源 Secret 的更新在下次 Reconcile 时同步
+func (r *ModelBoxReconciler) reconcilePullSecrets(ctx context.Context, modelbox *modelv2.ModelBox) error {
+	wanted := map[string]bool{}
+	for _, ref := range modelbox.Spec.ImagePullSecrets {
+		// ModelBox 位于集中管理的命名空间时直接引用源 Secret
+		if !ref.Copy || modelbox.Namespace == PullSecretNamespace {
+			continue
+		}
+		if PullSecretNamespace == "" {
+			err := fmt.Errorf("image pull secret %q can not be copied, the controller has no --pull-secret-namespace", ref.Name)
+			r.Recorder.Event(modelbox, corev1.EventTypeWarning, "PullSecretCopyDisabled", err.Error())
+			return err
+		}
+		wanted[ref.Name] = true
+		if err := r.copyPullSecret(ctx, modelbox, ref.Name); err != nil {
+			return err
+		}
+	}
+
+	// 不再引用的副本去掉该 ModelBox 的 ownerReference, 没有其他 ModelBox 引用时删除
+	var copies corev1.SecretList
+	if err := r.APIReader.List(ctx, &copies, client.InNamespace(modelbox.Namespace), client.MatchingLabels{pullSecretCopyLabel: "true"}); err != nil {
+		return err
+	}
+	for i := range copies.Items {
+		secret := &copies.Items[i]
+		if wanted[secret.Name] || !removeOwner(secret, modelbox) {
+			continue
+		}
+		var err error
+		if len(secret.OwnerReferences) == 0 {
+			err = r.Delete(ctx, secret)
+		} else {
+			err = r.Update(ctx, secret)
+		}
+		if client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyPullSecret 创建或更新副本, 命名空间中已有的同名 Secret 不是控制器复制的时不会覆盖
+func (r *ModelBoxReconciler) copyPullSecret(ctx context.Context, modelbox *modelv2.ModelBox, name string) error {
+	source := &corev1.Secret{}
+	err := r.APIReader.Get(ctx, client.ObjectKey{Namespace: PullSecretNamespace, Name: name}, source)
+	if errors.IsNotFound(err) {
+		err = fmt.Errorf("image pull secret %q not found in namespace %s", name, PullSecretNamespace)
+		r.Recorder.Event(modelbox, corev1.EventTypeWarning, "PullSecretNotFound", err.Error())
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	// 只复制拉取镜像的凭证, 避免通过 ModelBox 读取集中命名空间中的其他 Secret
+	if source.Type != corev1.SecretTypeDockerConfigJson && source.Type != corev1.SecretTypeDockercfg {
+		err := fmt.Errorf("secret %s/%s has type %s, only image pull secrets can be copied", PullSecretNamespace, name, source.Type)
+		r.Recorder.Event(modelbox, corev1.EventTypeWarning, "PullSecretInvalid", err.Error())
+		return err
+	}
+
+	current := &corev1.Secret{}
+	err = r.APIReader.Get(ctx, client.ObjectKey{Namespace: modelbox.Namespace, Name: name}, current)
+	if errors.IsNotFound(err) {
+		return r.Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            name,
+				Namespace:       modelbox.Namespace,
+				Labels:          map[string]string{pullSecretCopyLabel: "true"},
+				OwnerReferences: []metav1.OwnerReference{pullSecretOwner(modelbox)},
+			},
+			Type: source.Type,
+			Data: source.Data,
+		})
+	}
+	if err != nil {
+		return err
+	}
+	if current.Labels[pullSecretCopyLabel] != "true" {
+		err := fmt.Errorf("secret %q already exists in namespace %s and is not a copy managed by the controller", name, modelbox.Namespace)
+		r.Recorder.Event(modelbox, corev1.EventTypeWarning, "PullSecretExists", err.Error())
+		return err
+	}
+	// Secret 的类型不可修改, 源 Secret 换了类型时重新创建
+	if current.Type != source.Type {
+		if err := r.Delete(ctx, current); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		return fmt.Errorf("recreating image pull secret %q with type %s", name, source.Type)
+	}
+	owned := removeOwner(current, modelbox)
+	if owned && equality.Semantic.DeepEqual(current.Data, source.Data) {
+		return nil
+	}
+	current.OwnerReferences = append(current.OwnerReferences, pullSecretOwner(modelbox))
+	current.Data = source.Data
+	return r.Update(ctx, current)
+}
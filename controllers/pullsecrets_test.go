@@ -0,0 +1,188 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	modelv2 "github.com/sharelinuxs/my-first-opeartor/api/v2"
+)
+
+// TestNewDeployPullPolicyAndSecrets 拉取策略应用到所有容器, Pod 引用所有拉取镜像 Secret
+func TestNewDeployPullPolicyAndSecrets(t *testing.T) {
+	for _, hotReload := range []*modelv2.HotReloadSpec{nil, {}} {
+		modelbox := newTestModelBox()
+		modelbox.Spec.HotReload = hotReload
+		modelbox.Spec.ImagePullPolicy = corev1.PullAlways
+		modelbox.Spec.ImagePullSecrets = []modelv2.ImagePullSecret{{Name: "registry"}, {Name: "shared", Copy: true}}
+		podSpec := NewDeploy(modelbox).Spec.Template.Spec
+
+		containers := append(append([]corev1.Container{}, podSpec.InitContainers...), podSpec.Containers...)
+		for _, c := range containers {
+			if c.ImagePullPolicy != corev1.PullAlways {
+				t.Errorf("hot reload %t: %s got pull policy %q, want Always", hotReload != nil, c.Name, c.ImagePullPolicy)
+			}
+		}
+		want := []corev1.LocalObjectReference{{Name: "registry"}, {Name: "shared"}}
+		if !reflect.DeepEqual(podSpec.ImagePullSecrets, want) {
+			t.Errorf("got pull secrets %v, want %v", podSpec.ImagePullSecrets, want)
+		}
+	}
+
+	modelbox := newTestModelBox()
+	modelbox.Spec.Prefetch = &modelv2.PrefetchPolicy{}
+	modelbox.Spec.ImagePullPolicy = corev1.PullIfNotPresent
+	modelbox.Spec.ImagePullSecrets = []modelv2.ImagePullSecret{{Name: "registry"}}
+	podSpec := NewPrefetchDaemonSet(modelbox).Spec.Template.Spec
+	if podSpec.Containers[0].ImagePullPolicy != corev1.PullIfNotPresent || len(podSpec.ImagePullSecrets) != 1 {
+		t.Errorf("got prefetch pull policy %q and secrets %v", podSpec.Containers[0].ImagePullPolicy, podSpec.ImagePullSecrets)
+	}
+}
+
+func newPullSecret(namespace, name string, secretType corev1.SecretType, data string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Type:       secretType,
+		Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte(data)},
+	}
+}
+
+// TestReconcilePullSecrets 同一命名空间的 ModelBox 共用副本, 最后一个引用删除后删除副本
+func TestReconcilePullSecrets(t *testing.T) {
+	defer func(namespace string) { PullSecretNamespace = namespace }(PullSecretNamespace)
+	PullSecretNamespace = "registry-secrets"
+
+	source := newPullSecret("registry-secrets", "shared", corev1.SecretTypeDockerConfigJson, `{"auths":{}}`)
+	r, _ := newTestReconciler(t, source)
+	ctx := context.Background()
+	resnet := newTestModelBox()
+	resnet.Spec.ImagePullSecrets = []modelv2.ImagePullSecret{{Name: "shared", Copy: true}}
+	bert := resnet.DeepCopy()
+	bert.Name, bert.UID = "bert", "bert-uid"
+	key := client.ObjectKey{Namespace: "default", Name: "shared"}
+	owners := func() []types.UID {
+		t.Helper()
+		secret := &corev1.Secret{}
+		if err := r.Get(ctx, key, secret); err != nil {
+			t.Fatal(err)
+		}
+		var uids []types.UID
+		for _, ref := range secret.OwnerReferences {
+			if ref.Controller != nil && *ref.Controller {
+				t.Errorf("copy has a controller owner %s", ref.Name)
+			}
+			uids = append(uids, ref.UID)
+		}
+		return uids
+	}
+
+	for _, modelbox := range []*modelv2.ModelBox{resnet, bert} {
+		if err := r.reconcilePullSecrets(ctx, modelbox); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := owners(); !reflect.DeepEqual(got, []types.UID{"resnet-uid", "bert-uid"}) {
+		t.Errorf("got owners %v, want both ModelBoxes", got)
+	}
+
+	// 源 Secret 更新后同步到副本
+	source.Data[corev1.DockerConfigJsonKey] = []byte(`{"auths":{"registry.example.com":{}}}`)
+	if err := r.Update(ctx, source); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.reconcilePullSecrets(ctx, resnet); err != nil {
+		t.Fatal(err)
+	}
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, key, secret); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(secret.Data[corev1.DockerConfigJsonKey]), "registry.example.com") {
+		t.Errorf("got data %s, want the updated source", secret.Data[corev1.DockerConfigJsonKey])
+	}
+
+	resnet.Spec.ImagePullSecrets = nil
+	if err := r.reconcilePullSecrets(ctx, resnet); err != nil {
+		t.Fatal(err)
+	}
+	if got := owners(); !reflect.DeepEqual(got, []types.UID{"bert-uid"}) {
+		t.Errorf("got owners %v after resnet dropped the secret, want bert", got)
+	}
+	bert.Spec.ImagePullSecrets = nil
+	if err := r.reconcilePullSecrets(ctx, bert); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Get(ctx, key, &corev1.Secret{}); !errors.IsNotFound(err) {
+		t.Errorf("got error %v after the last reference was dropped, want NotFound", err)
+	}
+}
+
+func TestReconcilePullSecretsErrors(t *testing.T) {
+	defer func(namespace string) { PullSecretNamespace = namespace }(PullSecretNamespace)
+
+	tests := []struct {
+		name          string
+		namespace     string
+		objs          []client.Object
+		wantEvent     string
+		wantUntouched bool
+	}{
+		{
+			name:      "copy disabled",
+			wantEvent: "PullSecretCopyDisabled",
+		},
+		{
+			name:      "source not found",
+			namespace: "registry-secrets",
+			wantEvent: "PullSecretNotFound",
+		},
+		{
+			name:      "source is not an image pull secret",
+			namespace: "registry-secrets",
+			objs:      []client.Object{newPullSecret("registry-secrets", "shared", corev1.SecretTypeOpaque, "{}")},
+			wantEvent: "PullSecretInvalid",
+		},
+		{
+			name:      "existing Secret is not a copy",
+			namespace: "registry-secrets",
+			objs: []client.Object{
+				newPullSecret("registry-secrets", "shared", corev1.SecretTypeDockerConfigJson, `{"auths":{}}`),
+				newPullSecret("default", "shared", corev1.SecretTypeDockerConfigJson, `{"auths":{"mine":{}}}`),
+			},
+			wantEvent:     "PullSecretExists",
+			wantUntouched: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			PullSecretNamespace = tt.namespace
+			r, recorder := newTestReconciler(t, tt.objs...)
+			modelbox := newTestModelBox()
+			modelbox.Spec.ImagePullSecrets = []modelv2.ImagePullSecret{{Name: "shared", Copy: true}}
+
+			if err := r.reconcilePullSecrets(context.Background(), modelbox); err == nil {
+				t.Fatal("expected an error")
+			}
+			if event := <-recorder.Events; !strings.Contains(event, tt.wantEvent) {
+				t.Errorf("got event %q, want %s", event, tt.wantEvent)
+			}
+			if !tt.wantUntouched {
+				return
+			}
+			secret := &corev1.Secret{}
+			if err := r.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "shared"}, secret); err != nil {
+				t.Fatal(err)
+			}
+			if len(secret.OwnerReferences) != 0 || !strings.Contains(string(secret.Data[corev1.DockerConfigJsonKey]), "mine") {
+				t.Errorf("existing Secret modified: %+v", secret)
+			}
+		})
+	}
+}
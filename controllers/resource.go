@@ -1,6 +1,8 @@
 package controllers
 
 import (
+	"encoding/json"
+
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -8,17 +10,26 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/intstr"
 
-	modelv1 "github.com/sharelinuxs/my-first-opeartor/api/v1"
+	modelv2 "github.com/sharelinuxs/my-first-opeartor/api/v2"
 )
 
 // NewDeploy 创建 modelbox的 kubernetes Deployment
-func NewDeploy(modelbox *modelv1.ModelBox) *appsv1.Deployment {
+func NewDeploy(modelbox *modelv2.ModelBox) *appsv1.Deployment {
 	labels := map[string]string{"modelbox": modelbox.Name}
 	selector := &metav1.LabelSelector{
 		MatchLabels: labels,
 	}
-	maxUnavailable := intstr.FromString(modelbox.Spec.RollingUpdate)
-	maxSurge := intstr.FromString(modelbox.Spec.RollingUpdate)
+	// 未配置滚动更新时使用 Deployment 的默认值 25%
+	maxUnavailable := intstr.FromString("25%")
+	maxSurge := intstr.FromString("25%")
+	if ru := modelbox.Spec.Scaling.RollingUpdate; ru != nil {
+		if ru.MaxUnavailable != nil {
+			maxUnavailable = *ru.MaxUnavailable
+		}
+		if ru.MaxSurge != nil {
+			maxSurge = *ru.MaxSurge
+		}
+	}
 	return &appsv1.Deployment{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "Deployment",
@@ -39,15 +50,22 @@ func NewDeploy(modelbox *modelv1.ModelBox) *appsv1.Deployment {
 					MaxSurge:       &maxSurge,
 				},
 			},
-			Replicas: modelbox.Spec.Replicas,
+			Replicas: modelbox.Spec.Scaling.Replicas,
 			Template: corev1.PodTemplateSpec{ // Pod Template
 				ObjectMeta: metav1.ObjectMeta{
-					Labels: labels,
+					Labels:      labels,
+					Annotations: newServingAnnotations(modelbox),
 				},
 				Spec: corev1.PodSpec{
 					InitContainers: newInitContainers(modelbox),
 					Containers:     newContainers(modelbox),
 					Volumes:        newVolumes(modelbox),
+					// 配置了预热时优先调度到已缓存模型的节点
+					Affinity:           newPrefetchAffinity(modelbox),
+					ServiceAccountName: serviceAccountName(modelbox),
+					ImagePullSecrets:   imagePullSecrets(modelbox),
+					// preStop 等待请求处理完成时需要相应延长
+					TerminationGracePeriodSeconds: modelbox.Spec.Serving.TerminationGracePeriodSeconds,
 				},
 			},
 			Selector: selector,
@@ -55,7 +73,23 @@ func NewDeploy(modelbox *modelv1.ModelBox) *appsv1.Deployment {
 	}
 }
 
-func newVolumes(modelbox *modelv1.ModelBox) []corev1.Volume {
+// newServingAnnotations 在 Pod 模板上记录 ModelBox 中设置的镜像与环境变量. 合并了模板时 resolveTemplate
+// 已记录合并前的值, 容器中的镜像可能固定了 digest, 不能直接用于回滚
+func newServingAnnotations(modelbox *modelv2.ModelBox) map[string]string {
+	serving, ok := modelbox.Annotations[modelv2.ServingAnnotation]
+	if !ok {
+		serving = servingAnnotation(modelbox.Spec.Serving)
+	}
+	return map[string]string{modelv2.ServingAnnotation: serving}
+}
+
+// servingAnnotation 只保留 serving 的镜像与环境变量
+func servingAnnotation(serving modelv2.ServingSpec) string {
+	data, _ := json.Marshal(modelv2.ServingSpec{Image: serving.Image, Env: serving.Env})
+	return string(data)
+}
+
+func newVolumes(modelbox *modelv2.ModelBox) []corev1.Volume {
 	var volumes []corev1.Volume
 	// 模型下载存储空间
 	modelFileVolume := corev1.Volume{
@@ -77,11 +111,25 @@ func newVolumes(modelbox *modelv1.ModelBox) []corev1.Volume {
 	}
 	volumes = append(volumes, localFileVolume)
 
+	// pvc:// 模型引用的 PVC 与模型凭证, 只挂载到下载模型的容器中
+	volumes = append(volumes, newPVCVolumes(effectiveModels(modelbox))...)
+	volumes = append(volumes, newCredentialsVolumes(effectiveModels(modelbox))...)
+
+	// 热更新模式下挂载模型配置
+	if modelbox.Spec.HotReload != nil {
+		volumes = append(volumes, newModelConfigVolume(modelbox))
+	}
+
+	// 配置了预热时以只读方式挂载节点本地模型缓存
+	if modelbox.Spec.Prefetch != nil {
+		volumes = append(volumes, newModelCacheVolume(modelbox))
+	}
+
 	return volumes
 }
 
 // NewService 创建 modelbox 的 kubernetes Service
-func NewService(modelbox *modelv1.ModelBox) *corev1.Service {
+func NewService(modelbox *modelv2.ModelBox) *corev1.Service {
 	return &corev1.Service{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "Service",
@@ -94,9 +142,9 @@ func NewService(modelbox *modelv1.ModelBox) *corev1.Service {
 			OwnerReferences: makeOwnerReferences(modelbox),
 		},
 		Spec: corev1.ServiceSpec{
-			Ports: modelbox.Spec.Ports,
+			Ports: newServicePorts(modelbox),
 			// 此处可以定义为 Ingress
-			Type: modelbox.Spec.ServiceType,
+			Type: modelbox.Spec.Exposure.ServiceType,
 			//Type: corev1.ServiceTypeNodePort,
 			Selector: map[string]string{
 				"modelbox": modelbox.Name,
@@ -106,23 +154,17 @@ func NewService(modelbox *modelv1.ModelBox) *corev1.Service {
 }
 
 // newContainers 需要创建的容器组
-func newContainers(modelbox *modelv1.ModelBox) []corev1.Container {
+func newContainers(modelbox *modelv2.ModelBox) []corev1.Container {
 	var containers []corev1.Container
-	var containerPorts []corev1.ContainerPort
-
-	for _, svcPort := range modelbox.Spec.Ports {
-		containerPorts = append(containerPorts, corev1.ContainerPort{
-			ContainerPort: svcPort.TargetPort.IntVal,
-		})
-	}
+	containerPorts := servingContainerPorts(modelbox)
 
 	// 场景1: 单业务容器直接构造返回
 	//return []corev1.Container{
 	//	{
 	//		Name: modelbox.Name,
-	//		Image: modelbox.Spec.Image,
+	//		Image: modelbox.Spec.Serving.Image,
 	//		Resources: modelbox.Spec.Resources,
-	//		Env: modelbox.Spec.Envs,
+	//		Env: modelbox.Spec.Serving.Env,
 	//		Ports: containerPorts,
 	//	},
 	//}
@@ -130,12 +172,17 @@ func newContainers(modelbox *modelv1.ModelBox) []corev1.Container {
 	// 场景2: 业务容器需要InitContainer 或需要注入容器
 	// 添加业务 Container
 	containers = append(containers, corev1.Container{
-		Name:      modelbox.Name,
-		Image:     modelbox.Spec.Image,
-		Resources: newResourceRequirements(modelbox),
-		Env:       modelbox.Spec.Envs,
-		Ports:     containerPorts,
-		//Command: []string{"start"},
+		Name:            modelbox.Name,
+		Image:           pinnedImage(modelbox, modelbox.Spec.Serving.Image),
+		ImagePullPolicy: modelbox.Spec.ImagePullPolicy,
+		Resources:       newResourceRequirements(modelbox),
+		Env:             modelbox.Spec.Serving.Env,
+		Ports:           containerPorts,
+		Command:         modelbox.Spec.Serving.Command,
+		Args:            modelbox.Spec.Serving.Args,
+		WorkingDir:      modelbox.Spec.Serving.WorkingDir,
+		EnvFrom:         modelbox.Spec.Serving.EnvFrom,
+		Lifecycle:       modelbox.Spec.Serving.Lifecycle,
 		//ReadinessProbe: newReadinessProbe(modelbox), // 注入就绪探针，检测成功就关联svc
 		//LivenessProbe:  newLivenessProbe(modelbox),  // 注入存活探针，检测失败就重启或者终止该容器
 		VolumeMounts: []corev1.VolumeMount{
@@ -148,64 +195,58 @@ func newContainers(modelbox *modelv1.ModelBox) []corev1.Container {
 
 	// 添加一个通用容器
 	containers = append(containers, corev1.Container{
-		Name:      "db-container",
-		Image:     "busybox",
-		Command:   []string{"/bin/sh", "-c", "sleep 86400"},
-		Resources: newResourceRequirements(modelbox),
-		Env:       modelbox.Spec.Envs,
+		Name:            "db-container",
+		Image:           pinnedImage(modelbox, UtilityImage),
+		ImagePullPolicy: modelbox.Spec.ImagePullPolicy,
+		Command:         []string{"/bin/sh", "-c", "sleep 86400"},
+		Resources:       newResourceRequirements(modelbox),
+		Env:             modelbox.Spec.Serving.Env,
 	})
 
+	// 热更新模式下注入监视模型配置的 sidecar
+	if modelbox.Spec.HotReload != nil {
+		containers = append(containers, newModelReloader(modelbox))
+	}
+
 	return containers
 }
 
 // makeOwnerReferences 如果删除Modelbox，就需要自动关联删除Deployment、Service资源
-func makeOwnerReferences(modelbox *modelv1.ModelBox) []metav1.OwnerReference {
+func makeOwnerReferences(modelbox *modelv2.ModelBox) []metav1.OwnerReference {
 	return []metav1.OwnerReference{
 		// 生成一个References
 		*metav1.NewControllerRef(modelbox, schema.GroupVersionKind{
-			Group:   modelv1.GroupVersion.Group,
-			Version: modelv1.GroupVersion.Version,
-			Kind:    modelv1.Kind,
+			Group:   modelv2.GroupVersion.Group,
+			Version: modelv2.GroupVersion.Version,
+			Kind:    modelv2.Kind,
 		}),
 	}
 }
 
-func newInitContainers(modelbox *modelv1.ModelBox) []corev1.Container {
-	var containers []corev1.Container
-
-	// 注入 InitContainer
-	containers = append(containers, corev1.Container{
-		Name:  "init-container",
-		Image: "busybox",
-		Command: []string{"/bin/sh", "-c", "sleep 3 && touch /tmp/done"},
-		//Command: []string{"/root/s3client"},
-		//Resources: modelbox.Spec.Resources,
-		Resources: newResourceTypeRequirements("small"),
-		Env:       modelbox.Spec.Envs,
-		VolumeMounts: []corev1.VolumeMount{
-			{
-				Name:      "model-volume",
-				MountPath: "/app/model",
-			},
-		},
-	})
-
-	return containers
+func newInitContainers(modelbox *modelv2.ModelBox) []corev1.Container {
+	// 热更新模式下模型由 agent 按 ConfigMap 中的配置下载
+	if modelbox.Spec.HotReload != nil {
+		return []corev1.Container{newModelSyncContainer(modelbox)}
+	}
+	// 每个模型 (包括作为单个模型的 spec.model) 由单独的 InitContainer 下载, 没有模型时不需要 InitContainer
+	return newModelFetchers(modelbox)
 }
 
-func newResourceRequirements(modelbox *modelv1.ModelBox) corev1.ResourceRequirements {
+func newResourceRequirements(modelbox *modelv2.ModelBox) corev1.ResourceRequirements {
 	var rr corev1.ResourceRequirements
 
-	resourceType := modelbox.Spec.ResourceType
+	resourceType := modelbox.Spec.Serving.ResourceProfile
 	switch resourceType {
-	case "small":
-		rr = newResourceTypeRequirements(resourceType)
-	case "medium":
-		rr = newResourceTypeRequirements(resourceType)
-	case "large":
-		rr = newResourceTypeRequirements(resourceType)
-	case "custom":
-		rr = modelbox.Spec.Resources
+	case modelv2.ResourceProfileSmall:
+		rr = newResourceTypeRequirements(string(resourceType))
+	case modelv2.ResourceProfileMedium:
+		rr = newResourceTypeRequirements(string(resourceType))
+	case modelv2.ResourceProfileLarge:
+		rr = newResourceTypeRequirements(string(resourceType))
+	case modelv2.ResourceProfileCustom:
+		if modelbox.Spec.Serving.Resources != nil {
+			rr = *modelbox.Spec.Serving.Resources
+		}
 	}
 
 	return rr
@@ -240,9 +281,9 @@ func newResourceTypeRequirements(resourceType string) corev1.ResourceRequirement
 	return rr
 }
 
-func newReadinessProbe(modelbox *modelv1.ModelBox) *corev1.Probe {
-	if modelbox.Spec.ReadinessProbe != nil {
-		return modelbox.Spec.ReadinessProbe
+func newReadinessProbe(modelbox *modelv2.ModelBox) *corev1.Probe {
+	if modelbox.Spec.Serving.ReadinessProbe != nil {
+		return modelbox.Spec.Serving.ReadinessProbe
 	}
 	//readinessProbe:
 	//	initialDelaySeconds: 20
@@ -266,9 +307,9 @@ func newReadinessProbe(modelbox *modelv1.ModelBox) *corev1.Probe {
 	}
 }
 
-func newLivenessProbe(modelbox *modelv1.ModelBox) *corev1.Probe {
-	if modelbox.Spec.LivenessProbe != nil {
-		return modelbox.Spec.LivenessProbe
+func newLivenessProbe(modelbox *modelv2.ModelBox) *corev1.Probe {
+	if modelbox.Spec.Serving.LivenessProbe != nil {
+		return modelbox.Spec.Serving.LivenessProbe
 	}
 
 	//livenessProbe:
@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	modelv2 "github.com/sharelinuxs/my-first-opeartor/api/v2"
+)
+
+// TestNewDeployContainerOverrides 覆盖的启动命令、工作目录、envFrom 与生命周期钩子只作用于推理服务容器
+func TestNewDeployContainerOverrides(t *testing.T) {
+	envFrom := []corev1.EnvFromSource{{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "serving-config"}}}}
+	lifecycle := &corev1.Lifecycle{PreStop: &corev1.Handler{Exec: &corev1.ExecAction{Command: []string{"sleep", "20"}}}}
+	tests := []struct {
+		name        string
+		serving     modelv2.ServingSpec
+		wantGrace   *int64
+		wantDefault bool
+	}{
+		{
+			name:        "image defaults",
+			serving:     modelv2.ServingSpec{Image: "resnet:1"},
+			wantDefault: true,
+		},
+		{
+			name: "overrides",
+			serving: modelv2.ServingSpec{
+				Image:                         "resnet:1",
+				Command:                       []string{"tensorflow_model_server"},
+				Args:                          []string{"--port=8500", "--model_base_path=/app/model/model"},
+				WorkingDir:                    "/app",
+				EnvFrom:                       envFrom,
+				Lifecycle:                     lifecycle,
+				TerminationGracePeriodSeconds: int64Ptr(60),
+			},
+			wantGrace: int64Ptr(60),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modelbox := newTestModelBox()
+			modelbox.Spec.Serving = tt.serving
+			podSpec := NewDeploy(modelbox).Spec.Template.Spec
+
+			serving := findContainer(podSpec.Containers, "resnet")
+			if serving == nil {
+				t.Fatalf("got containers %v", containerNames(podSpec.Containers))
+			}
+			if !reflect.DeepEqual(serving.Command, tt.serving.Command) || !reflect.DeepEqual(serving.Args, tt.serving.Args) ||
+				serving.WorkingDir != tt.serving.WorkingDir || !reflect.DeepEqual(serving.EnvFrom, tt.serving.EnvFrom) ||
+				!reflect.DeepEqual(serving.Lifecycle, tt.serving.Lifecycle) {
+				t.Errorf("got serving container %+v", serving)
+			}
+			if tt.wantDefault && (serving.Command != nil || serving.Args != nil || serving.Lifecycle != nil) {
+				t.Errorf("got command %v, args %v and lifecycle %v, want the image defaults", serving.Command, serving.Args, serving.Lifecycle)
+			}
+			if !reflect.DeepEqual(podSpec.TerminationGracePeriodSeconds, tt.wantGrace) {
+				t.Errorf("got terminationGracePeriodSeconds %v, want %v", podSpec.TerminationGracePeriodSeconds, tt.wantGrace)
+			}
+
+			// 其他容器不受影响
+			for _, c := range append(append([]corev1.Container{}, podSpec.InitContainers...), podSpec.Containers...) {
+				if c.Name == "resnet" {
+					continue
+				}
+				if c.WorkingDir != "" || c.EnvFrom != nil || c.Lifecycle != nil || (len(tt.serving.Args) > 0 && reflect.DeepEqual(c.Args, tt.serving.Args)) {
+					t.Errorf("override applied to %s: %+v", c.Name, c)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	modelv2 "github.com/sharelinuxs/my-first-opeartor/api/v2"
+)
+
+// desiredReplicas 用户期望的副本数, 未设置时与 Deployment 一致默认为 1
+func desiredReplicas(modelbox *modelv2.ModelBox) int32 {
+	if modelbox.Spec.Scaling.Replicas == nil {
+		return 1
+	}
+	return *modelbox.Spec.Scaling.Replicas
+}
+
+// activeReplicas 根据空闲时间计算 Deployment 当前应有的副本数.
+// 最近一次活动时间取 last-activity 注解与创建时间中较晚的一个, 空闲超过 idleTimeout 时返回 0;
+// 未空闲时同时返回距离空闲还有多久, 用于到期后重新入队
+func activeReplicas(modelbox *modelv2.ModelBox, now time.Time) (int32, time.Duration) {
+	desired := desiredReplicas(modelbox)
+	idleTimeout := modelbox.Spec.Scaling.IdleTimeout
+	if idleTimeout == nil || idleTimeout.Duration <= 0 || desired == 0 {
+		return desired, 0
+	}
+
+	lastActive := modelbox.CreationTimestamp.Time
+	if t, err := time.Parse(time.RFC3339, modelbox.Annotations[modelv2.LastActivityAnnotation]); err == nil && t.After(lastActive) {
+		lastActive = t
+	}
+	idleAt := lastActive.Add(idleTimeout.Duration)
+	if now.Before(idleAt) {
+		return desired, idleAt.Sub(now)
+	}
+	return 0, 0
+}
+
+// reconcileScaleToZero 空闲时将 Deployment 或 StatefulSet 缩容到 0, apigateway 更新 last-activity 注解后恢复期望副本数
+func (r *ModelBoxReconciler) reconcileScaleToZero(ctx context.Context, modelbox *modelv2.ModelBox) (ctrl.Result, error) {
+	replicas, requeueAfter := activeReplicas(modelbox, time.Now())
+
+	workload := emptyWorkload(modelbox)
+	if err := r.Get(ctx, client.ObjectKeyFromObject(modelbox), workload); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	// 批量推理任务没有副本数, 不缩容
+	current := workloadReplicas(workload)
+	if current == nil {
+		return ctrl.Result{}, nil
+	}
+	if *current == nil || **current != replicas {
+		patch := client.MergeFrom(workload.DeepCopyObject().(client.Object))
+		*current = &replicas
+		if err := r.Patch(ctx, workload, patch); err != nil {
+			return ctrl.Result{}, err
+		}
+		if replicas == 0 {
+			r.Log.Info("modelbox is idle, scaled to zero", "modelbox", client.ObjectKeyFromObject(modelbox))
+		} else {
+			r.Log.Info("modelbox activated", "modelbox", client.ObjectKeyFromObject(modelbox), "replicas", replicas)
+		}
+	}
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	modelv2 "github.com/sharelinuxs/my-first-opeartor/api/v2"
+)
+
+func TestActiveReplicas(t *testing.T) {
+	created := time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name             string
+		replicas         *int32
+		idleTimeout      time.Duration
+		lastActivity     string
+		now              time.Time
+		wantReplicas     int32
+		wantRequeueAfter time.Duration
+	}{
+		{
+			name:         "no idle timeout",
+			replicas:     int32Ptr(3),
+			now:          created.Add(24 * time.Hour),
+			wantReplicas: 3,
+		},
+		{
+			name:         "replicas default to 1",
+			now:          created,
+			wantReplicas: 1,
+		},
+		{
+			name:         "scaled to 0 by the user",
+			replicas:     int32Ptr(0),
+			idleTimeout:  10 * time.Minute,
+			now:          created,
+			wantReplicas: 0,
+		},
+		{
+			name:             "idle since creation",
+			replicas:         int32Ptr(2),
+			idleTimeout:      10 * time.Minute,
+			now:              created.Add(4 * time.Minute),
+			wantReplicas:     2,
+			wantRequeueAfter: 6 * time.Minute,
+		},
+		{
+			name:         "idle timeout reached",
+			replicas:     int32Ptr(2),
+			idleTimeout:  10 * time.Minute,
+			now:          created.Add(10 * time.Minute),
+			wantReplicas: 0,
+		},
+		{
+			name:             "recent activity",
+			replicas:         int32Ptr(2),
+			idleTimeout:      10 * time.Minute,
+			lastActivity:     "2021-06-01T11:00:00Z",
+			now:              created.Add(65 * time.Minute),
+			wantReplicas:     2,
+			wantRequeueAfter: 5 * time.Minute,
+		},
+		{
+			name:         "idle after the last activity",
+			replicas:     int32Ptr(2),
+			idleTimeout:  10 * time.Minute,
+			lastActivity: "2021-06-01T11:00:00Z",
+			now:          created.Add(71 * time.Minute),
+			wantReplicas: 0,
+		},
+		{
+			name:             "activity before creation is ignored",
+			idleTimeout:      10 * time.Minute,
+			lastActivity:     "2021-06-01T09:00:00Z",
+			now:              created.Add(time.Minute),
+			wantReplicas:     1,
+			wantRequeueAfter: 9 * time.Minute,
+		},
+		{
+			name:         "malformed activity is ignored",
+			idleTimeout:  10 * time.Minute,
+			lastActivity: "yesterday",
+			now:          created.Add(11 * time.Minute),
+			wantReplicas: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modelbox := newTestModelBox()
+			modelbox.CreationTimestamp = metav1.NewTime(created)
+			modelbox.Spec.Scaling.Replicas = tt.replicas
+			if tt.idleTimeout > 0 {
+				modelbox.Spec.Scaling.IdleTimeout = &metav1.Duration{Duration: tt.idleTimeout}
+			}
+			if tt.lastActivity != "" {
+				modelbox.Annotations = map[string]string{modelv2.LastActivityAnnotation: tt.lastActivity}
+			}
+			replicas, requeueAfter := activeReplicas(modelbox, tt.now)
+			if replicas != tt.wantReplicas || requeueAfter != tt.wantRequeueAfter {
+				t.Errorf("got %d replicas and requeue after %s, want %d and %s", replicas, requeueAfter, tt.wantReplicas, tt.wantRequeueAfter)
+			}
+		})
+	}
+}
+
+// TestReconcileScaleToZero 空闲时缩容到 0, 收到请求更新 last-activity 后恢复期望副本数
+func TestReconcileScaleToZero(t *testing.T) {
+	modelbox := newTestModelBox()
+	modelbox.CreationTimestamp = metav1.NewTime(time.Now().Add(-time.Hour))
+	modelbox.Spec.Scaling.Replicas = int32Ptr(2)
+	modelbox.Spec.Scaling.IdleTimeout = &metav1.Duration{Duration: 10 * time.Minute}
+	r, _ := newTestReconciler(t, NewDeploy(modelbox))
+	ctx := context.Background()
+	deployReplicas := func() int32 {
+		t.Helper()
+		deploy := &appsv1.Deployment{}
+		if err := r.Get(ctx, client.ObjectKeyFromObject(modelbox), deploy); err != nil {
+			t.Fatal(err)
+		}
+		return *deploy.Spec.Replicas
+	}
+
+	result, err := r.reconcileScaleToZero(ctx, modelbox)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := deployReplicas(); got != 0 || result.RequeueAfter != 0 {
+		t.Errorf("got %d replicas and requeue after %s when idle, want 0", got, result.RequeueAfter)
+	}
+
+	modelbox.Annotations = map[string]string{modelv2.LastActivityAnnotation: time.Now().UTC().Format(time.RFC3339)}
+	if result, err = r.reconcileScaleToZero(ctx, modelbox); err != nil {
+		t.Fatal(err)
+	}
+	if got := deployReplicas(); got != 2 {
+		t.Errorf("got %d replicas after activity, want 2", got)
+	}
+	if result.RequeueAfter <= 9*time.Minute || result.RequeueAfter > 10*time.Minute {
+		t.Errorf("got requeue after %s, want the rest of the idle timeout", result.RequeueAfter)
+	}
+}
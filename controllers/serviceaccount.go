@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	modelv2 "github.com/sharelinuxs/my-first-opeartor/api/v2"
+)
+
+// createServiceAccount 是否由控制器创建专用的 ServiceAccount
+func createServiceAccount(modelbox *modelv2.ModelBox) bool {
+	return modelbox.Spec.ServiceAccount != nil && modelbox.Spec.ServiceAccount.Create
+}
+
+// serviceAccountName Pod 使用的 ServiceAccount, 为空时使用命名空间的 default
+func serviceAccountName(modelbox *modelv2.ModelBox) string {
+	if modelbox.Spec.ServiceAccountName != "" {
+		return modelbox.Spec.ServiceAccountName
+	}
+	if createServiceAccount(modelbox) {
+		return modelbox.Name
+	}
+	return ""
+}
+
+// NewServiceAccount 控制器创建的专用 ServiceAccount, 带有 modelbox=<name> 标签以便改名后清理
+func NewServiceAccount(modelbox *modelv2.ModelBox) *corev1.ServiceAccount {
+	return &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            serviceAccountName(modelbox),
+			Namespace:       modelbox.Namespace,
+			Labels:          map[string]string{"modelbox": modelbox.Name},
+			Annotations:     modelbox.Spec.ServiceAccount.Annotations,
+			OwnerReferences: makeOwnerReferences(modelbox),
+		},
+		ImagePullSecrets: modelbox.Spec.ServiceAccount.ImagePullSecrets,
+	}
+}
+
+// reconcileServiceAccount 设置了 serviceAccount.create 时创建或更新专用的 ServiceAccount, 需要在 Deployment 之前创建.
+// 删除配置或修改名称后删除之前创建的 ServiceAccount, 不属于该 ModelBox 的同名 ServiceAccount 不会被修改
+func (r *ModelBoxReconciler) reconcileServiceAccount(ctx context.Context, modelbox *modelv2.ModelBox) error {
+	desiredName := ""
+	if createServiceAccount(modelbox) {
+		desiredName = serviceAccountName(modelbox)
+	}
+
+	var owned corev1.ServiceAccountList
+	if err := r.List(ctx, &owned, client.InNamespace(modelbox.Namespace), client.MatchingLabels{"modelbox": modelbox.Name}); err != nil {
+		return err
+	}
+	for i := range owned.Items {
+		sa := &owned.Items[i]
+		if sa.Name != desiredName && metav1.IsControlledBy(sa, modelbox) {
+			if err := r.Delete(ctx, sa); client.IgnoreNotFound(err) != nil {
+				return err
+			}
+		}
+	}
+	if desiredName == "" {
+		return nil
+	}
+
+	desired := NewServiceAccount(modelbox)
+	current := &corev1.ServiceAccount{}
+	err := r.Get(ctx, client.ObjectKey{Namespace: modelbox.Namespace, Name: desiredName}, current)
+	if errors.IsNotFound(err) {
+		return r.Create(ctx, desired)
+	}
+	if err != nil {
+		return err
+	}
+	if !metav1.IsControlledBy(current, modelbox) {
+		err := fmt.Errorf("service account %q already exists and is not managed by this ModelBox", desiredName)
+		r.Recorder.Event(modelbox, corev1.EventTypeWarning, "ServiceAccountExists", err.Error())
+		return err
+	}
+	// token Secret 由 API server 维护, 只比较标签、注解与拉取镜像凭证
+	if equality.Semantic.DeepEqual(desired.Labels, current.Labels) &&
+		equality.Semantic.DeepEqual(desired.Annotations, current.Annotations) &&
+		equality.Semantic.DeepEqual(desired.ImagePullSecrets, current.ImagePullSecrets) {
+		return nil
+	}
+	current.Labels = desired.Labels
+	current.Annotations = desired.Annotations
+	current.ImagePullSecrets = desired.ImagePullSecrets
+	return r.Update(ctx, current)
+}
@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	modelv2 "github.com/sharelinuxs/my-first-opeartor/api/v2"
+)
+
+func TestServiceAccountName(t *testing.T) {
+	tests := []struct {
+		name           string
+		accountName    string
+		serviceAccount *modelv2.ServiceAccountSpec
+		want           string
+		wantCreate     bool
+	}{
+		{name: "namespace default"},
+		{name: "existing ServiceAccount", accountName: "inference", want: "inference"},
+		{name: "not created", accountName: "inference", serviceAccount: &modelv2.ServiceAccountSpec{}, want: "inference"},
+		{name: "created with the ModelBox name", serviceAccount: &modelv2.ServiceAccountSpec{Create: true}, want: "resnet", wantCreate: true},
+		{name: "created with a custom name", accountName: "inference", serviceAccount: &modelv2.ServiceAccountSpec{Create: true}, want: "inference", wantCreate: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modelbox := newTestModelBox()
+			modelbox.Spec.ServiceAccountName = tt.accountName
+			modelbox.Spec.ServiceAccount = tt.serviceAccount
+			if got := serviceAccountName(modelbox); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if got := createServiceAccount(modelbox); got != tt.wantCreate {
+				t.Errorf("got create %t, want %t", got, tt.wantCreate)
+			}
+			if got := NewDeploy(modelbox).Spec.Template.Spec.ServiceAccountName; got != tt.want {
+				t.Errorf("got pod serviceAccountName %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewServiceAccount(t *testing.T) {
+	modelbox := newTestModelBox()
+	modelbox.Spec.ServiceAccount = &modelv2.ServiceAccountSpec{
+		Create:           true,
+		Annotations:      map[string]string{"eks.amazonaws.com/role-arn": "arn:aws:iam::123456789012:role/models"},
+		ImagePullSecrets: []corev1.LocalObjectReference{{Name: "registry"}},
+	}
+	sa := NewServiceAccount(modelbox)
+	if sa.Name != "resnet" || sa.Namespace != "default" || sa.Labels["modelbox"] != "resnet" || len(sa.OwnerReferences) != 1 {
+		t.Errorf("got ServiceAccount %s/%s with labels %v and owners %v", sa.Namespace, sa.Name, sa.Labels, sa.OwnerReferences)
+	}
+	if !reflect.DeepEqual(sa.Annotations, modelbox.Spec.ServiceAccount.Annotations) || !reflect.DeepEqual(sa.ImagePullSecrets, modelbox.Spec.ServiceAccount.ImagePullSecrets) {
+		t.Errorf("got annotations %v and pull secrets %v", sa.Annotations, sa.ImagePullSecrets)
+	}
+}
+
+// TestReconcileServiceAccount 创建、更新、改名后清理以及不接管已有的同名 ServiceAccount
+func TestReconcileServiceAccount(t *testing.T) {
+	unmanaged := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "shared", Namespace: "default"}}
+	r, recorder := newTestReconciler(t, unmanaged)
+	ctx := context.Background()
+	modelbox := newTestModelBox()
+	get := func(name string) (*corev1.ServiceAccount, error) {
+		sa := &corev1.ServiceAccount{}
+		return sa, r.Get(ctx, client.ObjectKey{Namespace: "default", Name: name}, sa)
+	}
+
+	modelbox.Spec.ServiceAccount = &modelv2.ServiceAccountSpec{Create: true}
+	if err := r.reconcileServiceAccount(ctx, modelbox); err != nil {
+		t.Fatal(err)
+	}
+	modelbox.Spec.ServiceAccount.Annotations = map[string]string{"iam.gke.io/gcp-service-account": "models@example.iam.gserviceaccount.com"}
+	if err := r.reconcileServiceAccount(ctx, modelbox); err != nil {
+		t.Fatal(err)
+	}
+	sa, err := get("resnet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sa.Annotations["iam.gke.io/gcp-service-account"] == "" {
+		t.Errorf("got annotations %v after the update", sa.Annotations)
+	}
+
+	// 改名后删除之前创建的 ServiceAccount
+	modelbox.Spec.ServiceAccountName = "inference"
+	if err := r.reconcileServiceAccount(ctx, modelbox); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := get("inference"); err != nil {
+		t.Errorf("renamed ServiceAccount not created: %v", err)
+	}
+	if _, err := get("resnet"); !errors.IsNotFound(err) {
+		t.Errorf("got error %v for the old ServiceAccount, want NotFound", err)
+	}
+
+	// 同名的 ServiceAccount 不属于该 ModelBox 时报错, 不修改它
+	modelbox.Spec.ServiceAccountName = "shared"
+	if err := r.reconcileServiceAccount(ctx, modelbox); err == nil {
+		t.Fatal("took over an unmanaged ServiceAccount")
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "ServiceAccountExists") {
+		t.Errorf("got event %q, want ServiceAccountExists", event)
+	}
+	if sa, err := get("shared"); err != nil || len(sa.OwnerReferences) != 0 || len(sa.Annotations) != 0 {
+		t.Errorf("unmanaged ServiceAccount modified: %+v, %v", sa, err)
+	}
+
+	// 删除配置后清理, 不删除不属于该 ModelBox 的 ServiceAccount
+	modelbox.Spec.ServiceAccount = nil
+	if err := r.reconcileServiceAccount(ctx, modelbox); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := get("inference"); !errors.IsNotFound(err) {
+		t.Errorf("got error %v after removing serviceAccount, want NotFound", err)
+	}
+	if _, err := get("shared"); err != nil {
+		t.Errorf("unmanaged ServiceAccount deleted: %v", err)
+	}
+}
@@ -0,0 +1,192 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	modelv2 "github.com/sharelinuxs/my-first-opeartor/api/v2"
+)
+
+// templateRefIndex ModelBox 按引用的模板建立的索引, 取值为 <kind>/<name>, 模板变化时据此找到所有引用它的 ModelBox
+const templateRefIndex = "spec.templateRef"
+
+// templateKind 模板引用的类型, 默认为同一命名空间的 ModelBoxTemplate
+func templateKind(ref *modelv2.TemplateReference) string {
+	if ref.Kind == "" {
+		return modelv2.TemplateKind
+	}
+	return ref.Kind
+}
+
+// indexTemplateRef 提取 ModelBox 引用的模板作为索引
+func indexTemplateRef(obj client.Object) []string {
+	modelbox, ok := obj.(*modelv2.ModelBox)
+	if !ok || modelbox.Spec.TemplateRef == nil {
+		return nil
+	}
+	return []string{templateKind(modelbox.Spec.TemplateRef) + "/" + modelbox.Spec.TemplateRef.Name}
+}
+
+// applyTemplate 返回合并了模板的 ModelBox 副本, 之后的资源都按合并后的 spec 创建, 不会修改用户的 ModelBox.
+// 模板不存在或合并后缺少镜像时记录事件并返回错误
+func (r *ModelBoxReconciler) applyTemplate(ctx context.Context, modelbox *modelv2.ModelBox) (*modelv2.ModelBox, error) {
+	desired, err := resolveTemplate(ctx, r.Client, modelbox)
+	if errors.IsNotFound(err) {
+		ref := modelbox.Spec.TemplateRef
+		err = fmt.Errorf("%s %q not found", templateKind(ref), ref.Name)
+		r.Recorder.Event(modelbox, corev1.EventTypeWarning, "TemplateNotFound", err.Error())
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	if desired.Spec.Serving.Image == "" {
+		err := fmt.Errorf("spec.serving.image is required, set it in the ModelBox or its template")
+		r.Recorder.Event(modelbox, corev1.EventTypeWarning, "MissingImage", err.Error())
+		return nil, err
+	}
+	return desired, nil
+}
+
+// resolveTemplate 读取 ModelBox 引用的模板并合并, 没有引用模板时返回 ModelBox 的副本
+func resolveTemplate(ctx context.Context, c client.Reader, modelbox *modelv2.ModelBox) (*modelv2.ModelBox, error) {
+	desired := modelbox.DeepCopy()
+	ref := modelbox.Spec.TemplateRef
+	if ref == nil {
+		return desired, nil
+	}
+	var template modelv2.ModelBoxTemplateSpec
+	switch templateKind(ref) {
+	case modelv2.ClusterTemplateKind:
+		cluster := &modelv2.ClusterModelBoxTemplate{}
+		if err := c.Get(ctx, client.ObjectKey{Name: ref.Name}, cluster); err != nil {
+			return nil, err
+		}
+		template = cluster.Spec
+	default:
+		namespaced := &modelv2.ModelBoxTemplate{}
+		if err := c.Get(ctx, client.ObjectKey{Namespace: modelbox.Namespace, Name: ref.Name}, namespaced); err != nil {
+			return nil, err
+		}
+		template = namespaced.Spec
+	}
+	var err error
+	if desired.Spec, err = mergeTemplate(&template, modelbox.Spec); err != nil {
+		return nil, err
+	}
+	// rollout undo 恢复的是 ModelBox 自己的镜像与环境变量, 模板提供的值仍由模板提供
+	if desired.Annotations == nil {
+		desired.Annotations = map[string]string{}
+	}
+	desired.Annotations[modelv2.ServingAnnotation] = servingAnnotation(modelbox.Spec.Serving)
+	return desired, nil
+}
+
+// mergeTemplate 以模板为默认值合并 ModelBox 的 spec: spec 中设置了的字段优先, 对象逐字段合并,
+// 列表整体替换, 环境变量按名称合并. 空字符串、空列表与 null 视为未设置
+func mergeTemplate(template *modelv2.ModelBoxTemplateSpec, spec modelv2.ModelBoxSpec) (modelv2.ModelBoxSpec, error) {
+	var base, override map[string]interface{}
+	if err := roundTrip(template, &base); err != nil {
+		return spec, err
+	}
+	if err := roundTrip(spec, &override); err != nil {
+		return spec, err
+	}
+	var merged modelv2.ModelBoxSpec
+	if err := roundTrip(mergeValues(base, override), &merged); err != nil {
+		return spec, err
+	}
+	merged.Serving.Env = mergeEnv(template.Serving.Env, spec.Serving.Env)
+	return merged, nil
+}
+
+func roundTrip(in, out interface{}) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+func mergeValues(base, override interface{}) interface{} {
+	baseMap, baseIsMap := base.(map[string]interface{})
+	overrideMap, overrideIsMap := override.(map[string]interface{})
+	if baseIsMap && overrideIsMap {
+		for key, value := range overrideMap {
+			if !isEmptyValue(value) {
+				baseMap[key] = mergeValues(baseMap[key], value)
+			}
+		}
+		return baseMap
+	}
+	if isEmptyValue(override) {
+		return base
+	}
+	return override
+}
+
+func isEmptyValue(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+// mergeEnv 模板中的环境变量在前, ModelBox 中同名的环境变量覆盖模板中的取值
+func mergeEnv(base, override []corev1.EnvVar) []corev1.EnvVar {
+	if len(base) == 0 {
+		return override
+	}
+	index := map[string]int{}
+	merged := append([]corev1.EnvVar{}, base...)
+	for i, env := range merged {
+		index[env.Name] = i
+	}
+	for _, env := range override {
+		if i, ok := index[env.Name]; ok {
+			merged[i] = env
+			continue
+		}
+		merged = append(merged, env)
+	}
+	return merged
+}
+
+// templateToModelBoxes 模板变化时重新同步所有引用它的 ModelBox, 集群级别的模板对应所有命名空间中的 ModelBox
+func (r *ModelBoxReconciler) templateToModelBoxes(obj client.Object) []reconcile.Request {
+	kind := modelv2.TemplateKind
+	var opts []client.ListOption
+	if _, ok := obj.(*modelv2.ClusterModelBoxTemplate); ok {
+		kind = modelv2.ClusterTemplateKind
+	} else {
+		opts = append(opts, client.InNamespace(obj.GetNamespace()))
+	}
+	opts = append(opts, client.MatchingFields{templateRefIndex: kind + "/" + obj.GetName()})
+
+	var modelboxes modelv2.ModelBoxList
+	if err := r.List(context.Background(), &modelboxes, opts...); err != nil {
+		r.Log.Error(err, "list modelboxes of template", "kind", kind, "name", obj.GetName())
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(modelboxes.Items))
+	for _, modelbox := range modelboxes.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Namespace: modelbox.Namespace, Name: modelbox.Name},
+		})
+	}
+	return requests
+}
@@ -0,0 +1,279 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/diff"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	modelv2 "github.com/sharelinuxs/my-first-opeartor/api/v2"
+)
+
+func TestMergeTemplate(t *testing.T) {
+	template := modelv2.ModelBoxTemplateSpec{
+		Serving: modelv2.ServingSpec{
+			Image:           "registry.example.com/serving:1",
+			ResourceProfile: modelv2.ResourceProfileMedium,
+			Env:             []corev1.EnvVar{{Name: "WORKERS", Value: "2"}, {Name: "LOG_LEVEL", Value: "info"}},
+			Args:            []string{"--port=8500", "--rest-port=8501"},
+			ReadinessProbe: &corev1.Probe{
+				Handler:       corev1.Handler{HTTPGet: &corev1.HTTPGetAction{Path: "/ready", Port: intstr.FromInt(8501)}},
+				PeriodSeconds: 10,
+			},
+		},
+		Scaling:  modelv2.ScalingSpec{Replicas: int32Ptr(2)},
+		Exposure: modelv2.ExposureSpec{ServiceType: corev1.ServiceTypeNodePort, Ports: []corev1.ServicePort{{Name: "grpc", Port: 8500}, {Name: "http", Port: 8501}}},
+	}
+
+	tests := []struct {
+		name   string
+		spec   modelv2.ModelBoxSpec
+		modify func(want *modelv2.ModelBoxSpec)
+	}{
+		{
+			name: "template fills unset fields",
+			spec: modelv2.ModelBoxSpec{Model: modelv2.ModelSource{URL: "s3://models/resnet/"}},
+			modify: func(want *modelv2.ModelBoxSpec) {
+				want.Model = modelv2.ModelSource{URL: "s3://models/resnet/"}
+			},
+		},
+		{
+			name: "ModelBox fields override the template",
+			spec: modelv2.ModelBoxSpec{
+				Serving:  modelv2.ServingSpec{Image: "resnet:1", ResourceProfile: modelv2.ResourceProfileSmall},
+				Exposure: modelv2.ExposureSpec{ServiceType: corev1.ServiceTypeClusterIP},
+			},
+			modify: func(want *modelv2.ModelBoxSpec) {
+				want.Serving.Image = "resnet:1"
+				want.Serving.ResourceProfile = modelv2.ResourceProfileSmall
+				want.Exposure.ServiceType = corev1.ServiceTypeClusterIP
+			},
+		},
+		{
+			name: "zero replicas override the template",
+			spec: modelv2.ModelBoxSpec{Scaling: modelv2.ScalingSpec{Replicas: int32Ptr(0)}},
+			modify: func(want *modelv2.ModelBoxSpec) {
+				want.Scaling.Replicas = int32Ptr(0)
+			},
+		},
+		{
+			name: "lists replace the template",
+			spec: modelv2.ModelBoxSpec{
+				Serving:  modelv2.ServingSpec{Args: []string{"--port=9000"}},
+				Exposure: modelv2.ExposureSpec{Ports: []corev1.ServicePort{{Port: 80}}},
+			},
+			modify: func(want *modelv2.ModelBoxSpec) {
+				want.Serving.Args = []string{"--port=9000"}
+				want.Exposure.Ports = []corev1.ServicePort{{Port: 80}}
+			},
+		},
+		{
+			name: "empty lists and strings are unset",
+			spec: modelv2.ModelBoxSpec{
+				Serving:  modelv2.ServingSpec{Image: "", Args: []string{}},
+				Exposure: modelv2.ExposureSpec{Ports: []corev1.ServicePort{}},
+			},
+		},
+		{
+			name: "env merges by name",
+			spec: modelv2.ModelBoxSpec{
+				Serving: modelv2.ServingSpec{Env: []corev1.EnvVar{{Name: "LOG_LEVEL", Value: "debug"}, {Name: "MODEL_NAME", Value: "resnet"}}},
+			},
+			modify: func(want *modelv2.ModelBoxSpec) {
+				want.Serving.Env = []corev1.EnvVar{
+					{Name: "WORKERS", Value: "2"},
+					{Name: "LOG_LEVEL", Value: "debug"},
+					{Name: "MODEL_NAME", Value: "resnet"},
+				}
+			},
+		},
+		{
+			name: "objects merge field by field",
+			spec: modelv2.ModelBoxSpec{
+				Serving: modelv2.ServingSpec{ReadinessProbe: &corev1.Probe{TimeoutSeconds: 5}},
+			},
+			modify: func(want *modelv2.ModelBoxSpec) {
+				want.Serving.ReadinessProbe.TimeoutSeconds = 5
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := modelv2.ModelBoxSpec{
+				Serving:  *template.Serving.DeepCopy(),
+				Scaling:  *template.Scaling.DeepCopy(),
+				Exposure: *template.Exposure.DeepCopy(),
+			}
+			if tt.modify != nil {
+				tt.modify(&want)
+			}
+			got, err := mergeTemplate(template.DeepCopy(), tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equality.Semantic.DeepEqual(got, want) {
+				t.Errorf("merged spec mismatch:\n%s", diff.ObjectReflectDiff(want, got))
+			}
+		})
+	}
+}
+
+// TestResolveTemplate ModelBox 只引用一个模板, 同名的 ModelBoxTemplate 与 ClusterModelBoxTemplate 按 kind 区分,
+// 默认使用同一命名空间中的 ModelBoxTemplate
+func TestResolveTemplate(t *testing.T) {
+	namespaced := &modelv2.ModelBoxTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "gpu", Namespace: "default"},
+		Spec: modelv2.ModelBoxTemplateSpec{
+			Serving:  modelv2.ServingSpec{Image: "namespaced:1"},
+			Exposure: modelv2.ExposureSpec{ServiceType: corev1.ServiceTypeNodePort},
+		},
+	}
+	otherNamespace := &modelv2.ModelBoxTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "cpu", Namespace: "other"},
+		Spec:       modelv2.ModelBoxTemplateSpec{Serving: modelv2.ServingSpec{Image: "other:1"}},
+	}
+	cluster := &modelv2.ClusterModelBoxTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "gpu"},
+		Spec: modelv2.ModelBoxTemplateSpec{
+			Serving:  modelv2.ServingSpec{Image: "cluster:1"},
+			Exposure: modelv2.ExposureSpec{ServiceType: corev1.ServiceTypeLoadBalancer},
+		},
+	}
+
+	tests := []struct {
+		name            string
+		ref             *modelv2.TemplateReference
+		image           string
+		wantImage       string
+		wantServiceType corev1.ServiceType
+		wantNotFound    bool
+	}{
+		{
+			name:      "no template",
+			image:     "resnet:1",
+			wantImage: "resnet:1",
+		},
+		{
+			name:            "namespaced template by default",
+			ref:             &modelv2.TemplateReference{Name: "gpu"},
+			wantImage:       "namespaced:1",
+			wantServiceType: corev1.ServiceTypeNodePort,
+		},
+		{
+			name:            "ModelBox over namespaced template",
+			ref:             &modelv2.TemplateReference{Kind: modelv2.TemplateKind, Name: "gpu"},
+			image:           "resnet:1",
+			wantImage:       "resnet:1",
+			wantServiceType: corev1.ServiceTypeNodePort,
+		},
+		{
+			name:            "cluster template",
+			ref:             &modelv2.TemplateReference{Kind: modelv2.ClusterTemplateKind, Name: "gpu"},
+			wantImage:       "cluster:1",
+			wantServiceType: corev1.ServiceTypeLoadBalancer,
+		},
+		{
+			name:            "ModelBox over cluster template",
+			ref:             &modelv2.TemplateReference{Kind: modelv2.ClusterTemplateKind, Name: "gpu"},
+			image:           "resnet:1",
+			wantImage:       "resnet:1",
+			wantServiceType: corev1.ServiceTypeLoadBalancer,
+		},
+		{
+			name:         "namespaced template in another namespace",
+			ref:          &modelv2.TemplateReference{Name: "cpu"},
+			wantNotFound: true,
+		},
+		{
+			name:         "cluster template not found",
+			ref:          &modelv2.TemplateReference{Kind: modelv2.ClusterTemplateKind, Name: "cpu"},
+			wantNotFound: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := newTestReconciler(t, namespaced, otherNamespace, cluster)
+			modelbox := newTestModelBox()
+			modelbox.Spec.TemplateRef = tt.ref
+			modelbox.Spec.Serving.Image = tt.image
+
+			desired, err := resolveTemplate(context.Background(), r.Client, modelbox)
+			if tt.wantNotFound {
+				if !errors.IsNotFound(err) {
+					t.Fatalf("got error %v, want NotFound", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if desired == modelbox {
+				t.Error("resolveTemplate returned the ModelBox itself, want a copy")
+			}
+			if desired.Spec.Serving.Image != tt.wantImage {
+				t.Errorf("got image %q, want %q", desired.Spec.Serving.Image, tt.wantImage)
+			}
+			if desired.Spec.Exposure.ServiceType != tt.wantServiceType {
+				t.Errorf("got service type %q, want %q", desired.Spec.Exposure.ServiceType, tt.wantServiceType)
+			}
+			if modelbox.Spec.Serving.Image != tt.image {
+				t.Errorf("resolveTemplate modified the ModelBox image to %q", modelbox.Spec.Serving.Image)
+			}
+		})
+	}
+}
+
+// TestNewDeployServingAnnotation Pod 模板上记录 ModelBox 自己的镜像与环境变量, 不含模板提供的值
+func TestNewDeployServingAnnotation(t *testing.T) {
+	template := &modelv2.ClusterModelBoxTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "gpu"},
+		Spec: modelv2.ModelBoxTemplateSpec{Serving: modelv2.ServingSpec{
+			Image: "cluster:1",
+			Env:   []corev1.EnvVar{{Name: "CUDA_VISIBLE_DEVICES", Value: "0"}},
+		}},
+	}
+	env := []corev1.EnvVar{{Name: "BATCH_SIZE", Value: "8"}}
+	tests := []struct {
+		name  string
+		ref   *modelv2.TemplateReference
+		image string
+		want  string
+	}{
+		{
+			name:  "no template",
+			image: "resnet:1",
+			want:  `{"image":"resnet:1","env":[{"name":"BATCH_SIZE","value":"8"}]}`,
+		},
+		{
+			name: "image from the template",
+			ref:  &modelv2.TemplateReference{Kind: modelv2.ClusterTemplateKind, Name: "gpu"},
+			want: `{"env":[{"name":"BATCH_SIZE","value":"8"}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := newTestReconciler(t, template)
+			modelbox := newTestModelBox()
+			modelbox.Spec.TemplateRef = tt.ref
+			modelbox.Spec.Serving.Image = tt.image
+			modelbox.Spec.Serving.Env = env
+
+			desired, err := resolveTemplate(context.Background(), r.Client, modelbox)
+			if err != nil {
+				t.Fatal(err)
+			}
+			deploy := NewDeploy(desired)
+			if got := deploy.Spec.Template.Annotations[modelv2.ServingAnnotation]; got != tt.want {
+				t.Errorf("got annotation %s, want %s", got, tt.want)
+			}
+			if _, ok := modelbox.Annotations[modelv2.ServingAnnotation]; ok {
+				t.Error("resolveTemplate annotated the ModelBox itself")
+			}
+		})
+	}
+}
@@ -0,0 +1,358 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	modelv2 "github.com/sharelinuxs/my-first-opeartor/api/v2"
+)
+
+const (
+	// defaultMasterPort 分布式推理组默认的协调端口, 与 PyTorch 的默认值一致
+	defaultMasterPort = 29500
+	// podIndexLabel StatefulSet 控制器为 Pod 添加的序号标签, Kubernetes 1.28 及以上版本支持
+	podIndexLabel = "apps.kubernetes.io/pod-index"
+	// distributedEnvVolume 保存推理组环境变量文件的存储卷
+	distributedEnvVolume = "distributed-env"
+	// distributedEnvDir 推理组环境变量文件所在的目录
+	distributedEnvDir = "/etc/modelbox/distributed"
+)
+
+// distributedEnvScript 按 Pod 名称的序号后缀写入推理组的环境变量文件, 不依赖 pod-index 标签.
+// 标签不存在时 $(RANK) 为空, 将提示写入 termination message, 在 Pod 的状态中可见; 标签与序号不一致时失败
+const distributedEnvScript = `set -e
+rank="${POD_NAME##*-}"
+case "$rank" in
+''|*[!0-9]*)
+  echo "cannot derive the rank from pod name $POD_NAME" | tee /dev/termination-log >&2
+  exit 1 ;;
+esac
+if [ -z "$RANK" ]; then
+  echo "label apps.kubernetes.io/pod-index is missing (requires Kubernetes 1.28), RANK is empty: source $DISTRIBUTED_ENV_FILE instead" | tee /dev/termination-log >&2
+elif [ "$RANK" != "$rank" ]; then
+  echo "label apps.kubernetes.io/pod-index $RANK does not match pod name $POD_NAME" | tee /dev/termination-log >&2
+  exit 1
+fi
+printf 'export RANK=%s\nexport WORLD_SIZE=%s\nexport MASTER_ADDR=%s\nexport MASTER_PORT=%s\n' \
+  "$rank" "$WORLD_SIZE" "$MASTER_ADDR" "$MASTER_PORT" > "$DISTRIBUTED_ENV_FILE"
+`
+
+// isDistributed 是否以 StatefulSet 运行分布式推理
+func isDistributed(modelbox *modelv2.ModelBox) bool {
+	return modelbox.Spec.Distributed != nil
+}
+
+// workloadType ModelBox 的工作负载类型, 未设置时默认为 Deployment, 分布式推理默认为 StatefulSet
+func workloadType(modelbox *modelv2.ModelBox) modelv2.WorkloadType {
+	switch {
+	case modelbox.Spec.WorkloadType != "":
+		return modelbox.Spec.WorkloadType
+	case isDistributed(modelbox):
+		return modelv2.WorkloadStatefulSet
+	}
+	return modelv2.WorkloadDeployment
+}
+
+// validateWorkload 检查工作负载类型与相关配置的组合
+func validateWorkload(modelbox *modelv2.ModelBox) error {
+	kind := workloadType(modelbox)
+	if isDistributed(modelbox) && kind != modelv2.WorkloadStatefulSet {
+		return fmt.Errorf("distributed requires workloadType StatefulSet, got %s", kind)
+	}
+	if kind != modelv2.WorkloadBatchJob {
+		return nil
+	}
+	batch := modelbox.Spec.Batch
+	switch {
+	case batch == nil:
+		return fmt.Errorf("batch is required when workloadType is BatchJob")
+	case batch.Input.URL == "":
+		return fmt.Errorf("batch.input.url is required")
+	case batch.Output.ClaimName == "":
+		return fmt.Errorf("batch.output.claimName is required")
+	case modelbox.Spec.HotReload != nil:
+		// sidecar 不会退出, Job 无法完成
+		return fmt.Errorf("hotReload is not supported when workloadType is BatchJob")
+	}
+	for i, model := range modelbox.Spec.Models {
+		if modelName(i, model) == batchInputName {
+			return fmt.Errorf("model name %s is reserved for the batch input", batchInputName)
+		}
+	}
+	return nil
+}
+
+// headlessServiceName 推理组中各 Pod 互相发现使用的 headless Service
+func headlessServiceName(modelbox *modelv2.ModelBox) string {
+	return modelbox.Name + "-headless"
+}
+
+// masterPort 分布式推理组的协调端口
+func masterPort(modelbox *modelv2.ModelBox) int32 {
+	if modelbox.Spec.Distributed.MasterPort > 0 {
+		return modelbox.Spec.Distributed.MasterPort
+	}
+	return defaultMasterPort
+}
+
+// newDistributedEnv 推理组的环境变量, 放在用户的环境变量之前, 用户的环境变量与参数可以通过 $(RANK) 等方式引用.
+// 不支持 pod-index 标签的集群中 RANK 为空, 需要在命令中 source DISTRIBUTED_ENV_FILE
+func newDistributedEnv(modelbox *modelv2.ModelBox) []corev1.EnvVar {
+	return []corev1.EnvVar{
+		{
+			Name:      "POD_NAME",
+			ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"}},
+		},
+		{
+			Name: "RANK",
+			ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{
+				FieldPath: fmt.Sprintf("metadata.labels['%s']", podIndexLabel),
+			}},
+		},
+		{Name: "WORLD_SIZE", Value: strconv.Itoa(int(desiredReplicas(modelbox)))},
+		{Name: "MASTER_ADDR", Value: fmt.Sprintf("%s-0.%s.%s.svc", modelbox.Name, headlessServiceName(modelbox), modelbox.Namespace)},
+		{Name: "MASTER_PORT", Value: strconv.Itoa(int(masterPort(modelbox)))},
+		{Name: "DISTRIBUTED_ENV_FILE", Value: distributedEnvDir + "/env"},
+	}
+}
+
+// newDistributedEnvWriter 写入推理组环境变量文件的 InitContainer, 文件中的 RANK 取自 Pod 名称 (即主机名) 的序号
+func newDistributedEnvWriter(modelbox *modelv2.ModelBox) corev1.Container {
+	return corev1.Container{
+		Name:            "distributed-env",
+		Image:           pinnedImage(modelbox, UtilityImage),
+		ImagePullPolicy: modelbox.Spec.ImagePullPolicy,
+		Command:         []string{"/bin/sh", "-c", distributedEnvScript},
+		Env:             newDistributedEnv(modelbox),
+		VolumeMounts:    []corev1.VolumeMount{{Name: distributedEnvVolume, MountPath: distributedEnvDir}},
+	}
+}
+
+// NewStatefulSet ModelBox 的 StatefulSet, Pod 模板与 Deployment 相同, 分布式推理时推理服务容器中另外注入推理组的环境变量,
+// 并由第一个 InitContainer 写入环境变量文件. 推理组需要所有 Pod 同时运行, 因此并行创建 Pod
+func NewStatefulSet(modelbox *modelv2.ModelBox) *appsv1.StatefulSet {
+	deploy := NewDeploy(modelbox)
+	template := deploy.Spec.Template
+	if isDistributed(modelbox) {
+		for i := range template.Spec.Containers {
+			if container := &template.Spec.Containers[i]; container.Name == modelbox.Name {
+				container.Env = append(newDistributedEnv(modelbox), container.Env...)
+				container.VolumeMounts = append(container.VolumeMounts,
+					corev1.VolumeMount{Name: distributedEnvVolume, MountPath: distributedEnvDir, ReadOnly: true})
+			}
+		}
+		template.Spec.InitContainers = append([]corev1.Container{newDistributedEnvWriter(modelbox)}, template.Spec.InitContainers...)
+		template.Spec.Volumes = append(template.Spec.Volumes, corev1.Volume{
+			Name:         distributedEnvVolume,
+			VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+		})
+	}
+	return &appsv1.StatefulSet{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "StatefulSet",
+			APIVersion: "apps/v1",
+		},
+		ObjectMeta: deploy.ObjectMeta,
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:            modelbox.Spec.Scaling.Replicas,
+			Selector:            deploy.Spec.Selector,
+			Template:            template,
+			ServiceName:         headlessServiceName(modelbox),
+			PodManagementPolicy: appsv1.ParallelPodManagement,
+			UpdateStrategy:      appsv1.StatefulSetUpdateStrategy{Type: appsv1.RollingUpdateStatefulSetStrategyType},
+		},
+	}
+}
+
+// NewHeadlessService 为 StatefulSet 的 Pod 提供 <pod>.<name>-headless 域名, 未就绪的 Pod 也会发布, 推理组在就绪之前即可互相连接
+func NewHeadlessService(modelbox *modelv2.ModelBox) *corev1.Service {
+	ports := newServicePorts(modelbox)
+	hasMaster := !isDistributed(modelbox)
+	var master int32
+	if !hasMaster {
+		master = masterPort(modelbox)
+	}
+	for _, port := range ports {
+		hasMaster = hasMaster || port.Port == master
+	}
+	if !hasMaster {
+		ports = append(ports, corev1.ServicePort{Name: "master", Port: master, TargetPort: intstr.FromInt(int(master))})
+	}
+	return &corev1.Service{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Service",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            headlessServiceName(modelbox),
+			Namespace:       modelbox.Namespace,
+			OwnerReferences: makeOwnerReferences(modelbox),
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP:                corev1.ClusterIPNone,
+			PublishNotReadyAddresses: true,
+			Ports:                    ports,
+			Selector:                 map[string]string{"modelbox": modelbox.Name},
+		},
+	}
+}
+
+// reconcileHeadlessService 以 StatefulSet 运行时创建或更新 headless Service, 切换为其他工作负载后删除
+func (r *ModelBoxReconciler) reconcileHeadlessService(ctx context.Context, modelbox *modelv2.ModelBox) error {
+	current := &corev1.Service{}
+	err := r.Get(ctx, client.ObjectKey{Namespace: modelbox.Namespace, Name: headlessServiceName(modelbox)}, current)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	exists := err == nil
+
+	if workloadType(modelbox) != modelv2.WorkloadStatefulSet {
+		if exists && metav1.IsControlledBy(current, modelbox) {
+			return client.IgnoreNotFound(r.Delete(ctx, current))
+		}
+		return nil
+	}
+
+	desired := NewHeadlessService(modelbox)
+	if !exists {
+		return r.Create(ctx, desired)
+	}
+	// API server 会为端口填充协议等默认值, 只比较我们设置的字段
+	if equality.Semantic.DeepDerivative(desired.Spec, current.Spec) {
+		return nil
+	}
+	current.Spec.Ports = desired.Spec.Ports
+	current.Spec.Selector = desired.Spec.Selector
+	current.Spec.PublishNotReadyAddresses = desired.Spec.PublishNotReadyAddresses
+	return r.Update(ctx, current)
+}
+
+// emptyWorkload 用于读取 ModelBox 当前类型的工作负载
+func emptyWorkload(modelbox *modelv2.ModelBox) client.Object {
+	switch workloadType(modelbox) {
+	case modelv2.WorkloadStatefulSet:
+		return &appsv1.StatefulSet{}
+	case modelv2.WorkloadBatchJob:
+		return &batchv1.Job{}
+	}
+	return &appsv1.Deployment{}
+}
+
+// newWorkload ModelBox 的 Deployment、StatefulSet 或 Job, 已缩容到 0 的 ModelBox 保持缩容
+func newWorkload(modelbox *modelv2.ModelBox) client.Object {
+	replicas, _ := activeReplicas(modelbox, time.Now())
+	switch workloadType(modelbox) {
+	case modelv2.WorkloadStatefulSet:
+		sts := NewStatefulSet(modelbox)
+		sts.Spec.Replicas = &replicas
+		return sts
+	case modelv2.WorkloadBatchJob:
+		return NewBatchJob(modelbox)
+	}
+	deploy := NewDeploy(modelbox)
+	deploy.Spec.Replicas = &replicas
+	return deploy
+}
+
+// workloadReplicas 工作负载的副本数字段, Job 没有副本数时返回 nil
+func workloadReplicas(workload client.Object) **int32 {
+	switch w := workload.(type) {
+	case *appsv1.Deployment:
+		return &w.Spec.Replicas
+	case *appsv1.StatefulSet:
+		return &w.Spec.Replicas
+	}
+	return nil
+}
+
+// deleteWorkload 删除工作负载及其 Pod. batch/v1 Job 默认不级联删除 Pod, 需要显式指定
+func (r *ModelBoxReconciler) deleteWorkload(ctx context.Context, workload client.Object) error {
+	return client.IgnoreNotFound(r.Delete(ctx, workload, client.PropagationPolicy(metav1.DeletePropagationBackground)))
+}
+
+// createWorkload 创建工作负载. 切换了工作负载类型时, 删除之前类型的工作负载
+func (r *ModelBoxReconciler) createWorkload(ctx context.Context, modelbox *modelv2.ModelBox) error {
+	desired := newWorkload(modelbox)
+	if err := r.Create(ctx, desired); err != nil {
+		return err
+	}
+	for _, stale := range []client.Object{&appsv1.Deployment{}, &appsv1.StatefulSet{}, &batchv1.Job{}} {
+		if reflect.TypeOf(stale) == reflect.TypeOf(desired) {
+			continue
+		}
+		if err := r.Get(ctx, client.ObjectKeyFromObject(modelbox), stale); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+		if !metav1.IsControlledBy(stale, modelbox) {
+			continue
+		}
+		if err := r.deleteWorkload(ctx, stale); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateWorkload 按新的 spec 更新工作负载, StatefulSet 只有副本数、Pod 模板与更新策略可以修改.
+// Job 的 Pod 模板不可修改, 删除后在下次 Reconcile 时按新的 spec 重新运行
+func (r *ModelBoxReconciler) updateWorkload(ctx context.Context, modelbox *modelv2.ModelBox) error {
+	desired := newWorkload(modelbox)
+	current := emptyWorkload(modelbox)
+	if err := r.Get(ctx, client.ObjectKeyFromObject(modelbox), current); err != nil {
+		return err
+	}
+	switch c := current.(type) {
+	case *appsv1.Deployment:
+		c.Spec = desired.(*appsv1.Deployment).Spec
+	case *appsv1.StatefulSet:
+		d := desired.(*appsv1.StatefulSet)
+		c.Spec.Replicas = d.Spec.Replicas
+		c.Spec.Template = d.Spec.Template
+		c.Spec.UpdateStrategy = d.Spec.UpdateStrategy
+	case *batchv1.Job:
+		return r.deleteWorkload(ctx, c)
+	}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		return r.Update(ctx, current)
+	})
+}
+
+// workloadStatus 工作负载的状态. StatefulSet 的状态按 Deployment 的字段记录, 就绪的 Pod 视为可用;
+// Job 只记录运行中的 Pod 数, 任务的进度记录在 status.batch 中
+func (r *ModelBoxReconciler) workloadStatus(ctx context.Context, modelbox *modelv2.ModelBox) (appsv1.DeploymentStatus, *modelv2.BatchStatus, error) {
+	workload := emptyWorkload(modelbox)
+	if err := r.Get(ctx, client.ObjectKeyFromObject(modelbox), workload); err != nil {
+		return appsv1.DeploymentStatus{}, nil, err
+	}
+	switch w := workload.(type) {
+	case *appsv1.StatefulSet:
+		return appsv1.DeploymentStatus{
+			ObservedGeneration: w.Status.ObservedGeneration,
+			Replicas:           w.Status.Replicas,
+			UpdatedReplicas:    w.Status.UpdatedReplicas,
+			ReadyReplicas:      w.Status.ReadyReplicas,
+			AvailableReplicas:  w.Status.ReadyReplicas,
+		}, nil, nil
+	case *batchv1.Job:
+		return appsv1.DeploymentStatus{Replicas: w.Status.Active}, newBatchStatus(modelbox, w), nil
+	case *appsv1.Deployment:
+		return w.Status, nil, nil
+	}
+	return appsv1.DeploymentStatus{}, nil, nil
+}
@@ -0,0 +1,429 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	modelv2 "github.com/sharelinuxs/my-first-opeartor/api/v2"
+)
+
+func TestNewDistributedEnv(t *testing.T) {
+	tests := []struct {
+		name        string
+		replicas    *int32
+		distributed modelv2.DistributedSpec
+		want        map[string]string
+	}{
+		{
+			name:     "defaults",
+			replicas: int32Ptr(4),
+			want: map[string]string{
+				"WORLD_SIZE":           "4",
+				"MASTER_ADDR":          "resnet-0.resnet-headless.default.svc",
+				"MASTER_PORT":          "29500",
+				"DISTRIBUTED_ENV_FILE": "/etc/modelbox/distributed/env",
+			},
+		},
+		{
+			name:        "master port",
+			replicas:    int32Ptr(2),
+			distributed: modelv2.DistributedSpec{MasterPort: 12345},
+			want: map[string]string{
+				"WORLD_SIZE":           "2",
+				"MASTER_ADDR":          "resnet-0.resnet-headless.default.svc",
+				"MASTER_PORT":          "12345",
+				"DISTRIBUTED_ENV_FILE": "/etc/modelbox/distributed/env",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modelbox := newTestModelBox()
+			modelbox.Spec.Scaling.Replicas = tt.replicas
+			modelbox.Spec.Distributed = tt.distributed.DeepCopy()
+
+			got := map[string]string{}
+			fieldRefs := map[string]string{}
+			for _, env := range newDistributedEnv(modelbox) {
+				if env.ValueFrom != nil {
+					fieldRefs[env.Name] = env.ValueFrom.FieldRef.FieldPath
+					continue
+				}
+				got[env.Name] = env.Value
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got env %v, want %v", got, tt.want)
+			}
+			wantRefs := map[string]string{
+				"POD_NAME": "metadata.name",
+				"RANK":     "metadata.labels['apps.kubernetes.io/pod-index']",
+			}
+			if !reflect.DeepEqual(fieldRefs, wantRefs) {
+				t.Errorf("got field refs %v, want %v", fieldRefs, wantRefs)
+			}
+		})
+	}
+}
+
+func TestNewStatefulSet(t *testing.T) {
+	tests := []struct {
+		name            string
+		distributed     *modelv2.DistributedSpec
+		wantInit        []string
+		wantDistributed bool
+	}{
+		{
+			name:     "fixed hostnames only",
+			wantInit: []string{"fetch-model"},
+		},
+		{
+			name:            "distributed",
+			distributed:     &modelv2.DistributedSpec{},
+			wantInit:        []string{"distributed-env", "fetch-model"},
+			wantDistributed: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modelbox := newTestModelBox()
+			modelbox.Spec.WorkloadType = modelv2.WorkloadStatefulSet
+			modelbox.Spec.Distributed = tt.distributed
+			modelbox.Spec.Serving.Env = []corev1.EnvVar{{Name: "BATCH_SIZE", Value: "8"}}
+
+			sts := NewStatefulSet(modelbox)
+			if sts.Name != "resnet" || len(sts.OwnerReferences) != 1 {
+				t.Errorf("got StatefulSet %s with owners %v", sts.Name, sts.OwnerReferences)
+			}
+			if sts.Spec.ServiceName != "resnet-headless" || sts.Spec.PodManagementPolicy != appsv1.ParallelPodManagement ||
+				sts.Spec.UpdateStrategy.Type != appsv1.RollingUpdateStatefulSetStrategyType {
+				t.Errorf("got service %q, pod management %q and update strategy %q",
+					sts.Spec.ServiceName, sts.Spec.PodManagementPolicy, sts.Spec.UpdateStrategy.Type)
+			}
+			if !reflect.DeepEqual(sts.Spec.Selector, NewDeploy(modelbox).Spec.Selector) {
+				t.Errorf("got selector %v", sts.Spec.Selector)
+			}
+			podSpec := sts.Spec.Template.Spec
+			if got := containerNames(podSpec.InitContainers); !reflect.DeepEqual(got, tt.wantInit) {
+				t.Errorf("got init containers %v, want %v", got, tt.wantInit)
+			}
+
+			serving := findContainer(podSpec.Containers, "resnet")
+			if !tt.wantDistributed {
+				if !reflect.DeepEqual(serving.Env, modelbox.Spec.Serving.Env) {
+					t.Errorf("got env %v, want only the user's env", serving.Env)
+				}
+				if hasVolume(podSpec.Volumes, distributedEnvVolume) {
+					t.Error("env file volume added without distributed")
+				}
+				return
+			}
+			// 推理组的环境变量在用户的环境变量之前, 用户的环境变量可以引用它们
+			want := append(newDistributedEnv(modelbox), modelbox.Spec.Serving.Env...)
+			if !reflect.DeepEqual(serving.Env, want) {
+				t.Errorf("got env %v, want %v", serving.Env, want)
+			}
+			if mount := findVolumeMount(serving, distributedEnvVolume); mount == nil || mount.MountPath != distributedEnvDir || !mount.ReadOnly {
+				t.Errorf("got env file mount %+v, want read-only at %s", mount, distributedEnvDir)
+			}
+			if !hasVolume(podSpec.Volumes, distributedEnvVolume) {
+				t.Error("env file volume missing")
+			}
+			writer := podSpec.InitContainers[0]
+			if writer.Image != UtilityImage || !reflect.DeepEqual(writer.Env, newDistributedEnv(modelbox)) {
+				t.Errorf("got env writer image %q with env %v", writer.Image, writer.Env)
+			}
+			if mount := findVolumeMount(&writer, distributedEnvVolume); mount == nil || mount.ReadOnly {
+				t.Errorf("got env writer mount %+v, want writable", mount)
+			}
+			for _, c := range podSpec.Containers {
+				if c.Name != "resnet" && findVolumeMount(&c, distributedEnvVolume) != nil {
+					t.Errorf("env file mounted into %s", c.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestNewHeadlessService(t *testing.T) {
+	tests := []struct {
+		name        string
+		distributed *modelv2.DistributedSpec
+		ports       []corev1.ServicePort
+		want        []corev1.ServicePort
+	}{
+		{
+			name:  "no master port without distributed",
+			ports: []corev1.ServicePort{{Name: "http", Port: 80}},
+			want:  []corev1.ServicePort{{Name: "http", Port: 80, TargetPort: intstr.FromInt(80)}},
+		},
+		{
+			name:        "master port added",
+			distributed: &modelv2.DistributedSpec{},
+			ports:       []corev1.ServicePort{{Name: "http", Port: 80}},
+			want: []corev1.ServicePort{
+				{Name: "http", Port: 80, TargetPort: intstr.FromInt(80)},
+				{Name: "master", Port: 29500, TargetPort: intstr.FromInt(29500)},
+			},
+		},
+		{
+			name:        "master port already exposed",
+			distributed: &modelv2.DistributedSpec{MasterPort: 8080},
+			ports:       []corev1.ServicePort{{Name: "http", Port: 8080}},
+			want:        []corev1.ServicePort{{Name: "http", Port: 8080, TargetPort: intstr.FromInt(8080)}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modelbox := newTestModelBox()
+			modelbox.Spec.Distributed = tt.distributed
+			modelbox.Spec.Exposure.Ports = tt.ports
+
+			svc := NewHeadlessService(modelbox)
+			if svc.Name != "resnet-headless" || svc.Namespace != "default" || len(svc.OwnerReferences) != 1 {
+				t.Errorf("got Service %s/%s with owners %v", svc.Namespace, svc.Name, svc.OwnerReferences)
+			}
+			if svc.Spec.ClusterIP != corev1.ClusterIPNone || !svc.Spec.PublishNotReadyAddresses {
+				t.Errorf("got clusterIP %q and publishNotReadyAddresses %v", svc.Spec.ClusterIP, svc.Spec.PublishNotReadyAddresses)
+			}
+			if !reflect.DeepEqual(svc.Spec.Selector, map[string]string{"modelbox": "resnet"}) {
+				t.Errorf("got selector %v", svc.Spec.Selector)
+			}
+			if !reflect.DeepEqual(svc.Spec.Ports, tt.want) {
+				t.Errorf("got ports %+v, want %+v", svc.Spec.Ports, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateWorkload(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*modelv2.ModelBox)
+		wantErr string
+	}{
+		{
+			name: "Deployment",
+		},
+		{
+			name:   "distributed defaults to StatefulSet",
+			modify: func(m *modelv2.ModelBox) { m.Spec.Distributed = &modelv2.DistributedSpec{} },
+		},
+		{
+			name: "distributed Deployment",
+			modify: func(m *modelv2.ModelBox) {
+				m.Spec.Distributed = &modelv2.DistributedSpec{}
+				m.Spec.WorkloadType = modelv2.WorkloadDeployment
+			},
+			wantErr: "distributed requires workloadType StatefulSet",
+		},
+		{
+			name:   "BatchJob",
+			modify: func(m *modelv2.ModelBox) { *m = *newBatchModelBox() },
+		},
+		{
+			name:    "BatchJob without batch",
+			modify:  func(m *modelv2.ModelBox) { m.Spec.WorkloadType = modelv2.WorkloadBatchJob },
+			wantErr: "batch is required",
+		},
+		{
+			name: "BatchJob without input",
+			modify: func(m *modelv2.ModelBox) {
+				*m = *newBatchModelBox()
+				m.Spec.Batch.Input.URL = ""
+			},
+			wantErr: "batch.input.url is required",
+		},
+		{
+			name: "BatchJob without output",
+			modify: func(m *modelv2.ModelBox) {
+				*m = *newBatchModelBox()
+				m.Spec.Batch.Output.ClaimName = ""
+			},
+			wantErr: "batch.output.claimName is required",
+		},
+		{
+			name: "BatchJob with hot reload",
+			modify: func(m *modelv2.ModelBox) {
+				*m = *newBatchModelBox()
+				m.Spec.HotReload = &modelv2.HotReloadSpec{}
+			},
+			wantErr: "hotReload is not supported",
+		},
+		{
+			name: "model named like the batch input",
+			modify: func(m *modelv2.ModelBox) {
+				*m = *newBatchModelBox()
+				m.Spec.Model = modelv2.ModelSource{}
+				m.Spec.Models = []modelv2.ModelSource{{Name: batchInputName, URL: "s3://models/resnet/"}}
+			},
+			wantErr: "reserved for the batch input",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modelbox := newTestModelBox()
+			if tt.modify != nil {
+				tt.modify(modelbox)
+			}
+			err := validateWorkload(modelbox)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("got error %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestCreateWorkload 切换工作负载类型后创建新的工作负载, 删除由 ModelBox 创建的旧工作负载
+func TestCreateWorkload(t *testing.T) {
+	modelbox := newTestModelBox()
+	owned := metav1.ObjectMeta{Name: "resnet", Namespace: "default", OwnerReferences: makeOwnerReferences(modelbox)}
+	tests := []struct {
+		name     string
+		modify   func(*modelv2.ModelBox)
+		existing []client.Object
+		want     client.Object
+		wantGone []client.Object
+		wantKept []client.Object
+	}{
+		{
+			name: "Deployment",
+			want: &appsv1.Deployment{},
+		},
+		{
+			name:     "Deployment to StatefulSet",
+			modify:   func(m *modelv2.ModelBox) { m.Spec.Distributed = &modelv2.DistributedSpec{} },
+			existing: []client.Object{&appsv1.Deployment{ObjectMeta: owned}},
+			want:     &appsv1.StatefulSet{},
+			wantGone: []client.Object{&appsv1.Deployment{}},
+		},
+		{
+			name:     "StatefulSet to BatchJob",
+			modify:   func(m *modelv2.ModelBox) { *m = *newBatchModelBox() },
+			existing: []client.Object{&appsv1.StatefulSet{ObjectMeta: owned}},
+			want:     &batchv1.Job{},
+			wantGone: []client.Object{&appsv1.StatefulSet{}},
+		},
+		{
+			name:     "workloads of others are kept",
+			modify:   func(m *modelv2.ModelBox) { *m = *newBatchModelBox() },
+			existing: []client.Object{&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "resnet", Namespace: "default"}}},
+			want:     &batchv1.Job{},
+			wantKept: []client.Object{&appsv1.Deployment{}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := newTestReconciler(t, tt.existing...)
+			ctx := context.Background()
+			modelbox := newTestModelBox()
+			if tt.modify != nil {
+				tt.modify(modelbox)
+			}
+			key := client.ObjectKeyFromObject(modelbox)
+
+			if err := r.createWorkload(ctx, modelbox); err != nil {
+				t.Fatal(err)
+			}
+			if err := r.Get(ctx, key, tt.want); err != nil {
+				t.Errorf("get %T: %v", tt.want, err)
+			}
+			for _, obj := range tt.wantGone {
+				if err := r.Get(ctx, key, obj); !errors.IsNotFound(err) {
+					t.Errorf("got %T with error %v, want it deleted", obj, err)
+				}
+			}
+			for _, obj := range tt.wantKept {
+				if err := r.Get(ctx, key, obj); err != nil {
+					t.Errorf("got error %v, want %T kept", err, obj)
+				}
+			}
+		})
+	}
+}
+
+// TestUpdateWorkload Deployment 与 StatefulSet 按新的 spec 更新, Job 删除后重新运行
+func TestUpdateWorkload(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Deployment", func(t *testing.T) {
+		modelbox := newTestModelBox()
+		r, _ := newTestReconciler(t, NewDeploy(modelbox))
+		modelbox.Spec.Serving.Image = "resnet:2"
+		modelbox.Spec.Scaling.Replicas = int32Ptr(3)
+		if err := r.updateWorkload(ctx, modelbox); err != nil {
+			t.Fatal(err)
+		}
+		deploy := &appsv1.Deployment{}
+		if err := r.Get(ctx, client.ObjectKeyFromObject(modelbox), deploy); err != nil {
+			t.Fatal(err)
+		}
+		if image := findContainer(deploy.Spec.Template.Spec.Containers, "resnet").Image; image != "resnet:2" || *deploy.Spec.Replicas != 3 {
+			t.Errorf("got image %q and %d replicas, want resnet:2 and 3", image, *deploy.Spec.Replicas)
+		}
+	})
+
+	t.Run("StatefulSet", func(t *testing.T) {
+		modelbox := newTestModelBox()
+		modelbox.Spec.Distributed = &modelv2.DistributedSpec{}
+		existing := NewStatefulSet(modelbox)
+		r, _ := newTestReconciler(t, existing)
+		modelbox.Spec.Serving.Image = "resnet:2"
+		modelbox.Spec.Scaling.Replicas = int32Ptr(4)
+		if err := r.updateWorkload(ctx, modelbox); err != nil {
+			t.Fatal(err)
+		}
+		sts := &appsv1.StatefulSet{}
+		if err := r.Get(ctx, client.ObjectKeyFromObject(modelbox), sts); err != nil {
+			t.Fatal(err)
+		}
+		serving := findContainer(sts.Spec.Template.Spec.Containers, "resnet")
+		if serving.Image != "resnet:2" || *sts.Spec.Replicas != 4 {
+			t.Errorf("got image %q and %d replicas, want resnet:2 and 4", serving.Image, *sts.Spec.Replicas)
+		}
+		// WORLD_SIZE 随副本数更新
+		for _, env := range serving.Env {
+			if env.Name == "WORLD_SIZE" && env.Value != "4" {
+				t.Errorf("got WORLD_SIZE %s, want 4", env.Value)
+			}
+		}
+		// 不可修改的字段保持不变
+		if sts.Spec.ServiceName != existing.Spec.ServiceName || !reflect.DeepEqual(sts.Spec.Selector, existing.Spec.Selector) {
+			t.Errorf("got service %q and selector %v", sts.Spec.ServiceName, sts.Spec.Selector)
+		}
+	})
+
+	t.Run("Job", func(t *testing.T) {
+		modelbox := newBatchModelBox()
+		r, _ := newTestReconciler(t, NewBatchJob(modelbox))
+		modelbox.Spec.Serving.Image = "resnet:2"
+		if err := r.updateWorkload(ctx, modelbox); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Get(ctx, client.ObjectKeyFromObject(modelbox), &batchv1.Job{}); !errors.IsNotFound(err) {
+			t.Errorf("got error %v, want the Job deleted", err)
+		}
+	})
+
+	t.Run("missing workload", func(t *testing.T) {
+		r, _ := newTestReconciler(t)
+		if err := r.updateWorkload(ctx, newTestModelBox()); !errors.IsNotFound(err) {
+			t.Errorf("got error %v, want NotFound", err)
+		}
+	})
+}
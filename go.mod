@@ -4,13 +4,20 @@ go 1.15
 
 require (
 	github.com/go-logr/logr v0.3.0
+	github.com/golang-jwt/jwt/v4 v4.5.2
 	github.com/onsi/ginkgo v1.14.1
 	github.com/onsi/gomega v1.10.2
+	github.com/prometheus/client_golang v1.7.1
 	github.com/sirupsen/logrus v1.8.1
+	github.com/spf13/cobra v1.0.0
+	github.com/spf13/pflag v1.0.5
+	golang.org/x/net v0.0.0-20200707034311-ab3426394381
 	k8s.io/api v0.19.2
+	k8s.io/apiextensions-apiserver v0.19.2
 	k8s.io/apimachinery v0.19.2
 	k8s.io/client-go v0.19.2
 	k8s.io/code-generator v0.19.2
 	k8s.io/klog/v2 v2.2.0
 	sigs.k8s.io/controller-runtime v0.7.2
+	sigs.k8s.io/yaml v1.2.0
 )
@@ -19,19 +19,23 @@ package main
 import (
 	"flag"
 	"os"
+	"strings"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	modelv1 "github.com/sharelinuxs/my-first-opeartor/api/v1"
+	modelv2 "github.com/sharelinuxs/my-first-opeartor/api/v2"
 	"github.com/sharelinuxs/my-first-opeartor/controllers"
 	//+kubebuilder:scaffold:imports
 )
@@ -45,6 +49,7 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(modelv1.AddToScheme(scheme))
+	utilruntime.Must(modelv2.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
@@ -57,6 +62,25 @@ func main() {
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&controllers.AgentImage, "agent-image", controllers.AgentImage,
+		"The default image of the model sync agent injected into ModelBoxes with hot reload enabled.")
+	flag.StringVar(&controllers.UtilityImage, "utility-image", controllers.UtilityImage,
+		"The image of the utility container in ModelBox pods.")
+	var allowedRegistries string
+	flag.StringVar(&allowedRegistries, "allowed-registries", "",
+		"Comma-separated registries, optionally with a repository prefix, that ModelBox images must come from. "+
+			"Empty allows any registry.")
+	flag.StringVar(&controllers.GatewayNamespace, "gateway-namespace", "",
+		"The namespace of the apigateway pods allowed by ModelBox network policies. Empty matches any namespace.")
+	gatewayPodLabels := labels.Set(controllers.GatewayPodLabels).String()
+	flag.StringVar(&gatewayPodLabels, "gateway-pod-labels", gatewayPodLabels,
+		"Comma-separated key=value labels of the apigateway pods allowed by ModelBox network policies.")
+	flag.StringVar(&controllers.ControllerNamespace, "controller-namespace", os.Getenv("POD_NAMESPACE"),
+		"The namespace of the controller pods, allowed to reach the hot reload sidecar by ModelBox network policies.")
+	flag.StringVar(&controllers.PullSecretNamespace, "pull-secret-namespace", "",
+		"The namespace of image pull secrets that ModelBoxes may copy into their own namespace. Empty disables copying.")
+	flag.BoolVar(&controllers.ResolveDigests, "resolve-digests", false,
+		"Resolve image tags to digests once and record them in the ModelBox status, so pods keep using the same images.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -64,6 +88,17 @@ func main() {
 	flag.Parse()
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+	gatewayLabels, err := labels.ConvertSelectorToLabelsMap(gatewayPodLabels)
+	if err != nil {
+		setupLog.Error(err, "invalid --gateway-pod-labels")
+		os.Exit(1)
+	}
+	controllers.GatewayPodLabels = gatewayLabels
+	for _, registry := range strings.Split(allowedRegistries, ",") {
+		if registry = strings.TrimSpace(registry); registry != "" {
+			controllers.AllowedRegistries = append(controllers.AllowedRegistries, registry)
+		}
+	}
 
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
@@ -79,13 +114,23 @@ func main() {
 	}
 
 	if err = (&controllers.ModelBoxReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("ModelBox"),
-		Scheme: mgr.GetScheme(),
+		Client:    mgr.GetClient(),
+		Log:       ctrl.Log.WithName("controllers").WithName("ModelBox"),
+		Scheme:    mgr.GetScheme(),
+		APIReader: mgr.GetAPIReader(),
+		Recorder:  mgr.GetEventRecorderFor("modelbox-controller"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "ModelBox")
 		os.Exit(1)
 	}
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = (&modelv2.ModelBox{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "ModelBox")
+			os.Exit(1)
+		}
+		// 按命名空间中的 ModelBoxPolicy 检查 ModelBox
+		mgr.GetWebhookServer().Register(controllers.ValidatePath, &webhook.Admission{Handler: &controllers.ModelBoxValidator{Client: mgr.GetClient()}})
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
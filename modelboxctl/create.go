@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/yaml"
+
+	modelv1 "github.com/sharelinuxs/my-first-opeartor/api/v1"
+)
+
+type createOptions struct {
+	filename      string
+	image         string
+	model         string
+	replicas      int32
+	port          int32
+	resourceType  string
+	serviceType   string
+	rollingUpdate string
+	idleTimeout   time.Duration
+	output        string
+}
+
+func newCreateCommand(f *factory) *cobra.Command {
+	o := &createOptions{}
+	cmd := &cobra.Command{
+		Use:   "create (-f FILENAME | NAME --image=IMAGE --port=PORT)",
+		Short: "Create a ModelBox from a file or from flags",
+		Example: `  # 从 json/yaml 文件创建, - 表示标准输入
+  modelboxctl create -f config/samples/model_v1_modelbox.yaml
+
+  # 通过参数创建
+  modelboxctl create resnet --image=tensorflow/serving:2.4.0 --model=s3://models/resnet --port=8501`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateOutput(o.output); err != nil {
+				return err
+			}
+			modelBox, err := o.modelBox(args)
+			if err != nil {
+				return err
+			}
+			namespace, err := f.Namespace()
+			if err != nil {
+				return err
+			}
+			if modelBox.Namespace != "" && f.namespace != "" && modelBox.Namespace != f.namespace {
+				return fmt.Errorf("the namespace from the provided object %q does not match the namespace %q", modelBox.Namespace, f.namespace)
+			}
+			if modelBox.Namespace != "" {
+				namespace = modelBox.Namespace
+			}
+			modelBoxes, err := f.ModelBoxes(namespace)
+			if err != nil {
+				return err
+			}
+			created, err := modelBoxes.Create(context.TODO(), modelBox, metav1.CreateOptions{})
+			if err != nil {
+				return err
+			}
+			if o.output != "" {
+				return printModelBoxes(cmd.OutOrStdout(), []modelv1.ModelBox{*created}, o.output, true, false)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "modelbox/%s created\n", created.Name)
+			return nil
+		},
+	}
+	flags := cmd.Flags()
+	flags.StringVarP(&o.filename, "filename", "f", "", "File that contains the ModelBox to create, - for stdin.")
+	flags.StringVar(&o.image, "image", "", "Image of the serving container.")
+	flags.StringVar(&o.model, "model", "", "URL of the model file.")
+	flags.Int32Var(&o.replicas, "replicas", 1, "Number of replicas.")
+	flags.Int32Var(&o.port, "port", 0, "Port the model server listens on, exposed by the Service with the same port.")
+	flags.StringVar(&o.resourceType, "resource-type", "small", "Resource profile: small, medium, large or custom.")
+	flags.StringVar(&o.serviceType, "service-type", "", "Type of the Service: ClusterIP, NodePort or LoadBalancer.")
+	flags.StringVar(&o.rollingUpdate, "rolling-update", "25%", "Max unavailable/surge during rolling updates, a number or percentage.")
+	flags.DurationVar(&o.idleTimeout, "idle-timeout", 0, "Scale to zero after no inference traffic for this long, zero disables scale-to-zero.")
+	flags.StringVarP(&o.output, "output", "o", "", "Output format: json, yaml or wide.")
+	return cmd
+}
+
+func (o *createOptions) modelBox(args []string) (*modelv1.ModelBox, error) {
+	if o.filename != "" {
+		if len(args) > 0 {
+			return nil, fmt.Errorf("NAME cannot be specified together with --filename")
+		}
+		return readModelBox(o.filename)
+	}
+
+	if len(args) == 0 {
+		return nil, fmt.Errorf("either --filename or NAME is required")
+	}
+	if o.image == "" || o.port == 0 {
+		return nil, fmt.Errorf("--image and --port are required when creating from flags")
+	}
+	replicas := o.replicas
+	var idleTimeout *metav1.Duration
+	if o.idleTimeout > 0 {
+		idleTimeout = &metav1.Duration{Duration: o.idleTimeout}
+	}
+	return &modelv1.ModelBox{
+		ObjectMeta: metav1.ObjectMeta{Name: args[0]},
+		Spec: modelv1.ModelBoxSpec{
+			Image:         o.image,
+			Replicas:      &replicas,
+			ModelFileURL:  o.model,
+			ServiceType:   corev1.ServiceType(o.serviceType),
+			ResourceType:  o.resourceType,
+			RollingUpdate: o.rollingUpdate,
+			IdleTimeout:   idleTimeout,
+			Ports: []corev1.ServicePort{{
+				Name:       "http",
+				Port:       o.port,
+				TargetPort: intstr.FromInt(int(o.port)),
+			}},
+		},
+	}, nil
+}
+
+// readModelBox 读取 json 或 yaml 格式的 ModelBox
+func readModelBox(filename string) (*modelv1.ModelBox, error) {
+	var data []byte
+	var err error
+	if filename == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(filename)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	modelBox := &modelv1.ModelBox{}
+	if err := yaml.UnmarshalStrict(data, modelBox); err != nil {
+		return nil, fmt.Errorf("unable to decode %s: %v", filename, err)
+	}
+	gvk := modelBox.GroupVersionKind()
+	if gvk.Empty() {
+		modelBox.SetGroupVersionKind(modelv1.GroupVersion.WithKind(modelv1.Kind))
+	} else if gvk != modelv1.GroupVersion.WithKind(modelv1.Kind) {
+		return nil, fmt.Errorf("%s: expected %s, got %s", filename, modelv1.GroupVersion.WithKind(modelv1.Kind), gvk)
+	}
+	return modelBox, nil
+}
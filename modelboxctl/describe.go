@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+
+	modelv1 "github.com/sharelinuxs/my-first-opeartor/api/v1"
+	modelv2 "github.com/sharelinuxs/my-first-opeartor/api/v2"
+)
+
+func newDescribeCommand(f *factory) *cobra.Command {
+	return &cobra.Command{
+		Use:   "describe NAME",
+		Short: "Show details of a ModelBox, its Deployment, Pods and events",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			namespace, err := f.Namespace()
+			if err != nil {
+				return err
+			}
+			modelBoxes, err := f.ModelBoxes(namespace)
+			if err != nil {
+				return err
+			}
+			kubeClient, err := f.KubeClient()
+			if err != nil {
+				return err
+			}
+			modelBox, err := modelBoxes.Get(context.TODO(), args[0], metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			return describe(cmd.OutOrStdout(), kubeClient, modelBox)
+		},
+	}
+}
+
+func describe(out io.Writer, kubeClient kubernetes.Interface, mb *modelv1.ModelBox) error {
+	ctx := context.TODO()
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintf(w, "Name:\t%s\n", mb.Name)
+	fmt.Fprintf(w, "Namespace:\t%s\n", mb.Namespace)
+	fmt.Fprintf(w, "Labels:\t%s\n", orNone(labels.FormatLabels(mb.Labels)))
+	fmt.Fprintf(w, "CreationTimestamp:\t%s\n", mb.CreationTimestamp.UTC().Format("Mon, 02 Jan 2006 15:04:05 -0700"))
+	fmt.Fprintf(w, "Image:\t%s\n", orNone(mb.Spec.Image))
+	if len(mb.Spec.Command) > 0 || len(mb.Spec.Args) > 0 {
+		fmt.Fprintf(w, "Command:\t%s\n", strings.Join(append(append([]string{}, mb.Spec.Command...), mb.Spec.Args...), " "))
+	}
+	if len(mb.Spec.Models) == 0 {
+		fmt.Fprintf(w, "Model:\t%s\n", orNone(mb.Spec.ModelFileURL))
+	} else {
+		states := map[string]modelv1.ModelStatus{}
+		for _, status := range mb.Status.Models {
+			states[status.Name] = status
+		}
+		fmt.Fprintf(w, "Models:\n  Name\tURL\tState\tLoaded\tMessage\n  ----\t---\t-----\t------\t-------\n")
+		for _, model := range mb.Spec.Models {
+			status := states[model.Name]
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%d\t%s\n", model.Name, model.URL, orNone(status.State), status.LoadedReplicas, status.Message)
+		}
+	}
+	fmt.Fprintf(w, "Replicas:\t%d desired | %d updated | %d total | %d available | %d unavailable\n",
+		desiredReplicas(mb), mb.Status.UpdatedReplicas, mb.Status.Replicas, mb.Status.AvailableReplicas, mb.Status.UnavailableReplicas)
+	fmt.Fprintf(w, "Resource Type:\t%s\n", orNone(mb.Spec.ResourceType))
+	fmt.Fprintf(w, "Rolling Update:\t%s\n", orNone(mb.Spec.RollingUpdate))
+	if mb.Spec.IdleTimeout != nil {
+		fmt.Fprintf(w, "Idle Timeout:\t%s\n", mb.Spec.IdleTimeout.Duration)
+		fmt.Fprintf(w, "Last Activity:\t%s\n", orNone(mb.Annotations[modelv2.LastActivityAnnotation]))
+	}
+	if mb.Spec.HotReload != nil {
+		fmt.Fprintf(w, "Hot Reload:\tenabled, reload url %s\n", orNone(mb.Spec.HotReload.ReloadURL))
+		fmt.Fprintf(w, "Model Revision:\t%s\n", orNone(mb.Status.ModelRevision))
+		if len(mb.Status.Reloads) > 0 {
+			fmt.Fprintf(w, "Reloads:\n  Pod\tRevision\tState\tMessage\n  ---\t--------\t-----\t-------\n")
+			for _, reload := range mb.Status.Reloads {
+				fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", reload.Pod, orNone(reload.Revision), reload.State, reload.Message)
+			}
+		}
+	}
+	if mb.Spec.TemplateRef != nil {
+		kind := mb.Spec.TemplateRef.Kind
+		if kind == "" {
+			kind = modelv2.TemplateKind
+		}
+		fmt.Fprintf(w, "Template:\t%s/%s\n", kind, mb.Spec.TemplateRef.Name)
+	}
+	if mb.Spec.Prefetch != nil {
+		fmt.Fprintf(w, "Prefetch:\tnodes %s, cache %s\n",
+			orNone(labels.Set(mb.Spec.Prefetch.NodeSelector).String()), orNone(mb.Spec.Prefetch.CachePath))
+	}
+	if mb.Spec.ServiceAccountName != "" || mb.Spec.ServiceAccount != nil {
+		created := mb.Spec.ServiceAccount != nil && mb.Spec.ServiceAccount.Create
+		name := mb.Spec.ServiceAccountName
+		switch {
+		case name != "":
+		case created:
+			name = mb.Name
+		default:
+			name = "default"
+		}
+		fmt.Fprintf(w, "Service Account:\t%s (managed: %t)\n", name, created)
+	}
+	if mb.Spec.ImagePullPolicy != "" {
+		fmt.Fprintf(w, "Image Pull Policy:\t%s\n", mb.Spec.ImagePullPolicy)
+	}
+	if len(mb.Spec.ImagePullSecrets) > 0 {
+		var names []string
+		for _, secret := range mb.Spec.ImagePullSecrets {
+			name := secret.Name
+			if secret.Copy {
+				name += " (copied)"
+			}
+			names = append(names, name)
+		}
+		fmt.Fprintf(w, "Image Pull Secrets:\t%s\n", strings.Join(names, ", "))
+	}
+	if access := mb.Spec.NetworkAccess; access != nil {
+		gateway := access.AllowGateway == nil || *access.AllowGateway
+		fmt.Fprintf(w, "Network Access:\tnamespaces %s, %d pod selectors, gateway %t\n",
+			orNone(strings.Join(access.AllowedNamespaces, ",")), len(access.AllowedPods), gateway)
+	}
+	fmt.Fprintf(w, "Workload:\t%s\n", workloadType(mb))
+	if batch := mb.Spec.Batch; batch != nil {
+		fmt.Fprintf(w, "Batch Input:\t%s\n", batch.InputURL)
+		subPath := batch.OutputSubPath
+		if subPath == "" {
+			subPath = mb.Name
+		}
+		fmt.Fprintf(w, "Batch Output:\tpvc://%s/%s\n", batch.OutputClaimName, subPath)
+	}
+	if batch := mb.Status.Batch; batch != nil {
+		fmt.Fprintf(w, "Batch Status:\t%s (active %d, failed %d)\n", batch.Phase, batch.Active, batch.Failed)
+		if batch.Message != "" {
+			fmt.Fprintf(w, "Batch Message:\t%s\n", batch.Message)
+		}
+		if batch.CompletionTime != nil {
+			fmt.Fprintf(w, "Batch Completed:\t%s\n", batch.CompletionTime.UTC().Format("Mon, 02 Jan 2006 15:04:05 -0700"))
+		}
+	}
+	if mb.Spec.Distributed != nil {
+		port := mb.Spec.Distributed.MasterPort
+		if port == 0 {
+			port = 29500
+		}
+		fmt.Fprintf(w, "Distributed:\tStatefulSet, master %s-0.%s-headless:%d\n", mb.Name, mb.Name, port)
+	}
+	if len(mb.Status.PolicyViolations) > 0 {
+		fmt.Fprintf(w, "Policy Violations:\n")
+		for _, violation := range mb.Status.PolicyViolations {
+			fmt.Fprintf(w, "  %s\n", violation)
+		}
+	}
+	if len(mb.Status.ResolvedImages) > 0 {
+		fmt.Fprintf(w, "Resolved Images:\n")
+		for _, image := range mb.Status.ResolvedImages {
+			fmt.Fprintf(w, "  %s\t%s\n", image.Image, image.Digest)
+		}
+	}
+	fmt.Fprintf(w, "Service Type:\t%s\n", orNone(string(mb.Spec.ServiceType)))
+	fmt.Fprintf(w, "Ports:\n")
+	for _, port := range mb.Spec.Ports {
+		fmt.Fprintf(w, "  %s\t%d -> %s/%s\n", orNone(port.Name), port.Port, port.TargetPort.String(), protocol(port.Protocol))
+	}
+	if len(mb.Spec.ContainerPorts) > 0 {
+		fmt.Fprintf(w, "Container Ports:\n")
+		for _, port := range mb.Spec.ContainerPorts {
+			fmt.Fprintf(w, "  %s\t%d/%s\n", orNone(port.Name), port.ContainerPort, protocol(port.Protocol))
+		}
+	}
+	if len(mb.Spec.Envs) > 0 {
+		fmt.Fprintf(w, "Environment:\n")
+		for _, env := range mb.Spec.Envs {
+			value := env.Value
+			if env.ValueFrom != nil {
+				value = "<set from reference>"
+			}
+			fmt.Fprintf(w, "  %s:\t%s\n", env.Name, value)
+		}
+	}
+	if len(mb.Status.Conditions) > 0 {
+		fmt.Fprintf(w, "Conditions:\n  Type\tStatus\tReason\n  ----\t------\t------\n")
+		for _, c := range mb.Status.Conditions {
+			fmt.Fprintf(w, "  %s\t%s\t%s\n", c.Type, c.Status, c.Reason)
+		}
+	}
+
+	// Deployment 与 Pod 由控制器创建, 名称与 ModelBox 相同, Pod 带有 modelbox=<name> 标签
+	pods, err := kubeClient.CoreV1().Pods(mb.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{"modelbox": mb.Name}).String(),
+	})
+	if err != nil && !k8serrors.IsForbidden(err) {
+		return err
+	}
+	fmt.Fprintf(w, "Pods:\n")
+	if pods == nil || len(pods.Items) == 0 {
+		fmt.Fprintf(w, "  <none>\n")
+	} else {
+		fmt.Fprintf(w, "  Name\tPhase\tReady\tRestarts\tNode\n  ----\t-----\t-----\t--------\t----\n")
+		for i := range pods.Items {
+			pod := &pods.Items[i]
+			ready, restarts := podReadiness(pod)
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%d\t%s\n", pod.Name, pod.Status.Phase, ready, restarts, orNone(pod.Spec.NodeName))
+		}
+	}
+
+	events, err := kubeClient.CoreV1().Events(mb.Namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.Set{"involvedObject.name": mb.Name, "involvedObject.kind": modelv1.Kind}.AsSelector().String(),
+	})
+	if err != nil && !k8serrors.IsForbidden(err) {
+		return err
+	}
+	fmt.Fprintf(w, "Events:")
+	if events == nil || len(events.Items) == 0 {
+		fmt.Fprintf(w, "\t<none>\n")
+		return nil
+	}
+	sort.Slice(events.Items, func(i, j int) bool {
+		return events.Items[i].LastTimestamp.Before(&events.Items[j].LastTimestamp)
+	})
+	fmt.Fprintf(w, "\n  Type\tReason\tAge\tFrom\tMessage\n  ----\t------\t---\t----\t-------\n")
+	for _, e := range events.Items {
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\n", e.Type, e.Reason, age(e.LastTimestamp), e.Source.Component, strings.TrimSpace(e.Message))
+	}
+	return nil
+}
+
+func podReadiness(pod *corev1.Pod) (string, int32) {
+	var ready int
+	var restarts int32
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Ready {
+			ready++
+		}
+		restarts += status.RestartCount
+	}
+	return fmt.Sprintf("%d/%d", ready, len(pod.Spec.Containers)), restarts
+}
+
+func protocol(p corev1.Protocol) corev1.Protocol {
+	if p == "" {
+		return corev1.ProtocolTCP
+	}
+	return p
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func newDeleteCommand(f *factory) *cobra.Command {
+	var ignoreNotFound bool
+	cmd := &cobra.Command{
+		Use:   "delete NAME...",
+		Short: "Delete ModelBoxes, the Deployment and Service are garbage collected",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			namespace, err := f.Namespace()
+			if err != nil {
+				return err
+			}
+			modelBoxes, err := f.ModelBoxes(namespace)
+			if err != nil {
+				return err
+			}
+			for _, name := range args {
+				if err := modelBoxes.Delete(context.TODO(), name, metav1.DeleteOptions{}); err != nil {
+					if ignoreNotFound && k8serrors.IsNotFound(err) {
+						continue
+					}
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "modelbox/%s deleted\n", name)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&ignoreNotFound, "ignore-not-found", false, "Treat \"resource not found\" as a successful delete.")
+	return cmd
+}
+
+func newScaleCommand(f *factory) *cobra.Command {
+	var replicas int32
+	cmd := &cobra.Command{
+		Use:     "scale NAME --replicas=COUNT",
+		Short:   "Set the number of replicas of a ModelBox",
+		Example: `  modelboxctl scale resnet --replicas=3`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if replicas < 0 {
+				return fmt.Errorf("--replicas must be greater than or equal to 0")
+			}
+			if err := patchSpec(f, args[0], map[string]interface{}{"replicas": replicas}); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "modelbox/%s scaled\n", args[0])
+			return nil
+		},
+	}
+	cmd.Flags().Int32Var(&replicas, "replicas", -1, "The new desired number of replicas.")
+	_ = cmd.MarkFlagRequired("replicas")
+	return cmd
+}
+
+func newSetCommand(f *factory) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "set",
+		Short: "Update the image or model of a ModelBox",
+	}
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:     "image NAME IMAGE",
+			Short:   "Update the serving image of a ModelBox",
+			Example: `  modelboxctl set image resnet tensorflow/serving:2.5.0`,
+			Args:    cobra.ExactArgs(2),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				if err := patchSpec(f, args[0], map[string]interface{}{"image": args[1]}); err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "modelbox/%s image updated\n", args[0])
+				return nil
+			},
+		},
+		&cobra.Command{
+			Use:     "model NAME URL",
+			Short:   "Update the model file URL of a ModelBox",
+			Example: `  modelboxctl set model resnet s3://models/resnet/v2`,
+			Args:    cobra.ExactArgs(2),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				if err := patchSpec(f, args[0], map[string]interface{}{"modelFileURL": args[1]}); err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "modelbox/%s model updated\n", args[0])
+				return nil
+			},
+		},
+	)
+	return cmd
+}
+
+// patchSpec 以 merge patch 更新 spec 中的字段, 不会覆盖其他并发修改
+func patchSpec(f *factory, name string, spec map[string]interface{}) error {
+	namespace, err := f.Namespace()
+	if err != nil {
+		return err
+	}
+	modelBoxes, err := f.ModelBoxes(namespace)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(map[string]interface{}{"spec": spec})
+	if err != nil {
+		return err
+	}
+	_, err = modelBoxes.Patch(context.TODO(), name, types.MergePatchType, data, metav1.PatchOptions{})
+	return err
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"github.com/spf13/pflag"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+
+	clientset "github.com/sharelinuxs/my-first-opeartor/apigateway/clientset"
+	clientsetv1 "github.com/sharelinuxs/my-first-opeartor/apigateway/clientset/v1"
+)
+
+// factory 根据全局参数创建 clientset, 加载规则与 kubectl 相同 (KUBECONFIG 环境变量、~/.kube/config)
+type factory struct {
+	kubeconfig string
+	context    string
+	namespace  string
+
+	clientConfig clientcmd.ClientConfig
+	restConfig   *rest.Config
+}
+
+func (f *factory) addFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&f.kubeconfig, "kubeconfig", "", "Path to the kubeconfig file to use for CLI requests.")
+	flags.StringVar(&f.context, "context", "", "The name of the kubeconfig context to use.")
+	flags.StringVarP(&f.namespace, "namespace", "n", "", "If present, the namespace scope for this CLI request.")
+}
+
+func (f *factory) toClientConfig() clientcmd.ClientConfig {
+	if f.clientConfig == nil {
+		loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+		loadingRules.ExplicitPath = f.kubeconfig
+		overrides := &clientcmd.ConfigOverrides{CurrentContext: f.context}
+		f.clientConfig = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides)
+	}
+	return f.clientConfig
+}
+
+func (f *factory) toRESTConfig() (*rest.Config, error) {
+	if f.restConfig == nil {
+		config, err := f.toClientConfig().ClientConfig()
+		if err != nil {
+			return nil, err
+		}
+		f.restConfig = config
+	}
+	return f.restConfig, nil
+}
+
+// Namespace 未指定 -n 时使用 kubeconfig 当前 context 的 namespace
+func (f *factory) Namespace() (string, error) {
+	if f.namespace != "" {
+		return f.namespace, nil
+	}
+	namespace, _, err := f.toClientConfig().Namespace()
+	return namespace, err
+}
+
+// ModelBoxes 返回 namespace 下 ModelBox 的客户端, namespace 为空时表示所有 namespace
+func (f *factory) ModelBoxes(namespace string) (clientsetv1.ModelBoxInterface, error) {
+	config, err := f.toRESTConfig()
+	if err != nil {
+		return nil, err
+	}
+	client, err := clientset.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return client.ModelV1().ModelBoxes(namespace), nil
+}
+
+// KubeClient 访问 ModelBox 生成的 Deployment、Pod 等资源
+func (f *factory) KubeClient() (kubernetes.Interface, error) {
+	config, err := f.toRESTConfig()
+	if err != nil {
+		return nil, err
+	}
+	return kubernetes.NewForConfig(config)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	modelv1 "github.com/sharelinuxs/my-first-opeartor/api/v1"
+)
+
+type getOptions struct {
+	output        string
+	selector      string
+	allNamespaces bool
+}
+
+func (o *getOptions) addFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.StringVarP(&o.output, "output", "o", "", "Output format: json, yaml or wide.")
+	flags.StringVarP(&o.selector, "selector", "l", "", "Label selector to filter on, supports '=', '==', and '!='.")
+	flags.BoolVarP(&o.allNamespaces, "all-namespaces", "A", false, "List ModelBoxes across all namespaces.")
+}
+
+func newGetCommand(f *factory) *cobra.Command {
+	o := &getOptions{}
+	cmd := &cobra.Command{
+		Use:   "get [NAME...]",
+		Short: "Display one or many ModelBoxes",
+		Example: `  modelboxctl get
+  modelboxctl get resnet -o yaml
+  modelboxctl get -A -o wide`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.run(cmd, f, args)
+		},
+	}
+	o.addFlags(cmd)
+	return cmd
+}
+
+func newListCommand(f *factory) *cobra.Command {
+	o := &getOptions{}
+	cmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List ModelBoxes",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.run(cmd, f, nil)
+		},
+	}
+	o.addFlags(cmd)
+	return cmd
+}
+
+func (o *getOptions) run(cmd *cobra.Command, f *factory, names []string) error {
+	if err := validateOutput(o.output); err != nil {
+		return err
+	}
+	if o.allNamespaces && len(names) > 0 {
+		return fmt.Errorf("a resource cannot be retrieved by name across all namespaces")
+	}
+	if o.selector != "" && len(names) > 0 {
+		return fmt.Errorf("NAME cannot be specified together with --selector")
+	}
+
+	namespace := ""
+	if !o.allNamespaces {
+		var err error
+		if namespace, err = f.Namespace(); err != nil {
+			return err
+		}
+	}
+	modelBoxes, err := f.ModelBoxes(namespace)
+	if err != nil {
+		return err
+	}
+
+	var items []modelv1.ModelBox
+	if len(names) == 0 {
+		list, err := modelBoxes.List(context.TODO(), metav1.ListOptions{LabelSelector: o.selector})
+		if err != nil {
+			return err
+		}
+		if len(list.Items) == 0 && o.output == "" {
+			if o.allNamespaces {
+				fmt.Fprintln(cmd.ErrOrStderr(), "No resources found")
+			} else {
+				fmt.Fprintf(cmd.ErrOrStderr(), "No resources found in %s namespace.\n", namespace)
+			}
+			return nil
+		}
+		items = list.Items
+	} else {
+		for _, name := range names {
+			modelBox, err := modelBoxes.Get(context.TODO(), name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			items = append(items, *modelBox)
+		}
+	}
+	return printModelBoxes(cmd.OutOrStdout(), items, o.output, len(names) == 1, o.allNamespaces)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+type logsOptions struct {
+	container string
+	follow    bool
+	previous  bool
+	tail      int64
+}
+
+func newLogsCommand(f *factory) *cobra.Command {
+	o := &logsOptions{}
+	cmd := &cobra.Command{
+		Use:   "logs NAME",
+		Short: "Print the logs of the serving containers of a ModelBox",
+		Long: `Print the logs of the serving containers of a ModelBox.
+
+Logs from every Pod of the ModelBox are printed, prefixed with the Pod name
+when the ModelBox has more than one Pod.`,
+		Example: `  modelboxctl logs resnet
+  modelboxctl logs resnet -f --tail=100`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.run(cmd, f, args[0])
+		},
+	}
+	flags := cmd.Flags()
+	flags.StringVarP(&o.container, "container", "c", "", "Print the logs of this container, defaults to the serving container.")
+	flags.BoolVarP(&o.follow, "follow", "f", false, "Specify if the logs should be streamed.")
+	flags.BoolVarP(&o.previous, "previous", "p", false, "Print the logs for the previous instance of the container.")
+	flags.Int64Var(&o.tail, "tail", -1, "Lines of recent log file to display. Defaults to -1, showing all log lines.")
+	return cmd
+}
+
+func (o *logsOptions) run(cmd *cobra.Command, f *factory, name string) error {
+	namespace, err := f.Namespace()
+	if err != nil {
+		return err
+	}
+	kubeClient, err := f.KubeClient()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	// 控制器创建的 Pod 带有 modelbox=<name> 标签
+	pods, err := kubeClient.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{"modelbox": name}).String(),
+	})
+	if err != nil {
+		return err
+	}
+	if len(pods.Items) == 0 {
+		return fmt.Errorf("no pods found for modelbox %q", name)
+	}
+
+	container := o.container
+	if container == "" {
+		// 业务容器与 ModelBox 同名
+		container = name
+	}
+	logOptions := &corev1.PodLogOptions{
+		Container: container,
+		Follow:    o.follow,
+		Previous:  o.previous,
+	}
+	if o.tail >= 0 {
+		logOptions.TailLines = &o.tail
+	}
+
+	out := &syncWriter{w: cmd.OutOrStdout()}
+	prefix := len(pods.Items) > 1
+	var wg sync.WaitGroup
+	errs := make([]error, len(pods.Items))
+	for i := range pods.Items {
+		pod := pods.Items[i].Name
+		stream := func(i int) {
+			defer wg.Done()
+			rc, err := kubeClient.CoreV1().Pods(namespace).GetLogs(pod, logOptions).Stream(ctx)
+			if err != nil {
+				errs[i] = fmt.Errorf("pod %s: %v", pod, err)
+				return
+			}
+			defer rc.Close()
+			errs[i] = copyLines(out, rc, pod, prefix)
+		}
+		wg.Add(1)
+		// 不跟随时按顺序输出, 避免多个 Pod 的日志交错
+		if o.follow {
+			go stream(i)
+		} else {
+			stream(i)
+		}
+	}
+	wg.Wait()
+	return utilerrors.NewAggregate(errs)
+}
+
+// copyLines 逐行输出日志, 多个 Pod 时在每行前加上 [pod] 前缀
+func copyLines(out io.Writer, r io.Reader, pod string, prefix bool) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if prefix {
+			line = fmt.Sprintf("[%s] %s", pod, line)
+		}
+		if _, err := fmt.Fprintln(out, line); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// syncWriter 并发跟随多个 Pod 时保证每行完整输出
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+func main() {
+	if err := newRootCommand().Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+// newRootCommand modelboxctl 的根命令, 全局参数与 kubectl 保持一致
+func newRootCommand() *cobra.Command {
+	f := &factory{}
+	cmd := &cobra.Command{
+		Use:           "modelboxctl",
+		Short:         "modelboxctl controls ModelBoxes",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	f.addFlags(cmd.PersistentFlags())
+
+	cmd.AddCommand(
+		newCreateCommand(f),
+		newGetCommand(f),
+		newListCommand(f),
+		newDescribeCommand(f),
+		newDeleteCommand(f),
+		newScaleCommand(f),
+		newSetCommand(f),
+		newRolloutCommand(f),
+		newLogsCommand(f),
+	)
+	return cmd
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"sigs.k8s.io/yaml"
+
+	modelv1 "github.com/sharelinuxs/my-first-opeartor/api/v1"
+)
+
+const (
+	outputJSON = "json"
+	outputYAML = "yaml"
+	outputWide = "wide"
+)
+
+// validateOutput 检查 -o 参数, 为空表示默认表格
+func validateOutput(output string) error {
+	switch output {
+	case "", outputJSON, outputYAML, outputWide:
+		return nil
+	}
+	return fmt.Errorf("unsupported output format %q, allowed formats are: json, yaml, wide", output)
+}
+
+// printModelBoxes 按 -o 输出 ModelBox; 单个对象输出 json/yaml 时不包装为 List, 与 kubectl 一致
+func printModelBoxes(out io.Writer, items []modelv1.ModelBox, output string, single, withNamespace bool) error {
+	for i := range items {
+		items[i].SetGroupVersionKind(modelv1.GroupVersion.WithKind(modelv1.Kind))
+	}
+
+	var obj interface{}
+	if single && len(items) == 1 {
+		obj = &items[0]
+	} else {
+		list := &modelv1.ModelBoxList{Items: items}
+		list.SetGroupVersionKind(modelv1.GroupVersion.WithKind(modelv1.Kind + "List"))
+		obj = list
+	}
+
+	switch output {
+	case outputJSON:
+		data, err := json.MarshalIndent(obj, "", "    ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(out, string(data))
+		return err
+	case outputYAML:
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		_, err = out.Write(data)
+		return err
+	}
+	return printTable(out, items, output == outputWide, withNamespace)
+}
+
+func printTable(out io.Writer, items []modelv1.ModelBox, wide, withNamespace bool) error {
+	w := tabwriter.NewWriter(out, 0, 8, 3, ' ', 0)
+	var headers []string
+	if withNamespace {
+		headers = append(headers, "NAMESPACE")
+	}
+	headers = append(headers, "NAME", "READY", "UP-TO-DATE", "AVAILABLE", "AGE")
+	if wide {
+		headers = append(headers, "IMAGE", "MODEL", "RESOURCE-TYPE", "SERVICE-TYPE")
+	}
+	fmt.Fprintln(w, strings.Join(headers, "\t"))
+
+	for i := range items {
+		mb := &items[i]
+		var row []string
+		if withNamespace {
+			row = append(row, mb.Namespace)
+		}
+		row = append(row,
+			mb.Name,
+			fmt.Sprintf("%d/%d", mb.Status.ReadyReplicas, desiredReplicas(mb)),
+			fmt.Sprint(mb.Status.UpdatedReplicas),
+			fmt.Sprint(mb.Status.AvailableReplicas),
+			age(mb.CreationTimestamp),
+		)
+		if wide {
+			row = append(row,
+				orNone(mb.Spec.Image),
+				orNone(modelSummary(mb)),
+				orNone(mb.Spec.ResourceType),
+				orNone(string(mb.Spec.ServiceType)),
+			)
+		}
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
+
+// desiredReplicas 未设置 replicas 时 Deployment 默认为 1
+func desiredReplicas(mb *modelv1.ModelBox) int32 {
+	if mb.Spec.Replicas != nil {
+		return *mb.Spec.Replicas
+	}
+	return 1
+}
+
+func age(t metav1.Time) string {
+	if t.IsZero() {
+		return "<unknown>"
+	}
+	return duration.HumanDuration(time.Since(t.Time))
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "<none>"
+	}
+	return s
+}
+
+// modelSummary 多模型时列出模型名称, 否则为模型文件地址
+func modelSummary(mb *modelv1.ModelBox) string {
+	if len(mb.Spec.Models) == 0 {
+		return mb.Spec.ModelFileURL
+	}
+	names := make([]string, 0, len(mb.Spec.Models))
+	for _, model := range mb.Spec.Models {
+		names = append(names, model.Name)
+	}
+	return strings.Join(names, ",")
+}
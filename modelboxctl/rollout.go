@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+
+	modelv1 "github.com/sharelinuxs/my-first-opeartor/api/v1"
+	modelv2 "github.com/sharelinuxs/my-first-opeartor/api/v2"
+	clientsetv1 "github.com/sharelinuxs/my-first-opeartor/apigateway/clientset/v1"
+)
+
+const (
+	// revisionAnnotation Deployment 控制器记录在 ReplicaSet 上的版本号
+	revisionAnnotation = "deployment.kubernetes.io/revision"
+	// rolloutPollInterval rollout status 的轮询间隔
+	rolloutPollInterval = 2 * time.Second
+)
+
+func newRolloutCommand(f *factory) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rollout",
+		Short: "Manage the rollout of a ModelBox",
+	}
+	cmd.AddCommand(newRolloutStatusCommand(f), newRolloutUndoCommand(f))
+	return cmd
+}
+
+func newRolloutStatusCommand(f *factory) *cobra.Command {
+	var timeout time.Duration
+	var watch bool
+	cmd := &cobra.Command{
+		Use:   "status NAME",
+		Short: "Show the rollout status of a ModelBox, waiting until it finishes by default",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			namespace, err := f.Namespace()
+			if err != nil {
+				return err
+			}
+			modelBoxes, err := f.ModelBoxes(namespace)
+			if err != nil {
+				return err
+			}
+			kubeClient, err := f.KubeClient()
+			if err != nil {
+				return err
+			}
+
+			ctx := context.Background()
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+			out := cmd.OutOrStdout()
+			var last string
+			return wait.PollImmediateUntil(rolloutPollInterval, func() (bool, error) {
+				modelBox, err := modelBoxes.Get(ctx, args[0], metav1.GetOptions{})
+				if err != nil {
+					return false, err
+				}
+				deploy, err := getWorkload(ctx, kubeClient, modelBox)
+				if err != nil && !k8serrors.IsNotFound(err) {
+					return false, err
+				}
+				msg, done, err := rolloutStatus(modelBox, deploy)
+				if err != nil {
+					return false, err
+				}
+				if msg != last {
+					fmt.Fprintln(out, msg)
+					last = msg
+				}
+				if !done && !watch {
+					return true, nil
+				}
+				return done, nil
+			}, ctx.Done())
+		},
+	}
+	cmd.Flags().DurationVar(&timeout, "timeout", 0, "The length of time to wait before giving up, zero means never.")
+	cmd.Flags().BoolVarP(&watch, "watch", "w", true, "Watch the status of the rollout until it's done.")
+	return cmd
+}
+
+// workloadType 与控制器一致, 未设置时默认为 Deployment, 分布式推理默认为 StatefulSet
+func workloadType(mb *modelv1.ModelBox) string {
+	switch {
+	case mb.Spec.WorkloadType != "":
+		return mb.Spec.WorkloadType
+	case mb.Spec.Distributed != nil:
+		return "StatefulSet"
+	}
+	return "Deployment"
+}
+
+// getWorkload 读取 ModelBox 的 Deployment, StatefulSet 按 Deployment 的字段返回
+func getWorkload(ctx context.Context, kubeClient kubernetes.Interface, mb *modelv1.ModelBox) (*appsv1.Deployment, error) {
+	switch workloadType(mb) {
+	case "Deployment":
+		return kubeClient.AppsV1().Deployments(mb.Namespace).Get(ctx, mb.Name, metav1.GetOptions{})
+	case "BatchJob":
+		return nil, fmt.Errorf("modelbox %q runs a batch job, check its progress with modelboxctl describe", mb.Name)
+	}
+	sts, err := kubeClient.AppsV1().StatefulSets(mb.Namespace).Get(ctx, mb.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return &appsv1.Deployment{
+		ObjectMeta: sts.ObjectMeta,
+		Spec:       appsv1.DeploymentSpec{Replicas: sts.Spec.Replicas, Template: sts.Spec.Template},
+		Status: appsv1.DeploymentStatus{
+			ObservedGeneration: sts.Status.ObservedGeneration,
+			Replicas:           sts.Status.Replicas,
+			UpdatedReplicas:    sts.Status.UpdatedReplicas,
+			ReadyReplicas:      sts.Status.ReadyReplicas,
+			AvailableReplicas:  sts.Status.ReadyReplicas,
+		},
+	}, nil
+}
+
+// imageApplied 开启 digest 解析时控制器将镜像固定为 image@digest
+func imageApplied(container *corev1.Container, image string) bool {
+	return container.Image == image || strings.HasPrefix(container.Image, image+"@")
+}
+
+// specApplied 控制器是否已将 ModelBox 的镜像同步到 Pod 模板. Pod 模板上记录了 ModelBox 自身设置的镜像,
+// 镜像由模板提供时两者均为空; 没有该注解时按容器的镜像判断, 此时引用了模板的 ModelBox 无法判断, 不检查
+func specApplied(mb *modelv1.ModelBox, template *corev1.PodTemplateSpec) bool {
+	if data, ok := template.Annotations[modelv2.ServingAnnotation]; ok {
+		var serving modelv2.ServingSpec
+		if err := json.Unmarshal([]byte(data), &serving); err == nil {
+			return serving.Image == mb.Spec.Image
+		}
+	}
+	if mb.Spec.TemplateRef != nil {
+		return true
+	}
+	container := mainContainer(mb.Name, template.Spec.Containers)
+	return container != nil && imageApplied(container, mb.Spec.Image)
+}
+
+// rolloutStatus 判断逻辑与 kubectl rollout status deployment 一致,
+// 额外检查控制器是否已将 ModelBox 的镜像同步到 Deployment
+func rolloutStatus(mb *modelv1.ModelBox, deploy *appsv1.Deployment) (string, bool, error) {
+	if deploy == nil || deploy.Name == "" {
+		return fmt.Sprintf("Waiting for modelbox %q deployment to be created...", mb.Name), false, nil
+	}
+	if !specApplied(mb, &deploy.Spec.Template) {
+		return fmt.Sprintf("Waiting for modelbox %q spec to be applied to the deployment...", mb.Name), false, nil
+	}
+	if deploy.Generation > deploy.Status.ObservedGeneration {
+		return fmt.Sprintf("Waiting for modelbox %q rollout to start...", mb.Name), false, nil
+	}
+	for _, c := range deploy.Status.Conditions {
+		if c.Type == appsv1.DeploymentProgressing && c.Reason == "ProgressDeadlineExceeded" {
+			return "", false, fmt.Errorf("modelbox %q exceeded its progress deadline", mb.Name)
+		}
+	}
+
+	desired := int32(1)
+	if deploy.Spec.Replicas != nil {
+		desired = *deploy.Spec.Replicas
+	}
+	status := deploy.Status
+	switch {
+	case status.UpdatedReplicas < desired:
+		return fmt.Sprintf("Waiting for modelbox %q rollout to finish: %d out of %d new replicas have been updated...",
+			mb.Name, status.UpdatedReplicas, desired), false, nil
+	case status.Replicas > status.UpdatedReplicas:
+		return fmt.Sprintf("Waiting for modelbox %q rollout to finish: %d old replicas are pending termination...",
+			mb.Name, status.Replicas-status.UpdatedReplicas), false, nil
+	case status.AvailableReplicas < status.UpdatedReplicas:
+		return fmt.Sprintf("Waiting for modelbox %q rollout to finish: %d of %d updated replicas are available...",
+			mb.Name, status.AvailableReplicas, status.UpdatedReplicas), false, nil
+	}
+	return fmt.Sprintf("modelbox %q successfully rolled out", mb.Name), true, nil
+}
+
+func newRolloutUndoCommand(f *factory) *cobra.Command {
+	var toRevision int64
+	cmd := &cobra.Command{
+		Use:   "undo NAME",
+		Short: "Roll back the image and environment of a ModelBox to a previous revision",
+		Long: `Roll back the image and environment of a ModelBox to a previous revision.
+
+The Deployment is owned by the ModelBox controller, so the rollback is applied to
+the ModelBox spec using the image and environment recorded on the pod template of the
+target revision's ReplicaSet. Values supplied by the ModelBox template are left to the template.`,
+		Example: `  modelboxctl rollout undo resnet
+  modelboxctl rollout undo resnet --to-revision=2`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			namespace, err := f.Namespace()
+			if err != nil {
+				return err
+			}
+			kubeClient, err := f.KubeClient()
+			if err != nil {
+				return err
+			}
+			modelBoxes, err := f.ModelBoxes(namespace)
+			if err != nil {
+				return err
+			}
+			revision, err := rolloutUndo(context.TODO(), kubeClient, modelBoxes, args[0], toRevision)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "modelbox/%s rolled back to revision %d\n", args[0], revision)
+			return nil
+		},
+	}
+	cmd.Flags().Int64Var(&toRevision, "to-revision", 0, "The revision to roll back to. Default to 0 (last revision).")
+	return cmd
+}
+
+// rolloutUndo 将 ModelBox 的镜像与环境变量恢复为指定版本的值, 返回回滚到的版本号
+func rolloutUndo(ctx context.Context, kubeClient kubernetes.Interface, modelBoxes clientsetv1.ModelBoxInterface, name string, toRevision int64) (int64, error) {
+	modelBox, err := modelBoxes.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return 0, err
+	}
+	// StatefulSet 的历史记录在 ControllerRevision 中, 不记录版本号注解, Job 没有历史版本
+	if kind := workloadType(modelBox); kind != "Deployment" {
+		return 0, fmt.Errorf("rollout undo is not supported for modelbox %q running as a %s", name, kind)
+	}
+
+	template, revision, err := findRevision(kubeClient, modelBox.Namespace, name, toRevision)
+	if err != nil {
+		return 0, err
+	}
+	spec, err := revisionSpec(modelBox, template)
+	if err != nil {
+		return 0, fmt.Errorf("revision %d: %v", revision, err)
+	}
+	patch, err := json.Marshal(map[string]interface{}{"spec": spec})
+	if err != nil {
+		return 0, err
+	}
+	if _, err := modelBoxes.Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return 0, err
+	}
+	return revision, nil
+}
+
+// revisionSpec 返回恢复 spec 的 merge patch 字段. 控制器在 Pod 模板上记录了 ModelBox 自己的镜像与环境变量,
+// 未设置的字段置为 null, 继续由模板提供. 没有该注解的旧版本只能使用容器的配置: 去掉固定的 digest,
+// 引用了模板时容器的环境变量合并了模板的值, 不做恢复
+func revisionSpec(mb *modelv1.ModelBox, template *corev1.PodTemplateSpec) (map[string]interface{}, error) {
+	if data, ok := template.Annotations[modelv2.ServingAnnotation]; ok {
+		var serving modelv2.ServingSpec
+		if err := json.Unmarshal([]byte(data), &serving); err != nil {
+			return nil, fmt.Errorf("invalid %s annotation: %v", modelv2.ServingAnnotation, err)
+		}
+		spec := map[string]interface{}{"image": nil, "envs": nil}
+		if serving.Image != "" {
+			spec["image"] = serving.Image
+		}
+		if len(serving.Env) > 0 {
+			spec["envs"] = serving.Env
+		}
+		return spec, nil
+	}
+
+	container := mainContainer(mb.Name, template.Spec.Containers)
+	if container == nil {
+		return nil, fmt.Errorf("no container named %q", mb.Name)
+	}
+	spec := map[string]interface{}{"image": strings.SplitN(container.Image, "@", 2)[0]}
+	if mb.Spec.TemplateRef == nil {
+		spec["envs"] = container.Env
+	}
+	return spec, nil
+}
+
+// findRevision 返回 Deployment 指定版本的 Pod 模板, toRevision 为 0 时返回上一个版本
+func findRevision(kubeClient kubernetes.Interface, namespace, name string, toRevision int64) (*corev1.PodTemplateSpec, int64, error) {
+	ctx := context.TODO()
+	deploy, err := kubeClient.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, 0, err
+	}
+	replicaSets, err := kubeClient.AppsV1().ReplicaSets(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(deploy.Spec.Selector.MatchLabels).String(),
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	current, _ := strconv.ParseInt(deploy.Annotations[revisionAnnotation], 10, 64)
+	type revisioned struct {
+		revision int64
+		rs       *appsv1.ReplicaSet
+	}
+	var history []revisioned
+	for i := range replicaSets.Items {
+		rs := &replicaSets.Items[i]
+		if !metav1.IsControlledBy(rs, deploy) {
+			continue
+		}
+		revision, err := strconv.ParseInt(rs.Annotations[revisionAnnotation], 10, 64)
+		if err != nil {
+			continue
+		}
+		history = append(history, revisioned{revision: revision, rs: rs})
+	}
+	sort.Slice(history, func(i, j int) bool { return history[i].revision > history[j].revision })
+
+	for _, h := range history {
+		if toRevision > 0 && h.revision == toRevision {
+			return &h.rs.Spec.Template, h.revision, nil
+		}
+		if toRevision == 0 && h.revision < current {
+			return &h.rs.Spec.Template, h.revision, nil
+		}
+	}
+	if toRevision > 0 {
+		return nil, 0, fmt.Errorf("unable to find the specified revision %d", toRevision)
+	}
+	return nil, 0, fmt.Errorf("no rollout history found for modelbox %q", name)
+}
+
+// mainContainer 控制器生成的业务容器与 ModelBox 同名
+func mainContainer(name string, containers []corev1.Container) *corev1.Container {
+	for i := range containers {
+		if containers[i].Name == name {
+			return &containers[i]
+		}
+	}
+	return nil
+}
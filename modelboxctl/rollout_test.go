@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+
+	modelv1 "github.com/sharelinuxs/my-first-opeartor/api/v1"
+	modelv2 "github.com/sharelinuxs/my-first-opeartor/api/v2"
+	"github.com/sharelinuxs/my-first-opeartor/apigateway/clientset/fake"
+)
+
+const testDigest = "@sha256:aaaa"
+
+func int32Ptr(i int32) *int32 { return &i }
+
+// newTestDeployment 控制器为 resnet 创建的 Deployment, 当前版本为 revision
+func newTestDeployment(revision int64) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "resnet",
+			Namespace:   "default",
+			UID:         "deploy-uid",
+			Annotations: map[string]string{revisionAnnotation: strconv.FormatInt(revision, 10)},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"modelbox": "resnet"}},
+		},
+	}
+}
+
+// newTestReplicaSet Deployment 的一个历史版本, serving 为空时模拟控制器升级之前没有注解的版本
+func newTestReplicaSet(deploy *appsv1.Deployment, revision int64, image string, env []corev1.EnvVar, serving string) *appsv1.ReplicaSet {
+	controller := true
+	rs := &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "resnet-" + strconv.FormatInt(revision, 10),
+			Namespace:   "default",
+			Labels:      map[string]string{"modelbox": "resnet"},
+			Annotations: map[string]string{revisionAnnotation: strconv.FormatInt(revision, 10)},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: "apps/v1", Kind: "Deployment", Name: deploy.Name, UID: deploy.UID, Controller: &controller,
+			}},
+		},
+		Spec: appsv1.ReplicaSetSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{
+					{Name: "resnet", Image: image, Env: env},
+					{Name: "model-agent", Image: "agent:1"},
+				}},
+			},
+		},
+	}
+	if serving != "" {
+		rs.Spec.Template.Annotations = map[string]string{modelv2.ServingAnnotation: serving}
+	}
+	return rs
+}
+
+func TestRolloutUndo(t *testing.T) {
+	userEnv := []corev1.EnvVar{{Name: "BATCH_SIZE", Value: "8"}}
+	// 容器中的环境变量合并了模板提供的值
+	mergedEnv := []corev1.EnvVar{{Name: "CUDA_VISIBLE_DEVICES", Value: "0"}, {Name: "BATCH_SIZE", Value: "8"}}
+	currentEnv := []corev1.EnvVar{{Name: "BATCH_SIZE", Value: "16"}}
+
+	tests := []struct {
+		name         string
+		templateRef  *modelv1.TemplateReference
+		workloadType string
+		history      func(deploy *appsv1.Deployment) []runtime.Object
+		current      int64
+		toRevision   int64
+		wantRevision int64
+		wantImage    string
+		wantEnv      []corev1.EnvVar
+		wantErr      string
+	}{
+		{
+			name: "user spec from the annotation",
+			history: func(deploy *appsv1.Deployment) []runtime.Object {
+				return []runtime.Object{
+					newTestReplicaSet(deploy, 1, "resnet:1"+testDigest, mergedEnv, `{"image":"resnet:1","env":[{"name":"BATCH_SIZE","value":"8"}]}`),
+					newTestReplicaSet(deploy, 2, "resnet:2"+testDigest, currentEnv, `{"image":"resnet:2","env":[{"name":"BATCH_SIZE","value":"16"}]}`),
+				}
+			},
+			wantRevision: 1,
+			wantImage:    "resnet:1",
+			wantEnv:      userEnv,
+		},
+		{
+			name:        "fields supplied by the template are cleared",
+			templateRef: &modelv1.TemplateReference{Name: "gpu"},
+			history: func(deploy *appsv1.Deployment) []runtime.Object {
+				return []runtime.Object{
+					newTestReplicaSet(deploy, 1, "cluster:1"+testDigest, mergedEnv[:1], `{}`),
+					newTestReplicaSet(deploy, 2, "resnet:2"+testDigest, currentEnv, `{"image":"resnet:2","env":[{"name":"BATCH_SIZE","value":"16"}]}`),
+				}
+			},
+			wantRevision: 1,
+		},
+		{
+			name: "to revision",
+			history: func(deploy *appsv1.Deployment) []runtime.Object {
+				return []runtime.Object{
+					newTestReplicaSet(deploy, 1, "resnet:1"+testDigest, mergedEnv, `{"image":"resnet:1","env":[{"name":"BATCH_SIZE","value":"8"}]}`),
+					newTestReplicaSet(deploy, 2, "resnet:2", nil, `{"image":"resnet:2"}`),
+					newTestReplicaSet(deploy, 3, "resnet:3"+testDigest, currentEnv, `{"image":"resnet:3","env":[{"name":"BATCH_SIZE","value":"16"}]}`),
+				}
+			},
+			current:      3,
+			toRevision:   2,
+			wantRevision: 2,
+			wantImage:    "resnet:2",
+		},
+		{
+			name: "revision without the annotation drops the digest",
+			history: func(deploy *appsv1.Deployment) []runtime.Object {
+				return []runtime.Object{newTestReplicaSet(deploy, 1, "resnet:1"+testDigest, userEnv, "")}
+			},
+			wantRevision: 1,
+			wantImage:    "resnet:1",
+			wantEnv:      userEnv,
+		},
+		{
+			name:        "revision without the annotation keeps the env when a template is referenced",
+			templateRef: &modelv1.TemplateReference{Name: "gpu"},
+			history: func(deploy *appsv1.Deployment) []runtime.Object {
+				return []runtime.Object{newTestReplicaSet(deploy, 1, "resnet:1"+testDigest, mergedEnv, "")}
+			},
+			wantRevision: 1,
+			wantImage:    "resnet:1",
+			wantEnv:      currentEnv,
+		},
+		{
+			name: "ReplicaSets of other Deployments are ignored",
+			history: func(deploy *appsv1.Deployment) []runtime.Object {
+				other := newTestDeployment(1)
+				other.UID = "other-uid"
+				return []runtime.Object{newTestReplicaSet(other, 1, "other:1", nil, `{"image":"other:1"}`)}
+			},
+			wantErr: "no rollout history",
+		},
+		{
+			name: "revision not found",
+			history: func(deploy *appsv1.Deployment) []runtime.Object {
+				return []runtime.Object{newTestReplicaSet(deploy, 1, "resnet:1", nil, `{"image":"resnet:1"}`)}
+			},
+			toRevision: 5,
+			wantErr:    "unable to find the specified revision 5",
+		},
+		{
+			name:         "StatefulSet",
+			workloadType: "StatefulSet",
+			history:      func(deploy *appsv1.Deployment) []runtime.Object { return nil },
+			wantErr:      "not supported",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current := tt.current
+			if current == 0 {
+				current = 2
+			}
+			deploy := newTestDeployment(current)
+			kubeClient := kubefake.NewSimpleClientset(append(tt.history(deploy), deploy)...)
+			modelBox := &modelv1.ModelBox{
+				ObjectMeta: metav1.ObjectMeta{Name: "resnet", Namespace: "default"},
+				Spec: modelv1.ModelBoxSpec{
+					Image:        "resnet:2",
+					Envs:         currentEnv,
+					TemplateRef:  tt.templateRef,
+					WorkloadType: tt.workloadType,
+				},
+			}
+			client := fake.NewSimpleClientset(modelBox)
+			modelBoxes := client.ModelV1().ModelBoxes("default")
+
+			revision, err := rolloutUndo(context.Background(), kubeClient, modelBoxes, "resnet", tt.toRevision)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if revision != tt.wantRevision {
+				t.Errorf("got revision %d, want %d", revision, tt.wantRevision)
+			}
+			got, err := modelBoxes.Get(context.Background(), "resnet", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Spec.Image != tt.wantImage || !reflect.DeepEqual(got.Spec.Envs, tt.wantEnv) {
+				t.Errorf("got image %q and envs %v, want %q and %v", got.Spec.Image, got.Spec.Envs, tt.wantImage, tt.wantEnv)
+			}
+		})
+	}
+}
+
+func TestRolloutStatus(t *testing.T) {
+	// newDeploy 控制器按 ModelBox 的镜像 image 创建的 Deployment, serving 为 Pod 模板上的注解
+	newDeploy := func(image, serving string, status appsv1.DeploymentStatus) *appsv1.Deployment {
+		deploy := newTestDeployment(1)
+		deploy.Generation = 2
+		deploy.Spec.Replicas = int32Ptr(2)
+		deploy.Spec.Template.Spec.Containers = []corev1.Container{{Name: "resnet", Image: image}}
+		if serving != "" {
+			deploy.Spec.Template.Annotations = map[string]string{modelv2.ServingAnnotation: serving}
+		}
+		deploy.Status = status
+		return deploy
+	}
+	done := appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 2}
+
+	tests := []struct {
+		name        string
+		image       string
+		templateRef *modelv1.TemplateReference
+		deploy      *appsv1.Deployment
+		wantMsg     string
+		wantDone    bool
+		wantErr     bool
+	}{
+		{
+			name:    "not created",
+			image:   "resnet:2",
+			wantMsg: `Waiting for modelbox "resnet" deployment to be created...`,
+		},
+		{
+			name:    "new image not applied",
+			image:   "resnet:2",
+			deploy:  newDeploy("resnet:1", `{"image":"resnet:1"}`, done),
+			wantMsg: `Waiting for modelbox "resnet" spec to be applied to the deployment...`,
+		},
+		{
+			name:     "image pinned to a digest",
+			image:    "resnet:2",
+			deploy:   newDeploy("resnet:2"+testDigest, `{"image":"resnet:2"}`, done),
+			wantMsg:  `modelbox "resnet" successfully rolled out`,
+			wantDone: true,
+		},
+		{
+			name:        "image supplied by the template",
+			templateRef: &modelv1.TemplateReference{Name: "gpu"},
+			deploy:      newDeploy("cluster:1"+testDigest, `{}`, done),
+			wantMsg:     `modelbox "resnet" successfully rolled out`,
+			wantDone:    true,
+		},
+		{
+			name:        "own image overrides the template",
+			image:       "resnet:2",
+			templateRef: &modelv1.TemplateReference{Name: "gpu"},
+			deploy:      newDeploy("cluster:1", `{}`, done),
+			wantMsg:     `Waiting for modelbox "resnet" spec to be applied to the deployment...`,
+		},
+		{
+			name:     "without the annotation",
+			image:    "resnet:2",
+			deploy:   newDeploy("resnet:2", "", done),
+			wantMsg:  `modelbox "resnet" successfully rolled out`,
+			wantDone: true,
+		},
+		{
+			name:        "without the annotation the template image is not checked",
+			templateRef: &modelv1.TemplateReference{Name: "gpu"},
+			deploy:      newDeploy("cluster:1", "", done),
+			wantMsg:     `modelbox "resnet" successfully rolled out`,
+			wantDone:    true,
+		},
+		{
+			name:    "rollout not started",
+			image:   "resnet:2",
+			deploy:  newDeploy("resnet:2", `{"image":"resnet:2"}`, appsv1.DeploymentStatus{ObservedGeneration: 1}),
+			wantMsg: `Waiting for modelbox "resnet" rollout to start...`,
+		},
+		{
+			name:  "progress deadline exceeded",
+			image: "resnet:2",
+			deploy: newDeploy("resnet:2", `{"image":"resnet:2"}`, appsv1.DeploymentStatus{
+				ObservedGeneration: 2,
+				Conditions:         []appsv1.DeploymentCondition{{Type: appsv1.DeploymentProgressing, Reason: "ProgressDeadlineExceeded"}},
+			}),
+			wantErr: true,
+		},
+		{
+			name:    "replicas being updated",
+			image:   "resnet:2",
+			deploy:  newDeploy("resnet:2", `{"image":"resnet:2"}`, appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 1}),
+			wantMsg: `Waiting for modelbox "resnet" rollout to finish: 1 out of 2 new replicas have been updated...`,
+		},
+		{
+			name:    "old replicas terminating",
+			image:   "resnet:2",
+			deploy:  newDeploy("resnet:2", `{"image":"resnet:2"}`, appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 2}),
+			wantMsg: `Waiting for modelbox "resnet" rollout to finish: 1 old replicas are pending termination...`,
+		},
+		{
+			name:  "updated replicas not available",
+			image: "resnet:2",
+			deploy: newDeploy("resnet:2", `{"image":"resnet:2"}`, appsv1.DeploymentStatus{
+				ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 1,
+			}),
+			wantMsg: `Waiting for modelbox "resnet" rollout to finish: 1 of 2 updated replicas are available...`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modelBox := &modelv1.ModelBox{
+				ObjectMeta: metav1.ObjectMeta{Name: "resnet", Namespace: "default"},
+				Spec:       modelv1.ModelBoxSpec{Image: tt.image, TemplateRef: tt.templateRef},
+			}
+			msg, done, err := rolloutStatus(modelBox, tt.deploy)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("got no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msg != tt.wantMsg || done != tt.wantDone {
+				t.Errorf("got %q and done %v, want %q and %v", msg, done, tt.wantMsg, tt.wantDone)
+			}
+		})
+	}
+}